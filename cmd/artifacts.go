@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	units "github.com/docker/go-units"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/nektos/act/pkg/artifacts"
+)
+
+func newArtifactsCommand(input *Input) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "artifacts",
+		Short: "Inspect, download and clean up the artifacts of the artifact server in --artifact-server-path or --artifact-server-storage",
+	}
+
+	var filter artifacts.ArtifactFilter
+	var dir string
+	listCmd := &cobra.Command{
+		Use:          "list",
+		Short:        "List the artifacts, the most recent first",
+		Args:         cobra.NoArgs,
+		RunE:         runArtifactsList(input, &filter),
+		SilenceUsage: true,
+	}
+	downloadCmd := &cobra.Command{
+		Use:          "download",
+		Short:        "Download the artifacts into --dir like actions/download-artifact: an artifact selected by --name into --dir itself, the others into a directory per artifact",
+		Args:         cobra.NoArgs,
+		RunE:         runArtifactsDownload(input, &filter, &dir),
+		SilenceUsage: true,
+	}
+	downloadCmd.Flags().StringVar(&dir, "dir", ".", "Directory the artifacts are downloaded to")
+	deleteCmd := &cobra.Command{
+		Use:          "delete",
+		Short:        "Delete the artifacts selected by --run, --workflow and --name",
+		Args:         cobra.NoArgs,
+		RunE:         runArtifactsDelete(input, &filter),
+		SilenceUsage: true,
+	}
+	for _, c := range []*cobra.Command{listCmd, downloadCmd, deleteCmd} {
+		c.Flags().StringVar(&filter.RunID, "run", "", "Only artifacts of this run id")
+		c.Flags().StringVar(&filter.Workflow, "workflow", "", "Only artifacts of this workflow name")
+		c.Flags().StringVar(&filter.Name, "name", "", "Only artifacts with this name")
+	}
+	cmd.AddCommand(listCmd, downloadCmd, deleteCmd)
+	return cmd
+}
+
+// openArtifactStorage returns the storage of --artifact-server-storage, the directory of --artifact-server-path by default
+func openArtifactStorage(input *Input) (artifacts.Storage, error) {
+	if input.artifactServerPath == "" && input.artifactServerStorage == "" {
+		return nil, fmt.Errorf("--artifact-server-path is required")
+	}
+	return artifacts.OpenStorage(input.artifactServerPath, input.artifactServerStorage)
+}
+
+// setOIDCOptions sets the OIDC issuer options of the artifact server, the signing key is read from --oidc-signing-key
+func setOIDCOptions(input *Input, options *artifacts.Options) error {
+	options.OIDCIssuer = input.oidcIssuer
+	options.OIDCAudience = input.oidcAudience
+	if input.oidcSigningKey == "" {
+		return nil
+	}
+	key, err := artifacts.ReadOIDCKey(input.oidcSigningKey)
+	if err != nil {
+		return fmt.Errorf("invalid --oidc-signing-key: %w", err)
+	}
+	options.OIDCKey = key
+	return nil
+}
+
+// artifactStorageName returns the location of the artifacts for the messages
+func artifactStorageName(input *Input) string {
+	if input.artifactServerStorage != "" {
+		return input.artifactServerStorage
+	}
+	return input.artifactServerPath
+}
+
+func listArtifacts(input *Input, filter artifacts.ArtifactFilter) (artifacts.Storage, []*artifacts.Artifact, error) {
+	storage, err := openArtifactStorage(input)
+	if err != nil {
+		return nil, nil, err
+	}
+	list, err := artifacts.ListArtifacts(storage, filter)
+	return storage, list, err
+}
+
+func runArtifactsList(input *Input, filter *artifacts.ArtifactFilter) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		_, list, err := listArtifacts(input, *filter)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "RUN\tNAME\tWORKFLOW\tVERSION\tSIZE\tCREATED\tEXPIRES")
+		var size int64
+		for _, artifact := range list {
+			expires := "never"
+			if !artifact.ExpiresAt.IsZero() {
+				expires = artifact.ExpiresAt.Local().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\tv%d\t%s\t%s\t%s\n", artifact.RunID, artifact.Name, artifact.Workflow, artifact.Version, units.HumanSize(float64(artifact.Size)), artifact.CreatedAt.Local().Format(time.RFC3339), expires)
+			size += artifact.Size
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		log.Infof("%d artifacts, %s in %s", len(list), units.HumanSize(float64(size)), artifactStorageName(input))
+		return nil
+	}
+}
+
+func runArtifactsDownload(input *Input, filter *artifacts.ArtifactFilter, dir *string) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		storage, list, err := listArtifacts(input, *filter)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			return fmt.Errorf("no artifacts found in %s", artifactStorageName(input))
+		}
+		runs := map[string]string{}
+		for _, artifact := range list {
+			if run, ok := runs[artifact.Name]; ok {
+				return fmt.Errorf("artifact %s exists in runs %s and %s, select one with --run", artifact.Name, run, artifact.RunID)
+			}
+			runs[artifact.Name] = artifact.RunID
+		}
+
+		for _, artifact := range list {
+			dest := *dir
+			if filter.Name == "" {
+				dest = filepath.Join(dest, artifact.Name)
+			}
+			if err := artifacts.DownloadArtifact(storage, artifact, dest); err != nil {
+				return fmt.Errorf("failed to download artifact %s of run %s: %w", artifact.Name, artifact.RunID, err)
+			}
+			log.Infof("Downloaded artifact %s of run %s to %s", artifact.Name, artifact.RunID, dest)
+		}
+		return nil
+	}
+}
+
+func runArtifactsDelete(input *Input, filter *artifacts.ArtifactFilter) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if filter.IsEmpty() {
+			return fmt.Errorf("one of --run, --workflow and --name is required")
+		}
+		storage, list, err := listArtifacts(input, *filter)
+		if err != nil {
+			return err
+		}
+		if err := artifacts.DeleteArtifacts(storage, list); err != nil {
+			return err
+		}
+		log.Infof("Deleted %d artifacts from %s", len(list), artifactStorageName(input))
+		return nil
+	}
+}
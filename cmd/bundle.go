@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"context"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/nektos/act/pkg/container"
+	"github.com/nektos/act/pkg/model"
+	"github.com/nektos/act/pkg/runner"
+)
+
+func newBundleCommand(ctx context.Context, input *Input) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Export and import the actions, reusable workflows and images of workflows for runs without network access",
+	}
+
+	var output string
+	createCmd := &cobra.Command{
+		Use:          "create [event name]",
+		Short:        "Write the remote actions, reusable workflows and images the workflows of an event need, or of all workflows, into a bundle",
+		Args:         cobra.MaximumNArgs(1),
+		RunE:         runBundleCreate(ctx, input, &output),
+		SilenceUsage: true,
+	}
+	createCmd.Flags().StringArrayVarP(&input.platforms, "platform", "P", []string{}, "custom image to use per platform (e.g. -P ubuntu-18.04=nektos/act-environments-ubuntu:18.04)")
+	createCmd.Flags().StringVarP(&output, "output", "o", "act-bundle.tar.gz", "path of the bundle to write")
+
+	loadCmd := &cobra.Command{
+		Use:          "load <bundle>",
+		Short:        "Restore the actions and reusable workflows of a bundle into the action cache and load its images into docker",
+		Args:         cobra.ExactArgs(1),
+		RunE:         runBundleLoad(ctx, input),
+		SilenceUsage: true,
+	}
+
+	cmd.AddCommand(createCmd, loadCmd)
+	return cmd
+}
+
+func runBundleCreate(ctx context.Context, input *Input, output *string) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		planner, err := model.NewWorkflowPlanner(input.WorkflowsPath(), input.noWorkflowRecurse)
+		if err != nil {
+			return err
+		}
+		var plan *model.Plan
+		if len(args) > 0 {
+			plan, err = planner.PlanEvent(args[0])
+		} else {
+			plan, err = planner.PlanAll()
+		}
+		if plan == nil {
+			return err
+		}
+
+		secrets := map[string]string{}
+		_ = readEnvs(input.Secretfile(), secrets)
+		nodeRuntimes, err := parseNodeRuntimes(input.nodeRuntimes)
+		if err != nil {
+			return err
+		}
+		if ret, err := container.GetSocketAndHost(input.containerDaemonSocket); err != nil {
+			log.Warnf("Couldn't get a valid docker connection: %+v", err)
+		} else {
+			os.Setenv("DOCKER_HOST", ret.Host)
+		}
+
+		// the bundle is always resolved with the ActionCache, its repositories are exported as git bundles
+		config := &runner.Config{
+			Workdir:               input.Workdir(),
+			ActionCacheDir:        input.actionCachePath,
+			GitHubInstance:        input.githubInstance,
+			Token:                 secrets["GITHUB_TOKEN"],
+			Secrets:               secrets,
+			Platforms:             input.newPlatforms(),
+			ContainerArchitecture: input.containerArchitecture,
+			NodeRuntimes:          nodeRuntimes,
+			ActionCache: &runner.GoGitActionCache{
+				Path: input.actionCachePath,
+			},
+		}
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		manifest, err := runner.CreateBundle(ctx, config, plan.Workflows(), f)
+		if err != nil {
+			return err
+		}
+		log.Infof("Wrote %d action refs and %d images to %s", len(manifest.Actions), len(manifest.Images), *output)
+		return nil
+	}
+}
+
+func runBundleLoad(ctx context.Context, input *Input) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if ret, err := container.GetSocketAndHost(input.containerDaemonSocket); err != nil {
+			log.Warnf("Couldn't get a valid docker connection: %+v", err)
+		} else {
+			os.Setenv("DOCKER_HOST", ret.Host)
+		}
+
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		config := &runner.Config{
+			ActionCache: &runner.GoGitActionCache{
+				Path: input.actionCachePath,
+			},
+		}
+		manifest, err := runner.LoadBundle(ctx, config, f)
+		if err != nil {
+			return err
+		}
+		log.Infof("Loaded %d action refs and %d images from %s, run with --use-new-action-cache --action-offline-mode to use them without network access", len(manifest.Actions), len(manifest.Images), args[0])
+		return nil
+	}
+}
@@ -0,0 +1,296 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	units "github.com/docker/go-units"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/nektos/act/pkg/artifactcache"
+	"github.com/nektos/act/pkg/common"
+	"github.com/nektos/act/pkg/runner"
+)
+
+func newCacheCommand(ctx context.Context, input *Input) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Inspect and clean up the caches of act",
+	}
+
+	actionsCmd := &cobra.Command{
+		Use:   "actions",
+		Short: "Inspect and clean up the cached actions and reusable workflows in the action cache path",
+	}
+	listCmd := &cobra.Command{
+		Use:          "list",
+		Short:        "List the cached repositories and clones, the least recently used first",
+		Args:         cobra.NoArgs,
+		RunE:         runCacheActionsList(input),
+		SilenceUsage: true,
+	}
+	pruneCmd := &cobra.Command{
+		Use:          "prune",
+		Short:        "Remove the cached repositories, clones and refs exceeding --action-cache-max-size or --action-cache-max-age and repack the remaining repositories",
+		Args:         cobra.NoArgs,
+		RunE:         runCacheActionsPrune(ctx, input),
+		SilenceUsage: true,
+	}
+	actionsCmd.AddCommand(listCmd, pruneCmd)
+	cmd.AddCommand(actionsCmd)
+
+	var filter artifactcache.CacheFilter
+	serverListCmd := &cobra.Command{
+		Use:          "list",
+		Short:        "List the caches of the cache server in --cache-server-path, the most recently used first",
+		Args:         cobra.NoArgs,
+		RunE:         runCacheList(input, &filter),
+		SilenceUsage: true,
+	}
+	serverShowCmd := &cobra.Command{
+		Use:          "show <id>",
+		Short:        "Show a cache of the cache server",
+		Args:         cobra.ExactArgs(1),
+		RunE:         runCacheShow(input),
+		SilenceUsage: true,
+	}
+	serverDeleteCmd := &cobra.Command{
+		Use:          "delete [<id>...]",
+		Short:        "Delete caches of the cache server by id or by --key, --ref and --repo, e.g. to purge a poisoned cache",
+		RunE:         runCacheDelete(input, &filter),
+		SilenceUsage: true,
+	}
+	for _, c := range []*cobra.Command{serverListCmd, serverDeleteCmd} {
+		c.Flags().StringVar(&filter.Key, "key", "", "Only caches whose key starts with this prefix")
+		c.Flags().StringVar(&filter.Ref, "ref", "", "Only caches of this ref, e.g. refs/heads/main")
+		c.Flags().StringVar(&filter.Repository, "repo", "", "Only caches of this repository, e.g. nektos/act")
+	}
+	cmd.AddCommand(serverListCmd, serverShowCmd, serverDeleteCmd)
+	return cmd
+}
+
+// cacheServerPolicy returns the quota and the retention of the cache server
+func cacheServerPolicy(input *Input) (artifactcache.Policy, error) {
+	policy := artifactcache.Policy{
+		KeepUnused: input.cacheServerRetention,
+		KeepUsed:   input.cacheServerMaxAge,
+	}
+	if input.cacheServerMaxSize != "" {
+		size, err := units.FromHumanSize(input.cacheServerMaxSize)
+		if err != nil {
+			return policy, fmt.Errorf("invalid cache server size %q: %w", input.cacheServerMaxSize, err)
+		}
+		policy.MaxRepositorySize = size
+	}
+	return policy, nil
+}
+
+// startCacheHandler starts the cache server with the quota and the retention of the flags
+func startCacheHandler(ctx context.Context, input *Input) (*artifactcache.Handler, error) {
+	policy, err := cacheServerPolicy(input)
+	if err != nil {
+		return nil, err
+	}
+	storage, err := artifactcache.OpenStorage(input.cacheServerPath, input.cacheServerStorage)
+	if err != nil {
+		return nil, err
+	}
+	cacheHandler, err := artifactcache.StartHandlerWithStorage(input.cacheServerPath, storage, input.cacheServerAddr, input.cacheServerPort, common.Logger(ctx))
+	if err != nil {
+		return nil, err
+	}
+	cacheHandler.SetPolicy(policy)
+	if input.serverToken != "" {
+		cacheHandler.RequireAuthorization(input.serverToken)
+	}
+	return cacheHandler, nil
+}
+
+// actionCacheGCPolicy returns the budget of the action cache path
+func actionCacheGCPolicy(input *Input) (runner.ActionCacheGCPolicy, error) {
+	policy := runner.ActionCacheGCPolicy{MaxAge: input.actionCacheMaxAge}
+	if input.actionCacheMaxSize != "" {
+		size, err := units.FromHumanSize(input.actionCacheMaxSize)
+		if err != nil {
+			return policy, fmt.Errorf("invalid action cache size %q: %w", input.actionCacheMaxSize, err)
+		}
+		policy.MaxSize = size
+	}
+	return policy, nil
+}
+
+// pruneActionCacheIfDue runs the periodic gc of the action cache path if a budget is configured
+func pruneActionCacheIfDue(ctx context.Context, input *Input) {
+	if input.actionCacheMaxSize == "" && input.actionCacheMaxAge == 0 {
+		return
+	}
+	policy, err := actionCacheGCPolicy(input)
+	if err == nil {
+		err = runner.PruneActionCacheIfDue(ctx, input.actionCachePath, policy, runner.DefaultActionCacheGCInterval)
+	}
+	if err != nil {
+		log.Warnf("Failed to clean up the action cache %s: %v", input.actionCachePath, err)
+	}
+}
+
+func runCacheActionsList(input *Input) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		entries, err := runner.ListActionCache(input.actionCachePath)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tTYPE\tSIZE\tLAST USED\tREFS")
+		var size int64
+		for _, entry := range entries {
+			kind := "repository"
+			if entry.Clone {
+				kind = "clone"
+			}
+			refs := make([]string, 0, len(entry.Refs))
+			for ref := range entry.Refs {
+				refs = append(refs, ref)
+			}
+			sort.Strings(refs)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", entry.Name, kind, units.HumanSize(float64(entry.Size)), entry.LastUsed.Format(time.RFC3339), strings.Join(refs, ","))
+			size += entry.Size
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		log.Infof("%d entries, %s in %s", len(entries), units.HumanSize(float64(size)), input.actionCachePath)
+		return nil
+	}
+}
+
+func runCacheActionsPrune(ctx context.Context, input *Input) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		policy, err := actionCacheGCPolicy(input)
+		if err != nil {
+			return err
+		}
+		removed, err := runner.PruneActionCache(ctx, input.actionCachePath, policy)
+		if err != nil {
+			return err
+		}
+		var size int64
+		for _, entry := range removed {
+			size += entry.Size
+		}
+		log.Infof("Removed %d entries, %s from %s", len(removed), units.HumanSize(float64(size)), input.actionCachePath)
+		return nil
+	}
+}
+
+func runCacheList(input *Input, filter *artifactcache.CacheFilter) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		caches, err := artifactcache.ListCaches(input.cacheServerPath, *filter)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tKEY\tVERSION\tSIZE\tREF\tREPOSITORY\tLAST USED")
+		var size int64
+		for _, cache := range caches {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", cache.ID, cache.Key, shortVersion(cache.Version), units.HumanSize(float64(cache.Size)), cache.Ref, cache.Repository, time.Unix(cache.UsedAt, 0).Format(time.RFC3339))
+			size += cache.Size
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		log.Infof("%d caches, %s in %s", len(caches), units.HumanSize(float64(size)), input.cacheServerPath)
+		return nil
+	}
+}
+
+// shortVersion abbreviates the sha256 versions of the caches like git abbreviates commits
+func shortVersion(version string) string {
+	if len(version) > 12 {
+		return version[:12]
+	}
+	return version
+}
+
+func runCacheShow(input *Input) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid cache id %q: %w", args[0], err)
+		}
+		cache, err := artifactcache.GetCache(input.cacheServerPath, id)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "ID:\t%d\n", cache.ID)
+		fmt.Fprintf(w, "Key:\t%s\n", cache.Key)
+		fmt.Fprintf(w, "Version:\t%s\n", cache.Version)
+		fmt.Fprintf(w, "Size:\t%s (%d bytes)\n", units.HumanSize(float64(cache.Size)), cache.Size)
+		fmt.Fprintf(w, "Ref:\t%s\n", cache.Ref)
+		fmt.Fprintf(w, "Repository:\t%s\n", cache.Repository)
+		fmt.Fprintf(w, "Complete:\t%t\n", cache.Complete)
+		fmt.Fprintf(w, "Created:\t%s\n", time.Unix(cache.CreatedAt, 0).Format(time.RFC3339))
+		fmt.Fprintf(w, "Last used:\t%s\n", time.Unix(cache.UsedAt, 0).Format(time.RFC3339))
+		return w.Flush()
+	}
+}
+
+func runCacheDelete(input *Input, filter *artifactcache.CacheFilter) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 && !filter.IsEmpty() {
+			return fmt.Errorf("either cache ids or --key, --ref and --repo can be given")
+		} else if len(args) == 0 && filter.IsEmpty() {
+			return fmt.Errorf("cache ids or one of --key, --ref and --repo are required")
+		}
+		ids := make([]uint64, 0, len(args))
+		for _, arg := range args {
+			id, err := strconv.ParseUint(arg, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid cache id %q: %w", arg, err)
+			}
+			ids = append(ids, id)
+		}
+		if len(args) == 0 {
+			caches, err := artifactcache.ListCaches(input.cacheServerPath, *filter)
+			if err != nil {
+				return err
+			}
+			for _, cache := range caches {
+				ids = append(ids, cache.ID)
+			}
+		}
+		storage, err := artifactcache.OpenStorage(input.cacheServerPath, input.cacheServerStorage)
+		if err != nil {
+			return err
+		}
+		if err := artifactcache.DeleteCaches(input.cacheServerPath, storage, ids); err != nil {
+			return err
+		}
+		log.Infof("Deleted %d caches from %s", len(ids), input.cacheServerPath)
+		return nil
+	}
+}
+
+// serveResultsFromCache enables the cache service v2 by pointing ACTIONS_RESULTS_URL to the cache server,
+// which forwards the artifact service to the artifact server
+func serveResultsFromCache(cacheHandler *artifactcache.Handler, input *Input, envs map[string]string) error {
+	const resultsURLKey = "ACTIONS_RESULTS_URL"
+	if envs[resultsURLKey] != "" {
+		return nil
+	}
+	if input.artifactServerPath != "" {
+		if err := cacheHandler.ForwardResults(fmt.Sprintf("http://%s:%s/", input.artifactServerAddr, input.artifactServerPort)); err != nil {
+			return err
+		}
+	}
+	envs[resultsURLKey] = cacheHandler.ExternalURL() + "/"
+	envs["ACTIONS_CACHE_SERVICE_V2"] = "true"
+	return nil
+}
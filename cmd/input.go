@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"path/filepath"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -44,10 +46,25 @@ type Input struct {
 	artifactServerPath                 string
 	artifactServerAddr                 string
 	artifactServerPort                 string
+	artifactServerURL                  string
+	artifactServerRetentionDays        int
+	artifactServerGitHubAPI            bool
+	artifactServerStorage              string
+	oidcSigningKey                     string
+	oidcIssuer                         string
+	oidcAudience                       string
+	githubTokenProxy                   bool
+	defaultTokenPermissions            string
 	noCacheServer                      bool
 	cacheServerPath                    string
 	cacheServerAddr                    string
 	cacheServerPort                    uint16
+	cacheServerURL                     string
+	serverToken                        string
+	cacheServerStorage                 string
+	cacheServerMaxSize                 string
+	cacheServerRetention               time.Duration
+	cacheServerMaxAge                  time.Duration
 	jsonLogger                         bool
 	noSkipCheckout                     bool
 	remoteName                         string
@@ -60,6 +77,24 @@ type Input struct {
 	networkName                        string
 	useNewActionCache                  bool
 	localRepository                    []string
+	steps                              []string
+	skipSteps                          []string
+	fromStep                           string
+	untilStep                          string
+	stepOutputsFile                    string
+	mockActionsFile                    string
+	lockfile                           string
+	locked                             bool
+	actionPolicyFile                   string
+	nodeRuntimes                       []string
+	actionCacheMaxSize                 string
+	actionCacheMaxAge                  time.Duration
+	actionCacheTarball                 bool
+	registryMirrors                    []string
+	dockerBuildTargets                 []string
+	dockerBuildSecrets                 []string
+	secretProviders                    []string
+	secretKeyFile                      string
 }
 
 func (i *Input) resolve(path string) string {
@@ -86,6 +121,11 @@ func (i *Input) Secretfile() string {
 	return i.resolve(i.secretfile)
 }
 
+// SecretKeyFile returns path to the age identities of the encrypted secret files
+func (i *Input) SecretKeyFile() string {
+	return i.resolve(i.secretKeyFile)
+}
+
 func (i *Input) Varfile() string {
 	return i.resolve(i.varfile)
 }
@@ -105,7 +145,59 @@ func (i *Input) EventPath() string {
 	return i.resolve(i.eventPath)
 }
 
+// StepOutputsFile returns the path to the file with outputs of skipped steps
+func (i *Input) StepOutputsFile() string {
+	return i.resolve(i.stepOutputsFile)
+}
+
+// MockActionsFile returns the path to the file with stubs for mocked actions
+func (i *Input) MockActionsFile() string {
+	return i.resolve(i.mockActionsFile)
+}
+
+// Lockfile returns the path to the action lockfile
+func (i *Input) Lockfile() string {
+	return i.resolve(i.lockfile)
+}
+
+// ActionPolicyFile returns the path to the action policy file
+func (i *Input) ActionPolicyFile() string {
+	return i.resolve(i.actionPolicyFile)
+}
+
 // Inputfile returns the path to the input file
 func (i *Input) Inputfile() string {
 	return i.resolve(i.inputfile)
 }
+
+// DockerBuildTargets returns the build targets of --docker-build-target by uses: pattern, "" applies to every action
+func (i *Input) DockerBuildTargets() map[string]string {
+	if len(i.dockerBuildTargets) == 0 {
+		return nil
+	}
+	targets := map[string]string{}
+	for _, t := range i.dockerBuildTargets {
+		if pattern, target, ok := strings.Cut(t, "="); ok {
+			targets[pattern] = target
+		} else {
+			targets[""] = t
+		}
+	}
+	return targets
+}
+
+// DockerBuildSecrets returns the act secrets of --docker-build-secret by BuildKit secret id
+func (i *Input) DockerBuildSecrets() map[string]string {
+	if len(i.dockerBuildSecrets) == 0 {
+		return nil
+	}
+	secrets := map[string]string{}
+	for _, s := range i.dockerBuildSecrets {
+		if id, name, ok := strings.Cut(s, "="); ok {
+			secrets[id] = name
+		} else {
+			secrets[s] = s
+		}
+	}
+	return secrets
+}
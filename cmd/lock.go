@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/nektos/act/pkg/container"
+	"github.com/nektos/act/pkg/model"
+	"github.com/nektos/act/pkg/runner"
+)
+
+func newLockCommand(ctx context.Context, input *Input) *cobra.Command {
+	var lockImages bool
+	cmd := &cobra.Command{
+		Use:          "lock",
+		Short:        "Resolve the refs of all remote actions and reusable workflows to commit SHAs, with --images the images to digests, and write them to the lockfile",
+		Args:         cobra.NoArgs,
+		RunE:         runLock(ctx, input, &lockImages),
+		SilenceUsage: true,
+	}
+	cmd.Flags().BoolVar(&lockImages, "images", false, "also resolve the images of jobs, services, docker actions and platforms to registry digests, the digests of a previous lockfile are kept otherwise")
+	cmd.Flags().StringArrayVarP(&input.platforms, "platform", "P", []string{}, "custom image to use per platform (e.g. -P ubuntu-18.04=nektos/act-environments-ubuntu:18.04)")
+	cmd.Flags().StringArrayVarP(&input.localRepository, "local-repository", "", []string{}, "Replaces the specified repository and ref with a local folder (e.g. https://github.com/test/test@v0=/home/act/test or test/test@v0=/home/act/test, the latter matches any hosts or protocols)")
+	return cmd
+}
+
+func runLock(ctx context.Context, input *Input, lockImages *bool) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		planner, err := model.NewWorkflowPlanner(input.WorkflowsPath(), input.noWorkflowRecurse)
+		if err != nil {
+			return err
+		}
+		plan, err := planner.PlanAll()
+		if plan == nil {
+			return err
+		}
+
+		secrets := map[string]string{}
+		_ = readEnvs(input.Secretfile(), secrets)
+
+		// the lockfile is always resolved with the ActionCache
+		input.useNewActionCache = true
+		config := &runner.Config{
+			Workdir:         input.Workdir(),
+			ActionCacheDir:  input.actionCachePath,
+			GitHubInstance:  input.githubInstance,
+			Token:           secrets["GITHUB_TOKEN"],
+			Secrets:         secrets,
+			Platforms:       input.newPlatforms(),
+			RegistryMirrors: input.newRegistryMirrors(),
+			ActionCache:     newActionCache(input),
+		}
+		lockfile, err := runner.LockActions(ctx, config, plan.Workflows())
+		if err != nil {
+			return err
+		}
+		if *lockImages {
+			if ret, err := container.GetSocketAndHost(input.containerDaemonSocket); err != nil {
+				log.Warnf("Couldn't get a valid docker connection: %+v", err)
+			} else {
+				os.Setenv("DOCKER_HOST", ret.Host)
+			}
+			if err := runner.LockImages(ctx, config, plan.Workflows(), lockfile); err != nil {
+				return err
+			}
+		} else if previous, err := runner.ReadLockfile(input.Lockfile()); err == nil {
+			lockfile.Images = previous.Images
+		}
+		log.Infof("Writing %d locked refs and %d images to %s", len(lockfile.Actions), len(lockfile.Images), input.Lockfile())
+		return lockfile.Write(input.Lockfile())
+	}
+}
@@ -20,3 +20,16 @@ func (i *Input) newPlatforms() map[string]string {
 	}
 	return platforms
 }
+
+func (i *Input) newRegistryMirrors() map[string]string {
+	if len(i.registryMirrors) == 0 {
+		return nil
+	}
+	mirrors := map[string]string{}
+	for _, m := range i.registryMirrors {
+		if source, mirror, ok := strings.Cut(m, "="); ok && source != "" && mirror != "" {
+			mirrors[source] = mirror
+		}
+	}
+	return mirrors
+}
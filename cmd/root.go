@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -29,6 +30,7 @@ import (
 	"github.com/nektos/act/pkg/container"
 	"github.com/nektos/act/pkg/model"
 	"github.com/nektos/act/pkg/runner"
+	"github.com/nektos/act/pkg/tokenproxy"
 )
 
 // Execute is the entry point to running the CLI
@@ -60,7 +62,9 @@ func Execute(ctx context.Context, version string) {
 	rootCmd.Flags().BoolVarP(&input.reuseContainers, "reuse", "r", false, "don't remove container(s) on successfully completed workflow(s) to maintain state between runs")
 	rootCmd.Flags().BoolVarP(&input.bindWorkdir, "bind", "b", false, "bind working directory to container, rather than copy")
 	rootCmd.Flags().BoolVarP(&input.forcePull, "pull", "p", true, "pull docker image(s) even if already present")
-	rootCmd.Flags().BoolVarP(&input.forceRebuild, "rebuild", "", true, "rebuild local action docker image(s) even if already present")
+	rootCmd.Flags().BoolVarP(&input.forceRebuild, "rebuild", "", false, "rebuild action docker image(s) even if an image of the same build context is already present")
+	rootCmd.Flags().StringArrayVarP(&input.dockerBuildTargets, "docker-build-target", "", []string{}, "build stage of the Dockerfile of docker actions, optionally per uses: pattern (e.g. --docker-build-target release or --docker-build-target octo/*=release)")
+	rootCmd.Flags().StringArrayVarP(&input.dockerBuildSecrets, "docker-build-secret", "", []string{}, "pass a secret to docker action builds as BuildKit secret, optionally under another id (e.g. --docker-build-secret NPM_TOKEN or --docker-build-secret npm_token=NPM_TOKEN)")
 	rootCmd.Flags().BoolVarP(&input.autodetectEvent, "detect-event", "", false, "Use first event type from workflow as event that triggered the workflow")
 	rootCmd.Flags().StringVarP(&input.eventPath, "eventpath", "e", "", "path to event JSON file")
 	rootCmd.Flags().StringVar(&input.defaultBranch, "defaultbranch", "", "the name of the main branch")
@@ -73,6 +77,13 @@ func Execute(ctx context.Context, version string) {
 	rootCmd.Flags().StringArrayVarP(&input.replaceGheActionWithGithubCom, "replace-ghe-action-with-github-com", "", []string{}, "If you are using GitHub Enterprise Server and allow specified actions from GitHub (github.com), you can set actions on this. (e.g. --replace-ghe-action-with-github-com =github/super-linter)")
 	rootCmd.Flags().StringVar(&input.replaceGheActionTokenWithGithubCom, "replace-ghe-action-token-with-github-com", "", "If you are using replace-ghe-action-with-github-com  and you want to use private actions on GitHub, you have to set personal access token")
 	rootCmd.Flags().StringArrayVarP(&input.matrix, "matrix", "", []string{}, "specify which matrix configuration to include (e.g. --matrix java:13")
+	rootCmd.Flags().StringArrayVar(&input.steps, "step", []string{}, "run only the step with this ID, all other steps are skipped (e.g. --step build)")
+	rootCmd.Flags().StringArrayVar(&input.skipSteps, "skip-step", []string{}, "skip the step with this ID (e.g. --skip-step deploy)")
+	rootCmd.Flags().StringVar(&input.fromStep, "from-step", "", "skip all steps before the step with this ID")
+	rootCmd.Flags().StringVar(&input.untilStep, "until-step", "", "skip all steps after the step with this ID")
+	rootCmd.Flags().StringVar(&input.stepOutputsFile, "step-outputs-file", "", "YAML or JSON file with outputs of skipped steps by step ID (e.g. build: {version: 1.0.0})")
+	rootCmd.Flags().StringVar(&input.mockActionsFile, "mock-actions-file", "", "YAML or JSON file with stubs used instead of actions, docker images and reusable workflows by uses: pattern (e.g. aws-actions/*: {outputs: {aws-account-id: '123'}})")
+	rootCmd.Flags().BoolVar(&input.locked, "locked", false, "use only the commit SHAs of the lockfile for remote actions and reusable workflows and fail if a ref is missing or has moved")
 	rootCmd.PersistentFlags().StringVarP(&input.actor, "actor", "a", "nektos/act", "user that triggered the event")
 	rootCmd.PersistentFlags().StringVarP(&input.workflowsPath, "workflows", "W", "./.github/workflows/", "path to workflow file(s)")
 	rootCmd.PersistentFlags().BoolVarP(&input.noWorkflowRecurse, "no-recurse", "", false, "Flag to disable running workflows from subdirectories of specified path in '--workflows'/'-W' flag")
@@ -83,6 +94,8 @@ func Execute(ctx context.Context, version string) {
 	rootCmd.PersistentFlags().BoolVarP(&input.noOutput, "quiet", "q", false, "disable logging of output from steps")
 	rootCmd.PersistentFlags().BoolVarP(&input.dryrun, "dryrun", "n", false, "disable container creation, validates only workflow correctness")
 	rootCmd.PersistentFlags().StringVarP(&input.secretfile, "secret-file", "", ".secrets", "file with list of secrets to read from (e.g. --secret-file .secrets)")
+	rootCmd.PersistentFlags().StringArrayVarP(&input.secretProviders, "secret-provider", "", []string{}, "fetch the secrets of a name, a prefix or all names (*) the workflows reference from a provider: exec:COMMAND printing the secret of $ACT_SECRET_NAME, encrypted-file:FILE of an age encrypted dotenv or yaml file, or git-credential[:HOST] (e.g. --secret-provider 'NPM_TOKEN=exec:pass show npm' or --secret-provider GITHUB_TOKEN=git-credential)")
+	rootCmd.PersistentFlags().StringVarP(&input.secretKeyFile, "secret-key-file", "", os.Getenv("ACT_SECRET_KEY_FILE"), "file with the age identities the encrypted-file secret providers are decrypted with. Defaults to $ACT_SECRET_KEY_FILE.")
 	rootCmd.PersistentFlags().StringVarP(&input.varfile, "var-file", "", ".vars", "file with list of vars to read from (e.g. --var-file .vars)")
 	rootCmd.PersistentFlags().BoolVarP(&input.insecureSecrets, "insecure-secrets", "", false, "NOT RECOMMENDED! Doesn't hide secrets while printing logs.")
 	rootCmd.PersistentFlags().StringVarP(&input.envfile, "env-file", "", ".env", "environment file to read and use as env in the containers")
@@ -94,16 +107,44 @@ func Execute(ctx context.Context, version string) {
 	rootCmd.PersistentFlags().StringVarP(&input.artifactServerPath, "artifact-server-path", "", "", "Defines the path where the artifact server stores uploads and retrieves downloads from. If not specified the artifact server will not start.")
 	rootCmd.PersistentFlags().StringVarP(&input.artifactServerAddr, "artifact-server-addr", "", common.GetOutboundIP().String(), "Defines the address to which the artifact server binds.")
 	rootCmd.PersistentFlags().StringVarP(&input.artifactServerPort, "artifact-server-port", "", "34567", "Defines the port where the artifact server listens.")
+	rootCmd.PersistentFlags().IntVarP(&input.artifactServerRetentionDays, "artifact-server-retention-days", "", artifacts.DefaultRetentionDays, "Removes the artifacts uploaded without retention-days this many days after the upload, the expired artifacts are removed when the artifact server starts and hourly while it serves requests. 0 means never.")
+	rootCmd.PersistentFlags().StringVarP(&input.artifactServerStorage, "artifact-server-storage", "", "", "Where the artifact server stores the artifacts: a directory (e.g. file:///mnt/artifacts) or an S3 compatible bucket (e.g. s3://bucket/prefix?endpoint=http://minio:9000&region=us-east-1, with the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY credentials). Defaults to --artifact-server-path, which is still required to start the artifact server of the jobs.")
+	rootCmd.PersistentFlags().BoolVarP(&input.artifactServerGitHubAPI, "artifact-server-github-api", "", false, "Points GITHUB_API_URL of the jobs to the artifact server, which serves the artifacts of other runs to download-artifact's run-id and repository inputs and forwards the other requests to the GitHub API. A server of --artifact-server-url needs `act serve-artifacts --forward-api`.")
+	rootCmd.PersistentFlags().StringVarP(&input.oidcSigningKey, "oidc-signing-key", "", "", "PEM file of the RSA private key the artifact server signs the OIDC tokens of the jobs with, e.g. to register the issuer with a cloud provider once. A key is generated on start if not set. act serve-artifacts needs --server-token with a key.")
+	rootCmd.PersistentFlags().StringVarP(&input.oidcIssuer, "oidc-issuer", "", "", "Issuer of the OIDC tokens of the jobs, the url the discovery documents of the artifact server are reachable at. Defaults to the url the jobs reach the artifact server at.")
+	rootCmd.PersistentFlags().StringVarP(&input.oidcAudience, "oidc-audience", "", "", "Audience of the OIDC tokens requested without one. Defaults to https://github.com/<repository owner> like GitHub.")
+	rootCmd.PersistentFlags().BoolVarP(&input.githubTokenProxy, "github-token-proxy", "", false, "Gives the jobs a GITHUB_TOKEN scoped to their permissions instead of the real token and points GITHUB_API_URL to a local proxy, which forwards the requests of the REST API within the permissions with the real token and rejects the others like GitHub. The scoped token can't be used for git or ghcr.io.")
+	rootCmd.PersistentFlags().StringVarP(&input.defaultTokenPermissions, "default-token-permissions", "", "permissive", "Permissions of the GITHUB_TOKEN of the workflows without permissions, like the setting of the repository: permissive (read and write) or restricted (contents and packages read).")
 	rootCmd.PersistentFlags().BoolVarP(&input.noSkipCheckout, "no-skip-checkout", "", false, "Do not skip actions/checkout")
 	rootCmd.PersistentFlags().BoolVarP(&input.noCacheServer, "no-cache-server", "", false, "Disable cache server")
 	rootCmd.PersistentFlags().StringVarP(&input.cacheServerPath, "cache-server-path", "", filepath.Join(CacheHomeDir, "actcache"), "Defines the path where the cache server stores caches.")
 	rootCmd.PersistentFlags().StringVarP(&input.cacheServerAddr, "cache-server-addr", "", common.GetOutboundIP().String(), "Defines the address to which the cache server binds.")
 	rootCmd.PersistentFlags().Uint16VarP(&input.cacheServerPort, "cache-server-port", "", 0, "Defines the port where the artifact server listens. 0 means a randomly available port.")
+	rootCmd.PersistentFlags().StringVarP(&input.cacheServerURL, "cache-server-url", "", "", "Uses a running cache server, e.g. started by `act serve-cache`, instead of starting one. It serves the cache service v2 too unless --artifact-server-path is set.")
+	rootCmd.PersistentFlags().StringVarP(&input.artifactServerURL, "artifact-server-url", "", "", "Uses a running artifact server, e.g. started by `act serve-artifacts`, instead of starting one.")
+	rootCmd.PersistentFlags().StringVarP(&input.serverToken, "server-token", "", os.Getenv("ACT_SERVER_TOKEN"), "Secret shared with `act serve-cache` and `act serve-artifacts`, the runtime tokens of the jobs are signed with it. Defaults to $ACT_SERVER_TOKEN, or to a secret of the run if act starts the cache and the artifact server itself.")
+	rootCmd.PersistentFlags().StringVarP(&input.cacheServerStorage, "cache-server-storage", "", "", "Where the cache server stores the contents of the caches: a directory (e.g. file:///mnt/actcache) or an S3 compatible bucket (e.g. s3://bucket/prefix?endpoint=http://minio:9000&region=us-east-1, with the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY credentials). Defaults to --cache-server-path, which keeps the index. Neither can be shared by several cache servers, share one server with --cache-server-url instead.")
+	rootCmd.PersistentFlags().StringVarP(&input.cacheServerMaxSize, "cache-server-max-size", "", "10GB", "Size quota of the caches of each repository in the cache server, the least recently used caches are evicted first. 0 means no quota.")
+	rootCmd.PersistentFlags().DurationVarP(&input.cacheServerRetention, "cache-server-retention", "", artifactcache.DefaultPolicy.KeepUnused, "Removes the caches of the cache server which have not been used for this long. 0 means never.")
+	rootCmd.PersistentFlags().DurationVarP(&input.cacheServerMaxAge, "cache-server-max-age", "", artifactcache.DefaultPolicy.KeepUsed, "Removes the caches of the cache server created this long ago, even if they are still used. 0 means never.")
 	rootCmd.PersistentFlags().StringVarP(&input.actionCachePath, "action-cache-path", "", filepath.Join(CacheHomeDir, "act"), "Defines the path where the actions get cached and host workspaces created.")
+	rootCmd.PersistentFlags().StringVarP(&input.actionCacheMaxSize, "action-cache-max-size", "", "", "Size budget of the action cache path (e.g. 10GB), the least recently used actions are removed by a daily cleanup after runs and by `act cache actions prune`")
+	rootCmd.PersistentFlags().DurationVarP(&input.actionCacheMaxAge, "action-cache-max-age", "", 0, "Removes cached actions and refs not used for this long (e.g. 720h) by a daily cleanup after runs and by `act cache actions prune`")
 	rootCmd.PersistentFlags().BoolVarP(&input.actionOfflineMode, "action-offline-mode", "", false, "If action contents exists, it will not be fetch and pull again. If turn on this,will turn off force pull")
+	rootCmd.PersistentFlags().StringVarP(&input.lockfile, "lockfile", "", "act.lock", "lockfile with the commit SHAs of remote actions and reusable workflows, written by `act lock` and used with --locked")
+	rootCmd.PersistentFlags().StringVarP(&input.actionPolicyFile, "action-policy-file", "", "", "YAML file restricting the actions, reusable workflows and docker images workflows may use, violations fail the run before any job starts")
 	rootCmd.PersistentFlags().StringVarP(&input.networkName, "network", "", "host", "Sets a docker network name. Defaults to host.")
 	rootCmd.PersistentFlags().BoolVarP(&input.useNewActionCache, "use-new-action-cache", "", false, "Enable using the new Action Cache for storing Actions locally")
+	rootCmd.PersistentFlags().BoolVarP(&input.actionCacheTarball, "action-cache-tarball", "", false, "Download remote actions and reusable workflows with the repository tarball API instead of git, implies --use-new-action-cache")
 	rootCmd.PersistentFlags().StringArrayVarP(&input.localRepository, "local-repository", "", []string{}, "Replaces the specified repository and ref with a local folder (e.g. https://github.com/test/test@v0=/home/act/test or test/test@v0=/home/act/test, the latter matches any hosts or protocols)")
+	rootCmd.PersistentFlags().StringArrayVarP(&input.nodeRuntimes, "node-runtime", "", []string{}, "Selects the node binary of a javascript action runtime: a path in the job container (e.g. node20=/usr/local/bin/node), a path on the host copied into the job (e.g. node20=host:/usr/bin/node) or an image whose node is copied into the job (e.g. node24=docker://node:24-slim[#/usr/local/bin/node])")
+	rootCmd.PersistentFlags().StringArrayVarP(&input.registryMirrors, "registry-mirror", "", []string{}, "Pulls the images of a registry or repository prefix from a mirror (e.g. --registry-mirror docker.io=mirror.example.com/dockerhub), the longest matching prefix wins")
+	rootCmd.AddCommand(newTestCommand(ctx, input))
+	rootCmd.AddCommand(newLockCommand(ctx, input))
+	rootCmd.AddCommand(newBundleCommand(ctx, input))
+	rootCmd.AddCommand(newCacheCommand(ctx, input))
+	rootCmd.AddCommand(newArtifactsCommand(input))
+	rootCmd.AddCommand(newServeCacheCommand(ctx, input), newServeArtifactsCommand(ctx, input))
 	rootCmd.SetArgs(args())
 
 	if err := rootCmd.Execute(); err != nil {
@@ -329,6 +370,61 @@ func readEnvs(path string, envs map[string]string) bool {
 	return false
 }
 
+func readStepOutputs(file string) (map[string]map[string]string, error) {
+	if file == "" {
+		return nil, nil
+	}
+	log.Debugf("Loading outputs of skipped steps from %s", file)
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]map[string]string{}
+	if err = yaml.Unmarshal(content, &ret); err != nil {
+		return nil, fmt.Errorf("failed to parse step outputs from %s: %w", file, err)
+	}
+	return ret, nil
+}
+
+func parseNodeRuntimes(values []string) (map[string]*runner.NodeRuntime, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	nodeRuntimes := map[string]*runner.NodeRuntime{}
+	for _, value := range values {
+		using, nodeRuntime, err := runner.ParseNodeRuntime(value)
+		if err != nil {
+			return nil, err
+		}
+		nodeRuntimes[using] = nodeRuntime
+	}
+	return nodeRuntimes, nil
+}
+
+func readActionPolicy(file string) (*runner.ActionPolicy, error) {
+	if file == "" {
+		return nil, nil
+	}
+	log.Debugf("Loading action policy from %s", file)
+	return runner.ReadActionPolicy(file)
+}
+
+func readActionMocks(file string) (map[string]*runner.ActionMock, error) {
+	if file == "" {
+		return nil, nil
+	}
+	log.Debugf("Loading action mocks from %s", file)
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]*runner.ActionMock{}
+	if err = yaml.Unmarshal(content, &ret); err != nil {
+		return nil, fmt.Errorf("failed to parse action mocks from %s: %w", file, err)
+	}
+	return ret, nil
+}
+
 func parseMatrix(matrix []string) map[string]map[string]bool {
 	// each matrix entry should be of the form - string:string
 	r := regexp.MustCompile(":")
@@ -396,6 +492,11 @@ func newRunCommand(ctx context.Context, input *Input) func(*cobra.Command, []str
 		matrixes := parseMatrix(input.matrix)
 		log.Debugf("Evaluated matrix inclusions: %v", matrixes)
 
+		stepOutputs, err := readStepOutputs(input.StepOutputsFile())
+		if err != nil {
+			return err
+		}
+
 		planner, err := model.NewWorkflowPlanner(input.WorkflowsPath(), input.noWorkflowRecurse)
 		if err != nil {
 			return err
@@ -507,6 +608,10 @@ func newRunCommand(ctx context.Context, input *Input) func(*cobra.Command, []str
 			return plannerErr
 		}
 
+		if err := resolveSecrets(ctx, input, plan, secrets); err != nil {
+			return err
+		}
+
 		// check to see if the main branch was defined
 		defaultbranch, err := cmd.Flags().GetString("defaultbranch")
 		if err != nil {
@@ -546,89 +651,56 @@ func newRunCommand(ctx context.Context, input *Input) func(*cobra.Command, []str
 		}
 
 		// run the plan
-		config := &runner.Config{
-			Actor:                              input.actor,
-			EventName:                          eventName,
-			EventPath:                          input.EventPath(),
-			DefaultBranch:                      defaultbranch,
-			ForcePull:                          !input.actionOfflineMode && input.forcePull,
-			ForceRebuild:                       input.forceRebuild,
-			ReuseContainers:                    input.reuseContainers,
-			Workdir:                            input.Workdir(),
-			ActionCacheDir:                     input.actionCachePath,
-			ActionOfflineMode:                  input.actionOfflineMode,
-			BindWorkdir:                        input.bindWorkdir,
-			LogOutput:                          !input.noOutput,
-			JSONLogger:                         input.jsonLogger,
-			LogPrefixJobID:                     input.logPrefixJobID,
-			Env:                                envs,
-			Secrets:                            secrets,
-			Vars:                               vars,
-			Inputs:                             inputs,
-			Token:                              secrets["GITHUB_TOKEN"],
-			InsecureSecrets:                    input.insecureSecrets,
-			Platforms:                          input.newPlatforms(),
-			Privileged:                         input.privileged,
-			UsernsMode:                         input.usernsMode,
-			ContainerArchitecture:              input.containerArchitecture,
-			ContainerDaemonSocket:              input.containerDaemonSocket,
-			ContainerOptions:                   input.containerOptions,
-			UseGitIgnore:                       input.useGitIgnore,
-			GitHubInstance:                     input.githubInstance,
-			ContainerCapAdd:                    input.containerCapAdd,
-			ContainerCapDrop:                   input.containerCapDrop,
-			AutoRemove:                         input.autoRemove,
-			ArtifactServerPath:                 input.artifactServerPath,
-			ArtifactServerAddr:                 input.artifactServerAddr,
-			ArtifactServerPort:                 input.artifactServerPort,
-			NoSkipCheckout:                     input.noSkipCheckout,
-			RemoteName:                         input.remoteName,
-			ReplaceGheActionWithGithubCom:      input.replaceGheActionWithGithubCom,
-			ReplaceGheActionTokenWithGithubCom: input.replaceGheActionTokenWithGithubCom,
-			Matrix:                             matrixes,
-			ContainerNetworkMode:               docker_container.NetworkMode(input.networkName),
-		}
-		if input.useNewActionCache || len(input.localRepository) > 0 {
-			if input.actionOfflineMode {
-				config.ActionCache = &runner.GoGitActionCacheOfflineMode{
-					Parent: runner.GoGitActionCache{
-						Path: config.ActionCacheDir,
-					},
-				}
-			} else {
-				config.ActionCache = &runner.GoGitActionCache{
-					Path: config.ActionCacheDir,
-				}
-			}
-			if len(input.localRepository) > 0 {
-				localRepositories := map[string]string{}
-				for _, l := range input.localRepository {
-					k, v, _ := strings.Cut(l, "=")
-					localRepositories[k] = v
-				}
-				config.ActionCache = &runner.LocalRepositoryCache{
-					Parent:            config.ActionCache,
-					LocalRepositories: localRepositories,
-					CacheDirCache:     map[string]string{},
-				}
-			}
+		if err := useRunSecret(input); err != nil {
+			return err
 		}
+		config, err := newRunnerConfig(input, envs, inputs, secrets, vars)
+		if err != nil {
+			return err
+		}
+		config.EventName = eventName
+		config.EventPath = input.EventPath()
+		config.DefaultBranch = defaultbranch
+		config.ReuseContainers = input.reuseContainers
+		config.Privileged = input.privileged
+		config.UsernsMode = input.usernsMode
+		config.UseGitIgnore = input.useGitIgnore
+		config.ContainerCapAdd = input.containerCapAdd
+		config.ContainerCapDrop = input.containerCapDrop
+		config.AutoRemove = input.autoRemove
+		config.RemoteName = input.remoteName
+		config.ReplaceGheActionWithGithubCom = input.replaceGheActionWithGithubCom
+		config.ReplaceGheActionTokenWithGithubCom = input.replaceGheActionTokenWithGithubCom
+		config.Matrix = matrixes
+		config.Steps = input.steps
+		config.SkipSteps = input.skipSteps
+		config.FromStep = input.fromStep
+		config.UntilStep = input.untilStep
+		config.SkippedStepOutputs = stepOutputs
 		r, err := runner.New(config)
 		if err != nil {
 			return err
 		}
 
-		cancel := artifacts.Serve(ctx, input.artifactServerPath, input.artifactServerAddr, input.artifactServerPort)
+		cancel, err := startArtifactServer(ctx, input, config, envs)
+		if err != nil {
+			return err
+		}
 
 		const cacheURLKey = "ACTIONS_CACHE_URL"
 		var cacheHandler *artifactcache.Handler
-		if !input.noCacheServer && envs[cacheURLKey] == "" {
+		if !input.noCacheServer && envs[cacheURLKey] == "" && input.cacheServerURL != "" {
+			useCacheServerURL(input, envs)
+		} else if !input.noCacheServer && envs[cacheURLKey] == "" {
 			var err error
-			cacheHandler, err = artifactcache.StartHandler(input.cacheServerPath, input.cacheServerAddr, input.cacheServerPort, common.Logger(ctx))
+			cacheHandler, err = startCacheHandler(ctx, input)
 			if err != nil {
 				return err
 			}
 			envs[cacheURLKey] = cacheHandler.ExternalURL() + "/"
+			if err := serveResultsFromCache(cacheHandler, input, envs); err != nil {
+				return err
+			}
 		}
 
 		ctx = common.WithDryrun(ctx, input.dryrun)
@@ -645,6 +717,7 @@ func newRunCommand(ctx context.Context, input *Input) func(*cobra.Command, []str
 		executor := r.NewPlanExecutor(plan).Finally(func(ctx context.Context) error {
 			cancel()
 			_ = cacheHandler.Close()
+			pruneActionCacheIfDue(ctx, input)
 			return nil
 		})
 		err = executor(ctx)
@@ -655,6 +728,208 @@ func newRunCommand(ctx context.Context, input *Input) func(*cobra.Command, []str
 	}
 }
 
+// useRunSecret signs the runtime tokens of the jobs with a secret of the run when act starts their cache and artifact
+// servers itself, the servers accept the tokens signed with the empty secret otherwise, which any job can create
+func useRunSecret(input *Input) error {
+	if input.serverToken != "" || input.cacheServerURL != "" || input.artifactServerURL != "" {
+		return nil
+	}
+	secret, err := common.NewSecret()
+	if err != nil {
+		return err
+	}
+	input.serverToken = secret
+	return nil
+}
+
+// newRunnerConfig returns the config of the runner of the flags shared by the run and test commands
+func newRunnerConfig(input *Input, envs, inputs, secrets, vars map[string]string) (*runner.Config, error) {
+	config := &runner.Config{
+		Actor:                 input.actor,
+		DefaultBranch:         input.defaultBranch,
+		ForcePull:             !input.actionOfflineMode && input.forcePull,
+		ForceRebuild:          input.forceRebuild,
+		Workdir:               input.Workdir(),
+		ActionCacheDir:        input.actionCachePath,
+		ActionOfflineMode:     input.actionOfflineMode,
+		BindWorkdir:           input.bindWorkdir,
+		LogOutput:             !input.noOutput,
+		JSONLogger:            input.jsonLogger,
+		LogPrefixJobID:        input.logPrefixJobID,
+		Env:                   envs,
+		Secrets:               secrets,
+		Vars:                  vars,
+		Inputs:                inputs,
+		Token:                 secrets["GITHUB_TOKEN"],
+		InsecureSecrets:       input.insecureSecrets,
+		Platforms:             input.newPlatforms(),
+		ContainerArchitecture: input.containerArchitecture,
+		ContainerDaemonSocket: input.containerDaemonSocket,
+		ContainerOptions:      input.containerOptions,
+		GitHubInstance:        input.githubInstance,
+		ArtifactServerPath:    input.artifactServerPath,
+		ArtifactServerAddr:    input.artifactServerAddr,
+		ArtifactServerPort:    input.artifactServerPort,
+		ArtifactServerURL:     input.artifactServerURL,
+		ServerToken:           input.serverToken,
+		NoSkipCheckout:        input.noSkipCheckout,
+		ContainerNetworkMode:  docker_container.NetworkMode(input.networkName),
+		RegistryMirrors:       input.newRegistryMirrors(),
+		DockerBuildTargets:    input.DockerBuildTargets(),
+		DockerBuildSecrets:    input.DockerBuildSecrets(),
+		ActionCache:           newActionCache(input),
+	}
+	var err error
+	if config.ActionMocks, err = readActionMocks(input.MockActionsFile()); err != nil {
+		return nil, err
+	}
+	if input.locked {
+		if config.ActionLockfile, err = runner.ReadLockfile(input.Lockfile()); err != nil {
+			return nil, err
+		}
+	}
+	if config.ActionPolicy, err = readActionPolicy(input.ActionPolicyFile()); err != nil {
+		return nil, err
+	}
+	if config.NodeRuntimes, err = parseNodeRuntimes(input.nodeRuntimes); err != nil {
+		return nil, err
+	}
+	if config.DefaultPermissions, err = model.DefaultPermissions(input.defaultTokenPermissions); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// startArtifactServer starts the artifact server of the jobs if --artifact-server-path is set and the token proxy if --github-token-proxy is set
+func startArtifactServer(ctx context.Context, input *Input, config *runner.Config, envs map[string]string) (context.CancelFunc, error) {
+	var err error
+	artifactOptions := artifacts.Options{RetentionDays: input.artifactServerRetentionDays}
+	if input.artifactServerURL == "" {
+		artifactOptions.Secret = input.serverToken
+	}
+	if input.artifactServerPath != "" {
+		if artifactOptions.Storage, err = openArtifactStorage(input); err != nil {
+			return nil, err
+		}
+		if err := setOIDCOptions(input, &artifactOptions); err != nil {
+			return nil, err
+		}
+		// the OIDC request tokens of the artifact server of this run are signed with a secret of the run
+		if input.serverToken == "" && input.artifactServerURL == "" {
+			if artifactOptions.OIDCSecret, err = common.NewSecret(); err != nil {
+				return nil, err
+			}
+			config.OIDCSecret = artifactOptions.OIDCSecret
+		}
+	}
+	// the artifact server forwards the requests of the REST API to the token proxy
+	if input.githubTokenProxy {
+		if err := startTokenProxy(ctx, input, config, envs); err != nil {
+			return nil, err
+		}
+	}
+	if input.artifactServerGitHubAPI {
+		useArtifactServerAPI(input, config, envs, &artifactOptions)
+	}
+	return artifacts.Serve(ctx, input.artifactServerPath, input.artifactServerAddr, input.artifactServerPort, artifactOptions), nil
+}
+
+// startTokenProxy starts the proxy of the GitHub API the jobs use as GITHUB_API_URL with a GITHUB_TOKEN scoped to their
+// permissions, it forwards their requests to the GitHub API of the jobs with the real token until ctx is done.
+// The scoped token is only valid for the proxy, the jobs can't use it for git or for ghcr.io, act's own clones of
+// actions and reusable workflows keep using the real token.
+func startTokenProxy(ctx context.Context, input *Input, config *runner.Config, envs map[string]string) error {
+	upstream := config.GetGitHubApiServerUrl()
+	if envs["GITHUB_API_URL"] != "" {
+		upstream = envs["GITHUB_API_URL"]
+	}
+	// the scoped tokens are signed with a secret of the run, nobody else can sign tokens the proxy accepts
+	secret, err := common.NewSecret()
+	if err != nil {
+		return err
+	}
+	handler, err := tokenproxy.NewHandler(upstream, config.Token, secret)
+	if err != nil {
+		return err
+	}
+
+	// the job containers reach the host at the gateway of the docker bridge, the other machines of the network don't
+	ip, err := container.DockerBridgeGateway(ctx)
+	if err != nil {
+		ip = common.GetOutboundIP()
+		log.Warnf("The GitHub token proxy listens on %s, which other machines of the network may reach: %v", ip, err)
+	}
+	ready := make(chan string, 1)
+	errs := make(chan error, 1)
+	go func() {
+		serverConfig := common.ServerConfig{Addr: net.JoinHostPort(ip.String(), "0")}
+		errs <- common.ListenAndServe(ctx, serverConfig, handler, func(listener net.Listener) {
+			ready <- "http://" + listener.Addr().String()
+		})
+	}()
+	select {
+	case url := <-ready:
+		log.Debugf("Start GitHub token proxy on %s for %s", url, upstream)
+		envs["GITHUB_API_URL"] = url
+		config.TokenProxySecret = secret
+		return nil
+	case err := <-errs:
+		return fmt.Errorf("failed to start the GitHub token proxy: %w", err)
+	}
+}
+
+// useArtifactServerAPI points GITHUB_API_URL of the jobs to the artifact server, which forwards the requests other than
+// the ones of its artifacts to the GitHub API the jobs would use otherwise
+func useArtifactServerAPI(input *Input, config *runner.Config, envs map[string]string, options *artifacts.Options) {
+	options.GitHubAPIURL = config.GetGitHubApiServerUrl()
+	if envs["GITHUB_API_URL"] != "" {
+		options.GitHubAPIURL = envs["GITHUB_API_URL"]
+	}
+	if input.artifactServerURL != "" {
+		envs["GITHUB_API_URL"] = strings.TrimSuffix(input.artifactServerURL, "/")
+	} else if input.artifactServerPath != "" {
+		envs["GITHUB_API_URL"] = fmt.Sprintf("http://%s:%s", input.artifactServerAddr, input.artifactServerPort)
+	}
+}
+
+// newActionCache returns the ActionCache selected by the flags or nil to use the default cache
+func newActionCache(input *Input) runner.ActionCache {
+	// the lockfile can only be checked for drift and the policy of nested actions only be checked with the ActionCache
+	if !input.useNewActionCache && len(input.localRepository) == 0 && !input.locked && input.actionPolicyFile == "" && !input.actionCacheTarball {
+		return nil
+	}
+	var actionCache runner.ActionCache
+	if input.actionCacheTarball {
+		actionCache = &runner.TarballActionCache{
+			Path:   filepath.Join(input.actionCachePath, "tarball"),
+			APIURL: (&runner.Config{GitHubInstance: input.githubInstance}).GetGitHubApiServerUrl(),
+		}
+	} else if input.actionOfflineMode {
+		actionCache = &runner.GoGitActionCacheOfflineMode{
+			Parent: runner.GoGitActionCache{
+				Path: input.actionCachePath,
+			},
+		}
+	} else {
+		actionCache = &runner.GoGitActionCache{
+			Path: input.actionCachePath,
+		}
+	}
+	if len(input.localRepository) > 0 {
+		localRepositories := map[string]string{}
+		for _, l := range input.localRepository {
+			k, v, _ := strings.Cut(l, "=")
+			localRepositories[k] = v
+		}
+		actionCache = &runner.LocalRepositoryCache{
+			Parent:            actionCache,
+			LocalRepositories: localRepositories,
+			CacheDirCache:     map[string]string{},
+		}
+	}
+	return actionCache
+}
+
 func defaultImageSurvey(actrc string) error {
 	var answer string
 	confirmation := &survey.Select{
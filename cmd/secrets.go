@@ -1,12 +1,17 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/term"
+
+	"github.com/nektos/act/pkg/model"
+	"github.com/nektos/act/pkg/secretprovider"
 )
 
 type secrets map[string]string
@@ -40,3 +45,47 @@ func newSecrets(secretList []string) secrets {
 func (s secrets) AsMap() map[string]string {
 	return s
 }
+
+// implicitSecrets are the secrets act reads without a reference of the workflows
+var implicitSecrets = []string{"GITHUB_TOKEN", "DOCKER_USERNAME", "DOCKER_PASSWORD"}
+
+// resolveSecrets fetches the secrets of --secret-provider the plan references and adds them to the secrets, the
+// secrets of -s and --secret-file take precedence
+func resolveSecrets(ctx context.Context, input *Input, plan *model.Plan, secrets secrets) error {
+	if len(input.secretProviders) == 0 || plan == nil {
+		return nil
+	}
+	options := secretprovider.Options{KeyFile: input.SecretKeyFile(), GitHubInstance: input.githubInstance}
+	rules := make([]*secretprovider.Rule, 0, len(input.secretProviders))
+	for _, spec := range input.secretProviders {
+		rule, err := secretprovider.ParseRule(spec, options)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, rule)
+	}
+	resolver := secretprovider.NewResolver(rules...)
+
+	names, all := plan.SecretNames()
+	if all {
+		log.Debugf("The workflows may read any secret, the secret providers of a prefix only fetch the secrets they reference by name")
+		names = append(names, resolver.Names()...)
+	}
+	for _, name := range input.DockerBuildSecrets() {
+		names = append(names, name)
+	}
+	if err := resolver.Resolve(ctx, names, secrets); err != nil {
+		return err
+	}
+	// the implicit secrets are optional, a failing provider doesn't fail the run. The workflows don't reference them,
+	// so only the rules naming them fetch them and not the rules of a prefix or all secrets
+	for _, name := range resolver.Names() {
+		if !slices.Contains(implicitSecrets, name) {
+			continue
+		}
+		if err := resolver.Resolve(ctx, []string{name}, secrets); err != nil {
+			log.Debugf("Failed to fetch implicit secret: %v", err)
+		}
+	}
+	return nil
+}
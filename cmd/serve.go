@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/nektos/act/pkg/artifactcache"
+	"github.com/nektos/act/pkg/artifacts"
+	"github.com/nektos/act/pkg/common"
+)
+
+// serveInput are the flags of the long-running servers
+type serveInput struct {
+	addr            string
+	externalURL     string
+	tlsCert         string
+	tlsKey          string
+	shutdownTimeout time.Duration
+	forwardResults  string
+	forwardAPI      string
+}
+
+func (s *serveInput) addFlags(cmd *cobra.Command, defaultAddr string) {
+	cmd.Flags().StringVar(&s.addr, "addr", defaultAddr, "Address the server listens on")
+	cmd.Flags().StringVar(&s.externalURL, "external-url", "", "URL the jobs reach the server at, e.g. behind a reverse proxy. Defaults to the outbound IP and the port of --addr.")
+	cmd.Flags().StringVar(&s.tlsCert, "tls-cert", "", "Certificate file to serve https, requires --tls-key")
+	cmd.Flags().StringVar(&s.tlsKey, "tls-key", "", "Private key file of --tls-cert")
+	cmd.Flags().DurationVar(&s.shutdownTimeout, "shutdown-timeout", 30*time.Second, "Time the requests in progress get to complete on shutdown")
+}
+
+func newServeCacheCommand(ctx context.Context, input *Input) *cobra.Command {
+	serve := &serveInput{}
+	cmd := &cobra.Command{
+		Use:          "serve-cache",
+		Short:        "Run the cache server in --cache-server-path until interrupted, to share caches between act invocations and machines with --cache-server-url",
+		Args:         cobra.NoArgs,
+		RunE:         runServeCache(ctx, input, serve),
+		SilenceUsage: true,
+	}
+	serve.addFlags(cmd, ":8081")
+	cmd.Flags().StringVar(&serve.forwardResults, "forward-results", "", "URL of the artifact server the artifact service v4 is forwarded to, the cache server serves the results services of the jobs")
+	return cmd
+}
+
+func newServeArtifactsCommand(ctx context.Context, input *Input) *cobra.Command {
+	serve := &serveInput{}
+	cmd := &cobra.Command{
+		Use:          "serve-artifacts",
+		Short:        "Run the artifact server in --artifact-server-path or --artifact-server-storage until interrupted, to share artifacts between act invocations and machines with --artifact-server-url",
+		Args:         cobra.NoArgs,
+		RunE:         runServeArtifacts(ctx, input, serve),
+		SilenceUsage: true,
+	}
+	serve.addFlags(cmd, ":34567")
+	cmd.Flags().StringVar(&serve.forwardAPI, "forward-api", "", "URL of the GitHub API, e.g. https://api.github.com, the requests of the REST API are forwarded to. The server serves its artifacts in the REST API for download-artifact's run-id input, to jobs using it as GITHUB_API_URL.")
+	return cmd
+}
+
+func runServeCache(ctx context.Context, input *Input, serve *serveInput) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if input.jsonLogger {
+			log.SetFormatter(&log.JSONFormatter{})
+		}
+		policy, err := cacheServerPolicy(input)
+		if err != nil {
+			return err
+		}
+		storage, err := artifactcache.OpenStorage(input.cacheServerPath, input.cacheServerStorage)
+		if err != nil {
+			return err
+		}
+		handler, err := artifactcache.NewHandler(input.cacheServerPath, storage, log.StandardLogger())
+		if err != nil {
+			return err
+		}
+		handler.SetPolicy(policy)
+		if input.serverToken != "" {
+			handler.RequireAuthorization(input.serverToken)
+		} else {
+			log.Warn("No --server-token, the cache server accepts the requests of anyone who can reach it")
+		}
+		if serve.forwardResults != "" {
+			if err := handler.ForwardResults(serve.forwardResults); err != nil {
+				return err
+			}
+		}
+		return serve.listenAndServe(ctx, "cache", handler, handler.SetExternalURL)
+	}
+}
+
+func runServeArtifacts(ctx context.Context, input *Input, serve *serveInput) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if input.jsonLogger {
+			log.SetFormatter(&log.JSONFormatter{})
+		}
+		storage, err := openArtifactStorage(input)
+		if err != nil {
+			return err
+		}
+		if input.serverToken == "" {
+			// anyone could request OIDC tokens signed with the key
+			if input.oidcSigningKey != "" {
+				return fmt.Errorf("--oidc-signing-key needs --server-token")
+			}
+			log.Warn("No --server-token, the artifact server accepts the requests of anyone who can reach it and issues no OIDC tokens")
+		}
+		options := artifacts.Options{
+			Secret:        input.serverToken,
+			RetentionDays: input.artifactServerRetentionDays,
+			GitHubAPIURL:  serve.forwardAPI,
+			Storage:       storage,
+		}
+		if err := setOIDCOptions(input, &options); err != nil {
+			return err
+		}
+		handler, err := artifacts.NewHandler(input.artifactServerPath, options)
+		if err != nil {
+			return err
+		}
+		// the artifact server derives its urls from the requests, it doesn't need the external url
+		return serve.listenAndServe(ctx, "artifacts", handler, nil)
+	}
+}
+
+// listenAndServe serves the handler with access logs until ctx is done, setExternalURL is called with the url of the server
+func (s *serveInput) listenAndServe(ctx context.Context, name string, handler http.Handler, setExternalURL func(string)) error {
+	config := common.ServerConfig{
+		Addr:            s.addr,
+		TLSCertFile:     s.tlsCert,
+		TLSKeyFile:      s.tlsKey,
+		ShutdownTimeout: s.shutdownTimeout,
+	}
+	logger := log.WithField("server", name)
+	err := common.ListenAndServe(ctx, config, common.AccessLog(logger, handler), func(listener net.Listener) {
+		url := s.externalURL
+		if url == "" {
+			scheme := "http"
+			if s.tlsCert != "" {
+				scheme = "https"
+			}
+			url = fmt.Sprintf("%s://%s:%d", scheme, common.GetOutboundIP(), listener.Addr().(*net.TCPAddr).Port)
+		}
+		url = strings.TrimSuffix(url, "/")
+		if setExternalURL != nil {
+			setExternalURL(url)
+		}
+		logger.Infof("Listening on %s, reachable at %s", listener.Addr(), url)
+	})
+	if err != nil {
+		return err
+	}
+	logger.Info("Shut down")
+	return nil
+}
+
+// useCacheServerURL points the jobs to a running cache server, which serves the cache service v2 as the results service
+// unless the artifact server of this invocation serves it
+func useCacheServerURL(input *Input, envs map[string]string) {
+	url := strings.TrimSuffix(input.cacheServerURL, "/") + "/"
+	envs["ACTIONS_CACHE_URL"] = url
+	if envs["ACTIONS_RESULTS_URL"] == "" && input.artifactServerPath == "" {
+		envs["ACTIONS_RESULTS_URL"] = url
+		envs["ACTIONS_CACHE_SERVICE_V2"] = "true"
+	}
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/nektos/act/pkg/common"
+	"github.com/nektos/act/pkg/container"
+	"github.com/nektos/act/pkg/model"
+	"github.com/nektos/act/pkg/workflowtest"
+)
+
+func newTestCommand(ctx context.Context, input *Input) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "test [path to test case file or directory]",
+		Short:        "Run the workflows for every test case and check job results, outputs, step conclusions, annotations and summaries",
+		Args:         cobra.MaximumNArgs(1),
+		RunE:         runTests(ctx, input),
+		SilenceUsage: true,
+	}
+	cmd.Flags().StringArrayVarP(&input.platforms, "platform", "P", []string{}, "custom image to use per platform (e.g. -P ubuntu-18.04=nektos/act-environments-ubuntu:18.04)")
+	cmd.Flags().StringArrayVarP(&input.secrets, "secret", "s", []string{}, "secret to make available to actions with optional value (e.g. -s mysecret=foo or -s mysecret)")
+	cmd.Flags().StringArrayVar(&input.vars, "var", []string{}, "variable to make available to actions with optional value (e.g. --var myvar=foo or --var myvar)")
+	cmd.Flags().BoolVarP(&input.bindWorkdir, "bind", "b", false, "bind working directory to container, rather than copy")
+	cmd.Flags().BoolVarP(&input.forcePull, "pull", "p", true, "pull docker image(s) even if already present")
+	cmd.Flags().BoolVarP(&input.forceRebuild, "rebuild", "", false, "rebuild action docker image(s) even if an image of the same build context is already present")
+	cmd.Flags().StringArrayVarP(&input.dockerBuildTargets, "docker-build-target", "", []string{}, "build stage of the Dockerfile of docker actions, optionally per uses: pattern (e.g. --docker-build-target release or --docker-build-target octo/*=release)")
+	cmd.Flags().StringArrayVarP(&input.dockerBuildSecrets, "docker-build-secret", "", []string{}, "pass a secret to docker action builds as BuildKit secret, optionally under another id (e.g. --docker-build-secret NPM_TOKEN or --docker-build-secret npm_token=NPM_TOKEN)")
+	cmd.Flags().BoolVar(&input.locked, "locked", false, "use only the commit SHAs of the lockfile for remote actions and reusable workflows and fail if a ref is missing or has moved")
+	cmd.Flags().StringVar(&input.mockActionsFile, "mock-actions-file", "", "YAML or JSON file with stubs used instead of actions, docker images and reusable workflows by uses: pattern, test cases can add their own mocks")
+	cmd.Flags().BoolVarP(&input.useNewActionCache, "use-new-action-cache", "", false, "Enable using the new Action Cache for storing Actions locally")
+	cmd.Flags().StringArrayVarP(&input.localRepository, "local-repository", "", []string{}, "Replaces the specified repository and ref with a local folder (e.g. https://github.com/test/test@v0=/home/act/test or test/test@v0=/home/act/test, the latter matches any hosts or protocols)")
+	return cmd
+}
+
+func runTests(ctx context.Context, input *Input) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if input.jsonLogger {
+			log.SetFormatter(&log.JSONFormatter{})
+		}
+
+		casesPath := "./.github/act-tests/"
+		if len(args) > 0 {
+			casesPath = args[0]
+		}
+		cases, err := workflowtest.ReadCases(input.resolve(casesPath))
+		if err != nil {
+			return err
+		}
+		if len(cases) == 0 {
+			return fmt.Errorf("no test cases found in %s", casesPath)
+		}
+
+		if !input.dryrun {
+			if ret, err := container.GetSocketAndHost(input.containerDaemonSocket); err != nil {
+				log.Warnf("Couldn't get a valid docker connection: %+v", err)
+			} else {
+				os.Setenv("DOCKER_HOST", ret.Host)
+				input.containerDaemonSocket = ret.Socket
+			}
+		}
+
+		envs := map[string]string{}
+		_ = readEnvs(input.Envfile(), envs)
+		inputs := map[string]string{}
+		_ = readEnvs(input.Inputfile(), inputs)
+		secrets := newSecrets(input.secrets)
+		_ = readEnvs(input.Secretfile(), secrets)
+		// the secrets of the providers are fetched once for the workflows of every case
+		planner, err := model.NewWorkflowPlanner(input.WorkflowsPath(), input.noWorkflowRecurse)
+		if err != nil {
+			return err
+		}
+		plan, err := planner.PlanAll()
+		if plan == nil && err != nil {
+			return err
+		}
+		if err := resolveSecrets(ctx, input, plan, secrets); err != nil {
+			return err
+		}
+		vars := newSecrets(input.vars)
+		_ = readEnvs(input.Varfile(), vars)
+
+		if err := useRunSecret(input); err != nil {
+			return err
+		}
+		const cacheURLKey = "ACTIONS_CACHE_URL"
+		if !input.noCacheServer && !input.dryrun && envs[cacheURLKey] == "" && input.cacheServerURL != "" {
+			useCacheServerURL(input, envs)
+		} else if !input.noCacheServer && !input.dryrun && envs[cacheURLKey] == "" {
+			cacheHandler, err := startCacheHandler(ctx, input)
+			if err != nil {
+				return err
+			}
+			defer cacheHandler.Close()
+			envs[cacheURLKey] = cacheHandler.ExternalURL() + "/"
+			if err := serveResultsFromCache(cacheHandler, input, envs); err != nil {
+				return err
+			}
+		}
+
+		config, err := newRunnerConfig(input, envs, inputs, secrets, vars)
+		if err != nil {
+			return err
+		}
+		// the test cases run with the defaults of the flags of the run command the test command doesn't have
+		config.UseGitIgnore = true
+		config.AutoRemove = true
+		config.RemoteName = "origin"
+		cancel, err := startArtifactServer(ctx, input, config, envs)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		opts := workflowtest.Options{
+			WorkflowsPath:     input.WorkflowsPath(),
+			NoWorkflowRecurse: input.noWorkflowRecurse,
+		}
+
+		ctx := common.WithDryrun(ctx, input.dryrun)
+		failed := 0
+		for _, c := range cases {
+			result := workflowtest.Run(ctx, opts, *config, c)
+			if result.Passed() {
+				fmt.Fprintf(os.Stdout, "PASS  %s\n", c)
+				continue
+			}
+			failed++
+			fmt.Fprintf(os.Stdout, "FAIL  %s\n", c)
+			if result.Err != nil {
+				fmt.Fprintf(os.Stdout, "      %v\n", result.Err)
+			}
+			for _, failure := range result.Failures {
+				fmt.Fprintf(os.Stdout, "      %s\n", failure)
+			}
+		}
+		fmt.Fprintf(os.Stdout, "%d passed, %d failed\n", len(cases)-failed, failed)
+		if failed > 0 {
+			return fmt.Errorf("%d of %d test cases failed", failed, len(cases))
+		}
+		return nil
+	}
+}
@@ -2,7 +2,16 @@
 //
 // Inspired by https://github.com/sp-ricard-valverde/github-act-cache-server
 //
-// TODO: Authorization
-// TODO: Restrictions for accessing a cache, see https://docs.github.com/en/actions/using-workflows/caching-dependencies-to-speed-up-workflows#restrictions-for-accessing-a-cache
-// TODO: Force deleting cache entries, see https://docs.github.com/en/actions/using-workflows/caching-dependencies-to-speed-up-workflows#force-deleting-cache-entries
+// Caches are scoped by the refs of the runtime token like on GitHub, see https://docs.github.com/en/actions/using-workflows/caching-dependencies-to-speed-up-workflows#restrictions-for-accessing-a-cache
+//
+// The caches of a repository are limited to Policy.MaxRepositorySize, the least recently used caches are evicted first.
+// They can be listed and force deleted with the management API under /_apis/artifactcache/manage/caches,
+// see https://docs.github.com/en/actions/using-workflows/caching-dependencies-to-speed-up-workflows#force-deleting-cache-entries,
+// which is served to the clients of the same machine only unless the handler requires authorization, then a runtime
+// token manages the caches of its repository only. `act cache` manages all caches of the directory of a server.
+//
+// The index of the caches is kept in the directory of the handler, their contents in a Storage: the same directory,
+// another directory or an S3 compatible bucket, see OpenStorage. The index is a bolt database whose file lock is not
+// reliable on network file systems, so a directory and its Storage must be used by the handler of one host only.
+// Several machines share the caches by using one cache server, e.g. `act serve-cache` with `act --cache-server-url`.
 package artifactcache
@@ -1,6 +1,8 @@
 package artifactcache
 
 import (
+	"crypto/rand"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,6 +14,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -29,20 +32,70 @@ const (
 
 type Handler struct {
 	dir      string
-	storage  *Storage
+	storage  Storage
 	router   *httprouter.Router
 	listener net.Listener
 	server   *http.Server
 	logger   logrus.FieldLogger
 
-	gcing atomic.Bool
-	gcAt  time.Time
+	gcing   atomic.Bool
+	gcRerun atomic.Bool // requests another run of the running gc, see SetPolicy
+	mu      sync.Mutex  // guards gcAt and policy, SetPolicy may be called while the handler serves requests
+	gcAt    time.Time
+	policy  Policy
 
-	outboundIP string
+	outboundIP  string
+	externalURL string       // overrides the url of the listener, see SetExternalURL
+	authSecret  string       // requires runtime tokens signed with it, see RequireAuthorization
+	handler     http.Handler // the router, behind the authorization if required
+
+	signKey      []byte       // signs the upload and download urls of the cache service v2
+	resultsProxy http.Handler // forwards the requests for other results services, see ForwardResults
 }
 
 func StartHandler(dir, outboundIP string, port uint16, logger logrus.FieldLogger) (*Handler, error) {
-	h := &Handler{}
+	return StartHandlerWithStorage(dir, nil, outboundIP, port, logger)
+}
+
+// StartHandlerWithStorage starts a handler which keeps the index of the caches in dir and their contents in storage,
+// see OpenStorage. The contents are kept in dir too if storage is nil.
+func StartHandlerWithStorage(dir string, storage Storage, outboundIP string, port uint16, logger logrus.FieldLogger) (*Handler, error) {
+	h, err := NewHandler(dir, storage, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if outboundIP != "" {
+		h.outboundIP = outboundIP
+	} else if ip := common.GetOutboundIP(); ip == nil {
+		return nil, fmt.Errorf("unable to determine outbound IP address")
+	} else {
+		h.outboundIP = ip.String()
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port)) // listen on all interfaces
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{
+		ReadHeaderTimeout: 2 * time.Second,
+		Handler:           h,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && errors.Is(err, net.ErrClosed) {
+			h.logger.Errorf("http serve: %v", err)
+		}
+	}()
+	h.listener = listener
+	h.server = server
+
+	return h, nil
+}
+
+// NewHandler returns a handler which is not listening, to be served by a long-running server like `act serve-cache`.
+// The server has to set the url the runners reach it at with SetExternalURL.
+func NewHandler(dir string, storage Storage, logger logrus.FieldLogger) (*Handler, error) {
+	h := &Handler{policy: DefaultPolicy}
 
 	if logger == nil {
 		discard := logrus.New()
@@ -65,19 +118,18 @@ func StartHandler(dir, outboundIP string, port uint16, logger logrus.FieldLogger
 
 	h.dir = dir
 
-	storage, err := NewStorage(filepath.Join(dir, "cache"))
-	if err != nil {
+	h.signKey = make([]byte, 32)
+	if _, err := rand.Read(h.signKey); err != nil {
 		return nil, err
 	}
-	h.storage = storage
 
-	if outboundIP != "" {
-		h.outboundIP = outboundIP
-	} else if ip := common.GetOutboundIP(); ip == nil {
-		return nil, fmt.Errorf("unable to determine outbound IP address")
-	} else {
-		h.outboundIP = ip.String()
+	if storage == nil {
+		var err error
+		if storage, err = OpenStorage(dir, ""); err != nil {
+			return nil, err
+		}
 	}
+	h.storage = storage
 
 	router := httprouter.New()
 	router.GET(urlBase+"/cache", h.middleware(h.find))
@@ -86,32 +138,44 @@ func StartHandler(dir, outboundIP string, port uint16, logger logrus.FieldLogger
 	router.POST(urlBase+"/caches/:id", h.middleware(h.commit))
 	router.GET(urlBase+"/artifacts/:id", h.middleware(h.get))
 	router.POST(urlBase+"/clean", h.middleware(h.clean))
+	h.routesV2(router)
+	h.routesManage(router)
 
 	h.router = router
+	h.handler = router
 
 	h.gcCache()
 
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port)) // listen on all interfaces
-	if err != nil {
-		return nil, err
-	}
-	server := &http.Server{
-		ReadHeaderTimeout: 2 * time.Second,
-		Handler:           router,
-	}
-	go func() {
-		if err := server.Serve(listener); err != nil && errors.Is(err, net.ErrClosed) {
-			logger.Errorf("http serve: %v", err)
+	return h, nil
+}
+
+// SetExternalURL sets the url the runners reach the handler at, instead of the outbound IP and the port of its listener.
+func (h *Handler) SetExternalURL(url string) {
+	h.externalURL = strings.TrimSuffix(url, "/")
+}
+
+// RequireAuthorization rejects the requests without a runtime token signed with the secret, see
+// common.CreateRuntimeToken. The downloads and uploads of the archives are authorized by signed urls instead,
+// the requests forwarded to other results services by those services, see ForwardResults.
+func (h *Handler) RequireAuthorization(secret string) {
+	h.authSecret = secret
+	h.handler = common.RequireAuthorization(secret, func(r *http.Request) bool {
+		if !strings.HasPrefix(r.URL.Path, urlBase+"/") && !strings.HasPrefix(r.URL.Path, twirpBase+"/") {
+			return true
 		}
-	}()
-	h.listener = listener
-	h.server = server
+		return strings.HasPrefix(r.URL.Path, urlBase+"/artifacts/") ||
+			r.URL.Path == twirpBase+"/UploadCache" || r.URL.Path == twirpBase+"/DownloadCache"
+	}, h.router)
+}
 
-	return h, nil
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.handler.ServeHTTP(w, r)
 }
 
 func (h *Handler) ExternalURL() string {
-	// TODO: make the external url configurable if necessary
+	if h.externalURL != "" {
+		return h.externalURL
+	}
 	return fmt.Sprintf("http://%s:%d",
 		h.outboundIP,
 		h.listener.Addr().(*net.TCPAddr).Port)
@@ -143,7 +207,13 @@ func (h *Handler) Close() error {
 }
 
 func (h *Handler) openDB() (*bolthold.Store, error) {
-	return bolthold.Open(filepath.Join(h.dir, "bolt.db"), 0o644, &bolthold.Options{
+	return openDB(h.dir)
+}
+
+// openDB opens the index of the caches of a cache server directory, the handler opens it for each request
+// so other processes like `act cache` can use it while the server is running
+func openDB(dir string) (*bolthold.Store, error) {
+	return bolthold.Open(filepath.Join(dir, "bolt.db"), 0o644, &bolthold.Options{
 		Encoder: json.Marshal,
 		Decoder: json.Unmarshal,
 		Options: &bbolt.Options{
@@ -162,6 +232,7 @@ func (h *Handler) find(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 		keys[i] = strings.ToLower(key)
 	}
 	version := r.URL.Query().Get("version")
+	scope := h.cacheScope(r)
 
 	db, err := h.openDB()
 	if err != nil {
@@ -170,7 +241,7 @@ func (h *Handler) find(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 	}
 	defer db.Close()
 
-	cache, err := findCache(db, keys, version)
+	cache, err := findCache(db, keys, version, scope.Repository, scope.Refs)
 	if err != nil {
 		h.responseJSON(w, r, 500, err)
 		return
@@ -188,9 +259,14 @@ func (h *Handler) find(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 		h.responseJSON(w, r, 204)
 		return
 	}
+	archiveLocation := fmt.Sprintf("%s%s/artifacts/%d", h.ExternalURL(), urlBase, cache.ID)
+	if h.authSecret != "" {
+		// the archives are downloaded without the runtime token
+		archiveLocation += "?" + h.signedQuery("artifacts", cache.ID)
+	}
 	h.responseJSON(w, r, 200, map[string]any{
 		"result":          "hit",
-		"archiveLocation": fmt.Sprintf("%s%s/artifacts/%d", h.ExternalURL(), urlBase, cache.ID),
+		"archiveLocation": archiveLocation,
 		"cacheKey":        cache.Key,
 	})
 }
@@ -206,6 +282,8 @@ func (h *Handler) reserve(w http.ResponseWriter, r *http.Request, _ httprouter.P
 	api.Key = strings.ToLower(api.Key)
 
 	cache := api.ToCache()
+	scope := h.cacheScope(r)
+	cache.Ref, cache.Repository = scope.WriteRef, scope.Repository
 	db, err := h.openDB()
 	if err != nil {
 		h.responseJSON(w, r, 500, err)
@@ -317,6 +395,7 @@ func (h *Handler) commit(w http.ResponseWriter, r *http.Request, params httprout
 		h.responseJSON(w, r, 500, err)
 		return
 	}
+	h.evictCaches(db, cache.Repository, cache.ID)
 
 	h.responseJSON(w, r, 200)
 }
@@ -328,6 +407,12 @@ func (h *Handler) get(w http.ResponseWriter, r *http.Request, params httprouter.
 		h.responseJSON(w, r, 400, err)
 		return
 	}
+	if h.authSecret != "" {
+		if err := h.checkSignature(r.URL.Query(), "artifacts", uint64(id)); err != nil {
+			h.responseJSON(w, r, 401, err)
+			return
+		}
+	}
 	h.useCache(id)
 	h.storage.Serve(w, r, uint64(id))
 }
@@ -348,16 +433,36 @@ func (h *Handler) middleware(handler httprouter.Handle) httprouter.Handle {
 	}
 }
 
+// findCache returns the latest complete cache of the repository matching the first of the keys, exactly or by prefix.
+// The refs are searched in their order, all keys of a ref before the next ref. If refs is nil the caches of all refs
+// are searched. The caches of other repositories are never found, they may share a cache server.
 // if not found, return (nil, nil) instead of an error.
-func findCache(db *bolthold.Store, keys []string, version string) (*Cache, error) {
+func findCache(db *bolthold.Store, keys []string, version, repository string, refs []string) (*Cache, error) {
+	if refs == nil {
+		return findCacheOfRef(db, keys, version, repository, nil)
+	}
+	for _, ref := range refs {
+		ref := ref
+		cache, err := findCacheOfRef(db, keys, version, repository, &ref)
+		if cache != nil || err != nil {
+			return cache, err
+		}
+	}
+	return nil, nil
+}
+
+func findCacheOfRef(db *bolthold.Store, keys []string, version, repository string, ref *string) (*Cache, error) {
+	query := func(key *bolthold.Query) *bolthold.Query {
+		q := key.And("Version").Eq(version).And("Repository").Eq(repository).And("Complete").Eq(true)
+		if ref != nil {
+			q = q.And("Ref").Eq(*ref)
+		}
+		return q.SortBy("CreatedAt").Reverse()
+	}
 	cache := &Cache{}
 	for _, prefix := range keys {
 		// if a key in the list matches exactly, don't return partial matches
-		if err := db.FindOne(cache,
-			bolthold.Where("Key").Eq(prefix).
-				And("Version").Eq(version).
-				And("Complete").Eq(true).
-				SortBy("CreatedAt").Reverse()); err == nil || !errors.Is(err, bolthold.ErrNotFound) {
+		if err := db.FindOne(cache, query(bolthold.Where("Key").Eq(prefix))); err == nil || !errors.Is(err, bolthold.ErrNotFound) {
 			if err != nil {
 				return nil, fmt.Errorf("find cache: %w", err)
 			}
@@ -368,11 +473,7 @@ func findCache(db *bolthold.Store, keys []string, version string) (*Cache, error
 		if err != nil {
 			continue
 		}
-		if err := db.FindOne(cache,
-			bolthold.Where("Key").RegExp(re).
-				And("Version").Eq(version).
-				And("Complete").Eq(true).
-				SortBy("CreatedAt").Reverse()); err != nil {
+		if err := db.FindOne(cache, query(bolthold.Where("Key").RegExp(re))); err != nil {
 			if errors.Is(err, bolthold.ErrNotFound) {
 				continue
 			}
@@ -383,15 +484,44 @@ func findCache(db *bolthold.Store, keys []string, version string) (*Cache, error
 	return nil, nil
 }
 
+// cacheScope returns the access of a request to the caches, see common.ParseCacheScope.
+// Requests without a valid token are unscoped and see the caches of all refs.
+func (h *Handler) cacheScope(r *http.Request) *common.CacheScope {
+	scope, err := common.ParseSignedCacheScope(r, h.authSecret)
+	if err != nil {
+		h.logger.Debugf("%s %s: unscoped request: %v", r.Method, r.RequestURI, err)
+		return &common.CacheScope{}
+	}
+	return scope
+}
+
+// insertCache inserts the cache with a random id. The ids name the contents in the storage, which the cache servers of
+// several machines with their own index may share, so they must not be handed out by a sequence of the index.
 func insertCache(db *bolthold.Store, cache *Cache) error {
-	if err := db.Insert(bolthold.NextSequence(), cache); err != nil {
-		return fmt.Errorf("insert cache: %w", err)
+	for {
+		id, err := newCacheID()
+		if err != nil {
+			return fmt.Errorf("insert cache: %w", err)
+		} else if id == 0 {
+			continue
+		}
+		cache.ID = id
+		if err := db.Insert(id, cache); errors.Is(err, bolthold.ErrKeyExists) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("insert cache: %w", err)
+		}
+		return nil
 	}
-	// write back id to db
-	if err := db.Update(cache.ID, cache); err != nil {
-		return fmt.Errorf("write back id to db: %w", err)
+}
+
+// newCacheID returns a random id of 53 bits, the cache ids are numbers in javascript
+func newCacheID() (uint64, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
 	}
-	return nil
+	return binary.BigEndian.Uint64(b[:]) >> 11, nil
 }
 
 func (h *Handler) useCache(id int64) {
@@ -408,28 +538,110 @@ func (h *Handler) useCache(id int64) {
 	_ = db.Update(cache.ID, cache)
 }
 
+// Policy limits the size and the age of the caches kept by the handler.
+type Policy struct {
+	MaxRepositorySize int64         // total size of the complete caches of a repository, the least recently used caches are evicted first, no limit if <= 0
+	KeepUnused        time.Duration // remove the caches which have not been used for this long, never if <= 0
+	KeepUsed          time.Duration // remove the caches which have been created this long ago, even if they are still used, never if <= 0
+}
+
+// DefaultPolicy is the policy of GitHub, 10 GB per repository and caches which have not been accessed in 7 days are removed.
+var DefaultPolicy = Policy{
+	MaxRepositorySize: 10 << 30,
+	KeepUnused:        7 * 24 * time.Hour,
+	KeepUsed:          30 * 24 * time.Hour,
+}
+
 const (
-	keepUsed   = 30 * 24 * time.Hour
-	keepUnused = 7 * 24 * time.Hour
-	keepTemp   = 5 * time.Minute
-	keepOld    = 5 * time.Minute
+	keepTemp = 5 * time.Minute
+	keepOld  = 5 * time.Minute
 )
 
-func (h *Handler) gcCache() {
-	if h.gcing.Load() {
+// SetPolicy replaces the policy of the handler and applies it to the existing caches immediately, or right after the
+// gc running meanwhile.
+func (h *Handler) SetPolicy(policy Policy) {
+	h.mu.Lock()
+	h.policy = policy
+	h.gcAt = time.Time{}
+	h.mu.Unlock()
+	h.gcRerun.Store(true)
+	h.gcCache()
+}
+
+func (h *Handler) currentPolicy() Policy {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.policy
+}
+
+// evictCaches removes the least recently used complete caches of a repository until its caches fit in
+// Policy.MaxRepositorySize. The cache with the id keep is never evicted, it has just been saved.
+func (h *Handler) evictCaches(db *bolthold.Store, repository string, keep uint64) {
+	policy := h.currentPolicy()
+	if policy.MaxRepositorySize <= 0 {
 		return
 	}
-	if !h.gcing.CompareAndSwap(false, true) {
+	var caches []*Cache
+	if err := db.Find(&caches, bolthold.
+		Where("Repository").Eq(repository).
+		And("Complete").Eq(true).
+		SortBy("UsedAt"),
+	); err != nil {
+		h.logger.Warnf("find caches: %v", err)
 		return
 	}
-	defer h.gcing.Store(false)
+	var total int64
+	for _, cache := range caches {
+		total += cache.Size
+	}
+	for _, cache := range caches {
+		if total <= policy.MaxRepositorySize {
+			break
+		}
+		if cache.ID == keep {
+			continue
+		}
+		h.storage.Remove(cache.ID)
+		if err := db.Delete(cache.ID, cache); err != nil {
+			h.logger.Warnf("delete cache: %v", err)
+			continue
+		}
+		total -= cache.Size
+		h.logger.Infof("evicted cache: %+v", cache)
+	}
+}
+
+// gcCache runs the gc unless one is running, the running one runs again if SetPolicy was called meanwhile
+func (h *Handler) gcCache() {
+	for {
+		if h.gcing.Load() {
+			return
+		}
+		if !h.gcing.CompareAndSwap(false, true) {
+			return
+		}
+		h.gcRerun.Store(false)
+		h.gcOnce()
+		h.gcing.Store(false)
+		if !h.gcRerun.Load() {
+			return
+		}
+	}
+}
 
-	if time.Since(h.gcAt) < time.Hour {
-		h.logger.Debugf("skip gc: %v", h.gcAt.String())
+func (h *Handler) gcOnce() {
+	h.mu.Lock()
+	gcAt, policy := h.gcAt, h.policy
+	due := time.Since(gcAt) >= time.Hour
+	if due {
+		h.gcAt = time.Now()
+	}
+	h.mu.Unlock()
+	if !due {
+		h.logger.Debugf("skip gc: %v", gcAt.String())
 		return
 	}
-	h.gcAt = time.Now()
-	h.logger.Debugf("gc: %v", h.gcAt.String())
+	h.logger.Debugf("gc: %v", time.Now().String())
 
 	db, err := h.openDB()
 	if err != nil {
@@ -456,45 +668,49 @@ func (h *Handler) gcCache() {
 	}
 
 	// Remove the old caches which have not been used recently.
-	caches = caches[:0]
-	if err := db.Find(&caches, bolthold.
-		Where("UsedAt").Lt(time.Now().Add(-keepUnused).Unix()),
-	); err != nil {
-		h.logger.Warnf("find caches: %v", err)
-	} else {
-		for _, cache := range caches {
-			h.storage.Remove(cache.ID)
-			if err := db.Delete(cache.ID, cache); err != nil {
-				h.logger.Warnf("delete cache: %v", err)
-				continue
+	if policy.KeepUnused > 0 {
+		caches = caches[:0]
+		if err := db.Find(&caches, bolthold.
+			Where("UsedAt").Lt(time.Now().Add(-policy.KeepUnused).Unix()),
+		); err != nil {
+			h.logger.Warnf("find caches: %v", err)
+		} else {
+			for _, cache := range caches {
+				h.storage.Remove(cache.ID)
+				if err := db.Delete(cache.ID, cache); err != nil {
+					h.logger.Warnf("delete cache: %v", err)
+					continue
+				}
+				h.logger.Infof("deleted cache: %+v", cache)
 			}
-			h.logger.Infof("deleted cache: %+v", cache)
 		}
 	}
 
 	// Remove the old caches which are too old.
-	caches = caches[:0]
-	if err := db.Find(&caches, bolthold.
-		Where("CreatedAt").Lt(time.Now().Add(-keepUsed).Unix()),
-	); err != nil {
-		h.logger.Warnf("find caches: %v", err)
-	} else {
-		for _, cache := range caches {
-			h.storage.Remove(cache.ID)
-			if err := db.Delete(cache.ID, cache); err != nil {
-				h.logger.Warnf("delete cache: %v", err)
-				continue
+	if policy.KeepUsed > 0 {
+		caches = caches[:0]
+		if err := db.Find(&caches, bolthold.
+			Where("CreatedAt").Lt(time.Now().Add(-policy.KeepUsed).Unix()),
+		); err != nil {
+			h.logger.Warnf("find caches: %v", err)
+		} else {
+			for _, cache := range caches {
+				h.storage.Remove(cache.ID)
+				if err := db.Delete(cache.ID, cache); err != nil {
+					h.logger.Warnf("delete cache: %v", err)
+					continue
+				}
+				h.logger.Infof("deleted cache: %+v", cache)
 			}
-			h.logger.Infof("deleted cache: %+v", cache)
 		}
 	}
 
-	// Remove the old caches with the same key and version, keep the latest one.
+	// Remove the old caches with the same key, version, ref and repository, keep the latest one.
 	// Also keep the olds which have been used recently for a while in case of the cache is still in use.
 	if results, err := db.FindAggregate(
 		&Cache{},
 		bolthold.Where("Complete").Eq(true),
-		"Key", "Version",
+		"Key", "Version", "Ref", "Repository",
 	); err != nil {
 		h.logger.Warnf("find aggregate caches: %v", err)
 	} else {
@@ -520,6 +736,21 @@ func (h *Handler) gcCache() {
 			}
 		}
 	}
+
+	// Evict the least recently used caches of the repositories over the quota, it may have been lowered.
+	if results, err := db.FindAggregate(
+		&Cache{},
+		bolthold.Where("Complete").Eq(true),
+		"Repository",
+	); err != nil {
+		h.logger.Warnf("find aggregate caches: %v", err)
+	} else {
+		for _, result := range results {
+			var repository string
+			result.Group(&repository)
+			h.evictCaches(db, repository, 0)
+		}
+	}
 }
 
 func (h *Handler) responseJSON(w http.ResponseWriter, r *http.Request, code int, v ...any) {
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -16,6 +17,8 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/timshannon/bolthold"
 	"go.etcd.io/bbolt"
+
+	"github.com/nektos/act/pkg/common"
 )
 
 func TestHandler(t *testing.T) {
@@ -630,8 +633,8 @@ func TestHandler_gcCache(t *testing.T) {
 				Key:       "test_key_3",
 				Version:   "test_version",
 				Complete:  true,
-				UsedAt:    now.Add(-(keepUnused + time.Second)).Unix(),
-				CreatedAt: now.Add(-(keepUnused + time.Hour)).Unix(),
+				UsedAt:    now.Add(-(DefaultPolicy.KeepUnused + time.Second)).Unix(),
+				CreatedAt: now.Add(-(DefaultPolicy.KeepUnused + time.Hour)).Unix(),
 			},
 			Kept: false,
 		},
@@ -642,7 +645,7 @@ func TestHandler_gcCache(t *testing.T) {
 				Version:   "test_version",
 				Complete:  true,
 				UsedAt:    now.Unix(),
-				CreatedAt: now.Add(-(keepUsed + time.Second)).Unix(),
+				CreatedAt: now.Add(-(DefaultPolicy.KeepUsed + time.Second)).Unix(),
 			},
 			Kept: false,
 		},
@@ -695,3 +698,305 @@ func TestHandler_gcCache(t *testing.T) {
 	}
 	require.NoError(t, db.Close())
 }
+
+func TestHandlerCacheScopes(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "artifactcache")
+	handler, err := StartHandler(dir, "", 0, nil)
+	require.NoError(t, err)
+	defer handler.Close()
+
+	base := fmt.Sprintf("%s%s", handler.ExternalURL(), urlBase)
+	version := "c19da02a2bd7e77277f1ac29ab45c09b7d46a4ee758284e26bb3045ad11d9d20"
+	token := func(refs ...string) string {
+		token, err := common.CreateRuntimeToken(common.RuntimeTokenOptions{Run: common.RunClaims{TaskID: 1, RunID: 1, JobID: 1}, CacheRefs: refs})
+		require.NoError(t, err)
+		return token
+	}
+	do := func(method, url, token string, body []byte) *http.Response {
+		req, err := http.NewRequest(method, url, bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes 0-%d/*", len(body)-1))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+	save := func(token, key string) {
+		body, err := json.Marshal(&Request{Key: key, Version: version, Size: int64(len(key))})
+		require.NoError(t, err)
+		resp := do(http.MethodPost, base+"/caches", token, body)
+		got := struct {
+			CacheID uint64 `json:"cacheId"`
+		}{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+		resp.Body.Close()
+		resp = do(http.MethodPatch, fmt.Sprintf("%s/caches/%d", base, got.CacheID), token, []byte(key))
+		resp.Body.Close()
+		require.Equal(t, 200, resp.StatusCode)
+		resp = do(http.MethodPost, fmt.Sprintf("%s/caches/%d", base, got.CacheID), token, nil)
+		resp.Body.Close()
+		require.Equal(t, 200, resp.StatusCode)
+	}
+	restore := func(token string, keys ...string) string {
+		resp := do(http.MethodGet, fmt.Sprintf("%s/cache?keys=%s&version=%s", base, strings.Join(keys, ","), version), token, nil)
+		defer resp.Body.Close()
+		if resp.StatusCode == 204 {
+			return ""
+		}
+		got := struct {
+			CacheKey string `json:"cacheKey"`
+		}{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+		return got.CacheKey
+	}
+
+	mainBranch := token("refs/heads/main")
+	featureA := token("refs/heads/feature-a", "refs/heads/main")
+	featureB := token("refs/heads/feature-b", "refs/heads/main")
+	pull := token("refs/pull/1/merge", "refs/heads/feature-a", "refs/heads/main")
+
+	// a fresh branch misses until the default branch has a cache
+	assert.Equal(t, "", restore(featureA, "deps-"))
+	save(mainBranch, "deps-main")
+	assert.Equal(t, "deps-main", restore(featureA, "deps-"))
+
+	// the entries of the branch take precedence, other feature branches never see them
+	save(featureA, "deps-a")
+	assert.Equal(t, "deps-a", restore(featureA, "deps-"))
+	assert.Equal(t, "deps-main", restore(featureB, "deps-"))
+	assert.Equal(t, "", restore(featureB, "deps-a"))
+	assert.Equal(t, "deps-main", restore(mainBranch, "deps-"))
+
+	// all keys are searched in a ref before the next ref
+	assert.Equal(t, "deps-a", restore(featureA, "deps-main", "deps-"))
+
+	// pull requests restore from the base branch
+	assert.Equal(t, "deps-a", restore(pull, "deps-"))
+
+	// unscoped requests see every ref
+	assert.NotEqual(t, "", restore("", "deps-a"))
+}
+
+func TestHandlerRepositories(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "artifactcache")
+	handler, err := StartHandler(dir, "", 0, nil)
+	require.NoError(t, err)
+	defer handler.Close()
+
+	base := handler.ExternalURL() + twirpBase
+	token := func(repository string) string {
+		token, err := common.CreateRuntimeToken(common.RuntimeTokenOptions{Run: common.RunClaims{TaskID: 1, RunID: 1, JobID: 1, Repository: repository}, CacheRefs: []string{"refs/heads/main"}})
+		require.NoError(t, err)
+		return token
+	}
+	repoA, repoB := token("octo/a"), token("octo/b")
+	save := func(token, content string) bool {
+		create := &CreateCacheEntryResponse{}
+		require.Equal(t, 200, postTwirpWithToken(t, base, token, "CreateCacheEntry", map[string]any{"key": "deps", "version": "v"}, create))
+		if !create.Ok {
+			return false
+		}
+		require.Equal(t, http.StatusCreated, putBlob(t, create.SignedUploadURL, []byte(content)))
+		finalize := &FinalizeCacheEntryUploadResponse{}
+		require.Equal(t, 200, postTwirpWithToken(t, base, token, "FinalizeCacheEntryUpload", map[string]any{"key": "deps", "sizeBytes": len(content), "version": "v"}, finalize))
+		return finalize.Ok
+	}
+	restore := func(token string) string {
+		resp := &GetCacheEntryDownloadURLResponse{}
+		require.Equal(t, 200, postTwirpWithToken(t, base, token, "GetCacheEntryDownloadURL", map[string]any{"key": "deps", "version": "v"}, resp))
+		if !resp.Ok {
+			return ""
+		}
+		get, err := http.Get(resp.SignedDownloadURL)
+		require.NoError(t, err)
+		defer get.Body.Close()
+		content, err := io.ReadAll(get.Body)
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	// the caches of the same key and ref of another repository are neither restored nor taken as duplicates
+	require.True(t, save(repoA, "a"))
+	assert.Equal(t, "", restore(repoB))
+	require.True(t, save(repoB, "b"))
+	assert.Equal(t, "a", restore(repoA))
+	assert.Equal(t, "b", restore(repoB))
+	assert.False(t, save(repoA, "a"))
+
+	// the caches api v1 is isolated too
+	req, err := http.NewRequest(http.MethodGet, handler.ExternalURL()+urlBase+"/cache?keys=deps&version=v", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token("octo/c"))
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 204, resp.StatusCode)
+}
+
+func TestHandlerRepositoryQuota(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "artifactcache")
+	handler, err := StartHandler(dir, "", 0, nil)
+	require.NoError(t, err)
+	defer handler.Close()
+	handler.SetPolicy(Policy{MaxRepositorySize: 250})
+
+	now := time.Now()
+	old := []*Cache{
+		{Key: "least-recently-used", Version: "v", Repository: "octo/repo", Size: 100, Complete: true, UsedAt: now.Add(-2 * time.Hour).Unix(), CreatedAt: now.Add(-time.Hour).Unix()},
+		{Key: "recently-used", Version: "v", Repository: "octo/repo", Size: 100, Complete: true, UsedAt: now.Add(-time.Hour).Unix(), CreatedAt: now.Add(-2 * time.Hour).Unix()},
+		{Key: "other-repository", Version: "v", Repository: "octo/other", Size: 200, Complete: true, UsedAt: now.Add(-3 * time.Hour).Unix(), CreatedAt: now.Add(-3 * time.Hour).Unix()},
+	}
+	db, err := handler.openDB()
+	require.NoError(t, err)
+	for _, cache := range old {
+		require.NoError(t, insertCache(db, cache))
+	}
+	require.NoError(t, db.Close())
+
+	token, err := common.CreateRuntimeToken(common.RuntimeTokenOptions{Run: common.RunClaims{TaskID: 1, RunID: 1, JobID: 1, Repository: "octo/repo"}, CacheRefs: []string{"refs/heads/main"}})
+	require.NoError(t, err)
+	do := func(method, url string, body []byte) *http.Response {
+		req, err := http.NewRequest(method, url, bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes 0-%d/*", len(body)-1))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	base := handler.ExternalURL() + urlBase
+	content := make([]byte, 100)
+	body, err := json.Marshal(&Request{Key: "new", Version: "v", Size: 100})
+	require.NoError(t, err)
+	resp := do(http.MethodPost, base+"/caches", body)
+	require.Equal(t, 200, resp.StatusCode)
+	got := struct {
+		CacheID uint64 `json:"cacheId"`
+	}{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	resp.Body.Close()
+	resp = do(http.MethodPatch, fmt.Sprintf("%s/caches/%d", base, got.CacheID), content)
+	require.Equal(t, 200, resp.StatusCode)
+	resp.Body.Close()
+	resp = do(http.MethodPost, fmt.Sprintf("%s/caches/%d", base, got.CacheID), nil)
+	require.Equal(t, 200, resp.StatusCode)
+	resp.Body.Close()
+
+	// the new cache exceeds the quota of its repository, the least recently used cache is evicted
+	caches, err := ListCaches(dir, CacheFilter{})
+	require.NoError(t, err)
+	keys := []string{}
+	for _, cache := range caches {
+		keys = append(keys, cache.Key)
+	}
+	assert.Equal(t, []string{"new", "recently-used", "other-repository"}, keys)
+	assert.Equal(t, "octo/repo", caches[0].Repository)
+	assert.Equal(t, "refs/heads/main", caches[0].Ref)
+
+	// lowering the quota applies to the existing caches
+	handler.SetPolicy(Policy{MaxRepositorySize: 100})
+	caches, err = ListCaches(dir, CacheFilter{})
+	require.NoError(t, err)
+	keys = keys[:0]
+	for _, cache := range caches {
+		keys = append(keys, cache.Key)
+	}
+	assert.Equal(t, []string{"new"}, keys)
+
+	// a policy set while a gc runs is applied right after it, the running gc still uses the previous one
+	db, err = handler.openDB()
+	require.NoError(t, err)
+	caches[0].UsedAt = now.Add(-time.Hour).Unix()
+	require.NoError(t, db.Update(caches[0].ID, caches[0]))
+	handler.mu.Lock()
+	handler.gcAt = time.Time{}
+	handler.mu.Unlock()
+	go handler.gcCache()
+	require.Eventually(t, handler.gcing.Load, 5*time.Second, 10*time.Millisecond)
+	handler.SetPolicy(Policy{MaxRepositorySize: 100, KeepUnused: time.Minute})
+	require.NoError(t, db.Close())
+	assert.Eventually(t, func() bool {
+		caches, err := ListCaches(dir, CacheFilter{})
+		return err == nil && len(caches) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestHandlerRequireAuthorization(t *testing.T) {
+	handler, err := NewHandler(filepath.Join(t.TempDir(), "artifactcache"), nil, nil)
+	require.NoError(t, err)
+	handler.RequireAuthorization("s3cret")
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	handler.SetExternalURL(server.URL + "/")
+	assert.Equal(t, server.URL, handler.ExternalURL())
+
+	token, err := common.CreateRuntimeToken(common.RuntimeTokenOptions{Secret: "s3cret", Run: common.RunClaims{TaskID: 1, RunID: 1, JobID: 1, Repository: "octo/repo"}, CacheRefs: []string{"refs/heads/main"}})
+	require.NoError(t, err)
+	unsigned, err := common.CreateRuntimeToken(common.RuntimeTokenOptions{Run: common.RunClaims{TaskID: 1, RunID: 1, JobID: 1, Repository: "octo/repo"}, CacheRefs: []string{"refs/heads/main"}})
+	require.NoError(t, err)
+	do := func(method, url, token string, body []byte) *http.Response {
+		req, err := http.NewRequest(method, url, bytes.NewReader(body))
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes 0-%d/*", len(body)-1))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	base := server.URL + urlBase
+	version := "c19da02a2bd7e77277f1ac29ab45c09b7d46a4ee758284e26bb3045ad11d9d20"
+	body, err := json.Marshal(&Request{Key: "key", Version: version, Size: 100})
+	require.NoError(t, err)
+	assert.Equal(t, 401, do(http.MethodPost, base+"/caches", "", body).StatusCode)
+	assert.Equal(t, 401, do(http.MethodPost, base+"/caches", unsigned, body).StatusCode)
+
+	resp := do(http.MethodPost, base+"/caches", token, body)
+	require.Equal(t, 200, resp.StatusCode)
+	got := struct {
+		CacheID uint64 `json:"cacheId"`
+	}{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	content := make([]byte, 100)
+	require.Equal(t, 200, do(http.MethodPatch, fmt.Sprintf("%s/caches/%d", base, got.CacheID), token, content).StatusCode)
+	require.Equal(t, 200, do(http.MethodPost, fmt.Sprintf("%s/caches/%d", base, got.CacheID), token, nil).StatusCode)
+
+	resp = do(http.MethodGet, fmt.Sprintf("%s/cache?keys=key&version=%s", base, version), token, nil)
+	require.Equal(t, 200, resp.StatusCode)
+	hit := struct {
+		ArchiveLocation string `json:"archiveLocation"`
+	}{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&hit))
+	assert.True(t, strings.HasPrefix(hit.ArchiveLocation, server.URL+urlBase+"/artifacts/"))
+
+	// the archives are downloaded without the runtime token, by their signed url
+	assert.Equal(t, 200, do(http.MethodGet, hit.ArchiveLocation, "", nil).StatusCode)
+	assert.Equal(t, 401, do(http.MethodGet, strings.Split(hit.ArchiveLocation, "?")[0], "", nil).StatusCode)
+
+	// the management API needs the runtime token
+	assert.Equal(t, 401, do(http.MethodGet, base+"/manage/caches", "", nil).StatusCode)
+	assert.Equal(t, 200, do(http.MethodGet, base+"/manage/caches", token, nil).StatusCode)
+
+	// the tokens of other repositories neither see nor delete the caches
+	other, err := common.CreateRuntimeToken(common.RuntimeTokenOptions{Secret: "s3cret", Run: common.RunClaims{TaskID: 1, RunID: 1, JobID: 1, Repository: "octo/other"}, CacheRefs: []string{"refs/heads/main"}})
+	require.NoError(t, err)
+	list := &CacheList{}
+	resp = do(http.MethodGet, base+"/manage/caches", other, nil)
+	require.Equal(t, 200, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(list))
+	assert.Equal(t, 0, list.TotalCount)
+	assert.Equal(t, 403, do(http.MethodGet, base+"/manage/caches?repository=octo/repo", other, nil).StatusCode)
+	assert.Equal(t, 403, do(http.MethodDelete, base+"/manage/caches?repository=octo/repo", other, nil).StatusCode)
+	assert.Equal(t, 200, do(http.MethodDelete, base+"/manage/caches?key=key", other, nil).StatusCode)
+	assert.Equal(t, 404, do(http.MethodDelete, fmt.Sprintf("%s/manage/caches/%d", base, got.CacheID), other, nil).StatusCode)
+	assert.Equal(t, 200, do(http.MethodGet, fmt.Sprintf("%s/manage/caches/%d", base, got.CacheID), token, nil).StatusCode)
+
+	// the tokens without a repository manage no caches
+	anonymous, err := common.CreateRuntimeToken(common.RuntimeTokenOptions{Secret: "s3cret", Run: common.RunClaims{TaskID: 1, RunID: 1, JobID: 1}, CacheRefs: []string{"refs/heads/main"}})
+	require.NoError(t, err)
+	assert.Equal(t, 403, do(http.MethodGet, base+"/manage/caches", anonymous, nil).StatusCode)
+}
@@ -0,0 +1,454 @@
+package artifactcache
+
+// Cache service v2 of actions/cache v4 and @actions/cache 4.x
+//
+// The toolkit talks to the Twirp service github.actions.results.api.v1.CacheService at ACTIONS_RESULTS_URL
+// when ACTIONS_CACHE_SERVICE_V2 is set, the archives are transferred with the Azure blob storage SDK:
+//
+// 1. Upload
+// 1.1. POST /twirp/github.actions.results.api.v1.CacheService/CreateCacheEntry
+//      {"metadata": {...}, "key": "...", "version": "..."} => {"ok": true, "signedUploadUrl": "..."}
+// 1.2. PUT {signedUploadUrl} with x-ms-blob-type: BlockBlob uploads small archives at once, larger archives
+//      are staged with PUT {signedUploadUrl}&comp=block&blockid=... and committed with
+//      PUT {signedUploadUrl}&comp=blocklist and the XML block list as body
+// 1.3. POST /twirp/github.actions.results.api.v1.CacheService/FinalizeCacheEntryUpload
+//      {"metadata": {...}, "key": "...", "sizeBytes": "...", "version": "..."} => {"ok": true, "entryId": "..."}
+// 2. Download
+// 2.1. POST /twirp/github.actions.results.api.v1.CacheService/GetCacheEntryDownloadURL
+//      {"metadata": {...}, "key": "...", "restoreKeys": [...], "version": "..."} => {"ok": true, "signedDownloadUrl": "...", "matchedKey": "..."}
+// 2.2. HEAD and ranged GET {signedDownloadUrl}, the range is sent as x-ms-range
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/timshannon/bolthold"
+
+	"github.com/nektos/act/pkg/common"
+)
+
+const (
+	twirpBase = "/twirp/github.actions.results.api.v1.CacheService"
+
+	signedURLExpiry = time.Hour
+
+	// permissions of a CacheScope
+	cachePermissionRead  = 1
+	cachePermissionWrite = 2
+)
+
+// CacheMetadata is the scope of a cache entry
+type CacheMetadata struct {
+	RepositoryID int64String  `json:"repositoryId"`
+	Scope        []CacheScope `json:"scope"`
+}
+
+type CacheScope struct {
+	Scope      string      `json:"scope"`
+	Permission int64String `json:"permission"`
+}
+
+type CreateCacheEntryRequest struct {
+	Metadata *CacheMetadata `json:"metadata"`
+	Key      string         `json:"key"`
+	Version  string         `json:"version"`
+}
+
+type CreateCacheEntryResponse struct {
+	Ok              bool   `json:"ok"`
+	SignedUploadURL string `json:"signedUploadUrl"`
+	Message         string `json:"message,omitempty"`
+}
+
+type FinalizeCacheEntryUploadRequest struct {
+	Metadata  *CacheMetadata `json:"metadata"`
+	Key       string         `json:"key"`
+	SizeBytes int64String    `json:"sizeBytes"`
+	Version   string         `json:"version"`
+}
+
+type FinalizeCacheEntryUploadResponse struct {
+	Ok      bool        `json:"ok"`
+	EntryID int64String `json:"entryId"`
+	Message string      `json:"message,omitempty"`
+}
+
+type GetCacheEntryDownloadURLRequest struct {
+	Metadata    *CacheMetadata `json:"metadata"`
+	Key         string         `json:"key"`
+	RestoreKeys []string       `json:"restoreKeys"`
+	Version     string         `json:"version"`
+}
+
+type GetCacheEntryDownloadURLResponse struct {
+	Ok                bool   `json:"ok"`
+	SignedDownloadURL string `json:"signedDownloadUrl"`
+	MatchedKey        string `json:"matchedKey"`
+}
+
+// int64String is an int64 in the protobuf JSON encoding, a string when marshaled and a string or a number when unmarshaled
+type int64String int64
+
+func (i int64String) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatInt(int64(i), 10))
+}
+
+func (i *int64String) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*i = 0
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid int64 %s: %w", data, err)
+	}
+	*i = int64String(v)
+	return nil
+}
+
+func (h *Handler) routesV2(router *httprouter.Router) {
+	router.POST(twirpBase+"/CreateCacheEntry", h.middleware(h.createCacheEntry))
+	router.POST(twirpBase+"/FinalizeCacheEntryUpload", h.middleware(h.finalizeCacheEntryUpload))
+	router.POST(twirpBase+"/GetCacheEntryDownloadURL", h.middleware(h.getCacheEntryDownloadURL))
+	router.PUT(twirpBase+"/UploadCache", h.middleware(h.uploadCache))
+	router.GET(twirpBase+"/DownloadCache", h.middleware(h.downloadCache))
+	router.HEAD(twirpBase+"/DownloadCache", h.middleware(h.downloadCache))
+	router.NotFound = http.HandlerFunc(h.forwardResults)
+}
+
+// ForwardResults forwards the requests for the results service the handler doesn't implement, like the artifacts
+// service of the artifact server, to target. ACTIONS_RESULTS_URL can point to the handler while both are running.
+func (h *Handler) ForwardResults(target string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	h.resultsProxy = httputil.NewSingleHostReverseProxy(u)
+	return nil
+}
+
+func (h *Handler) forwardResults(w http.ResponseWriter, r *http.Request) {
+	if h.resultsProxy == nil {
+		http.NotFound(w, r)
+		return
+	}
+	h.logger.Debugf("forward %s %s", r.Method, r.RequestURI)
+	h.resultsProxy.ServeHTTP(w, r)
+}
+
+// POST /twirp/github.actions.results.api.v1.CacheService/CreateCacheEntry
+func (h *Handler) createCacheEntry(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	req := &CreateCacheEntryRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		h.responseTwirpError(w, r, http.StatusBadRequest, "malformed", err)
+		return
+	}
+	// cache keys are case insensitive
+	req.Key = strings.ToLower(req.Key)
+	scope := h.cacheScopeV2(r, req.Metadata)
+
+	db, err := h.openDB()
+	if err != nil {
+		h.responseTwirpError(w, r, http.StatusInternalServerError, "internal", err)
+		return
+	}
+	defer db.Close()
+
+	existing := &Cache{}
+	if err := db.FindOne(existing, bolthold.Where("Key").Eq(req.Key).And("Version").Eq(req.Version).And("Ref").Eq(scope.WriteRef).And("Repository").Eq(scope.Repository).And("Complete").Eq(true)); err == nil {
+		h.responseJSON(w, r, 200, &CreateCacheEntryResponse{
+			Message: fmt.Sprintf("cache entry %q already exists", req.Key),
+		})
+		return
+	} else if !errors.Is(err, bolthold.ErrNotFound) {
+		h.responseTwirpError(w, r, http.StatusInternalServerError, "internal", err)
+		return
+	}
+
+	now := time.Now().Unix()
+	cache := &Cache{
+		Key:        req.Key,
+		Version:    req.Version,
+		Ref:        scope.WriteRef,
+		Repository: scope.Repository,
+		Size:       -1, // the size is sent by FinalizeCacheEntryUpload
+		CreatedAt:  now,
+		UsedAt:     now,
+	}
+	if err := insertCache(db, cache); err != nil {
+		h.responseTwirpError(w, r, http.StatusInternalServerError, "internal", err)
+		return
+	}
+	h.responseJSON(w, r, 200, &CreateCacheEntryResponse{
+		Ok:              true,
+		SignedUploadURL: h.signedURL("UploadCache", cache.ID),
+	})
+}
+
+// blockList is the body of a Put Block List request, the ids are Committed, Uncommitted or Latest elements
+type blockList struct {
+	Blocks []struct {
+		ID string `xml:",chardata"`
+	} `xml:",any"`
+}
+
+// PUT /twirp/github.actions.results.api.v1.CacheService/UploadCache
+func (h *Handler) uploadCache(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	id, ok := h.verifySignedURL(w, r, "UploadCache")
+	if !ok {
+		return
+	}
+	cache := &Cache{}
+	if ok := h.getIncompleteCache(w, r, id, cache); !ok {
+		return
+	}
+
+	var err error
+	switch r.URL.Query().Get("comp") {
+	case "block":
+		blockID := r.URL.Query().Get("blockid")
+		if blockID == "" {
+			h.responseTwirpError(w, r, http.StatusBadRequest, "invalid_argument", errors.New("missing blockid"))
+			return
+		}
+		err = h.storage.WriteBlock(id, blockID, r.Body)
+	case "blocklist":
+		list := &blockList{}
+		if err := xml.NewDecoder(r.Body).Decode(list); err != nil {
+			h.responseTwirpError(w, r, http.StatusBadRequest, "malformed", err)
+			return
+		}
+		// all blocks are staged by this handler, the kind of the list entries doesn't matter
+		blocks := make([]string, 0, len(list.Blocks))
+		for _, block := range list.Blocks {
+			blocks = append(blocks, strings.TrimSpace(block.ID))
+		}
+		err = h.storage.CommitBlocks(id, blocks)
+	case "":
+		err = h.storage.Write(id, 0, r.Body)
+	default:
+		h.responseTwirpError(w, r, http.StatusBadRequest, "invalid_argument", fmt.Errorf("unsupported comp %q", r.URL.Query().Get("comp")))
+		return
+	}
+	if err != nil {
+		h.responseTwirpError(w, r, http.StatusInternalServerError, "internal", err)
+		return
+	}
+	h.useCache(int64(id))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// POST /twirp/github.actions.results.api.v1.CacheService/FinalizeCacheEntryUpload
+func (h *Handler) finalizeCacheEntryUpload(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	req := &FinalizeCacheEntryUploadRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		h.responseTwirpError(w, r, http.StatusBadRequest, "malformed", err)
+		return
+	}
+	req.Key = strings.ToLower(req.Key)
+	scope := h.cacheScopeV2(r, req.Metadata)
+
+	db, err := h.openDB()
+	if err != nil {
+		h.responseTwirpError(w, r, http.StatusInternalServerError, "internal", err)
+		return
+	}
+	defer db.Close()
+
+	cache := &Cache{}
+	if err := db.FindOne(cache, bolthold.Where("Key").Eq(req.Key).And("Version").Eq(req.Version).And("Ref").Eq(scope.WriteRef).And("Repository").Eq(scope.Repository).And("Complete").Eq(false).SortBy("CreatedAt").Reverse()); err != nil {
+		if errors.Is(err, bolthold.ErrNotFound) {
+			h.responseTwirpError(w, r, http.StatusNotFound, "not_found", fmt.Errorf("cache %q: not reserved", req.Key))
+			return
+		}
+		h.responseTwirpError(w, r, http.StatusInternalServerError, "internal", err)
+		return
+	}
+
+	size, err := h.storage.Commit(cache.ID, int64(req.SizeBytes))
+	if err != nil {
+		h.responseTwirpError(w, r, http.StatusInternalServerError, "internal", err)
+		return
+	}
+	cache.Size = size
+	cache.Complete = true
+	if err := db.Update(cache.ID, cache); err != nil {
+		h.responseTwirpError(w, r, http.StatusInternalServerError, "internal", err)
+		return
+	}
+	h.evictCaches(db, cache.Repository, cache.ID)
+
+	h.responseJSON(w, r, 200, &FinalizeCacheEntryUploadResponse{
+		Ok:      true,
+		EntryID: int64String(cache.ID),
+	})
+}
+
+// POST /twirp/github.actions.results.api.v1.CacheService/GetCacheEntryDownloadURL
+func (h *Handler) getCacheEntryDownloadURL(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	req := &GetCacheEntryDownloadURLRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		h.responseTwirpError(w, r, http.StatusBadRequest, "malformed", err)
+		return
+	}
+	keys := append([]string{req.Key}, req.RestoreKeys...)
+	for i, key := range keys {
+		keys[i] = strings.ToLower(key)
+	}
+	scope := h.cacheScopeV2(r, req.Metadata)
+
+	db, err := h.openDB()
+	if err != nil {
+		h.responseTwirpError(w, r, http.StatusInternalServerError, "internal", err)
+		return
+	}
+	defer db.Close()
+
+	cache, err := findCache(db, keys, req.Version, scope.Repository, scope.Refs)
+	if err != nil {
+		h.responseTwirpError(w, r, http.StatusInternalServerError, "internal", err)
+		return
+	}
+	if cache != nil {
+		if ok, err := h.storage.Exist(cache.ID); err != nil {
+			h.responseTwirpError(w, r, http.StatusInternalServerError, "internal", err)
+			return
+		} else if !ok {
+			_ = db.Delete(cache.ID, cache)
+			cache = nil
+		}
+	}
+	if cache == nil {
+		h.responseJSON(w, r, 200, &GetCacheEntryDownloadURLResponse{})
+		return
+	}
+	h.responseJSON(w, r, 200, &GetCacheEntryDownloadURLResponse{
+		Ok:                true,
+		SignedDownloadURL: h.signedURL("DownloadCache", cache.ID),
+		MatchedKey:        cache.Key,
+	})
+}
+
+// GET and HEAD /twirp/github.actions.results.api.v1.CacheService/DownloadCache
+func (h *Handler) downloadCache(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	id, ok := h.verifySignedURL(w, r, "DownloadCache")
+	if !ok {
+		return
+	}
+	// the blob storage SDK requests ranges with x-ms-range
+	if rng := r.Header.Get("x-ms-range"); rng != "" {
+		r.Header.Set("Range", rng)
+	}
+	w.Header().Set("x-ms-blob-type", "BlockBlob")
+	h.useCache(int64(id))
+	h.storage.Serve(w, r, id)
+}
+
+// cacheScopeV2 returns the access of a request to the caches, which is the access of its token, see cacheScope.
+// The refs of the metadata only narrow the refs of a scoped token the caches are restored from, the new caches are
+// always created for the ref of the token.
+func (h *Handler) cacheScopeV2(r *http.Request, metadata *CacheMetadata) *common.CacheScope {
+	scope := h.cacheScope(r)
+	if metadata == nil || len(metadata.Scope) == 0 || scope.Refs == nil {
+		return scope
+	}
+	var read []string
+	for _, s := range metadata.Scope {
+		if s.Permission&cachePermissionRead != 0 {
+			read = append(read, s.Scope)
+		}
+	}
+	// the refs keep the order of the token
+	scope.Refs = slices.DeleteFunc(slices.Clone(scope.Refs), func(ref string) bool {
+		return !slices.Contains(read, ref)
+	})
+	return scope
+}
+
+func (h *Handler) getIncompleteCache(w http.ResponseWriter, r *http.Request, id uint64, cache *Cache) bool {
+	db, err := h.openDB()
+	if err != nil {
+		h.responseTwirpError(w, r, http.StatusInternalServerError, "internal", err)
+		return false
+	}
+	defer db.Close()
+	if err := db.Get(id, cache); err != nil {
+		if errors.Is(err, bolthold.ErrNotFound) {
+			h.responseTwirpError(w, r, http.StatusNotFound, "not_found", fmt.Errorf("cache %d: not reserved", id))
+			return false
+		}
+		h.responseTwirpError(w, r, http.StatusInternalServerError, "internal", err)
+		return false
+	}
+	if cache.Complete {
+		h.responseTwirpError(w, r, http.StatusConflict, "already_exists", fmt.Errorf("cache %v %q: already complete", cache.ID, cache.Key))
+		return false
+	}
+	return true
+}
+
+func (h *Handler) signature(endpoint, expires string, id uint64) []byte {
+	mac := hmac.New(sha256.New, h.signKey)
+	fmt.Fprintf(mac, "%s\n%s\n%d", endpoint, expires, id)
+	return mac.Sum(nil)
+}
+
+func (h *Handler) signedURL(endpoint string, id uint64) string {
+	return fmt.Sprintf("%s%s/%s?%s&cacheID=%d", h.ExternalURL(), twirpBase, endpoint, h.signedQuery(endpoint, id), id)
+}
+
+// signedQuery returns the query parameters which authorize the requests of the endpoint for the cache, see checkSignature
+func (h *Handler) signedQuery(endpoint string, id uint64) string {
+	expires := strconv.FormatInt(time.Now().Add(signedURLExpiry).Unix(), 10)
+	return fmt.Sprintf("sig=%s&expires=%s", base64.URLEncoding.EncodeToString(h.signature(endpoint, expires, id)), expires)
+}
+
+func (h *Handler) checkSignature(query url.Values, endpoint string, id uint64) error {
+	sig, _ := base64.URLEncoding.DecodeString(query.Get("sig"))
+	expires := query.Get("expires")
+	if !hmac.Equal(sig, h.signature(endpoint, expires, id)) {
+		return errors.New("invalid signature")
+	}
+	if t, err := strconv.ParseInt(expires, 10, 64); err != nil || time.Now().Unix() > t {
+		return errors.New("signed url expired")
+	}
+	return nil
+}
+
+func (h *Handler) verifySignedURL(w http.ResponseWriter, r *http.Request, endpoint string) (uint64, bool) {
+	query := r.URL.Query()
+	id, err := strconv.ParseUint(query.Get("cacheID"), 10, 64)
+	if err != nil {
+		h.responseTwirpError(w, r, http.StatusBadRequest, "invalid_argument", err)
+		return 0, false
+	}
+	if err := h.checkSignature(query, endpoint, id); err != nil {
+		h.responseTwirpError(w, r, http.StatusUnauthorized, "unauthenticated", err)
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *Handler) responseTwirpError(w http.ResponseWriter, r *http.Request, code int, twirpCode string, err error) {
+	h.logger.Errorf("%v %v: %v", r.Method, r.RequestURI, err)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"code": twirpCode,
+		"msg":  err.Error(),
+	})
+}
@@ -0,0 +1,239 @@
+package artifactcache
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timshannon/bolthold"
+
+	"github.com/nektos/act/pkg/common"
+)
+
+func postTwirp(t *testing.T, base, method string, req, resp any) int {
+	return postTwirpWithToken(t, base, "", method, req, resp)
+}
+
+func postTwirpWithToken(t *testing.T, base, token, method string, req, resp any) int {
+	body, err := json.Marshal(req)
+	require.NoError(t, err)
+	request, err := http.NewRequest(http.MethodPost, base+"/"+method, bytes.NewReader(body))
+	require.NoError(t, err)
+	request.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	r, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer r.Body.Close()
+	if r.StatusCode == http.StatusOK && resp != nil {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(resp))
+	}
+	return r.StatusCode
+}
+
+func putBlob(t *testing.T, url string, body []byte) int {
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestHandlerV2(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "artifactcache")
+	handler, err := StartHandler(dir, "", 0, nil)
+	require.NoError(t, err)
+	defer handler.Close()
+
+	base := handler.ExternalURL() + twirpBase
+	version := "c19da02a2bd7e77277f1ac29ab45c09b7d46a4ee758284e26bb3045ad11d9d20"
+	metadata := map[string]any{"repositoryId": "1", "scope": []map[string]any{{"scope": "refs/heads/main", "permission": "3"}}}
+
+	t.Run("miss", func(t *testing.T) {
+		resp := &GetCacheEntryDownloadURLResponse{}
+		require.Equal(t, 200, postTwirp(t, base, "GetCacheEntryDownloadURL", map[string]any{
+			"metadata": metadata, "key": "missing", "version": version,
+		}, resp))
+		assert.False(t, resp.Ok)
+	})
+
+	content := make([]byte, 300)
+	_, err = rand.Read(content)
+	require.NoError(t, err)
+
+	t.Run("upload blocks", func(t *testing.T) {
+		create := &CreateCacheEntryResponse{}
+		require.Equal(t, 200, postTwirp(t, base, "CreateCacheEntry", map[string]any{
+			"metadata": metadata, "key": "Linux-Node-abc", "version": version,
+		}, create))
+		require.True(t, create.Ok)
+
+		// blocks are staged out of order and committed in the order of the block list
+		ids := []string{}
+		for i := 2; i >= 0; i-- {
+			id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("block-%d", i)))
+			ids = append([]string{id}, ids...)
+			assert.Equal(t, http.StatusCreated, putBlob(t, create.SignedUploadURL+"&comp=block&blockid="+id, content[i*100:(i+1)*100]))
+		}
+		blocks := `<?xml version="1.0" encoding="utf-8"?><BlockList>`
+		for _, id := range ids {
+			blocks += "<Latest>" + id + "</Latest>"
+		}
+		blocks += "</BlockList>"
+		assert.Equal(t, http.StatusCreated, putBlob(t, create.SignedUploadURL+"&comp=blocklist", []byte(blocks)))
+
+		finalize := &FinalizeCacheEntryUploadResponse{}
+		require.Equal(t, 200, postTwirp(t, base, "FinalizeCacheEntryUpload", map[string]any{
+			"metadata": metadata, "key": "Linux-Node-abc", "sizeBytes": "300", "version": version,
+		}, finalize))
+		assert.True(t, finalize.Ok)
+		assert.NotZero(t, finalize.EntryID)
+	})
+
+	t.Run("download with restore key", func(t *testing.T) {
+		resp := &GetCacheEntryDownloadURLResponse{}
+		require.Equal(t, 200, postTwirp(t, base, "GetCacheEntryDownloadURL", map[string]any{
+			"metadata": metadata, "key": "linux-node-def", "restoreKeys": []string{"Linux-Node-"}, "version": version,
+		}, resp))
+		require.True(t, resp.Ok)
+		assert.Equal(t, "linux-node-abc", resp.MatchedKey)
+
+		head, err := http.Head(resp.SignedDownloadURL)
+		require.NoError(t, err)
+		head.Body.Close()
+		assert.Equal(t, int64(300), head.ContentLength)
+
+		req, err := http.NewRequest(http.MethodGet, resp.SignedDownloadURL, nil)
+		require.NoError(t, err)
+		req.Header.Set("x-ms-range", "bytes=100-199")
+		get, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer get.Body.Close()
+		assert.Equal(t, http.StatusPartialContent, get.StatusCode)
+		got, err := io.ReadAll(get.Body)
+		require.NoError(t, err)
+		assert.Equal(t, content[100:200], got)
+
+		tampered := strings.Replace(resp.SignedDownloadURL, "cacheID=", "cacheID=9", 1)
+		forbidden, err := http.Get(tampered)
+		require.NoError(t, err)
+		forbidden.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, forbidden.StatusCode)
+	})
+
+	t.Run("single shot upload and duplicate", func(t *testing.T) {
+		create := &CreateCacheEntryResponse{}
+		require.Equal(t, 200, postTwirp(t, base, "CreateCacheEntry", map[string]any{"key": "single", "version": version}, create))
+		require.True(t, create.Ok)
+		assert.Equal(t, http.StatusCreated, putBlob(t, create.SignedUploadURL, content))
+
+		finalize := &FinalizeCacheEntryUploadResponse{}
+		require.Equal(t, 200, postTwirp(t, base, "FinalizeCacheEntryUpload", map[string]any{"key": "single", "sizeBytes": 300, "version": version}, finalize))
+		assert.True(t, finalize.Ok)
+
+		// the entry is complete, it can neither be uploaded again nor recreated
+		assert.Equal(t, http.StatusConflict, putBlob(t, create.SignedUploadURL, content))
+		duplicate := &CreateCacheEntryResponse{}
+		require.Equal(t, 200, postTwirp(t, base, "CreateCacheEntry", map[string]any{"key": "single", "version": version}, duplicate))
+		assert.False(t, duplicate.Ok)
+	})
+
+	t.Run("size mismatch", func(t *testing.T) {
+		create := &CreateCacheEntryResponse{}
+		require.Equal(t, 200, postTwirp(t, base, "CreateCacheEntry", map[string]any{"key": "broken", "version": version}, create))
+		assert.Equal(t, http.StatusCreated, putBlob(t, create.SignedUploadURL, content[:10]))
+		assert.Equal(t, http.StatusInternalServerError, postTwirp(t, base, "FinalizeCacheEntryUpload", map[string]any{"key": "broken", "sizeBytes": "300", "version": version}, nil))
+	})
+}
+
+func TestHandlerV2ForgedScope(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "artifactcache")
+	handler, err := StartHandler(dir, "", 0, nil)
+	require.NoError(t, err)
+	defer handler.Close()
+
+	db, err := handler.openDB()
+	require.NoError(t, err)
+	for _, ref := range []string{"refs/heads/main", "refs/heads/other"} {
+		cache := &Cache{Key: "deps-" + ref, Version: "v", Ref: ref, Repository: "octo/repo", Complete: true}
+		require.NoError(t, insertCache(db, cache))
+		require.NoError(t, handler.storage.Write(cache.ID, 0, strings.NewReader(cache.Key)))
+		_, err = handler.storage.Commit(cache.ID, int64(len(cache.Key)))
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.Close())
+
+	base := handler.ExternalURL() + twirpBase
+	token, err := common.CreateRuntimeToken(common.RuntimeTokenOptions{Run: common.RunClaims{TaskID: 1, RunID: 1, JobID: 1, Repository: "octo/repo"}, CacheRefs: []string{"refs/heads/feature", "refs/heads/main"}})
+	require.NoError(t, err)
+	scope := func(refs ...string) map[string]any {
+		scopes := []map[string]any{}
+		for _, ref := range refs {
+			scopes = append(scopes, map[string]any{"scope": ref, "permission": "3"})
+		}
+		return map[string]any{"repositoryId": "1", "scope": scopes}
+	}
+	restore := func(metadata map[string]any) string {
+		resp := &GetCacheEntryDownloadURLResponse{}
+		require.Equal(t, 200, postTwirpWithToken(t, base, token, "GetCacheEntryDownloadURL", map[string]any{
+			"metadata": metadata, "key": "deps-", "version": "v",
+		}, resp))
+		return resp.MatchedKey
+	}
+
+	// the metadata narrows the refs of the token, the refs outside the token are never read
+	assert.Equal(t, "deps-refs/heads/main", restore(scope("refs/heads/main")))
+	assert.Equal(t, "", restore(scope("refs/heads/other")))
+	assert.Equal(t, "deps-refs/heads/main", restore(nil))
+
+	// the caches are created for the ref of the token
+	create := &CreateCacheEntryResponse{}
+	require.Equal(t, 200, postTwirpWithToken(t, base, token, "CreateCacheEntry", map[string]any{
+		"metadata": scope("refs/heads/main"), "key": "forged", "version": "v",
+	}, create))
+	require.True(t, create.Ok)
+	db, err = handler.openDB()
+	require.NoError(t, err)
+	defer db.Close()
+	cache := &Cache{}
+	require.NoError(t, db.FindOne(cache, bolthold.Where("Key").Eq("forged")))
+	assert.Equal(t, "refs/heads/feature", cache.Ref)
+}
+
+func TestHandlerForwardResults(t *testing.T) {
+	artifacts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("artifacts " + r.URL.Path))
+	}))
+	defer artifacts.Close()
+
+	handler, err := StartHandler(filepath.Join(t.TempDir(), "artifactcache"), "", 0, nil)
+	require.NoError(t, err)
+	defer handler.Close()
+
+	url := handler.ExternalURL() + "/twirp/github.actions.results.api.v1.ArtifactService/ListArtifacts"
+	resp, err := http.Post(url, "application/json", strings.NewReader("{}"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	require.NoError(t, handler.ForwardResults(artifacts.URL))
+	resp, err = http.Post(url, "application/json", strings.NewReader("{}"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "artifacts /twirp/github.actions.results.api.v1.ArtifactService/ListArtifacts", string(body))
+}
@@ -0,0 +1,312 @@
+package artifactcache
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/timshannon/bolthold"
+)
+
+// CacheFilter selects the caches to list or delete, the empty fields match all caches.
+type CacheFilter struct {
+	Key        string // prefix of the key, case insensitive like the lookup of the caches
+	Ref        string
+	Repository string
+}
+
+// IsEmpty returns whether the filter matches all caches.
+func (f CacheFilter) IsEmpty() bool {
+	return f.Key == "" && f.Ref == "" && f.Repository == ""
+}
+
+func (f CacheFilter) query() *bolthold.Query {
+	query := bolthold.Where("Complete").Eq(true)
+	if f.Key != "" {
+		query = query.And("Key").RegExp(regexp.MustCompile("^" + regexp.QuoteMeta(strings.ToLower(f.Key))))
+	}
+	if f.Ref != "" {
+		query = query.And("Ref").Eq(f.Ref)
+	}
+	if f.Repository != "" {
+		query = query.And("Repository").Eq(f.Repository)
+	}
+	return query.SortBy("UsedAt").Reverse()
+}
+
+// ListCaches returns the complete caches of a cache server directory matching the filter, the most recently used first.
+func ListCaches(dir string, filter CacheFilter) ([]*Cache, error) {
+	db, err := openDB(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return listCaches(db, filter)
+}
+
+func listCaches(db *bolthold.Store, filter CacheFilter) ([]*Cache, error) {
+	var caches []*Cache
+	if err := db.Find(&caches, filter.query()); err != nil {
+		return nil, err
+	}
+	return caches, nil
+}
+
+// GetCache returns the cache with the id of a cache server directory, or an error wrapping bolthold.ErrNotFound.
+func GetCache(dir string, id uint64) (*Cache, error) {
+	db, err := openDB(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	cache := &Cache{}
+	if err := db.Get(id, cache); err != nil {
+		return nil, fmt.Errorf("cache %d: %w", id, err)
+	}
+	return cache, nil
+}
+
+// DeleteCaches removes the caches with the ids from a cache server directory and their content from the storage,
+// which is the one of the directory if nil, see OpenStorage. It's safe to use while a handler serves the directory.
+func DeleteCaches(dir string, storage Storage, ids []uint64) error {
+	db, err := openDB(dir)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if storage == nil {
+		if storage, err = OpenStorage(dir, ""); err != nil {
+			return err
+		}
+	}
+	return deleteCaches(db, storage, ids)
+}
+
+func deleteCaches(db *bolthold.Store, storage Storage, ids []uint64) error {
+	for _, id := range ids {
+		if err := db.Delete(id, &Cache{}); err != nil {
+			return fmt.Errorf("cache %d: %w", id, err)
+		}
+		storage.Remove(id)
+	}
+	return nil
+}
+
+// CacheEntry is a cache in the format of the GitHub REST API, see https://docs.github.com/en/rest/actions/cache
+type CacheEntry struct {
+	ID             uint64    `json:"id"`
+	Ref            string    `json:"ref"`
+	Key            string    `json:"key"`
+	Version        string    `json:"version"`
+	Repository     string    `json:"repository"`
+	LastAccessedAt time.Time `json:"last_accessed_at"`
+	CreatedAt      time.Time `json:"created_at"`
+	SizeInBytes    int64     `json:"size_in_bytes"`
+}
+
+func newCacheEntry(cache *Cache) *CacheEntry {
+	return &CacheEntry{
+		ID:             cache.ID,
+		Ref:            cache.Ref,
+		Key:            cache.Key,
+		Version:        cache.Version,
+		Repository:     cache.Repository,
+		LastAccessedAt: time.Unix(cache.UsedAt, 0).UTC(),
+		CreatedAt:      time.Unix(cache.CreatedAt, 0).UTC(),
+		SizeInBytes:    cache.Size,
+	}
+}
+
+// CacheList is the response of the list and delete requests of the management API.
+type CacheList struct {
+	TotalCount   int           `json:"total_count"`
+	ActionsCache []*CacheEntry `json:"actions_caches"`
+}
+
+func newCacheList(caches []*Cache) *CacheList {
+	ret := &CacheList{TotalCount: len(caches), ActionsCache: make([]*CacheEntry, 0, len(caches))}
+	for _, cache := range caches {
+		ret.ActionsCache = append(ret.ActionsCache, newCacheEntry(cache))
+	}
+	return ret
+}
+
+func (h *Handler) routesManage(router *httprouter.Router) {
+	router.GET(urlBase+"/manage/caches", h.middleware(h.manageMiddleware(h.manageList)))
+	router.DELETE(urlBase+"/manage/caches", h.middleware(h.manageMiddleware(h.manageDeleteByFilter)))
+	router.GET(urlBase+"/manage/caches/:id", h.middleware(h.manageMiddleware(h.manageGet)))
+	router.DELETE(urlBase+"/manage/caches/:id", h.middleware(h.manageMiddleware(h.manageDelete)))
+}
+
+// manageMiddleware serves the management API to the clients of this machine only, unless the handler requires
+// authorization, then the requests have a runtime token signed with its secret, see RequireAuthorization, and manage
+// the caches of the repository of the token only, see manageRepository.
+// The servers of a run listen on all interfaces, anyone reaching them must not list or wipe the caches.
+func (h *Handler) manageMiddleware(handler httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		if h.authSecret == "" && !isLoopback(r.RemoteAddr) {
+			h.responseJSON(w, r, http.StatusForbidden, fmt.Errorf("the management API is served to the clients of this machine only"))
+			return
+		}
+		if h.authSecret != "" && h.manageRepository(r) == "" {
+			h.responseJSON(w, r, http.StatusForbidden, fmt.Errorf("the token has no repository"))
+			return
+		}
+		handler(w, r, params)
+	}
+}
+
+// manageRepository returns the repository of the caches the request manages, the repository of its token if the
+// handler requires authorization, empty for all caches. Every job has a runtime token, it must not list or wipe
+// the caches of the other repositories of a shared server.
+func (h *Handler) manageRepository(r *http.Request) string {
+	if h.authSecret == "" {
+		return ""
+	}
+	return h.cacheScope(r).Repository
+}
+
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func parseCacheFilter(r *http.Request) CacheFilter {
+	query := r.URL.Query()
+	return CacheFilter{
+		Key:        query.Get("key"),
+		Ref:        query.Get("ref"),
+		Repository: query.Get("repository"),
+	}
+}
+
+// manageFilter restricts the filter to the repository of the request, see manageRepository
+func (h *Handler) manageFilter(r *http.Request, filter CacheFilter) (CacheFilter, error) {
+	repository := h.manageRepository(r)
+	if repository == "" {
+		return filter, nil
+	}
+	if filter.Repository != "" && filter.Repository != repository {
+		return filter, fmt.Errorf("the token can't manage the caches of repository %s", filter.Repository)
+	}
+	filter.Repository = repository
+	return filter, nil
+}
+
+// GET /_apis/artifactcache/manage/caches?key=&ref=&repository=
+func (h *Handler) manageList(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	db, err := h.openDB()
+	if err != nil {
+		h.responseJSON(w, r, 500, err)
+		return
+	}
+	defer db.Close()
+
+	filter, err := h.manageFilter(r, parseCacheFilter(r))
+	if err != nil {
+		h.responseJSON(w, r, 403, err)
+		return
+	}
+	caches, err := listCaches(db, filter)
+	if err != nil {
+		h.responseJSON(w, r, 500, err)
+		return
+	}
+	h.responseJSON(w, r, 200, newCacheList(caches))
+}
+
+// DELETE /_apis/artifactcache/manage/caches?key=&ref=&repository=
+func (h *Handler) manageDeleteByFilter(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	filter := parseCacheFilter(r)
+	if filter.IsEmpty() {
+		h.responseJSON(w, r, 400, fmt.Errorf("one of key, ref or repository is required"))
+		return
+	}
+	filter, err := h.manageFilter(r, filter)
+	if err != nil {
+		h.responseJSON(w, r, 403, err)
+		return
+	}
+
+	db, err := h.openDB()
+	if err != nil {
+		h.responseJSON(w, r, 500, err)
+		return
+	}
+	defer db.Close()
+
+	caches, err := listCaches(db, filter)
+	if err != nil {
+		h.responseJSON(w, r, 500, err)
+		return
+	}
+	ids := make([]uint64, 0, len(caches))
+	for _, cache := range caches {
+		ids = append(ids, cache.ID)
+	}
+	if err := deleteCaches(db, h.storage, ids); err != nil {
+		h.responseJSON(w, r, 500, err)
+		return
+	}
+	h.responseJSON(w, r, 200, newCacheList(caches))
+}
+
+// GET /_apis/artifactcache/manage/caches/:id
+func (h *Handler) manageGet(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	cache, code, err := h.manageCache(r, params)
+	if err != nil {
+		h.responseJSON(w, r, code, err)
+		return
+	}
+	h.responseJSON(w, r, 200, newCacheEntry(cache))
+}
+
+// DELETE /_apis/artifactcache/manage/caches/:id
+func (h *Handler) manageDelete(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	cache, code, err := h.manageCache(r, params)
+	if err != nil {
+		h.responseJSON(w, r, code, err)
+		return
+	}
+
+	db, err := h.openDB()
+	if err != nil {
+		h.responseJSON(w, r, 500, err)
+		return
+	}
+	defer db.Close()
+
+	if err := deleteCaches(db, h.storage, []uint64{cache.ID}); err != nil {
+		h.responseJSON(w, r, 500, err)
+		return
+	}
+	h.responseJSON(w, r, 200, newCacheEntry(cache))
+}
+
+func (h *Handler) manageCache(r *http.Request, params httprouter.Params) (*Cache, int, error) {
+	id, err := strconv.ParseUint(params.ByName("id"), 10, 64)
+	if err != nil {
+		return nil, 400, err
+	}
+	cache, err := GetCache(h.dir, id)
+	if errors.Is(err, bolthold.ErrNotFound) {
+		return nil, 404, err
+	} else if err != nil {
+		return nil, 500, err
+	}
+	// the caches of other repositories don't exist for the request
+	if repository := h.manageRepository(r); repository != "" && cache.Repository != repository {
+		return nil, 404, bolthold.ErrNotFound
+	}
+	return cache, 200, nil
+}
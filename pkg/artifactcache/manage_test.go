@@ -0,0 +1,136 @@
+package artifactcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timshannon/bolthold"
+)
+
+func insertTestCaches(t *testing.T, dir string, caches ...*Cache) {
+	db, err := openDB(dir)
+	require.NoError(t, err)
+	defer db.Close()
+	storage, err := NewLocalStorage(filepath.Join(dir, "cache"))
+	require.NoError(t, err)
+	for _, cache := range caches {
+		require.NoError(t, insertCache(db, cache))
+		require.NoError(t, os.MkdirAll(filepath.Dir(storage.filename(cache.ID)), 0o755))
+		require.NoError(t, os.WriteFile(storage.filename(cache.ID), []byte("content"), 0o644))
+	}
+}
+
+func testCaches() []*Cache {
+	now := time.Now()
+	return []*Cache{
+		{Key: "linux-node-abc", Version: "v", Ref: "refs/heads/main", Repository: "octo/repo", Size: 7, Complete: true, UsedAt: now.Add(-time.Hour).Unix()},
+		{Key: "linux-node-def", Version: "v", Ref: "refs/heads/feature", Repository: "octo/repo", Size: 7, Complete: true, UsedAt: now.Unix()},
+		{Key: "linux-go-abc", Version: "v", Ref: "refs/heads/main", Repository: "octo/other", Size: 7, Complete: true, UsedAt: now.Add(-2 * time.Hour).Unix()},
+		{Key: "linux-node-incomplete", Version: "v", Ref: "refs/heads/main", Repository: "octo/repo", Size: -1},
+	}
+}
+
+func cacheKeys(caches []*Cache) []string {
+	keys := []string{}
+	for _, cache := range caches {
+		keys = append(keys, cache.Key)
+	}
+	return keys
+}
+
+func TestListAndDeleteCaches(t *testing.T) {
+	dir := t.TempDir()
+	caches := testCaches()
+	insertTestCaches(t, dir, caches...)
+
+	for _, c := range []struct {
+		filter CacheFilter
+		keys   []string
+	}{
+		{CacheFilter{}, []string{"linux-node-def", "linux-node-abc", "linux-go-abc"}},
+		{CacheFilter{Key: "Linux-Node-"}, []string{"linux-node-def", "linux-node-abc"}},
+		{CacheFilter{Ref: "refs/heads/main"}, []string{"linux-node-abc", "linux-go-abc"}},
+		{CacheFilter{Repository: "octo/repo", Ref: "refs/heads/main"}, []string{"linux-node-abc"}},
+	} {
+		t.Run(fmt.Sprintf("%+v", c.filter), func(t *testing.T) {
+			got, err := ListCaches(dir, c.filter)
+			require.NoError(t, err)
+			assert.Equal(t, c.keys, cacheKeys(got))
+		})
+	}
+
+	got, err := GetCache(dir, caches[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "octo/repo", got.Repository)
+
+	require.NoError(t, DeleteCaches(dir, nil, []uint64{caches[0].ID}))
+	_, err = GetCache(dir, caches[0].ID)
+	assert.ErrorIs(t, err, bolthold.ErrNotFound)
+	storage, err := NewLocalStorage(filepath.Join(dir, "cache"))
+	require.NoError(t, err)
+	exist, err := storage.Exist(caches[0].ID)
+	require.NoError(t, err)
+	assert.False(t, exist)
+
+	assert.ErrorIs(t, DeleteCaches(dir, nil, []uint64{caches[0].ID}), bolthold.ErrNotFound)
+}
+
+func TestHandlerManage(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "artifactcache")
+	handler, err := StartHandler(dir, "", 0, nil)
+	require.NoError(t, err)
+	defer handler.Close()
+
+	caches := testCaches()
+	insertTestCaches(t, dir, caches...)
+	// the management API is served to the clients of this machine only
+	port := handler.listener.Addr().(*net.TCPAddr).Port
+	base := fmt.Sprintf("http://127.0.0.1:%d%s/manage/caches", port, urlBase)
+
+	do := func(method, url string, code int, v any) {
+		req, err := http.NewRequest(method, url, nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, code, resp.StatusCode)
+		if v != nil {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+	}
+
+	if ip := net.ParseIP(handler.outboundIP); ip != nil && !ip.IsLoopback() {
+		do(http.MethodGet, handler.ExternalURL()+urlBase+"/manage/caches", 403, nil)
+		do(http.MethodDelete, fmt.Sprintf("%s%s/manage/caches/%d", handler.ExternalURL(), urlBase, caches[0].ID), 403, nil)
+	}
+
+	list := &CacheList{}
+	do(http.MethodGet, base+"?repository=octo/repo", 200, list)
+	assert.Equal(t, 2, list.TotalCount)
+	assert.Equal(t, "linux-node-def", list.ActionsCache[0].Key)
+	assert.Equal(t, int64(7), list.ActionsCache[0].SizeInBytes)
+
+	entry := &CacheEntry{}
+	do(http.MethodGet, fmt.Sprintf("%s/%d", base, caches[2].ID), 200, entry)
+	assert.Equal(t, "linux-go-abc", entry.Key)
+	assert.Equal(t, "refs/heads/main", entry.Ref)
+	do(http.MethodGet, base+"/1000", 404, nil)
+
+	do(http.MethodDelete, fmt.Sprintf("%s/%d", base, caches[2].ID), 200, entry)
+	do(http.MethodGet, fmt.Sprintf("%s/%d", base, caches[2].ID), 404, nil)
+
+	// purge the poisoned caches of a key prefix, a filter is required to delete caches in bulk
+	do(http.MethodDelete, base, 400, nil)
+	do(http.MethodDelete, base+"?key=linux-node-", 200, list)
+	assert.Equal(t, 2, list.TotalCount)
+	do(http.MethodGet, base, 200, list)
+	assert.Equal(t, 0, list.TotalCount)
+}
@@ -24,11 +24,13 @@ func (c *Request) ToCache() *Cache {
 }
 
 type Cache struct {
-	ID        uint64 `json:"id" boltholdKey:"ID"`
-	Key       string `json:"key" boltholdIndex:"Key"`
-	Version   string `json:"version" boltholdIndex:"Version"`
-	Size      int64  `json:"cacheSize"`
-	Complete  bool   `json:"complete" boltholdIndex:"Complete"`
-	UsedAt    int64  `json:"usedAt" boltholdIndex:"UsedAt"`
-	CreatedAt int64  `json:"createdAt" boltholdIndex:"CreatedAt"`
+	ID         uint64 `json:"id" boltholdKey:"ID"`
+	Key        string `json:"key" boltholdIndex:"Key"`
+	Version    string `json:"version" boltholdIndex:"Version"`
+	Ref        string `json:"ref" boltholdIndex:"Ref"`               // github.ref of the run which created the cache, empty if the request was unscoped
+	Repository string `json:"repository" boltholdIndex:"Repository"` // repository of the run which created the cache, quotas apply per repository
+	Size       int64  `json:"cacheSize"`
+	Complete   bool   `json:"complete" boltholdIndex:"Complete"`
+	UsedAt     int64  `json:"usedAt" boltholdIndex:"UsedAt"`
+	CreatedAt  int64  `json:"createdAt" boltholdIndex:"CreatedAt"`
 }
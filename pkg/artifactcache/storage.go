@@ -1,27 +1,79 @@
 package artifactcache
 
 import (
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+
+	"github.com/nektos/act/pkg/common"
 )
 
-type Storage struct {
+// Storage stores the contents of the caches, the index of the caches is kept by the handler.
+// Uploads are written in parts or blocks and committed once complete, see Commit.
+type Storage interface {
+	// Exist returns whether the cache has been committed
+	Exist(id uint64) (bool, error)
+	// Write stores a part of an upload at the offset
+	Write(id uint64, offset int64, reader io.Reader) error
+	// WriteBlock stores a staged block of a block blob upload, see CommitBlocks
+	WriteBlock(id uint64, blockID string, reader io.Reader) error
+	// CommitBlocks turns the staged blocks into the parts of the upload in the order of the block list,
+	// blocks which are not in the list are discarded
+	CommitBlocks(id uint64, blockIDs []string) error
+	// Commit concatenates the parts of an upload and returns its size, size is checked unless it is < 0
+	Commit(id uint64, size int64) (int64, error)
+	// Serve responds the content of a committed cache, including range requests
+	Serve(w http.ResponseWriter, r *http.Request, id uint64)
+	// Remove removes the content and the parts of a cache
+	Remove(id uint64)
+}
+
+// LocalStorage stores the caches in a directory. The ids of the caches are those of the index of one handler,
+// so the directory must not be shared by several cache servers.
+type LocalStorage struct {
 	rootDir string
 }
 
-func NewStorage(rootDir string) (*Storage, error) {
+var _ Storage = &LocalStorage{}
+
+// OpenStorage returns the storage of a cache server directory, rawURL selects where the contents are stored:
+//
+//   - "": the "cache" directory in dir
+//   - "file:///path" or "/path": a directory, e.g. on another disk
+//   - "s3://bucket/prefix?endpoint=http://minio:9000&region=us-east-1": a bucket of an S3 compatible object store,
+//     the credentials are taken from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+func OpenStorage(dir, rawURL string) (Storage, error) {
+	if rawURL == "" {
+		return NewLocalStorage(filepath.Join(dir, "cache"))
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage %q: %w", rawURL, err)
+	}
+	switch u.Scheme {
+	case "", "file":
+		return NewLocalStorage(u.Path)
+	case "s3":
+		return NewS3Storage(filepath.Join(dir, "cache"), common.ParseS3URL(u))
+	default:
+		return nil, fmt.Errorf("invalid storage %q: unsupported scheme %q", rawURL, u.Scheme)
+	}
+}
+
+func NewLocalStorage(rootDir string) (*LocalStorage, error) {
 	if err := os.MkdirAll(rootDir, 0o755); err != nil {
 		return nil, err
 	}
-	return &Storage{
+	return &LocalStorage{
 		rootDir: rootDir,
 	}, nil
 }
 
-func (s *Storage) Exist(id uint64) (bool, error) {
+func (s *LocalStorage) Exist(id uint64) (bool, error) {
 	name := s.filename(id)
 	if _, err := os.Stat(name); os.IsNotExist(err) {
 		return false, nil
@@ -31,7 +83,7 @@ func (s *Storage) Exist(id uint64) (bool, error) {
 	return true, nil
 }
 
-func (s *Storage) Write(id uint64, offset int64, reader io.Reader) error {
+func (s *LocalStorage) Write(id uint64, offset int64, reader io.Reader) error {
 	name := s.tempName(id, offset)
 	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
 		return err
@@ -46,7 +98,45 @@ func (s *Storage) Write(id uint64, offset int64, reader io.Reader) error {
 	return err
 }
 
-func (s *Storage) Commit(id uint64, size int64) (int64, error) {
+func (s *LocalStorage) WriteBlock(id uint64, blockID string, reader io.Reader) error {
+	name := s.blockName(id, blockID)
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, reader)
+	return err
+}
+
+func (s *LocalStorage) CommitBlocks(id uint64, blockIDs []string) error {
+	defer func() {
+		_ = os.RemoveAll(s.blockDir(id))
+	}()
+
+	if err := os.MkdirAll(s.tempDir(id), 0o755); err != nil {
+		return err
+	}
+	var offset int64
+	for _, blockID := range blockIDs {
+		name := s.blockName(id, blockID)
+		info, err := os.Stat(name)
+		if err != nil {
+			return fmt.Errorf("block %q: %w", blockID, err)
+		}
+		if err := os.Rename(name, s.tempName(id, offset)); err != nil {
+			return err
+		}
+		offset += info.Size()
+	}
+	return nil
+}
+
+func (s *LocalStorage) Commit(id uint64, size int64) (int64, error) {
 	defer func() {
 		_ = os.RemoveAll(s.tempDir(id))
 	}()
@@ -60,11 +150,16 @@ func (s *Storage) Commit(id uint64, size int64) (int64, error) {
 	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
 		return 0, err
 	}
-	file, err := os.Create(name)
+	// the parts are concatenated to a temporary file which is renamed once complete, so the servers
+	// sharing the directory never serve a partial file
+	file, err := os.CreateTemp(filepath.Dir(name), fmt.Sprintf(".%d-*", id))
 	if err != nil {
 		return 0, err
 	}
-	defer file.Close()
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
 
 	var written int64
 	for _, v := range tempNames {
@@ -84,37 +179,54 @@ func (s *Storage) Commit(id uint64, size int64) (int64, error) {
 	// We can't check the size of the file, just skip the check.
 	// It happens when the request comes from old versions of actions, like `actions/cache@v2`.
 	if size >= 0 && written != size {
-		_ = file.Close()
-		_ = os.Remove(name)
 		return 0, fmt.Errorf("broken file: %v != %v", written, size)
 	}
 
+	if err := file.Chmod(0o644); err != nil {
+		return 0, err
+	}
+	if err := file.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(file.Name(), name); err != nil {
+		return 0, err
+	}
 	return written, nil
 }
 
-func (s *Storage) Serve(w http.ResponseWriter, r *http.Request, id uint64) {
+func (s *LocalStorage) Serve(w http.ResponseWriter, r *http.Request, id uint64) {
 	name := s.filename(id)
 	http.ServeFile(w, r, name)
 }
 
-func (s *Storage) Remove(id uint64) {
+func (s *LocalStorage) Remove(id uint64) {
 	_ = os.Remove(s.filename(id))
 	_ = os.RemoveAll(s.tempDir(id))
+	_ = os.RemoveAll(s.blockDir(id))
 }
 
-func (s *Storage) filename(id uint64) string {
+func (s *LocalStorage) filename(id uint64) string {
 	return filepath.Join(s.rootDir, fmt.Sprintf("%02x", id%0xff), fmt.Sprint(id))
 }
 
-func (s *Storage) tempDir(id uint64) string {
+func (s *LocalStorage) tempDir(id uint64) string {
 	return filepath.Join(s.rootDir, "tmp", fmt.Sprint(id))
 }
 
-func (s *Storage) tempName(id uint64, offset int64) string {
+func (s *LocalStorage) tempName(id uint64, offset int64) string {
 	return filepath.Join(s.tempDir(id), fmt.Sprintf("%016x", offset))
 }
 
-func (s *Storage) tempNames(id uint64) ([]string, error) {
+func (s *LocalStorage) blockDir(id uint64) string {
+	return filepath.Join(s.rootDir, "blocks", fmt.Sprint(id))
+}
+
+func (s *LocalStorage) blockName(id uint64, blockID string) string {
+	// block ids are base64 encoded, the hex encoding is safe in file names
+	return filepath.Join(s.blockDir(id), hex.EncodeToString([]byte(blockID)))
+}
+
+func (s *LocalStorage) tempNames(id uint64) ([]string, error) {
 	dir := s.tempDir(id)
 	files, err := os.ReadDir(dir)
 	if err != nil {
@@ -0,0 +1,93 @@
+package artifactcache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+
+	"github.com/nektos/act/pkg/common"
+)
+
+// S3Config locates a bucket of an S3 compatible object store, e.g. AWS S3 or MinIO.
+type S3Config = common.S3Config
+
+// S3Storage stores the caches in a bucket of an S3 compatible object store. The parts of an upload are staged
+// locally, the cache is put to the bucket once committed and downloads are streamed from the bucket.
+type S3Storage struct {
+	client  *common.S3Client
+	staging *LocalStorage
+}
+
+var _ Storage = &S3Storage{}
+
+// NewS3Storage returns a storage for the bucket, stagingDir keeps the uploads until they are committed.
+func NewS3Storage(stagingDir string, config S3Config) (*S3Storage, error) {
+	client, err := common.NewS3Client(config)
+	if err != nil {
+		return nil, err
+	}
+	staging, err := NewLocalStorage(stagingDir)
+	if err != nil {
+		return nil, err
+	}
+	return &S3Storage{
+		client:  client,
+		staging: staging,
+	}, nil
+}
+
+func (s *S3Storage) Exist(id uint64) (bool, error) {
+	if _, err := s.client.Head(s.key(id)); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *S3Storage) Write(id uint64, offset int64, reader io.Reader) error {
+	return s.staging.Write(id, offset, reader)
+}
+
+func (s *S3Storage) WriteBlock(id uint64, blockID string, reader io.Reader) error {
+	return s.staging.WriteBlock(id, blockID, reader)
+}
+
+func (s *S3Storage) CommitBlocks(id uint64, blockIDs []string) error {
+	return s.staging.CommitBlocks(id, blockIDs)
+}
+
+func (s *S3Storage) Commit(id uint64, size int64) (int64, error) {
+	defer s.staging.Remove(id)
+
+	written, err := s.staging.Commit(id, size)
+	if err != nil {
+		return 0, err
+	}
+	file, err := os.Open(s.staging.filename(id))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if err := s.client.Put(s.key(id), file, written); err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+func (s *S3Storage) Serve(w http.ResponseWriter, r *http.Request, id uint64) {
+	s.client.Serve(w, r, s.key(id))
+}
+
+func (s *S3Storage) Remove(id uint64) {
+	s.staging.Remove(id)
+	_ = s.client.Delete(s.key(id))
+}
+
+// key returns the object key of a cache, with the layout of the local storage
+func (s *S3Storage) key(id uint64) string {
+	return path.Join(fmt.Sprintf("%02x", id%0xff), fmt.Sprint(id))
+}
@@ -0,0 +1,176 @@
+package artifactcache
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is an in-process stand-in of an S3 compatible object store, it checks the signatures of the requests
+type fakeS3 struct {
+	config  S3Config
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	s3 := &fakeS3{
+		config:  S3Config{Bucket: "bucket", Prefix: "act/caches", Region: "eu-west-1", AccessKeyID: "AKID", SecretAccessKey: "secret"},
+		objects: map[string][]byte{},
+	}
+	server := httptest.NewServer(s3)
+	t.Cleanup(server.Close)
+	s3.config.Endpoint = server.URL
+	return s3
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	date, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		http.Error(w, "missing date", http.StatusForbidden)
+		return
+	}
+	signed, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	signed.Header = r.Header.Clone()
+	s.config.Sign(signed, r.Header.Get("X-Amz-Content-Sha256"), date)
+	if signed.Header.Get("Authorization") != r.Header.Get("Authorization") {
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		s.objects[r.URL.Path] = body
+	case http.MethodGet, http.MethodHead:
+		body, ok := s.objects[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+	case http.MethodDelete:
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3Storage(t *testing.T) {
+	s3 := newFakeS3(t)
+	storage, err := NewS3Storage(t.TempDir(), s3.config)
+	require.NoError(t, err)
+
+	content := make([]byte, 300)
+	_, err = rand.Read(content)
+	require.NoError(t, err)
+
+	require.NoError(t, storage.Write(1, 100, bytes.NewReader(content[100:])))
+	require.NoError(t, storage.Write(1, 0, bytes.NewReader(content[:100])))
+	exist, err := storage.Exist(1)
+	require.NoError(t, err)
+	assert.False(t, exist)
+
+	size, err := storage.Commit(1, 300)
+	require.NoError(t, err)
+	assert.Equal(t, int64(300), size)
+	assert.Equal(t, content, s3.objects["/bucket/act/caches/01/1"])
+	exist, err = storage.Exist(1)
+	require.NoError(t, err)
+	assert.True(t, exist)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Range", "bytes=10-19")
+	rec := httptest.NewRecorder()
+	storage.Serve(rec, req, 1)
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, content[10:20], rec.Body.Bytes())
+
+	storage.Remove(1)
+	exist, err = storage.Exist(1)
+	require.NoError(t, err)
+	assert.False(t, exist)
+
+	t.Run("broken upload is not put", func(t *testing.T) {
+		require.NoError(t, storage.Write(2, 0, bytes.NewReader(content[:10])))
+		_, err := storage.Commit(2, 300)
+		assert.Error(t, err)
+		assert.NotContains(t, s3.objects, "/bucket/act/caches/02/2")
+	})
+
+	t.Run("wrong credentials", func(t *testing.T) {
+		config := s3.config
+		config.SecretAccessKey = "wrong"
+		storage, err := NewS3Storage(t.TempDir(), config)
+		require.NoError(t, err)
+		_, err = storage.Exist(1)
+		assert.ErrorContains(t, err, "403 Forbidden")
+	})
+}
+
+func TestHandlerS3Storage(t *testing.T) {
+	s3 := newFakeS3(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", s3.config.AccessKeyID)
+	t.Setenv("AWS_SECRET_ACCESS_KEY", s3.config.SecretAccessKey)
+	dir := filepath.Join(t.TempDir(), "artifactcache")
+	storage, err := OpenStorage(dir, fmt.Sprintf("s3://bucket/act/caches?endpoint=%s&region=eu-west-1", s3.config.Endpoint))
+	require.NoError(t, err)
+	require.IsType(t, &S3Storage{}, storage)
+
+	handler, err := StartHandlerWithStorage(dir, storage, "", 0, nil)
+	require.NoError(t, err)
+	defer handler.Close()
+
+	content := make([]byte, 100)
+	_, err = rand.Read(content)
+	require.NoError(t, err)
+	uploadCacheNormally(t, handler.ExternalURL()+urlBase, "s3-key", "c19da02a2bd7e77277f1ac29ab45c09b7d46a4ee758284e26bb3045ad11d9d20", content)
+
+	caches, err := ListCaches(dir, CacheFilter{Key: "s3-key"})
+	require.NoError(t, err)
+	require.Len(t, caches, 1)
+	assert.Contains(t, s3.objects, fmt.Sprintf("/bucket/act/caches/%02x/%d", caches[0].ID%0xff, caches[0].ID))
+
+	require.NoError(t, DeleteCaches(dir, storage, []uint64{caches[0].ID}))
+	assert.Empty(t, s3.objects)
+}
+
+func TestOpenStorage(t *testing.T) {
+	dir := t.TempDir()
+	for _, c := range []struct {
+		url  string
+		want string
+		err  string
+	}{
+		{url: "", want: filepath.Join(dir, "cache")},
+		{url: "file:///mnt/actcache", want: "/mnt/actcache"},
+		{url: "/mnt/actcache", want: "/mnt/actcache"},
+		{url: "gs://bucket", err: `unsupported scheme "gs"`},
+	} {
+		t.Run(c.url, func(t *testing.T) {
+			if strings.HasPrefix(c.want, "/mnt") {
+				c.want = filepath.Join(dir, c.want)
+				c.url = strings.Replace(c.url, "/mnt", filepath.ToSlash(dir)+"/mnt", 1)
+			}
+			storage, err := OpenStorage(dir, c.url)
+			if c.err != "" {
+				assert.ErrorContains(t, err, c.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.want, storage.(*LocalStorage).rootDir)
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package artifactcache
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStorageCommit(t *testing.T) {
+	storage, err := NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+
+	require.NoError(t, storage.Write(1, 0, bytes.NewReader([]byte("broken"))))
+	_, err = storage.Commit(1, 100)
+	assert.ErrorContains(t, err, "broken file: 6 != 100")
+	exist, err := storage.Exist(1)
+	require.NoError(t, err)
+	assert.False(t, exist)
+
+	require.NoError(t, storage.Write(2, 5, bytes.NewReader([]byte(" world"))))
+	require.NoError(t, storage.Write(2, 0, bytes.NewReader([]byte("hello"))))
+	size, err := storage.Commit(2, 11)
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), size)
+	content, err := os.ReadFile(storage.filename(2))
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(content))
+	info, err := os.Stat(storage.filename(2))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+
+	// the temporary files of the commits are gone, only the committed file is visible to the other servers
+	entries, err := os.ReadDir(filepath.Dir(storage.filename(2)))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "2", entries[0].Name())
+}
+
+func TestSharedLocalStorage(t *testing.T) {
+	// the cache servers of two machines share the storage, each with its own index
+	storage, err := NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	var ids []uint64
+	for _, content := range []string{"first machine", "second machine"} {
+		dir := t.TempDir()
+		handler, err := StartHandlerWithStorage(dir, storage, "", 0, nil)
+		require.NoError(t, err)
+		uploadCacheNormally(t, handler.ExternalURL()+urlBase, "shared-key", "c19da02a2bd7e77277f1ac29ab45c09b7d46a4ee758284e26bb3045ad11d9d20", []byte(content))
+		require.NoError(t, handler.Close())
+
+		caches, err := ListCaches(dir, CacheFilter{Key: "shared-key"})
+		require.NoError(t, err)
+		require.Len(t, caches, 1)
+		ids = append(ids, caches[0].ID)
+	}
+	require.NotEqual(t, ids[0], ids[1])
+	for i, content := range []string{"first machine", "second machine"} {
+		got, err := os.ReadFile(storage.filename(ids[i]))
+		require.NoError(t, err)
+		assert.Equal(t, content, string(got))
+	}
+}
@@ -0,0 +1,227 @@
+package artifacts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// restArtifact is an artifact in the format of the GitHub REST API, see https://docs.github.com/en/rest/actions/artifacts
+type restArtifact struct {
+	ID                 int64           `json:"id"`
+	Name               string          `json:"name"`
+	SizeInBytes        int64           `json:"size_in_bytes"`
+	URL                string          `json:"url"`
+	ArchiveDownloadURL string          `json:"archive_download_url"`
+	Expired            bool            `json:"expired"`
+	Digest             string          `json:"digest,omitempty"`
+	CreatedAt          time.Time       `json:"created_at"`
+	UpdatedAt          time.Time       `json:"updated_at"`
+	ExpiresAt          *time.Time      `json:"expires_at"`
+	WorkflowRun        restWorkflowRun `json:"workflow_run"`
+}
+
+type restWorkflowRun struct {
+	ID int64 `json:"id"`
+}
+
+type restArtifactList struct {
+	TotalCount int             `json:"total_count"`
+	Artifacts  []*restArtifact `json:"artifacts"`
+}
+
+// routesAPI serves the artifacts v4 of the artifact server in the format of the GitHub REST API, which download-artifact
+// uses to download the artifacts of other runs with the run-id and repository inputs. The other requests are forwarded
+// to the GitHub API at upstream, so the jobs can use the server as GITHUB_API_URL.
+func routesAPI(router *httprouter.Router, route *artifactV4Routes, upstream *url.URL) {
+	proxy := httputil.NewSingleHostReverseProxy(upstream)
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		req.Host = upstream.Host
+	}
+	router.NotFound = proxy
+	// the other methods of the artifact routes, e.g. DELETE, are forwarded too
+	router.HandleMethodNotAllowed = false
+
+	api := &artifactAPI{route: route, upstream: upstream}
+	router.GET("/repos/:owner/:repo/actions/artifacts", api.listArtifacts)
+	router.GET("/repos/:owner/:repo/actions/runs/:run_id/artifacts", api.listArtifacts)
+	router.GET("/repos/:owner/:repo/actions/artifacts/:artifact_id", api.getArtifact)
+	router.GET("/repos/:owner/:repo/actions/artifacts/:artifact_id/:archive_format", api.downloadArtifact)
+}
+
+type artifactAPI struct {
+	route    *artifactV4Routes
+	upstream *url.URL
+}
+
+// authorize checks the token of the request grants access to the repository on the GitHub API, if the server has a secret
+func (a *artifactAPI) authorize(w http.ResponseWriter, r *http.Request, params httprouter.Params) bool {
+	if a.route.policy.secret == "" {
+		return true
+	}
+	u := *a.upstream
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/repos/" + url.PathEscape(params.ByName("owner")) + "/" + url.PathEscape(params.ByName("repo"))
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, u.String(), nil)
+	if err != nil {
+		a.responseError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	req.Header.Set("Authorization", r.Header.Get("Authorization"))
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		a.responseError(w, http.StatusBadGateway, err.Error())
+		return false
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		a.responseError(w, http.StatusNotFound, "Not Found")
+		return false
+	}
+	return true
+}
+
+// artifacts returns the finalized artifacts v4 of the repository matching the filter, the artifacts of unknown repositories
+// are the ones of the runs of any repository
+func (a *artifactAPI) artifacts(params httprouter.Params, filter ArtifactFilter) ([]*Artifact, error) {
+	filter.RunID = params.ByName("run_id")
+	artifacts, err := ListArtifacts(a.route.storage, filter)
+	if err != nil {
+		return nil, err
+	}
+	repository := params.ByName("owner") + "/" + params.ByName("repo")
+	ret := artifacts[:0]
+	for _, artifact := range artifacts {
+		if artifact.Version >= 4 && artifact.Finalized && (artifact.Repository == "" || strings.EqualFold(artifact.Repository, repository)) {
+			ret = append(ret, artifact)
+		}
+	}
+	return ret, nil
+}
+
+func (a *artifactAPI) findArtifact(w http.ResponseWriter, params httprouter.Params) (*Artifact, bool) {
+	id, err := strconv.ParseInt(params.ByName("artifact_id"), 10, 64)
+	if err != nil {
+		a.responseError(w, http.StatusNotFound, "Not Found")
+		return nil, false
+	}
+	artifacts, err := a.artifacts(params, ArtifactFilter{})
+	if err != nil {
+		a.responseError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	for _, artifact := range artifacts {
+		if artifact.ID == id {
+			return artifact, true
+		}
+	}
+	a.responseError(w, http.StatusNotFound, "Not Found")
+	return nil, false
+}
+
+// GET /repos/:owner/:repo/actions/artifacts?name=&per_page=&page=
+// GET /repos/:owner/:repo/actions/runs/:run_id/artifacts?name=&per_page=&page=
+func (a *artifactAPI) listArtifacts(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if !a.authorize(w, r, params) {
+		return
+	}
+	query := r.URL.Query()
+	artifacts, err := a.artifacts(params, ArtifactFilter{Name: query.Get("name")})
+	if err != nil {
+		a.responseError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	perPage, err := strconv.Atoi(query.Get("per_page"))
+	if err != nil || perPage <= 0 {
+		perPage = 30
+	} else if perPage > 100 {
+		perPage = 100
+	}
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	list := restArtifactList{TotalCount: len(artifacts), Artifacts: []*restArtifact{}}
+	for i := (page - 1) * perPage; i < len(artifacts) && i < page*perPage; i++ {
+		list.Artifacts = append(list.Artifacts, a.restArtifact(r, params, artifacts[i]))
+	}
+	a.responseJSON(w, http.StatusOK, list)
+}
+
+// GET /repos/:owner/:repo/actions/artifacts/:artifact_id
+func (a *artifactAPI) getArtifact(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if !a.authorize(w, r, params) {
+		return
+	}
+	if artifact, ok := a.findArtifact(w, params); ok {
+		a.responseJSON(w, http.StatusOK, a.restArtifact(r, params, artifact))
+	}
+}
+
+// GET /repos/:owner/:repo/actions/artifacts/:artifact_id/zip redirects to the signed url of the artifact
+func (a *artifactAPI) downloadArtifact(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if params.ByName("archive_format") != "zip" {
+		a.responseError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	if !a.authorize(w, r, params) {
+		return
+	}
+	artifact, ok := a.findArtifact(w, params)
+	if !ok {
+		return
+	}
+	if artifact.Expired(time.Now()) {
+		a.responseError(w, http.StatusGone, "Artifact has expired")
+		return
+	}
+	runID, _ := strconv.ParseInt(artifact.RunID, 10, 64)
+	route := *a.route
+	route.AppURL = requestBaseURL(r)
+	http.Redirect(w, r, route.buildArtifactURL("DownloadArtifact", artifact.Name, runID), http.StatusFound)
+}
+
+func (a *artifactAPI) restArtifact(r *http.Request, params httprouter.Params, artifact *Artifact) *restArtifact {
+	runID, _ := strconv.ParseInt(artifact.RunID, 10, 64)
+	artifactURL := requestBaseURL(r) + "/repos/" + params.ByName("owner") + "/" + params.ByName("repo") + "/actions/artifacts/" + strconv.FormatInt(artifact.ID, 10)
+	ret := &restArtifact{
+		ID:                 artifact.ID,
+		Name:               artifact.Name,
+		SizeInBytes:        artifact.Size,
+		URL:                artifactURL,
+		ArchiveDownloadURL: artifactURL + "/zip",
+		Expired:            artifact.Expired(time.Now()),
+		CreatedAt:          artifact.CreatedAt,
+		UpdatedAt:          artifact.CreatedAt,
+		WorkflowRun:        restWorkflowRun{ID: runID},
+	}
+	if artifact.SHA256 != "" {
+		ret.Digest = "sha256:" + artifact.SHA256
+	}
+	if !artifact.ExpiresAt.IsZero() {
+		ret.ExpiresAt = &artifact.ExpiresAt
+	}
+	return ret
+}
+
+func (a *artifactAPI) responseJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("Error encode response body: %v", err)
+	}
+}
+
+func (a *artifactAPI) responseError(w http.ResponseWriter, status int, message string) {
+	a.responseJSON(w, status, map[string]string{"message": message})
+}
@@ -0,0 +1,134 @@
+package artifacts
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nektos/act/pkg/common"
+)
+
+// newFakeGitHubAPI returns a stand-in of the GitHub API, it grants access to octo/repo with "token good"
+// and echoes the paths of the other requests
+func newFakeGitHubAPI(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v3/repos/octo/repo" {
+			if r.Header.Get("Authorization") != "token good" {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprint(w, `{"full_name":"octo/repo"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"forwarded":%q}`, r.Method+" "+r.URL.Path)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func getAPI(t *testing.T, url, authorization string, v any) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if v != nil && resp.StatusCode == http.StatusOK {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+	if location, ok := v.(*string); ok {
+		*location = resp.Header.Get("Location")
+	}
+	return resp.StatusCode
+}
+
+func TestArtifactAPI(t *testing.T) {
+	upstream := newFakeGitHubAPI(t)
+	dir := t.TempDir()
+	handler, err := NewHandler(dir, Options{RetentionDays: DefaultRetentionDays, GitHubAPIURL: upstream.URL + "/api/v3"})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	token, err := common.CreateRuntimeToken(common.RuntimeTokenOptions{Run: common.RunClaims{RunID: 1, Repository: "octo/repo", Workflow: "CI"}})
+	require.NoError(t, err)
+
+	contents := map[string][]byte{}
+	for _, runID := range []string{"1", "2"} {
+		content := uploadArtifactV4(t, server, token, runID, "report", nil)
+		status, _ := finalizeArtifactV4(t, server, token, runID, "report", int64(len(content)), "sha256:"+sha256Hex(content))
+		require.Equal(t, http.StatusOK, status)
+		contents[runID] = content
+	}
+	uploadArtifactV4(t, server, token, "2", "unfinalized", nil)
+
+	list := restArtifactList{}
+	require.Equal(t, http.StatusOK, getAPI(t, server.URL+"/repos/octo/repo/actions/runs/1/artifacts?name=report", "", &list))
+	require.Equal(t, 1, list.TotalCount)
+	artifact := list.Artifacts[0]
+	assert.Equal(t, artifactID("1", "report"), artifact.ID)
+	assert.Equal(t, "report", artifact.Name)
+	assert.Equal(t, "sha256:"+sha256Hex(contents["1"]), artifact.Digest)
+	assert.Equal(t, int64(len(contents["1"])), artifact.SizeInBytes)
+	assert.Equal(t, int64(1), artifact.WorkflowRun.ID)
+	assert.NotNil(t, artifact.ExpiresAt)
+
+	list = restArtifactList{}
+	require.Equal(t, http.StatusOK, getAPI(t, server.URL+"/repos/octo/repo/actions/artifacts?per_page=1&page=2", "", &list))
+	assert.Equal(t, 2, list.TotalCount)
+	assert.Len(t, list.Artifacts, 1)
+
+	list = restArtifactList{}
+	require.Equal(t, http.StatusOK, getAPI(t, server.URL+"/repos/other/repo/actions/artifacts", "", &list))
+	assert.Equal(t, 0, list.TotalCount)
+
+	var got restArtifact
+	require.Equal(t, http.StatusOK, getAPI(t, artifact.URL, "", &got))
+	assert.Equal(t, artifact.ID, got.ID)
+	assert.Equal(t, http.StatusNotFound, getAPI(t, server.URL+"/repos/octo/repo/actions/artifacts/1", "", nil))
+
+	// download-artifact follows the redirect of the archive to the signed url
+	var location string
+	require.Equal(t, http.StatusFound, getAPI(t, artifact.ArchiveDownloadURL, "", &location))
+	resp, err := http.Get(location)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, contents["1"], data)
+
+	// the other requests are forwarded to the GitHub API
+	forwarded := map[string]string{}
+	require.Equal(t, http.StatusOK, getAPI(t, server.URL+"/repos/octo/repo/issues", "", &forwarded))
+	assert.Equal(t, "GET /api/v3/repos/octo/repo/issues", forwarded["forwarded"])
+	req, err := http.NewRequest(http.MethodDelete, artifact.URL, nil)
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&forwarded))
+	assert.Equal(t, fmt.Sprintf("DELETE /api/v3/repos/octo/repo/actions/artifacts/%d", artifact.ID), forwarded["forwarded"])
+
+	t.Run("secret", func(t *testing.T) {
+		handler, err := NewHandler(dir, Options{Secret: "s3cret", GitHubAPIURL: upstream.URL + "/api/v3"})
+		require.NoError(t, err)
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		// the REST API is authorized by the GitHub API with the token of the client
+		assert.Equal(t, http.StatusOK, getAPI(t, server.URL+"/repos/octo/repo/actions/runs/2/artifacts", "token good", &restArtifactList{}))
+		assert.Equal(t, http.StatusNotFound, getAPI(t, server.URL+"/repos/octo/repo/actions/runs/2/artifacts", "token bad", nil))
+		assert.Equal(t, http.StatusOK, getAPI(t, server.URL+"/repos/octo/repo/issues", "token bad", nil))
+		// the artifact services still need a runtime token
+		assert.Equal(t, http.StatusUnauthorized, getAPI(t, server.URL+"/_apis/pipelines/workflows/1/artifacts", "token good", nil))
+	})
+}
@@ -82,13 +82,13 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
-	"errors"
+	"encoding/hex"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
 	"net/url"
-	"os"
 	"path"
 	"strconv"
 	"strings"
@@ -108,12 +108,15 @@ const (
 
 type artifactV4Routes struct {
 	prefix  string
-	fs      WriteFS
-	rfs     fs.FS
-	AppURL  string
-	baseDir string
+	storage Storage
+	AppURL  string // base url the client reached the server at
+	signKey []byte
+	policy  uploadPolicy
 }
 
+// defaultSignKey signs the urls of the artifacts of the servers without a secret
+var defaultSignKey = []byte{0xba, 0xdb, 0xee, 0xf0}
+
 type ArtifactContext struct {
 	Req  *http.Request
 	Resp http.ResponseWriter
@@ -138,14 +141,18 @@ func validateRunIDV4(ctx *ArtifactContext, rawRunID string) (interface{}, int64,
 }
 
 func RoutesV4(router *httprouter.Router, baseDir string, fsys WriteFS, rfs fs.FS) {
+	routesV4(router, fsStorage{baseDir: baseDir, fs: fsys, rfs: rfs}, defaultSignKey, uploadPolicy{retentionDays: DefaultRetentionDays})
+}
+
+func routesV4(router *httprouter.Router, storage Storage, signKey []byte, policy uploadPolicy) *artifactV4Routes {
 	route := &artifactV4Routes{
-		fs:      fsys,
-		rfs:     rfs,
-		baseDir: baseDir,
+		storage: storage,
 		prefix:  ArtifactV4RouteBase,
+		signKey: signKey,
+		policy:  policy,
 	}
 	router.POST(path.Join(ArtifactV4RouteBase, "CreateArtifact"), func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		route.AppURL = r.Host
+		route.AppURL = requestBaseURL(r)
 		route.createArtifact(&ArtifactContext{
 			Req:  r,
 			Resp: w,
@@ -164,14 +171,14 @@ func RoutesV4(router *httprouter.Router, baseDir string, fsys WriteFS, rfs fs.FS
 		})
 	})
 	router.POST(path.Join(ArtifactV4RouteBase, "GetSignedArtifactURL"), func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		route.AppURL = r.Host
+		route.AppURL = requestBaseURL(r)
 		route.getSignedArtifactURL(&ArtifactContext{
 			Req:  r,
 			Resp: w,
 		})
 	})
 	router.POST(path.Join(ArtifactV4RouteBase, "DeleteArtifact"), func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		route.AppURL = r.Host
+		route.AppURL = requestBaseURL(r)
 		route.deleteArtifact(&ArtifactContext{
 			Req:  r,
 			Resp: w,
@@ -189,10 +196,11 @@ func RoutesV4(router *httprouter.Router, baseDir string, fsys WriteFS, rfs fs.FS
 			Resp: w,
 		})
 	})
+	return route
 }
 
 func (r artifactV4Routes) buildSignature(endp, expires, artifactName string, taskID int64) []byte {
-	mac := hmac.New(sha256.New, []byte{0xba, 0xdb, 0xee, 0xf0})
+	mac := hmac.New(sha256.New, r.signKey)
 	mac.Write([]byte(endp))
 	mac.Write([]byte(expires))
 	mac.Write([]byte(artifactName))
@@ -202,7 +210,7 @@ func (r artifactV4Routes) buildSignature(endp, expires, artifactName string, tas
 
 func (r artifactV4Routes) buildArtifactURL(endp, artifactName string, taskID int64) string {
 	expires := time.Now().Add(60 * time.Minute).Format("2006-01-02 15:04:05.999999999 -0700 MST")
-	uploadURL := "http://" + strings.TrimSuffix(r.AppURL, "/") + strings.TrimSuffix(r.prefix, "/") +
+	uploadURL := strings.TrimSuffix(r.AppURL, "/") + strings.TrimSuffix(r.prefix, "/") +
 		"/" + endp + "?sig=" + base64.URLEncoding.EncodeToString(r.buildSignature(endp, expires, artifactName, taskID)) + "&expires=" + url.QueryEscape(expires) + "&artifactName=" + url.QueryEscape(artifactName) + "&taskID=" + fmt.Sprint(taskID)
 	return uploadURL
 }
@@ -271,15 +279,19 @@ func (r *artifactV4Routes) createArtifact(ctx *ArtifactContext) {
 
 	artifactName := req.Name
 
-	safeRunPath := safeResolve(r.baseDir, fmt.Sprint(runID))
-	safePath := safeResolve(safeRunPath, artifactName)
-	safePath = safeResolve(safePath, artifactName+".zip")
-	file, err := r.fs.OpenWritable(safePath)
+	if err := r.writeFile(r.storage.Create, zipKey(fmt.Sprint(runID), artifactName), http.NoBody); err != nil {
+		panic(err)
+	}
+	r.removeBlocks(fmt.Sprint(runID), artifactName)
 
-	if err != nil {
+	var expiresAt time.Time
+	if req.ExpiresAt != nil {
+		expiresAt = req.ExpiresAt.AsTime()
+	}
+	artifact := r.policy.newArtifact(ctx.Req, fmt.Sprint(runID), artifactName, 4, expiresAt)
+	if err := writeArtifactMetadata(r.storage, artifact); err != nil {
 		panic(err)
 	}
-	file.Close()
 
 	respData := CreateArtifactResponse{
 		Ok:              true,
@@ -288,45 +300,150 @@ func (r *artifactV4Routes) createArtifact(ctx *ArtifactContext) {
 	r.sendProtbufBody(ctx, &respData)
 }
 
+// uploadArtifact implements the subset of the Azure Blob Storage API upload-artifact uploads the zip archives with,
+// see https://learn.microsoft.com/en-us/rest/api/storageservices/operations-on-blobs:
+// blocks staged by id with comp=block, committed in the order of the block list of comp=blocklist,
+// single-shot uploads without comp, and the appended blocks of comp=appendBlock
 func (r *artifactV4Routes) uploadArtifact(ctx *ArtifactContext) {
 	task, artifactName, ok := r.verifySignature(ctx, "UploadArtifact")
 	if !ok {
 		return
 	}
+	runID := fmt.Sprint(task)
 
-	comp := ctx.Req.URL.Query().Get("comp")
-	switch comp {
-	case "block", "appendBlock":
+	if ctx.Req.Body == nil {
+		ctx.Error(http.StatusBadRequest, "No body given")
+		return
+	}
+
+	query := ctx.Req.URL.Query()
+	switch comp := query.Get("comp"); comp {
+	case "":
+		if err := r.writeFile(r.storage.Create, zipKey(runID, artifactName), ctx.Req.Body); err != nil {
+			log.Errorf("Error upload artifact %s: %v", artifactName, err)
+			ctx.Error(http.StatusInternalServerError, "Error upload artifact")
+			return
+		}
+		r.removeBlocks(runID, artifactName)
+		ctx.JSON(http.StatusCreated, "created")
+	case "block":
+		blockKey, err := r.blockKey(runID, artifactName, query.Get("blockid"))
+		if err != nil {
+			log.Errorf("Error invalid block of artifact %s: %v", artifactName, err)
+			ctx.Error(http.StatusBadRequest, "InvalidQueryParameterValue")
+			return
+		}
+		// retried blocks replace the staged ones
+		if err := r.writeFile(r.storage.Create, blockKey, ctx.Req.Body); err != nil {
+			log.Errorf("Error stage block of artifact %s: %v", artifactName, err)
+			ctx.Error(http.StatusInternalServerError, "Error stage block")
+			return
+		}
+		ctx.JSON(http.StatusCreated, "staged")
+	case "blocklist", "blockList":
+		if err := r.commitBlocks(runID, artifactName, ctx.Req.Body); err != nil {
+			log.Errorf("Error commit blocks of artifact %s: %v", artifactName, err)
+			ctx.Error(http.StatusBadRequest, "InvalidBlockList")
+			return
+		}
+		ctx.JSON(http.StatusCreated, "created")
+	case "appendBlock":
+		if err := r.writeFile(r.storage.Append, zipKey(runID, artifactName), ctx.Req.Body); err != nil {
+			log.Errorf("Error append block of artifact %s: %v", artifactName, err)
+			ctx.Error(http.StatusInternalServerError, "Error append block")
+			return
+		}
+		ctx.JSON(http.StatusCreated, "appended")
+	default:
+		log.Errorf("Error unsupported comp %q", comp)
+		ctx.Error(http.StatusBadRequest, "UnsupportedQueryParameter")
+	}
+}
 
-		safeRunPath := safeResolve(r.baseDir, fmt.Sprint(task))
-		safePath := safeResolve(safeRunPath, artifactName)
-		safePath = safeResolve(safePath, artifactName+".zip")
+// blocksDir keeps the staged blocks of the uploads apart from the artifacts
+const blocksDir = ".blocks"
 
-		file, err := r.fs.OpenAppendable(safePath)
+func blocksKey(runID, artifactName string) string {
+	return safeKey(blocksDir, runID, artifactName)
+}
 
+// blockKey returns the file of a staged block, the block ids are base64 encoded strings of up to 64 bytes
+func (r *artifactV4Routes) blockKey(runID, artifactName, blockID string) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(blockID)
+	if err != nil || len(decoded) == 0 || len(decoded) > 64 {
+		return "", fmt.Errorf("invalid block id %q", blockID)
+	}
+	return safeKey(blocksKey(runID, artifactName), hex.EncodeToString([]byte(blockID))), nil
+}
+
+func (r *artifactV4Routes) removeBlocks(runID, artifactName string) {
+	_ = r.storage.Remove(blocksKey(runID, artifactName))
+}
+
+// blockList is the body of a Put Block List request, the ids of the blocks of the blob in their order
+type blockList struct {
+	XMLName xml.Name `xml:"BlockList"`
+	Blocks  []struct {
+		XMLName xml.Name // Committed, Uncommitted or Latest, the blocks of the artifacts are always staged ones
+		ID      string   `xml:",chardata"`
+	} `xml:",any"`
+}
+
+// commitBlocks writes the staged blocks of the list to the zip archive of the artifact and discards the staged blocks
+func (r *artifactV4Routes) commitBlocks(runID, artifactName string, body io.Reader) error {
+	var list blockList
+	if err := xml.NewDecoder(body).Decode(&list); err != nil {
+		return fmt.Errorf("invalid block list: %w", err)
+	}
+	blockKeys := make([]string, 0, len(list.Blocks))
+	for _, block := range list.Blocks {
+		blockKey, err := r.blockKey(runID, artifactName, strings.TrimSpace(block.ID))
 		if err != nil {
-			panic(err)
+			return err
 		}
-		defer file.Close()
-
-		writer, ok := file.(io.Writer)
-		if !ok {
-			panic(errors.New("File is not writable"))
+		if _, err := r.storage.Stat(blockKey); err != nil {
+			return fmt.Errorf("block %s is not staged", block.ID)
 		}
+		blockKeys = append(blockKeys, blockKey)
+	}
 
-		if ctx.Req.Body == nil {
-			panic(errors.New("No body given"))
+	file, err := r.storage.Create(zipKey(runID, artifactName))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	for _, blockKey := range blockKeys {
+		if err := r.copyFile(file, blockKey); err != nil {
+			return err
 		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	r.removeBlocks(runID, artifactName)
+	return nil
+}
 
-		_, err = io.Copy(writer, ctx.Req.Body)
-		if err != nil {
-			panic(err)
-		}
+func (r *artifactV4Routes) copyFile(w io.Writer, key string) error {
+	file, err := r.storage.Open(key)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+func (r *artifactV4Routes) writeFile(open func(string) (io.WriteCloser, error), key string, body io.Reader) error {
+	file, err := open(key)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, body); err != nil {
 		file.Close()
-		ctx.JSON(http.StatusCreated, "appended")
-	case "blocklist":
-		ctx.JSON(http.StatusCreated, "created")
+		return err
 	}
+	return file.Close()
 }
 
 func (r *artifactV4Routes) finalizeArtifact(ctx *ArtifactContext) {
@@ -335,18 +452,75 @@ func (r *artifactV4Routes) finalizeArtifact(ctx *ArtifactContext) {
 	if ok := r.parseProtbufBody(ctx, &req); !ok {
 		return
 	}
-	_, _, ok := validateRunIDV4(ctx, req.WorkflowRunBackendId)
+	_, runID, ok := validateRunIDV4(ctx, req.WorkflowRunBackendId)
 	if !ok {
 		return
 	}
 
+	artifact, err := readArtifact(r.storage, fmt.Sprint(runID), req.Name)
+	if err != nil {
+		log.Errorf("Error artifact %s not found: %v", req.Name, err)
+		ctx.Error(http.StatusNotFound, "Error artifact not found")
+		return
+	}
+	sum, size, err := r.hashArtifact(artifact)
+	if err != nil {
+		log.Errorf("Error hash artifact %s: %v", req.Name, err)
+		ctx.Error(http.StatusInternalServerError, "Error hash artifact")
+		return
+	}
+	if size != req.Size {
+		log.Errorf("Error artifact %s has %d bytes, %d were uploaded", req.Name, size, req.Size)
+		ctx.Error(http.StatusBadRequest, "Error size mismatch")
+		return
+	}
+	if req.Hash != nil && req.Hash.Value != "sha256:"+sum {
+		log.Errorf("Error artifact %s has hash sha256:%s, %s was uploaded", req.Name, sum, req.Hash.Value)
+		ctx.Error(http.StatusBadRequest, "Error hash mismatch")
+		return
+	}
+
+	artifact.SHA256 = sum
+	artifact.Finalized = true
+	if err := writeArtifactMetadata(r.storage, artifact); err != nil {
+		log.Errorf("Error write metadata of artifact %s: %v", req.Name, err)
+		ctx.Error(http.StatusInternalServerError, "Error write metadata")
+		return
+	}
+
 	respData := FinalizeArtifactResponse{
 		Ok:         true,
-		ArtifactId: 1,
+		ArtifactId: artifact.ID,
 	}
 	r.sendProtbufBody(ctx, &respData)
 }
 
+// hashArtifact returns the hex encoded sha256 and the size of the zip archive of an artifact
+func (r *artifactV4Routes) hashArtifact(artifact *Artifact) (string, int64, error) {
+	file, err := r.storage.Open(zipKey(artifact.RunID, artifact.Name))
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// lookupArtifact returns the finalized artifact v4 of the run, or responds not found
+func (r *artifactV4Routes) lookupArtifact(ctx *ArtifactContext, runID, artifactName string) (*Artifact, bool) {
+	artifact, err := readArtifact(r.storage, runID, artifactName)
+	if err != nil || artifact.Version < 4 || !artifact.Finalized || artifact.Expired(time.Now()) {
+		log.Errorf("Error artifact %s of run %s not found", artifactName, runID)
+		ctx.Error(http.StatusNotFound, "Error artifact not found")
+		return nil, false
+	}
+	return artifact, true
+}
+
 func (r *artifactV4Routes) listArtifacts(ctx *ArtifactContext) {
 	var req ListArtifactsRequest
 
@@ -358,31 +532,31 @@ func (r *artifactV4Routes) listArtifacts(ctx *ArtifactContext) {
 		return
 	}
 
-	safePath := safeResolve(r.baseDir, fmt.Sprint(runID))
-
-	entries, err := fs.ReadDir(r.rfs, safePath)
+	filter := ArtifactFilter{RunID: fmt.Sprint(runID)}
+	if req.NameFilter != nil {
+		filter.Name = req.NameFilter.Value
+	}
+	artifacts, err := ListArtifacts(r.storage, filter)
 	if err != nil {
-		panic(err)
+		log.Errorf("Error list artifacts: %v", err)
+		ctx.Error(http.StatusInternalServerError, "Error list artifacts")
+		return
 	}
 
 	list := []*ListArtifactsResponse_MonolithArtifact{}
-
-	for _, entry := range entries {
-		if req.NameFilter == nil || req.NameFilter.Value == entry.Name() {
-			data := &ListArtifactsResponse_MonolithArtifact{
-				Name:                    entry.Name(),
-				CreatedAt:               timestamppb.Now(),
-				DatabaseId:              1,
-				WorkflowRunBackendId:    req.WorkflowRunBackendId,
-				WorkflowJobRunBackendId: req.WorkflowJobRunBackendId,
-				Size:                    0,
-			}
-			if info, err := entry.Info(); err == nil {
-				data.Size = info.Size()
-				data.CreatedAt = timestamppb.New(info.ModTime())
-			}
-			list = append(list, data)
+	now := time.Now()
+	for _, artifact := range artifacts {
+		if artifact.Version < 4 || !artifact.Finalized || artifact.Expired(now) || (req.IdFilter != nil && req.IdFilter.Value != artifact.ID) {
+			continue
 		}
+		list = append(list, &ListArtifactsResponse_MonolithArtifact{
+			Name:                    artifact.Name,
+			CreatedAt:               timestamppb.New(artifact.CreatedAt),
+			DatabaseId:              artifact.ID,
+			WorkflowRunBackendId:    req.WorkflowRunBackendId,
+			WorkflowJobRunBackendId: req.WorkflowJobRunBackendId,
+			Size:                    artifact.Size,
+		})
 	}
 
 	respData := ListArtifactsResponse{
@@ -402,11 +576,14 @@ func (r *artifactV4Routes) getSignedArtifactURL(ctx *ArtifactContext) {
 		return
 	}
 
-	artifactName := req.Name
+	artifact, ok := r.lookupArtifact(ctx, fmt.Sprint(runID), req.Name)
+	if !ok {
+		return
+	}
 
 	respData := GetSignedArtifactURLResponse{}
 
-	respData.SignedUrl = r.buildArtifactURL("DownloadArtifact", artifactName, runID)
+	respData.SignedUrl = r.buildArtifactURL("DownloadArtifact", artifact.Name, runID)
 	r.sendProtbufBody(ctx, &respData)
 }
 
@@ -416,13 +593,9 @@ func (r *artifactV4Routes) downloadArtifact(ctx *ArtifactContext) {
 		return
 	}
 
-	safeRunPath := safeResolve(r.baseDir, fmt.Sprint(task))
-	safePath := safeResolve(safeRunPath, artifactName)
-	safePath = safeResolve(safePath, artifactName+".zip")
-
-	file, _ := r.rfs.Open(safePath)
-
-	_, _ = io.Copy(ctx.Resp, file)
+	// the downloads are streamed from the storage, download-artifact resumes the interrupted ones with range requests
+	ctx.Resp.Header().Set("Content-Type", ArtifactV4ContentEncoding)
+	r.storage.Serve(ctx.Resp, ctx.Req, zipKey(fmt.Sprint(task), artifactName))
 }
 
 func (r *artifactV4Routes) deleteArtifact(ctx *ArtifactContext) {
@@ -435,10 +608,7 @@ func (r *artifactV4Routes) deleteArtifact(ctx *ArtifactContext) {
 	if !ok {
 		return
 	}
-	safeRunPath := safeResolve(r.baseDir, fmt.Sprint(runID))
-	safePath := safeResolve(safeRunPath, req.Name)
-
-	_ = os.RemoveAll(safePath)
+	_ = removeArtifact(r.storage, fmt.Sprint(runID), req.Name)
 
 	respData := DeleteArtifactResponse{
 		Ok:         true,
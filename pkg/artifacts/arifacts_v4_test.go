@@ -0,0 +1,213 @@
+package artifacts
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// callTwirp posts the request to a method of the artifact service v4 and decodes the response of a successful call
+func callTwirp(t *testing.T, server *httptest.Server, token, method string, req, resp proto.Message) int {
+	t.Helper()
+	body, err := protojson.Marshal(req)
+	require.NoError(t, err)
+	httpReq, err := http.NewRequest(http.MethodPost, server.URL+ArtifactV4RouteBase+"/"+method, bytes.NewReader(body))
+	require.NoError(t, err)
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+	httpResp, err := http.DefaultClient.Do(httpReq)
+	require.NoError(t, err)
+	defer httpResp.Body.Close()
+	data, err := io.ReadAll(httpResp.Body)
+	require.NoError(t, err)
+	if httpResp.StatusCode == http.StatusOK {
+		require.NoError(t, protojson.Unmarshal(data, resp))
+	}
+	return httpResp.StatusCode
+}
+
+func finalizeArtifactV4(t *testing.T, server *httptest.Server, token, runID, name string, size int64, hash string) (int, *FinalizeArtifactResponse) {
+	t.Helper()
+	resp := &FinalizeArtifactResponse{}
+	status := callTwirp(t, server, token, "FinalizeArtifact", &FinalizeArtifactRequest{
+		WorkflowRunBackendId:    runID,
+		WorkflowJobRunBackendId: runID,
+		Name:                    name,
+		Size:                    size,
+		Hash:                    wrapperspb.String(hash),
+	}, resp)
+	return status, resp
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestArtifactV4Finalize(t *testing.T) {
+	dir := t.TempDir()
+	server, token := newArtifactServer(t, dir, DefaultRetentionDays)
+
+	content := uploadArtifactV4(t, server, token, "1", "report", nil)
+	hash := "sha256:" + sha256Hex(content)
+
+	status, _ := finalizeArtifactV4(t, server, token, "1", "report", int64(len(content))+1, hash)
+	assert.Equal(t, http.StatusBadRequest, status, "size mismatch")
+	status, _ = finalizeArtifactV4(t, server, token, "1", "report", int64(len(content)), "sha256:"+sha256Hex(nil))
+	assert.Equal(t, http.StatusBadRequest, status, "hash mismatch")
+	status, _ = finalizeArtifactV4(t, server, token, "1", "missing", 0, hash)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// the artifacts are listed once finalized
+	list := &ListArtifactsResponse{}
+	require.Equal(t, http.StatusOK, callTwirp(t, server, token, "ListArtifacts", &ListArtifactsRequest{WorkflowRunBackendId: "1", WorkflowJobRunBackendId: "1"}, list))
+	assert.Empty(t, list.Artifacts)
+	signed := &GetSignedArtifactURLResponse{}
+	assert.Equal(t, http.StatusNotFound, callTwirp(t, server, token, "GetSignedArtifactURL", &GetSignedArtifactURLRequest{WorkflowRunBackendId: "1", WorkflowJobRunBackendId: "1", Name: "report"}, signed))
+
+	status, finalized := finalizeArtifactV4(t, server, token, "1", "report", int64(len(content)), hash)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, artifactID("1", "report"), finalized.ArtifactId)
+
+	artifacts, err := ListArtifacts(NewLocalStorage(dir), ArtifactFilter{Name: "report"})
+	require.NoError(t, err)
+	require.Len(t, artifacts, 1)
+	assert.True(t, artifacts[0].Finalized)
+	assert.Equal(t, sha256Hex(content), artifacts[0].SHA256)
+	assert.Equal(t, "CI", artifacts[0].Workflow)
+
+	other := uploadArtifactV4(t, server, token, "1", "other", nil)
+	status, _ = finalizeArtifactV4(t, server, token, "1", "other", int64(len(other)), "sha256:"+sha256Hex(other))
+	require.Equal(t, http.StatusOK, status)
+
+	for _, c := range []struct {
+		name string
+		req  *ListArtifactsRequest
+		want []string
+	}{
+		{name: "all", req: &ListArtifactsRequest{}, want: []string{"other", "report"}},
+		{name: "name", req: &ListArtifactsRequest{NameFilter: wrapperspb.String("report")}, want: []string{"report"}},
+		{name: "id", req: &ListArtifactsRequest{IdFilter: wrapperspb.Int64(artifactID("1", "other"))}, want: []string{"other"}},
+		{name: "no match", req: &ListArtifactsRequest{IdFilter: wrapperspb.Int64(1)}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			c.req.WorkflowRunBackendId = "1"
+			c.req.WorkflowJobRunBackendId = "1"
+			list := &ListArtifactsResponse{}
+			require.Equal(t, http.StatusOK, callTwirp(t, server, token, "ListArtifacts", c.req, list))
+			var names []string
+			for _, artifact := range list.Artifacts {
+				names = append(names, artifact.Name)
+				assert.Equal(t, artifactID("1", artifact.Name), artifact.DatabaseId)
+			}
+			assert.ElementsMatch(t, c.want, names)
+		})
+	}
+
+	require.Equal(t, http.StatusOK, callTwirp(t, server, token, "GetSignedArtifactURL", &GetSignedArtifactURLRequest{WorkflowRunBackendId: "1", WorkflowJobRunBackendId: "1", Name: "report"}, signed))
+	resp, err := http.Get(signed.SignedUrl)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+}
+
+func TestArtifactV4UploadBlocks(t *testing.T) {
+	dir := t.TempDir()
+	server, token := newArtifactServer(t, dir, DefaultRetentionDays)
+
+	create := func(name string) string {
+		resp := &CreateArtifactResponse{}
+		require.Equal(t, http.StatusOK, callTwirp(t, server, token, "CreateArtifact", &CreateArtifactRequest{WorkflowRunBackendId: "1", WorkflowJobRunBackendId: "1", Name: name, Version: 4}, resp))
+		return resp.SignedUploadUrl
+	}
+	put := func(target string, body []byte) int {
+		resp, err := http.DefaultClient.Do(mustRequest(t, http.MethodPut, target, body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	blockID := func(i int) string {
+		return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("block-%06d", i)))
+	}
+	blockList := func(ids ...string) []byte {
+		var b strings.Builder
+		b.WriteString(`<?xml version="1.0" encoding="utf-8"?><BlockList>`)
+		for _, id := range ids {
+			b.WriteString("<Latest>" + id + "</Latest>")
+		}
+		b.WriteString("</BlockList>")
+		return []byte(b.String())
+	}
+
+	content := make([]byte, 64*1024)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+	const blocks = 16
+	chunk := len(content) / blocks
+
+	uploadURL := create("parallel")
+	// a retried block replaces the first attempt
+	require.Equal(t, http.StatusCreated, put(uploadURL+"&comp=block&blockid="+url.QueryEscape(blockID(3)), []byte("broken")))
+	var wg sync.WaitGroup
+	statuses := make([]int, blocks)
+	for i := blocks - 1; i >= 0; i-- {
+		req := mustRequest(t, http.MethodPut, uploadURL+"&comp=block&blockid="+url.QueryEscape(blockID(i)), content[i*chunk:(i+1)*chunk])
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := http.DefaultClient.Do(req)
+			if err == nil {
+				statuses[i] = resp.StatusCode
+				resp.Body.Close()
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i, status := range statuses {
+		require.Equal(t, http.StatusCreated, status, "block %d", i)
+	}
+
+	ids := make([]string, 0, blocks)
+	for i := 0; i < blocks; i++ {
+		ids = append(ids, blockID(i))
+	}
+	assert.Equal(t, http.StatusBadRequest, put(uploadURL+"&comp=blocklist", blockList(append(ids, blockID(blocks))...)), "unknown block")
+	assert.Equal(t, http.StatusBadRequest, put(uploadURL+"&comp=block&blockid=not-base64", []byte("x")))
+	require.Equal(t, http.StatusCreated, put(uploadURL+"&comp=blocklist", blockList(ids...)))
+	status, _ := finalizeArtifactV4(t, server, token, "1", "parallel", int64(len(content)), "sha256:"+sha256Hex(content))
+	require.Equal(t, http.StatusOK, status)
+	assert.NoDirExists(t, filepath.Join(dir, blocksKey("1", "parallel")), "the staged blocks are discarded once committed")
+
+	uploadURL = create("single-shot")
+	require.Equal(t, http.StatusCreated, put(uploadURL, content))
+	status, _ = finalizeArtifactV4(t, server, token, "1", "single-shot", int64(len(content)), "sha256:"+sha256Hex(content))
+	require.Equal(t, http.StatusOK, status)
+
+	uploadURL = create("appended")
+	require.Equal(t, http.StatusCreated, put(uploadURL+"&comp=appendBlock", content[:chunk]))
+	require.Equal(t, http.StatusCreated, put(uploadURL+"&comp=appendBlock", content[chunk:]))
+	status, _ = finalizeArtifactV4(t, server, token, "1", "appended", int64(len(content)), "sha256:"+sha256Hex(content))
+	require.Equal(t, http.StatusOK, status)
+
+	artifacts, err := ListArtifacts(NewLocalStorage(dir), ArtifactFilter{RunID: "1"})
+	require.NoError(t, err)
+	assert.Len(t, artifacts, 3)
+}
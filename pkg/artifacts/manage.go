@@ -0,0 +1,437 @@
+package artifacts
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nektos/act/pkg/common"
+)
+
+// DefaultRetentionDays is the retention of the artifacts uploaded without retention-days, like the default of GitHub
+const DefaultRetentionDays = 90
+
+// metadataDir keeps the metadata of the artifacts apart from their content, which the routes list by run
+const metadataDir = ".metadata"
+
+// Artifact is an artifact of the artifact server, stored in <run id>/<name> of its storage
+type Artifact struct {
+	ID         int64     `json:"id"` // derived from the run and the name, see artifactID
+	RunID      string    `json:"runId"`
+	Name       string    `json:"name"`
+	Workflow   string    `json:"workflow,omitempty"`   // name of the workflow of the run, empty if unknown
+	Repository string    `json:"repository,omitempty"` // repository of the run, empty if unknown
+	Version    int       `json:"version"`              // major version of upload-artifact, the artifacts v4 are stored as zip archives
+	CreatedAt  time.Time `json:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`        // zero if the artifact is kept forever
+	Finalized  bool      `json:"finalized"`        // whether the upload of an artifact v4 was verified and finalized
+	SHA256     string    `json:"sha256,omitempty"` // hex encoded hash of the zip archive of an artifact v4
+	Size       int64     `json:"-"`                // size of the stored content, computed when listed
+}
+
+// artifactID returns the id of an artifact, a hash of the run and the name within the integers javascript represents exactly
+func artifactID(runID, name string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(runID + "/" + name))
+	return int64(h.Sum64() & (1<<53 - 1))
+}
+
+// Expired returns whether the retention of the artifact has passed
+func (a *Artifact) Expired(now time.Time) bool {
+	return !a.ExpiresAt.IsZero() && a.ExpiresAt.Before(now)
+}
+
+// ArtifactFilter selects the artifacts to list, download or delete, the empty fields match all artifacts.
+type ArtifactFilter struct {
+	RunID    string
+	Workflow string
+	Name     string
+}
+
+// IsEmpty returns whether the filter matches all artifacts.
+func (f ArtifactFilter) IsEmpty() bool {
+	return f.RunID == "" && f.Workflow == "" && f.Name == ""
+}
+
+func (f ArtifactFilter) match(artifact *Artifact) bool {
+	return (f.RunID == "" || f.RunID == artifact.RunID) &&
+		(f.Workflow == "" || f.Workflow == artifact.Workflow) &&
+		(f.Name == "" || f.Name == artifact.Name)
+}
+
+// uploadPolicy decides the metadata of the artifacts created by the routes
+type uploadPolicy struct {
+	secret        string // verifies the runtime tokens the workflow of an artifact is read from
+	retentionDays int    // retention of the artifacts uploaded without one, 0 keeps them forever
+}
+
+// newArtifact returns the metadata of an artifact created by the request, expiresAt is zero for the default retention
+func (p uploadPolicy) newArtifact(req *http.Request, runID, name string, version int, expiresAt time.Time) *Artifact {
+	now := time.Now().UTC()
+	artifact := &Artifact{
+		ID:        artifactID(runID, name),
+		RunID:     runID,
+		Name:      name,
+		Version:   version,
+		CreatedAt: now,
+		ExpiresAt: expiresAt.UTC(),
+	}
+	if expiresAt.IsZero() && p.retentionDays > 0 {
+		artifact.ExpiresAt = now.AddDate(0, 0, p.retentionDays)
+	}
+	// the workflow is informative, the artifacts of the requests without a valid token are kept without it
+	if run, err := common.ParseRunClaims(req, p.secret); err == nil && run != nil {
+		artifact.Workflow = run.Workflow
+		artifact.Repository = run.Repository
+	}
+	return artifact
+}
+
+func metadataKey(runID, name string) string {
+	return safeKey(metadataDir, runID, name+".json")
+}
+
+func zipKey(runID, name string) string {
+	return safeKey(runID, name, name+".zip")
+}
+
+func writeArtifactMetadata(storage Storage, artifact *Artifact) error {
+	file, err := storage.Create(metadataKey(artifact.RunID, artifact.Name))
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(file).Encode(artifact); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// readArtifact returns the artifact stored in the directory of the run
+func readArtifact(storage Storage, runID, name string) (*Artifact, error) {
+	objects, err := storage.List(safeKey(runID, name))
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, &fs.PathError{Op: "read", Path: safeKey(runID, name), Err: fs.ErrNotExist}
+	}
+	return loadArtifact(storage, runID, name, objects)
+}
+
+// loadArtifact returns the artifact of the files stored in the directory of the run, the metadata of the artifacts
+// uploaded before it was recorded are derived from their files
+func loadArtifact(storage Storage, runID, name string, objects []*ObjectInfo) (*Artifact, error) {
+	artifact := &Artifact{}
+	file, err := storage.Open(metadataKey(runID, name))
+	if err == nil {
+		err = json.NewDecoder(file).Decode(artifact)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata of artifact %s of run %s: %w", name, runID, err)
+		}
+	} else if errors.Is(err, fs.ErrNotExist) {
+		artifact = &Artifact{RunID: runID, Name: name, Version: 3, Finalized: true}
+		for _, object := range objects {
+			if object.Key == zipKey(runID, name) {
+				artifact.Version = 4
+			}
+			if object.ModTime.After(artifact.CreatedAt) {
+				artifact.CreatedAt = object.ModTime.UTC()
+			}
+		}
+	} else {
+		return nil, err
+	}
+	artifact.ID = artifactID(runID, name)
+
+	for _, object := range objects {
+		artifact.Size += object.Size
+	}
+	return artifact, nil
+}
+
+// ListArtifacts returns the artifacts of an artifact server storage matching the filter, the most recent first.
+// The artifacts with invalid metadata are skipped with a warning.
+func ListArtifacts(storage Storage, filter ArtifactFilter) ([]*Artifact, error) {
+	objects, err := storage.List(safeKey(filter.RunID))
+	if err != nil {
+		return nil, err
+	}
+
+	// the files are listed by key, the files of an artifact are adjacent
+	var artifacts []*Artifact
+	for i := 0; i < len(objects); {
+		parts := strings.SplitN(objects[i].Key, "/", 3)
+		j := i + 1
+		if len(parts) < 3 || strings.HasPrefix(parts[0], ".") || (filter.Name != "" && filter.Name != parts[1]) {
+			i = j
+			continue
+		}
+		prefix := parts[0] + "/" + parts[1] + "/"
+		for j < len(objects) && strings.HasPrefix(objects[j].Key, prefix) {
+			j++
+		}
+		artifact, err := loadArtifact(storage, parts[0], parts[1], objects[i:j])
+		if err != nil {
+			// one broken artifact doesn't hide the others
+			log.Warnf("Skipping artifact %s of run %s: %v", parts[1], parts[0], err)
+			i = j
+			continue
+		}
+		if filter.match(artifact) {
+			artifacts = append(artifacts, artifact)
+		}
+		i = j
+	}
+	sort.SliceStable(artifacts, func(i, j int) bool {
+		return artifacts[i].CreatedAt.After(artifacts[j].CreatedAt)
+	})
+	return artifacts, nil
+}
+
+// DownloadArtifact copies the files of an artifact to dest, the zip archives of the artifacts v4 are extracted
+// and the files uploaded gzip compressed are decompressed.
+func DownloadArtifact(storage Storage, artifact *Artifact, dest string) error {
+	if artifact.Version >= 4 {
+		return extractZip(storage, zipKey(artifact.RunID, artifact.Name), dest)
+	}
+	artifactKey := safeKey(artifact.RunID, artifact.Name)
+	objects, err := storage.List(artifactKey)
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		rel := strings.TrimPrefix(object.Key, artifactKey+"/")
+		if err := downloadFile(storage, object.Key, rel, dest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func downloadFile(storage Storage, key, rel, dest string) error {
+	file, err := storage.Open(key)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(rel, gzipExtension) {
+		rel = strings.TrimSuffix(rel, gzipExtension)
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	return writeFile(safeResolve(dest, rel), reader, 0o644)
+}
+
+// extractZip extracts the zip archive of the key, which is copied to a temporary file for the random access of the reader
+func extractZip(storage Storage, key, dest string) error {
+	file, err := storage.Open(key)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	temp, err := os.CreateTemp("", "act-artifact-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+	size, err := io.Copy(temp, file)
+	if err != nil {
+		return err
+	}
+	archive, err := zip.NewReader(temp, size)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range archive.File {
+		// the names are resolved inside dest, the entries can't escape it
+		target := safeResolve(dest, f.Name)
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+		mode := f.Mode().Perm()
+		if mode == 0 {
+			mode = 0o644
+		}
+		if err := extractZipFile(f, target, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractZipFile(f *zip.File, target string, mode fs.FileMode) error {
+	reader, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return writeFile(target, reader, mode)
+}
+
+func writeFile(name string, reader io.Reader, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, reader); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// DeleteArtifacts removes the artifacts and their metadata from an artifact server storage.
+func DeleteArtifacts(storage Storage, artifacts []*Artifact) error {
+	for _, artifact := range artifacts {
+		if err := removeArtifact(storage, artifact.RunID, artifact.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeArtifact(storage Storage, runID, name string) error {
+	for _, key := range []string{safeKey(runID, name), metadataKey(runID, name), blocksKey(runID, name)} {
+		if err := storage.Remove(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveExpiredArtifacts removes the artifacts whose retention has passed from an artifact server storage
+// and returns them. The staged blocks of the uploads that were never committed are removed too, those of the missing
+// artifacts and those staged retentionDays before now, 0 keeps the blocks of the existing artifacts.
+func RemoveExpiredArtifacts(storage Storage, now time.Time, retentionDays int) ([]*Artifact, error) {
+	artifacts, err := ListArtifacts(storage, ArtifactFilter{})
+	if err != nil {
+		return nil, err
+	}
+	var expired []*Artifact
+	for _, artifact := range artifacts {
+		if artifact.Expired(now) {
+			expired = append(expired, artifact)
+		}
+	}
+	if err := DeleteArtifacts(storage, expired); err != nil {
+		return expired, err
+	}
+	var stagedBefore time.Time
+	if retentionDays > 0 {
+		stagedBefore = now.AddDate(0, 0, -retentionDays)
+	}
+	return expired, removeStaleBlocks(storage, stagedBefore)
+}
+
+// retentionSweeper removes the expired artifacts of a storage at most once per interval, it is triggered by the
+// requests of the artifact server like the gc of the cache server
+type retentionSweeper struct {
+	storage       Storage
+	name          string // of the storage in the logs
+	retentionDays int
+	interval      time.Duration
+	sweeping      atomic.Bool
+	mu            sync.Mutex // guards interval and sweptAt
+	sweptAt       time.Time
+}
+
+func (s *retentionSweeper) sweep() {
+	if !s.sweeping.CompareAndSwap(false, true) {
+		return
+	}
+	defer s.sweeping.Store(false)
+
+	s.mu.Lock()
+	due := time.Since(s.sweptAt) >= s.interval
+	if due {
+		s.sweptAt = time.Now()
+	}
+	s.mu.Unlock()
+	if !due {
+		return
+	}
+	if expired, err := RemoveExpiredArtifacts(s.storage, time.Now(), s.retentionDays); err != nil {
+		log.Warnf("Failed to remove the expired artifacts of %s: %v", s.name, err)
+	} else if len(expired) > 0 {
+		log.Infof("Removed %d expired artifacts from %s", len(expired), s.name)
+	}
+}
+
+// middleware sweeps after the requests, the expired artifacts are removed while the server runs
+func (s *retentionSweeper) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		go s.sweep()
+	})
+}
+
+// removeStaleBlocks removes the staged blocks of the missing artifacts and the blocks staged before stagedBefore,
+// the artifacts v4 are created before their blocks are staged
+func removeStaleBlocks(storage Storage, stagedBefore time.Time) error {
+	objects, err := storage.List(blocksDir)
+	if err != nil {
+		return err
+	}
+	// the blocks are listed by key, the blocks of an upload are adjacent in .blocks/<run id>/<name>/<block>
+	for i := 0; i < len(objects); {
+		parts := strings.SplitN(objects[i].Key, "/", 4)
+		j := i + 1
+		if len(parts) < 4 {
+			i = j
+			continue
+		}
+		runID, name := parts[1], parts[2]
+		key := blocksKey(runID, name)
+		latest := objects[i].ModTime
+		for j < len(objects) && strings.HasPrefix(objects[j].Key, key+"/") {
+			if objects[j].ModTime.After(latest) {
+				latest = objects[j].ModTime
+			}
+			j++
+		}
+		i = j
+
+		_, err := storage.Stat(metadataKey(runID, name))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if err == nil && (stagedBefore.IsZero() || !latest.Before(stagedBefore)) {
+			continue
+		}
+		if err := storage.Remove(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package artifacts
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/nektos/act/pkg/common"
+)
+
+func newArtifactServer(t *testing.T, dir string, retentionDays int) (*httptest.Server, string) {
+	t.Helper()
+	handler, err := NewHandler(dir, Options{RetentionDays: retentionDays})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	token, err := common.CreateRuntimeToken(common.RuntimeTokenOptions{Run: common.RunClaims{TaskID: 7, RunID: 7, JobID: 7, Repository: "octo/repo", Workflow: "CI"}})
+	require.NoError(t, err)
+	return server, token
+}
+
+func doArtifactRequest(t *testing.T, method, url, token, body string, header http.Header) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode, "%s %s", method, url)
+}
+
+func uploadArtifactV3(t *testing.T, server *httptest.Server, token, runID, name, body string) {
+	doArtifactRequest(t, http.MethodPost, server.URL+"/_apis/pipelines/workflows/"+runID+"/artifacts", token, body, nil)
+	doArtifactRequest(t, http.MethodPut, server.URL+"/upload/"+runID+"?itemPath="+name+"/hello.txt", token, "hello", nil)
+
+	var gz bytes.Buffer
+	writer := gzip.NewWriter(&gz)
+	_, _ = writer.Write([]byte("compressed"))
+	require.NoError(t, writer.Close())
+	doArtifactRequest(t, http.MethodPut, server.URL+"/upload/"+runID+"?itemPath="+name+"/dir/compressed.txt", token, gz.String(), http.Header{"Content-Encoding": {"gzip"}})
+}
+
+// uploadArtifactV4 creates an artifact v4 and uploads its zip archive, which is returned
+func uploadArtifactV4(t *testing.T, server *httptest.Server, token string, runID, name string, expiresAt *timestamppb.Timestamp) []byte {
+	body, err := protojson.Marshal(&CreateArtifactRequest{WorkflowRunBackendId: runID, WorkflowJobRunBackendId: runID, Name: name, ExpiresAt: expiresAt, Version: 4})
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, server.URL+ArtifactV4RouteBase+"/CreateArtifact", bytes.NewReader(body))
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	created := &CreateArtifactResponse{}
+	require.NoError(t, protojson.Unmarshal(data, created))
+
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	file, err := writer.Create("sub/report.txt")
+	require.NoError(t, err)
+	_, _ = file.Write([]byte("report"))
+	// the entries escaping the destination are extracted inside it
+	file, err = writer.Create("../../escape.txt")
+	require.NoError(t, err)
+	_, _ = file.Write([]byte("escape"))
+	require.NoError(t, writer.Close())
+
+	resp, err = http.DefaultClient.Do(mustRequest(t, http.MethodPut, created.SignedUploadUrl, archive.Bytes()))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	return archive.Bytes()
+}
+
+func mustRequest(t *testing.T, method, url string, body []byte) *http.Request {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	require.NoError(t, err)
+	return req
+}
+
+func TestManageArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	storage := NewLocalStorage(dir)
+	server, token := newArtifactServer(t, dir, 30)
+
+	uploadArtifactV3(t, server, token, "1", "logs", `{"Type":"actions_storage","Name":"logs","RetentionDays":5}`)
+	uploadArtifactV4(t, server, token, "2", "report", nil)
+	uploadArtifactV4(t, server, "", "2", "anonymous", timestamppb.New(time.Now().Add(time.Hour)))
+	// the artifacts stored before the metadata was recorded
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "3", "legacy"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "3", "legacy", "file.txt"), []byte("legacy"), 0o644))
+
+	artifacts, err := ListArtifacts(storage, ArtifactFilter{})
+	require.NoError(t, err)
+	require.Len(t, artifacts, 4)
+	byName := map[string]*Artifact{}
+	for _, artifact := range artifacts {
+		byName[artifact.Name] = artifact
+	}
+
+	logs := byName["logs"]
+	assert.Equal(t, "1", logs.RunID)
+	assert.Equal(t, "CI", logs.Workflow)
+	assert.Equal(t, "octo/repo", logs.Repository)
+	assert.Equal(t, 3, logs.Version)
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, 5), logs.ExpiresAt, time.Minute)
+
+	report := byName["report"]
+	assert.Equal(t, 4, report.Version)
+	assert.Equal(t, "CI", report.Workflow)
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, 30), report.ExpiresAt, time.Minute)
+	assert.Positive(t, report.Size)
+
+	assert.Equal(t, "", byName["anonymous"].Workflow)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), byName["anonymous"].ExpiresAt, time.Minute)
+
+	legacy := byName["legacy"]
+	assert.Equal(t, 3, legacy.Version)
+	assert.True(t, legacy.ExpiresAt.IsZero())
+	assert.Equal(t, int64(len("legacy")), legacy.Size)
+
+	for _, c := range []struct {
+		filter ArtifactFilter
+		want   []string
+	}{
+		{filter: ArtifactFilter{RunID: "2"}, want: []string{"anonymous", "report"}},
+		{filter: ArtifactFilter{Workflow: "CI"}, want: []string{"logs", "report"}},
+		{filter: ArtifactFilter{Workflow: "CI", Name: "logs"}, want: []string{"logs"}},
+		{filter: ArtifactFilter{Name: "missing"}},
+	} {
+		artifacts, err := ListArtifacts(storage, c.filter)
+		require.NoError(t, err)
+		var names []string
+		for _, artifact := range artifacts {
+			names = append(names, artifact.Name)
+		}
+		assert.ElementsMatch(t, c.want, names, "%+v", c.filter)
+	}
+
+	t.Run("download", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "a", "b")
+		require.NoError(t, DownloadArtifact(storage, logs, dest))
+		data, err := os.ReadFile(filepath.Join(dest, "hello.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(data))
+		data, err = os.ReadFile(filepath.Join(dest, "dir", "compressed.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "compressed", string(data))
+
+		require.NoError(t, DownloadArtifact(storage, report, dest))
+		data, err = os.ReadFile(filepath.Join(dest, "sub", "report.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "report", string(data))
+		assert.FileExists(t, filepath.Join(dest, "escape.txt"))
+		assert.NoFileExists(t, filepath.Join(filepath.Dir(filepath.Dir(dest)), "escape.txt"))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, DeleteArtifacts(storage, []*Artifact{legacy}))
+		assert.NoDirExists(t, filepath.Join(dir, "3"))
+
+		// the v4 api deletes the metadata too
+		body, err := protojson.Marshal(&DeleteArtifactRequest{WorkflowRunBackendId: "2", WorkflowJobRunBackendId: "2", Name: "anonymous"})
+		require.NoError(t, err)
+		doArtifactRequest(t, http.MethodPost, server.URL+ArtifactV4RouteBase+"/DeleteArtifact", token, string(body), nil)
+		assert.NoFileExists(t, filepath.Join(dir, metadataKey("2", "anonymous")))
+
+		artifacts, err := ListArtifacts(storage, ArtifactFilter{})
+		require.NoError(t, err)
+		assert.Len(t, artifacts, 2)
+	})
+
+	t.Run("invalid metadata is skipped", func(t *testing.T) {
+		for _, key := range []string{metadataKey("5", "broken"), safeKey("5", "broken", "file.txt")} {
+			file, err := storage.Create(key)
+			require.NoError(t, err)
+			_, err = file.Write([]byte("{"))
+			require.NoError(t, err)
+			require.NoError(t, file.Close())
+		}
+		defer func() {
+			require.NoError(t, removeArtifact(storage, "5", "broken"))
+		}()
+
+		artifacts, err := ListArtifacts(storage, ArtifactFilter{})
+		require.NoError(t, err)
+		assert.Len(t, artifacts, 2)
+		_, err = RemoveExpiredArtifacts(storage, time.Now(), 30)
+		assert.NoError(t, err)
+	})
+
+	t.Run("stale blocks are removed", func(t *testing.T) {
+		stage := func(runID, name string) string {
+			key := safeKey(blocksKey(runID, name), "626c6f636b")
+			file, err := storage.Create(key)
+			require.NoError(t, err)
+			require.NoError(t, file.Close())
+			return filepath.Join(dir, filepath.FromSlash(key))
+		}
+		missing := stage("9", "never-created")
+		staged := stage("2", "report")
+
+		expired, err := RemoveExpiredArtifacts(storage, time.Now(), 30)
+		require.NoError(t, err)
+		assert.Empty(t, expired)
+		assert.NoFileExists(t, missing)
+		assert.FileExists(t, staged)
+
+		// the uploads of the existing artifacts are abandoned after the retention period
+		old := time.Now().AddDate(0, 0, -31)
+		require.NoError(t, os.Chtimes(staged, old, old))
+		_, err = RemoveExpiredArtifacts(storage, time.Now(), 0)
+		require.NoError(t, err)
+		assert.FileExists(t, staged)
+		_, err = RemoveExpiredArtifacts(storage, time.Now(), 30)
+		require.NoError(t, err)
+		assert.NoFileExists(t, staged)
+	})
+
+	t.Run("expired artifacts are removed on start", func(t *testing.T) {
+		expired, err := RemoveExpiredArtifacts(storage, time.Now().AddDate(0, 0, 10), 30)
+		require.NoError(t, err)
+		require.Len(t, expired, 1)
+		assert.Equal(t, "logs", expired[0].Name)
+		assert.NoDirExists(t, filepath.Join(dir, "1"))
+		assert.NoDirExists(t, filepath.Join(dir, metadataDir, "1"))
+
+		report.ExpiresAt = time.Now().Add(-time.Minute)
+		require.NoError(t, writeArtifactMetadata(storage, report))
+		newArtifactServer(t, dir, 30)
+		artifacts, err := ListArtifacts(storage, ArtifactFilter{})
+		require.NoError(t, err)
+		assert.Empty(t, artifacts)
+	})
+
+	t.Run("expired artifacts are removed while serving", func(t *testing.T) {
+		sweeper := &retentionSweeper{storage: storage, name: dir, retentionDays: 30, interval: time.Hour}
+		handler := sweeper.middleware(http.NotFoundHandler())
+		sweeper.sweep()
+
+		expiring := &Artifact{RunID: "6", Name: "expiring", ExpiresAt: time.Now().Add(-time.Minute)}
+		require.NoError(t, writeArtifactMetadata(storage, expiring))
+		file, err := storage.Create(safeKey("6", "expiring", "file.txt"))
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+		// the sweeps are throttled to one per interval
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		sweeper.sweep()
+		artifacts, err := ListArtifacts(storage, ArtifactFilter{})
+		require.NoError(t, err)
+		assert.Len(t, artifacts, 1)
+
+		sweeper.mu.Lock()
+		sweeper.interval = 0
+		sweeper.mu.Unlock()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Eventually(t, func() bool {
+			artifacts, err := ListArtifacts(storage, ArtifactFilter{})
+			return err == nil && len(artifacts) == 0
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
@@ -0,0 +1,195 @@
+package artifacts
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nektos/act/pkg/common"
+)
+
+// OIDCTokenPath is the route of the OIDC tokens of the jobs, ACTIONS_ID_TOKEN_REQUEST_URL
+const OIDCTokenPath = "/_apis/oidc/token"
+
+// oidcTokenLifetime is the lifetime of the OIDC tokens, like the tokens of GitHub they are exchanged right away
+const oidcTokenLifetime = 5 * time.Minute
+
+// oidcIssuer issues the OIDC tokens of the jobs, which request them with a token of common.CreateIDTokenRequestToken
+type oidcIssuer struct {
+	key      *rsa.PrivateKey
+	keyID    string
+	issuer   string // issuer of the tokens, the url of the requests if empty
+	audience string // audience of the tokens requested without one, https://github.com/<owner> if empty
+	secret   string // verifies the request tokens, no tokens are issued if empty
+}
+
+func newOIDCIssuer(options Options) (*oidcIssuer, error) {
+	key := options.OIDCKey
+	if key == nil {
+		var err error
+		if key, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			return nil, fmt.Errorf("failed to generate the OIDC signing key: %w", err)
+		}
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	secret := options.OIDCSecret
+	if secret == "" {
+		secret = options.Secret
+	}
+	return &oidcIssuer{
+		key:      key,
+		keyID:    hex.EncodeToString(sum[:8]),
+		issuer:   strings.TrimSuffix(options.OIDCIssuer, "/"),
+		audience: options.OIDCAudience,
+		secret:   secret,
+	}, nil
+}
+
+// ReadOIDCKey reads the RSA private key the OIDC tokens are signed with from a PEM file, in PKCS #1 or PKCS #8.
+func ReadOIDCKey(name string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", name)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an RSA private key", name)
+	}
+	return key, nil
+}
+
+// routesOIDC serves the OIDC tokens of the jobs and the discovery documents their audiences verify them with
+func routesOIDC(router *httprouter.Router, issuer *oidcIssuer) {
+	router.GET(OIDCTokenPath, issuer.token)
+	router.GET("/.well-known/openid-configuration", issuer.configuration)
+	router.GET("/.well-known/jwks", issuer.jwks)
+}
+
+func (o *oidcIssuer) issuerURL(r *http.Request) string {
+	if o.issuer != "" {
+		return o.issuer
+	}
+	return requestBaseURL(r)
+}
+
+// token returns an OIDC token with the claims of the request token, in the format of @actions/core's getIDToken
+func (o *oidcIssuer) token(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// anyone could sign the request tokens of an empty secret
+	if o.secret == "" {
+		responseOIDCJSON(w, http.StatusForbidden, map[string]string{"message": "the artifact server has no secret to verify OIDC token requests, see --server-token"})
+		return
+	}
+	claims, err := common.ParseIDTokenRequest(r, o.secret)
+	if err != nil {
+		responseOIDCJSON(w, http.StatusUnauthorized, map[string]string{"message": fmt.Sprintf("unauthorized: %v", err)})
+		return
+	}
+	audience := r.URL.Query().Get("audience")
+	if audience == "" {
+		audience = o.audience
+	}
+	if audience == "" {
+		audience = "https://github.com/" + claims.RepositoryOwner
+	}
+
+	now := time.Now()
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		responseOIDCJSON(w, http.StatusInternalServerError, map[string]string{"message": err.Error()})
+		return
+	}
+	// the claims of the job are merged with the registered claims, which share the sub claim
+	data, err := json.Marshal(claims)
+	if err != nil {
+		responseOIDCJSON(w, http.StatusInternalServerError, map[string]string{"message": err.Error()})
+		return
+	}
+	mapClaims := jwt.MapClaims{}
+	if err := json.Unmarshal(data, &mapClaims); err != nil {
+		responseOIDCJSON(w, http.StatusInternalServerError, map[string]string{"message": err.Error()})
+		return
+	}
+	mapClaims["iss"] = o.issuerURL(r)
+	mapClaims["aud"] = audience
+	mapClaims["iat"] = now.Unix()
+	mapClaims["nbf"] = now.Unix()
+	mapClaims["exp"] = now.Add(oidcTokenLifetime).Unix()
+	mapClaims["jti"] = hex.EncodeToString(jti)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, mapClaims)
+	token.Header["kid"] = o.keyID
+	signed, err := token.SignedString(o.key)
+	if err != nil {
+		responseOIDCJSON(w, http.StatusInternalServerError, map[string]string{"message": err.Error()})
+		return
+	}
+	responseOIDCJSON(w, http.StatusOK, map[string]string{"value": signed})
+}
+
+func (o *oidcIssuer) configuration(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	issuer := o.issuerURL(r)
+	responseOIDCJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                issuer,
+		"jwks_uri":                              issuer + "/.well-known/jwks",
+		"subject_types_supported":               []string{"public", "pairwise"},
+		"response_types_supported":              []string{"id_token"},
+		"scopes_supported":                      []string{"openid"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"claims_supported": []string{
+			"sub", "aud", "exp", "iat", "iss", "jti", "nbf", "ref", "sha", "repository", "repository_owner",
+			"run_id", "run_number", "run_attempt", "actor", "workflow", "workflow_ref", "job_workflow_ref",
+			"event_name", "ref_type", "head_ref", "base_ref", "environment", "runner_environment",
+		},
+	})
+}
+
+func (o *oidcIssuer) jwks(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	encode := base64.RawURLEncoding.EncodeToString
+	responseOIDCJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": o.keyID,
+			"n":   encode(o.key.N.Bytes()),
+			"e":   encode(big.NewInt(int64(o.key.E)).Bytes()),
+		}},
+	})
+}
+
+func responseOIDCJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("Error encode response body: %v", err)
+	}
+}
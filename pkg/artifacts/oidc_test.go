@@ -0,0 +1,152 @@
+package artifacts
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nektos/act/pkg/common"
+)
+
+func getOIDCJSON(t *testing.T, url, token string, v any) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+	return resp.StatusCode
+}
+
+func TestOIDCIssuer(t *testing.T) {
+	handler, err := NewHandler(t.TempDir(), Options{Secret: "s3cret"})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// the discovery documents are public
+	configuration := map[string]any{}
+	require.Equal(t, http.StatusOK, getOIDCJSON(t, server.URL+"/.well-known/openid-configuration", "", &configuration))
+	assert.Equal(t, server.URL, configuration["issuer"])
+	assert.Equal(t, server.URL+"/.well-known/jwks", configuration["jwks_uri"])
+
+	var jwks struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	require.Equal(t, http.StatusOK, getOIDCJSON(t, server.URL+"/.well-known/jwks", "", &jwks))
+	require.Len(t, jwks.Keys, 1)
+	n, err := base64.RawURLEncoding.DecodeString(jwks.Keys[0]["n"])
+	require.NoError(t, err)
+	e, err := base64.RawURLEncoding.DecodeString(jwks.Keys[0]["e"])
+	require.NoError(t, err)
+	publicKey := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+	requestToken, err := common.CreateIDTokenRequestToken("s3cret", common.IDTokenClaims{
+		Subject:         "repo:octo/repo:ref:refs/heads/main",
+		Ref:             "refs/heads/main",
+		Repository:      "octo/repo",
+		RepositoryOwner: "octo",
+	})
+	require.NoError(t, err)
+	parse := func(value string) jwt.MapClaims {
+		claims := jwt.MapClaims{}
+		token, err := jwt.ParseWithClaims(value, claims, func(token *jwt.Token) (any, error) {
+			assert.Equal(t, jwks.Keys[0]["kid"], token.Header["kid"])
+			return publicKey, nil
+		}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithIssuer(server.URL))
+		require.NoError(t, err)
+		require.True(t, token.Valid)
+		return claims
+	}
+
+	var response struct {
+		Value string `json:"value"`
+	}
+	require.Equal(t, http.StatusOK, getOIDCJSON(t, server.URL+OIDCTokenPath+"?api-version=2.0", requestToken, &response))
+	claims := parse(response.Value)
+	assert.Equal(t, "repo:octo/repo:ref:refs/heads/main", claims["sub"])
+	assert.Equal(t, "https://github.com/octo", claims["aud"])
+	assert.Equal(t, "octo/repo", claims["repository"])
+	assert.NotEmpty(t, claims["jti"])
+	exp, err := claims.GetExpirationTime()
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(oidcTokenLifetime), exp.Time, time.Minute)
+
+	require.Equal(t, http.StatusOK, getOIDCJSON(t, server.URL+OIDCTokenPath+"?api-version=2.0&audience=sts.amazonaws.com", requestToken, &response))
+	assert.Equal(t, "sts.amazonaws.com", parse(response.Value)["aud"])
+
+	// the runtime tokens and the tokens of other secrets can't request OIDC tokens
+	runtimeToken, err := common.CreateRuntimeToken(common.RuntimeTokenOptions{Secret: "s3cret", Run: common.RunClaims{RunID: 1}})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, getOIDCJSON(t, server.URL+OIDCTokenPath, runtimeToken, &response))
+	otherToken, err := common.CreateIDTokenRequestToken("other", common.IDTokenClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, getOIDCJSON(t, server.URL+OIDCTokenPath, otherToken, &response))
+	assert.Equal(t, http.StatusUnauthorized, getOIDCJSON(t, server.URL+OIDCTokenPath, "", &response))
+}
+
+func TestOIDCIssuerOptions(t *testing.T) {
+	dir := t.TempDir()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	for name, block := range map[string]*pem.Block{
+		"pkcs1.pem": {Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)},
+		"pkcs8.pem": {Type: "PRIVATE KEY", Bytes: pkcs8},
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0o600))
+		read, err := ReadOIDCKey(filepath.Join(dir, name))
+		require.NoError(t, err, name)
+		assert.True(t, key.Equal(read), name)
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "invalid.pem"), []byte("invalid"), 0o600))
+	_, err = ReadOIDCKey(filepath.Join(dir, "invalid.pem"))
+	assert.Error(t, err)
+
+	handler, err := NewHandler(t.TempDir(), Options{OIDCKey: key, OIDCIssuer: "https://oidc.example.com/", OIDCAudience: "act", OIDCSecret: "run"})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	requestToken, err := common.CreateIDTokenRequestToken("run", common.IDTokenClaims{RepositoryOwner: "octo"})
+	require.NoError(t, err)
+	var response struct {
+		Value string `json:"value"`
+	}
+	require.Equal(t, http.StatusOK, getOIDCJSON(t, server.URL+OIDCTokenPath, requestToken, &response))
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(response.Value, claims, func(*jwt.Token) (any, error) {
+		return &key.PublicKey, nil
+	}, jwt.WithIssuer("https://oidc.example.com"), jwt.WithAudience("act"))
+	assert.NoError(t, err)
+
+	// without a secret, anyone could sign the request tokens
+	handler, err = NewHandler(t.TempDir(), Options{OIDCKey: key})
+	require.NoError(t, err)
+	unsigned := httptest.NewServer(handler)
+	defer unsigned.Close()
+	requestToken, err = common.CreateIDTokenRequestToken("", common.IDTokenClaims{RepositoryOwner: "octo"})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, getOIDCJSON(t, unsigned.URL+OIDCTokenPath, requestToken, nil))
+}
@@ -2,18 +2,23 @@ package artifacts
 
 import (
 	"context"
+	"crypto/rsa"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
 
 	"github.com/nektos/act/pkg/common"
 )
@@ -92,12 +97,59 @@ func safeResolve(baseDir string, relPath string) string {
 	return filepath.Join(baseDir, filepath.Clean(filepath.Join(string(os.PathSeparator), relPath)))
 }
 
-func uploads(router *httprouter.Router, baseDir string, fsys WriteFS) {
+// requestBaseURL returns the url the client reached the server at, for the urls of the responses
+func requestBaseURL(req *http.Request) string {
+	if req.TLS != nil {
+		return "https://" + req.Host
+	}
+	return "http://" + req.Host
+}
+
+// createContainerRequest is the request of upload-artifact to create the container of an artifact
+type createContainerRequest struct {
+	Type          string
+	Name          string
+	RetentionDays int
+}
+
+// validRunID rejects the run ids which are not numbers with 400, the files of the runs are stored in the directories
+// of their ids and the routes must not reach the other directories of the storage, like metadataDir and blocksDir
+func validRunID(w http.ResponseWriter, runID string) bool {
+	if _, err := strconv.ParseUint(runID, 10, 64); err != nil {
+		log.Errorf("Error invalid run id %q", runID)
+		http.Error(w, "invalid run id", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func uploads(router *httprouter.Router, storage Storage, policy uploadPolicy) {
 	router.POST("/_apis/pipelines/workflows/:runId/artifacts", func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
 		runID := params.ByName("runId")
+		if !validRunID(w, runID) {
+			return
+		}
+
+		var container createContainerRequest
+		if req.Body != nil {
+			if err := json.NewDecoder(req.Body).Decode(&container); err != nil && err != io.EOF {
+				log.Errorf("Error decode request body: %v", err)
+				http.Error(w, "Error decode request body", http.StatusBadRequest)
+				return
+			}
+		}
+		if container.Name != "" {
+			var expiresAt time.Time
+			if container.RetentionDays > 0 {
+				expiresAt = time.Now().AddDate(0, 0, container.RetentionDays)
+			}
+			if err := writeArtifactMetadata(storage, policy.newArtifact(req, runID, container.Name, 3, expiresAt)); err != nil {
+				panic(err)
+			}
+		}
 
 		json, err := json.Marshal(FileContainerResourceURL{
-			FileContainerResourceURL: fmt.Sprintf("http://%s/upload/%s", req.Host, runID),
+			FileContainerResourceURL: fmt.Sprintf("%s/upload/%s", requestBaseURL(req), runID),
 		})
 		if err != nil {
 			panic(err)
@@ -112,20 +164,22 @@ func uploads(router *httprouter.Router, baseDir string, fsys WriteFS) {
 	router.PUT("/upload/:runId", func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
 		itemPath := req.URL.Query().Get("itemPath")
 		runID := params.ByName("runId")
+		if !validRunID(w, runID) {
+			return
+		}
 
 		if req.Header.Get("Content-Encoding") == "gzip" {
 			itemPath += gzipExtension
 		}
 
-		safeRunPath := safeResolve(baseDir, runID)
-		safePath := safeResolve(safeRunPath, itemPath)
+		key := safeKey(runID, itemPath)
 
-		file, err := func() (WritableFile, error) {
+		file, err := func() (io.WriteCloser, error) {
 			contentRange := req.Header.Get("Content-Range")
 			if contentRange != "" && !strings.HasPrefix(contentRange, "bytes 0-") {
-				return fsys.OpenAppendable(safePath)
+				return storage.Append(key)
 			}
-			return fsys.OpenWritable(safePath)
+			return storage.Create(key)
 		}()
 
 		if err != nil {
@@ -133,19 +187,18 @@ func uploads(router *httprouter.Router, baseDir string, fsys WriteFS) {
 		}
 		defer file.Close()
 
-		writer, ok := file.(io.Writer)
-		if !ok {
-			panic(errors.New("File is not writable"))
-		}
-
 		if req.Body == nil {
 			panic(errors.New("No body given"))
 		}
 
-		_, err = io.Copy(writer, req.Body)
+		_, err = io.Copy(file, req.Body)
 		if err != nil {
 			panic(err)
 		}
+		// the writers of object stores upload the file when they are closed
+		if err := file.Close(); err != nil {
+			panic(err)
+		}
 
 		json, err := json.Marshal(ResponseMessage{
 			Message: "success",
@@ -175,22 +228,30 @@ func uploads(router *httprouter.Router, baseDir string, fsys WriteFS) {
 	})
 }
 
-func downloads(router *httprouter.Router, baseDir string, fsys fs.FS) {
+func downloads(router *httprouter.Router, storage Storage) {
 	router.GET("/_apis/pipelines/workflows/:runId/artifacts", func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
 		runID := params.ByName("runId")
+		if !validRunID(w, runID) {
+			return
+		}
 
-		safePath := safeResolve(baseDir, runID)
+		key := safeKey(runID)
 
-		entries, err := fs.ReadDir(fsys, safePath)
+		objects, err := storage.List(key)
 		if err != nil {
 			panic(err)
 		}
 
 		var list []NamedFileContainerResourceURL
-		for _, entry := range entries {
+		for _, object := range objects {
+			// the entries of the run directory
+			name, _, _ := strings.Cut(strings.TrimPrefix(object.Key, key+"/"), "/")
+			if len(list) > 0 && list[len(list)-1].Name == name {
+				continue
+			}
 			list = append(list, NamedFileContainerResourceURL{
-				Name:                     entry.Name(),
-				FileContainerResourceURL: fmt.Sprintf("http://%s/download/%s", req.Host, runID),
+				Name:                     name,
+				FileContainerResourceURL: fmt.Sprintf("%s/download/%s", requestBaseURL(req), runID),
 			})
 		}
 
@@ -210,36 +271,35 @@ func downloads(router *httprouter.Router, baseDir string, fsys fs.FS) {
 
 	router.GET("/download/:container", func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
 		container := params.ByName("container")
+		if !validRunID(w, container) {
+			return
+		}
 		itemPath := req.URL.Query().Get("itemPath")
-		safePath := safeResolve(baseDir, filepath.Join(container, itemPath))
+		key := safeKey(container, itemPath)
 
-		var files []ContainerItem
-		err := fs.WalkDir(fsys, safePath, func(path string, entry fs.DirEntry, err error) error {
-			if !entry.IsDir() {
-				rel, err := filepath.Rel(safePath, path)
-				if err != nil {
-					panic(err)
-				}
-
-				// if it was upload as gzip
-				rel = strings.TrimSuffix(rel, gzipExtension)
-				path := filepath.Join(itemPath, rel)
-
-				rel = filepath.ToSlash(rel)
-				path = filepath.ToSlash(path)
-
-				files = append(files, ContainerItem{
-					Path:            path,
-					ItemType:        "file",
-					ContentLocation: fmt.Sprintf("http://%s/artifact/%s/%s/%s", req.Host, container, itemPath, rel),
-				})
-			}
-			return nil
-		})
+		objects, err := storage.List(key)
 		if err != nil {
 			panic(err)
 		}
 
+		var files []ContainerItem
+		for _, object := range objects {
+			rel := strings.TrimPrefix(strings.TrimPrefix(object.Key, key), "/")
+			if rel == "" {
+				rel = "."
+			}
+
+			// if it was upload as gzip
+			rel = strings.TrimSuffix(rel, gzipExtension)
+			path := path.Join(itemPath, rel)
+
+			files = append(files, ContainerItem{
+				Path:            path,
+				ItemType:        "file",
+				ContentLocation: fmt.Sprintf("%s/artifact/%s/%s/%s", requestBaseURL(req), container, itemPath, rel),
+			})
+		}
+
 		json, err := json.Marshal(ContainerItemResponse{
 			Value: files,
 		})
@@ -255,27 +315,100 @@ func downloads(router *httprouter.Router, baseDir string, fsys fs.FS) {
 
 	router.GET("/artifact/*path", func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
 		path := params.ByName("path")[1:]
+		if runID, _, _ := strings.Cut(path, "/"); !validRunID(w, runID) {
+			return
+		}
 
-		safePath := safeResolve(baseDir, path)
+		key := safeKey(path)
 
-		file, err := fsys.Open(safePath)
-		if err != nil {
+		if _, err := storage.Stat(key); err != nil {
 			// try gzip file
-			file, err = fsys.Open(safePath + gzipExtension)
-			if err != nil {
+			if _, err := storage.Stat(key + gzipExtension); err != nil {
 				panic(err)
 			}
+			key += gzipExtension
 			w.Header().Add("Content-Encoding", "gzip")
 		}
 
-		_, err = io.Copy(w, file)
+		// the downloads are streamed from the storage, with range requests
+		storage.Serve(w, req, key)
+	})
+}
+
+// Options configure an artifact server, see NewHandler
+type Options struct {
+	Secret        string  // the requests need a runtime token signed with it if set, see common.RequireAuthorization
+	RetentionDays int     // retention of the artifacts uploaded without retention-days, 0 keeps them forever
+	GitHubAPIURL  string  // GitHub API the server forwards to while it serves the artifacts of the REST API itself, see routesAPI
+	Storage       Storage // stores the artifacts, a LocalStorage of the artifact path if nil, see OpenStorage
+
+	OIDCKey      *rsa.PrivateKey // signs the OIDC tokens of the jobs, generated when the handler is created if nil, see ReadOIDCKey
+	OIDCIssuer   string          // issuer of the OIDC tokens, the url the jobs reach the server at if empty
+	OIDCAudience string          // audience of the OIDC tokens requested without one, https://github.com/<owner> if empty
+	OIDCSecret   string          // verifies the OIDC request tokens, Secret if empty. Without both, no OIDC tokens are issued
+}
+
+// NewHandler returns the handler of an artifact server storing the artifacts in artifactPath or the storage of the options, to be served by a long-running
+// server like `act serve-artifacts`. With a secret, the requests need a runtime token signed with it, except the requests
+// of the signed urls of the artifacts v4, which are signed with the secret too, the requests of the GitHub REST API and
+// the discovery documents of the OIDC issuer. The OIDC tokens are requested with the tokens of common.CreateIDTokenRequestToken.
+// The expired artifacts and the stale blocks of the uploads are removed when the handler is created.
+func NewHandler(artifactPath string, options Options) (http.Handler, error) {
+	storage := options.Storage
+	if storage == nil {
+		storage = NewLocalStorage(artifactPath)
+	}
+	sweeper := &retentionSweeper{storage: storage, name: artifactPath, retentionDays: options.RetentionDays, interval: time.Hour}
+	sweeper.sweep()
+
+	router := httprouter.New()
+	policy := uploadPolicy{secret: options.Secret, retentionDays: options.RetentionDays}
+	uploads(router, storage, policy)
+	downloads(router, storage)
+	signKey := defaultSignKey
+	if options.Secret != "" {
+		signKey = []byte(options.Secret)
+	}
+	route := routesV4(router, storage, signKey, policy)
+	issuer, err := newOIDCIssuer(options)
+	if err != nil {
+		return nil, err
+	}
+	routesOIDC(router, issuer)
+	if options.GitHubAPIURL != "" {
+		upstream, err := url.Parse(options.GitHubAPIURL)
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("invalid GitHub API url %q: %w", options.GitHubAPIURL, err)
 		}
-	})
+		routesAPI(router, route, upstream)
+	}
+	if options.Secret == "" {
+		return sweeper.middleware(router), nil
+	}
+	return sweeper.middleware(common.RequireAuthorization(options.Secret, func(r *http.Request) bool {
+		if r.URL.Path == path.Join(ArtifactV4RouteBase, "UploadArtifact") || r.URL.Path == path.Join(ArtifactV4RouteBase, "DownloadArtifact") {
+			return true
+		}
+		// the audiences of the OIDC tokens fetch the discovery documents without a token
+		if strings.HasPrefix(r.URL.Path, "/.well-known/") {
+			return true
+		}
+		// the requests of the REST API are authorized by the GitHub API with the token of the client
+		return options.GitHubAPIURL != "" && !isArtifactServerPath(r.URL.Path)
+	}, router)), nil
 }
 
-func Serve(ctx context.Context, artifactPath string, addr string, port string) context.CancelFunc {
+// isArtifactServerPath returns whether the path is one of the routes of the artifact services rather than of the REST API
+func isArtifactServerPath(urlPath string) bool {
+	for _, prefix := range []string{"/_apis/", "/.well-known/", "/upload/", "/download/", "/artifact/", ArtifactV4RouteBase + "/"} {
+		if strings.HasPrefix(urlPath, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func Serve(ctx context.Context, artifactPath string, addr string, port string, options Options) context.CancelFunc {
 	serverContext, cancel := context.WithCancel(ctx)
 	logger := common.Logger(serverContext)
 
@@ -283,18 +416,16 @@ func Serve(ctx context.Context, artifactPath string, addr string, port string) c
 		return cancel
 	}
 
-	router := httprouter.New()
-
 	logger.Debugf("Artifacts base path '%s'", artifactPath)
-	fsys := readWriteFSImpl{}
-	uploads(router, artifactPath, fsys)
-	downloads(router, artifactPath, fsys)
-	RoutesV4(router, artifactPath, fsys, fsys)
 
+	handler, err := NewHandler(artifactPath, options)
+	if err != nil {
+		logger.Fatal(err)
+	}
 	server := &http.Server{
 		Addr:              fmt.Sprintf("%s:%s", addr, port),
 		ReadHeaderTimeout: 2 * time.Second,
-		Handler:           router,
+		Handler:           handler,
 	}
 
 	// run server
@@ -17,6 +17,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/nektos/act/pkg/common"
 	"github.com/nektos/act/pkg/model"
 	"github.com/nektos/act/pkg/runner"
 )
@@ -66,7 +67,7 @@ func TestNewArtifactUploadPrepare(t *testing.T) {
 	var memfs = fstest.MapFS(map[string]*fstest.MapFile{})
 
 	router := httprouter.New()
-	uploads(router, "artifact/server/path", writeMapFS{memfs})
+	uploads(router, fsStorage{baseDir: "artifact/server/path", fs: writeMapFS{memfs}, rfs: memfs}, uploadPolicy{})
 
 	req, _ := http.NewRequest("POST", "http://localhost/_apis/pipelines/workflows/1/artifacts", nil)
 	rr := httptest.NewRecorder()
@@ -86,13 +87,55 @@ func TestNewArtifactUploadPrepare(t *testing.T) {
 	assert.Equal("http://localhost/upload/1", response.FileContainerResourceURL)
 }
 
+func TestNewArtifactUploadPrepareInvalidBody(t *testing.T) {
+	assert := assert.New(t)
+
+	var memfs = fstest.MapFS(map[string]*fstest.MapFile{})
+
+	router := httprouter.New()
+	uploads(router, fsStorage{baseDir: "artifact/server/path", fs: writeMapFS{memfs}, rfs: memfs}, uploadPolicy{})
+
+	req, _ := http.NewRequest("POST", "http://localhost/_apis/pipelines/workflows/1/artifacts", strings.NewReader("{"))
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(http.StatusBadRequest, rr.Code)
+}
+
+func TestArtifactInvalidRunID(t *testing.T) {
+	assert := assert.New(t)
+
+	var memfs = fstest.MapFS(map[string]*fstest.MapFile{})
+
+	router := httprouter.New()
+	storage := fsStorage{baseDir: "artifact/server/path", fs: writeMapFS{memfs}, rfs: memfs}
+	uploads(router, storage, uploadPolicy{})
+	downloads(router, storage)
+
+	// the metadata and the staged blocks are out of reach of the routes
+	for _, req := range []*http.Request{
+		httptest.NewRequest("POST", "http://localhost/_apis/pipelines/workflows/.metadata/artifacts", strings.NewReader(`{"name": "x"}`)),
+		httptest.NewRequest("PUT", "http://localhost/upload/.metadata?itemPath=1/artifact.json", strings.NewReader(`{"finalized": true}`)),
+		httptest.NewRequest("PUT", "http://localhost/upload/.blocks?itemPath=1/artifact/626c6f636b", strings.NewReader("block")),
+		httptest.NewRequest("GET", "http://localhost/_apis/pipelines/workflows/.metadata/artifacts", nil),
+		httptest.NewRequest("GET", "http://localhost/download/.metadata?itemPath=1", nil),
+		httptest.NewRequest("GET", "http://localhost/artifact/.metadata/1/artifact.json", nil),
+	} {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(http.StatusBadRequest, rr.Code, "%s %s", req.Method, req.URL)
+	}
+	assert.Empty(memfs)
+}
+
 func TestArtifactUploadBlob(t *testing.T) {
 	assert := assert.New(t)
 
 	var memfs = fstest.MapFS(map[string]*fstest.MapFile{})
 
 	router := httprouter.New()
-	uploads(router, "artifact/server/path", writeMapFS{memfs})
+	uploads(router, fsStorage{baseDir: "artifact/server/path", fs: writeMapFS{memfs}, rfs: memfs}, uploadPolicy{})
 
 	req, _ := http.NewRequest("PUT", "http://localhost/upload/1?itemPath=some/file", strings.NewReader("content"))
 	rr := httptest.NewRecorder()
@@ -119,7 +162,7 @@ func TestFinalizeArtifactUpload(t *testing.T) {
 	var memfs = fstest.MapFS(map[string]*fstest.MapFile{})
 
 	router := httprouter.New()
-	uploads(router, "artifact/server/path", writeMapFS{memfs})
+	uploads(router, fsStorage{baseDir: "artifact/server/path", fs: writeMapFS{memfs}, rfs: memfs}, uploadPolicy{})
 
 	req, _ := http.NewRequest("PATCH", "http://localhost/_apis/pipelines/workflows/1/artifacts", nil)
 	rr := httptest.NewRecorder()
@@ -149,7 +192,7 @@ func TestListArtifacts(t *testing.T) {
 	})
 
 	router := httprouter.New()
-	downloads(router, "artifact/server/path", memfs)
+	downloads(router, fsStorage{baseDir: "artifact/server/path", rfs: memfs})
 
 	req, _ := http.NewRequest("GET", "http://localhost/_apis/pipelines/workflows/1/artifacts", nil)
 	rr := httptest.NewRecorder()
@@ -181,7 +224,7 @@ func TestListArtifactContainer(t *testing.T) {
 	})
 
 	router := httprouter.New()
-	downloads(router, "artifact/server/path", memfs)
+	downloads(router, fsStorage{baseDir: "artifact/server/path", rfs: memfs})
 
 	req, _ := http.NewRequest("GET", "http://localhost/download/1?itemPath=some/file", nil)
 	rr := httptest.NewRecorder()
@@ -214,7 +257,7 @@ func TestDownloadArtifactFile(t *testing.T) {
 	})
 
 	router := httprouter.New()
-	downloads(router, "artifact/server/path", memfs)
+	downloads(router, fsStorage{baseDir: "artifact/server/path", rfs: memfs})
 
 	req, _ := http.NewRequest("GET", "http://localhost/artifact/1/some/file", nil)
 	rr := httptest.NewRecorder()
@@ -252,7 +295,7 @@ func TestArtifactFlow(t *testing.T) {
 
 	ctx := context.Background()
 
-	cancel := Serve(ctx, artifactsPath, artifactsAddr, artifactsPort)
+	cancel := Serve(ctx, artifactsPath, artifactsAddr, artifactsPort, Options{RetentionDays: DefaultRetentionDays})
 	defer cancel()
 
 	platforms := map[string]string{
@@ -352,7 +395,7 @@ func TestDownloadArtifactFileUnsafePath(t *testing.T) {
 	})
 
 	router := httprouter.New()
-	downloads(router, "artifact/server/path", memfs)
+	downloads(router, fsStorage{baseDir: "artifact/server/path", rfs: memfs})
 
 	req, _ := http.NewRequest("GET", "http://localhost/artifact/2/../../some/file", nil)
 	rr := httptest.NewRecorder()
@@ -374,7 +417,7 @@ func TestArtifactUploadBlobUnsafePath(t *testing.T) {
 	var memfs = fstest.MapFS(map[string]*fstest.MapFile{})
 
 	router := httprouter.New()
-	uploads(router, "artifact/server/path", writeMapFS{memfs})
+	uploads(router, fsStorage{baseDir: "artifact/server/path", fs: writeMapFS{memfs}, rfs: memfs}, uploadPolicy{})
 
 	req, _ := http.NewRequest("PUT", "http://localhost/upload/1?itemPath=../../some/file", strings.NewReader("content"))
 	rr := httptest.NewRecorder()
@@ -394,3 +437,33 @@ func TestArtifactUploadBlobUnsafePath(t *testing.T) {
 	assert.Equal("success", response.Message)
 	assert.Equal("content", string(memfs["artifact/server/path/1/some/file"].Data))
 }
+
+func TestNewHandlerRequireAuthorization(t *testing.T) {
+	assert := assert.New(t)
+
+	handler, err := NewHandler(t.TempDir(), Options{Secret: "s3cret", RetentionDays: DefaultRetentionDays})
+	assert.NoError(err)
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	req := httptest.NewRequest("POST", "https://act.example.com/_apis/pipelines/workflows/1/artifacts", nil)
+	assert.Equal(http.StatusUnauthorized, serve(req).Code)
+
+	token, err := common.CreateRuntimeToken(common.RuntimeTokenOptions{Secret: "s3cret", Run: common.RunClaims{TaskID: 1, RunID: 1, JobID: 1, Repository: "octo/repo"}})
+	assert.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := serve(req)
+	assert.Equal(http.StatusOK, rr.Code)
+	response := FileContainerResourceURL{}
+	assert.NoError(json.Unmarshal(rr.Body.Bytes(), &response))
+	// the urls keep the scheme the server was reached with
+	assert.Equal("https://act.example.com/upload/1", response.FileContainerResourceURL)
+
+	// the uploads of the artifacts v4 are authorized by their signed url, the default key doesn't sign them
+	routes := artifactV4Routes{signKey: defaultSignKey, prefix: ArtifactV4RouteBase, AppURL: "https://act.example.com"}
+	forged := routes.buildArtifactURL("UploadArtifact", "artifact", 1) + "&comp=block"
+	assert.Equal(http.StatusUnauthorized, serve(httptest.NewRequest("PUT", forged, nil)).Code)
+}
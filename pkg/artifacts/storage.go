@@ -0,0 +1,501 @@
+package artifacts
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nektos/act/pkg/common"
+)
+
+// Storage stores the files of the artifact server under slash separated keys: <run id>/<name>/<path> for the files
+// of the artifacts, and the metadata and the staged blocks under the keys of metadataDir and blocksDir. The run ids
+// are numbers, so the files the clients upload never land in metadataDir or blocksDir, see validRunID.
+// The keys are resolved within the root of the storage like by safeResolve, see safeKey.
+type Storage interface {
+	// Create returns a writer replacing the file
+	Create(key string) (io.WriteCloser, error)
+	// Append returns a writer appending to the file, which is created if missing
+	Append(key string) (io.WriteCloser, error)
+	// Open returns the content of the file, the error is fs.ErrNotExist if it is missing
+	Open(key string) (io.ReadCloser, error)
+	// Stat returns the size and the modification time of the file, the error is fs.ErrNotExist if it is missing
+	Stat(key string) (*ObjectInfo, error)
+	// List returns the file of the key or the files below it, sorted by key, all files if the key is empty
+	List(key string) ([]*ObjectInfo, error)
+	// Remove removes the file of the key or the files below it, the empty key is refused
+	Remove(key string) error
+	// Serve responds the content of the file, including range requests, or not found if it is missing
+	Serve(w http.ResponseWriter, r *http.Request, key string)
+}
+
+// ObjectInfo describes a file of a Storage
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// safeKey joins the parts to a storage key, each part is resolved within the preceding ones like by safeResolve
+func safeKey(parts ...string) string {
+	key := ""
+	for _, part := range parts {
+		key = path.Join(key, strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(part)), "/"))
+	}
+	return key
+}
+
+// errRemoveRoot refuses to remove all files of a storage, e.g. with the empty name of an artifact
+var errRemoveRoot = errors.New("the root of the storage can't be removed")
+
+// underKey returns whether the file of the storage is the file of the key or below it
+func underKey(name, key string) bool {
+	return key == "" || name == key || strings.HasPrefix(name, key+"/")
+}
+
+// OpenStorage returns the storage of the artifacts, rawURL selects where they are stored:
+//
+//   - "": the directory dir
+//   - "file:///path" or "/path": a directory
+//   - "s3://bucket/prefix?endpoint=http://minio:9000&region=us-east-1": a bucket of an S3 compatible object store,
+//     the credentials are taken from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+func OpenStorage(dir, rawURL string) (Storage, error) {
+	if rawURL == "" {
+		return NewLocalStorage(dir), nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage %q: %w", rawURL, err)
+	}
+	switch u.Scheme {
+	case "", "file":
+		return NewLocalStorage(u.Path), nil
+	case "s3":
+		return NewS3Storage(common.ParseS3URL(u))
+	default:
+		return nil, fmt.Errorf("invalid storage %q: unsupported scheme %q", rawURL, u.Scheme)
+	}
+}
+
+// LocalStorage stores the files in a directory, the layout of the artifact server directories
+type LocalStorage struct {
+	rootDir string
+}
+
+var _ Storage = &LocalStorage{}
+
+func NewLocalStorage(rootDir string) *LocalStorage {
+	return &LocalStorage{
+		rootDir: rootDir,
+	}
+}
+
+func (s *LocalStorage) Create(key string) (io.WriteCloser, error) {
+	return readWriteFSImpl{}.OpenWritable(s.path(key))
+}
+
+func (s *LocalStorage) Append(key string) (io.WriteCloser, error) {
+	return readWriteFSImpl{}.OpenAppendable(s.path(key))
+}
+
+func (s *LocalStorage) Open(key string) (io.ReadCloser, error) {
+	return os.Open(s.path(key))
+}
+
+func (s *LocalStorage) Stat(key string) (*ObjectInfo, error) {
+	info, err := os.Stat(s.path(key))
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "stat", Path: key, Err: fs.ErrNotExist}
+	}
+	return &ObjectInfo{Key: safeKey(key), Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (s *LocalStorage) List(key string) ([]*ObjectInfo, error) {
+	return listFS(readWriteFSImpl{}, s.rootDir, key)
+}
+
+// Remove removes the file or the directory of the key, and the parent directories it leaves empty
+func (s *LocalStorage) Remove(key string) error {
+	key = safeKey(key)
+	if key == "" {
+		return errRemoveRoot
+	}
+	if err := os.RemoveAll(s.path(key)); err != nil {
+		return err
+	}
+	for dir := path.Dir(key); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		// removing the directories still in use fails
+		if os.Remove(s.path(dir)) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *LocalStorage) Serve(w http.ResponseWriter, r *http.Request, key string) {
+	file, err := os.Open(s.path(key))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	// http.ServeFile would reject the paths of the requests with "..", which are resolved within the storage
+	http.ServeContent(w, r, path.Base(key), info.ModTime(), file)
+}
+
+func (s *LocalStorage) path(key string) string {
+	return safeResolve(s.rootDir, key)
+}
+
+// listFS returns the file of the key or the files below it in the directory baseDir of fsys
+func listFS(fsys fs.FS, baseDir, key string) ([]*ObjectInfo, error) {
+	root := safeResolve(baseDir, key)
+	var objects []*ObjectInfo
+	err := fs.WalkDir(fsys, root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && name == root {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(baseDir, name)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, &ObjectInfo{Key: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	// the directories are walked in the order of their names, "a.b" before "a/b"
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	return objects, err
+}
+
+// fsStorage adapts the WriteFS and the fs.FS the routes were built on, with the files of the keys in baseDir
+type fsStorage struct {
+	baseDir string
+	fs      WriteFS
+	rfs     fs.FS
+}
+
+var _ Storage = fsStorage{}
+
+func (s fsStorage) Create(key string) (io.WriteCloser, error) {
+	return s.fs.OpenWritable(safeResolve(s.baseDir, key))
+}
+
+func (s fsStorage) Append(key string) (io.WriteCloser, error) {
+	return s.fs.OpenAppendable(safeResolve(s.baseDir, key))
+}
+
+func (s fsStorage) Open(key string) (io.ReadCloser, error) {
+	return s.rfs.Open(safeResolve(s.baseDir, key))
+}
+
+func (s fsStorage) Stat(key string) (*ObjectInfo, error) {
+	info, err := fs.Stat(s.rfs, safeResolve(s.baseDir, key))
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "stat", Path: key, Err: fs.ErrNotExist}
+	}
+	return &ObjectInfo{Key: safeKey(key), Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (s fsStorage) List(key string) ([]*ObjectInfo, error) {
+	return listFS(s.rfs, s.baseDir, key)
+}
+
+func (s fsStorage) Remove(key string) error {
+	if remover, ok := s.fs.(interface{ RemoveAll(string) error }); ok {
+		return remover.RemoveAll(safeResolve(s.baseDir, key))
+	}
+	return fmt.Errorf("remove %s: %w", key, errors.ErrUnsupported)
+}
+
+func (s fsStorage) Serve(w http.ResponseWriter, r *http.Request, key string) {
+	file, err := s.rfs.Open(safeResolve(s.baseDir, key))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	if seeker, ok := file.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, path.Base(key), info.ModTime(), seeker)
+		return
+	}
+	_, _ = io.Copy(w, file)
+}
+
+// MemoryStorage keeps the files in memory, for the tests
+type MemoryStorage struct {
+	mu      sync.Mutex
+	objects map[string]*memoryObject
+}
+
+type memoryObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+var _ Storage = &MemoryStorage{}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		objects: map[string]*memoryObject{},
+	}
+}
+
+// memoryWriter stores its content in the storage when it is closed the first time
+type memoryWriter struct {
+	bytes.Buffer
+	storage *MemoryStorage
+	key     string
+	append  bool
+	closed  bool
+}
+
+func (w *memoryWriter) Close() error {
+	w.storage.mu.Lock()
+	defer w.storage.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	data := w.Bytes()
+	if object, ok := w.storage.objects[w.key]; ok && w.append {
+		data = append(append([]byte{}, object.data...), data...)
+	}
+	w.storage.objects[w.key] = &memoryObject{data: data, modTime: time.Now()}
+	return nil
+}
+
+func (s *MemoryStorage) Create(key string) (io.WriteCloser, error) {
+	return &memoryWriter{storage: s, key: safeKey(key)}, nil
+}
+
+func (s *MemoryStorage) Append(key string) (io.WriteCloser, error) {
+	return &memoryWriter{storage: s, key: safeKey(key), append: true}, nil
+}
+
+func (s *MemoryStorage) Open(key string) (io.ReadCloser, error) {
+	object, err := s.object(key)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(object.data)), nil
+}
+
+func (s *MemoryStorage) Stat(key string) (*ObjectInfo, error) {
+	object, err := s.object(key)
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectInfo{Key: safeKey(key), Size: int64(len(object.data)), ModTime: object.modTime}, nil
+}
+
+func (s *MemoryStorage) List(key string) ([]*ObjectInfo, error) {
+	key = safeKey(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var objects []*ObjectInfo
+	for name, object := range s.objects {
+		if underKey(name, key) {
+			objects = append(objects, &ObjectInfo{Key: name, Size: int64(len(object.data)), ModTime: object.modTime})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	return objects, nil
+}
+
+func (s *MemoryStorage) Remove(key string) error {
+	key = safeKey(key)
+	if key == "" {
+		return errRemoveRoot
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name := range s.objects {
+		if underKey(name, key) {
+			delete(s.objects, name)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStorage) Serve(w http.ResponseWriter, r *http.Request, key string) {
+	object, err := s.object(key)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, path.Base(key), object.modTime, bytes.NewReader(object.data))
+}
+
+func (s *MemoryStorage) object(key string) (*memoryObject, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	object, ok := s.objects[safeKey(key)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: key, Err: fs.ErrNotExist}
+	}
+	return object, nil
+}
+
+// S3Storage stores the files in a bucket of an S3 compatible object store, the downloads are streamed from the bucket.
+// Object stores can't append to objects, the files are uploaded when their writers are closed and the appended chunks
+// of the uploads rewrite the objects.
+type S3Storage struct {
+	client *common.S3Client
+}
+
+var _ Storage = &S3Storage{}
+
+func NewS3Storage(config common.S3Config) (*S3Storage, error) {
+	client, err := common.NewS3Client(config)
+	if err != nil {
+		return nil, err
+	}
+	return &S3Storage{
+		client: client,
+	}, nil
+}
+
+// s3Writer buffers the content of an object in a temporary file, which is put to the bucket when the writer is closed
+type s3Writer struct {
+	*os.File
+	client *common.S3Client
+	key    string
+}
+
+func (w *s3Writer) Close() error {
+	defer w.discard()
+	size, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return w.client.Put(w.key, w.File, size)
+}
+
+func (w *s3Writer) discard() {
+	_ = w.File.Close()
+	_ = os.Remove(w.Name())
+}
+
+func (s *S3Storage) Create(key string) (io.WriteCloser, error) {
+	return s.newWriter(key)
+}
+
+func (s *S3Storage) Append(key string) (io.WriteCloser, error) {
+	writer, err := s.newWriter(key)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := s.client.Get(writer.key)
+	if errors.Is(err, fs.ErrNotExist) {
+		return writer, nil
+	} else if err != nil {
+		writer.discard()
+		return nil, err
+	}
+	defer reader.Close()
+	if _, err := io.Copy(writer, reader); err != nil {
+		writer.discard()
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (s *S3Storage) newWriter(key string) (*s3Writer, error) {
+	file, err := os.CreateTemp("", "act-artifact-*")
+	if err != nil {
+		return nil, err
+	}
+	return &s3Writer{File: file, client: s.client, key: safeKey(key)}, nil
+}
+
+func (s *S3Storage) Open(key string) (io.ReadCloser, error) {
+	return s.client.Get(safeKey(key))
+}
+
+func (s *S3Storage) Stat(key string) (*ObjectInfo, error) {
+	object, err := s.client.Head(safeKey(key))
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectInfo{Key: object.Key, Size: object.Size, ModTime: object.LastModified}, nil
+}
+
+func (s *S3Storage) List(key string) ([]*ObjectInfo, error) {
+	key = safeKey(key)
+	objects, err := s.client.List(key)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*ObjectInfo, 0, len(objects))
+	for _, object := range objects {
+		// the prefix matches the keys of the siblings too, e.g. 10/ for the run 1
+		if underKey(object.Key, key) {
+			ret = append(ret, &ObjectInfo{Key: object.Key, Size: object.Size, ModTime: object.LastModified})
+		}
+	}
+	return ret, nil
+}
+
+func (s *S3Storage) Remove(key string) error {
+	if safeKey(key) == "" {
+		return errRemoveRoot
+	}
+	objects, err := s.List(key)
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if err := s.client.Delete(object.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *S3Storage) Serve(w http.ResponseWriter, r *http.Request, key string) {
+	s.client.Serve(w, r, safeKey(key))
+}
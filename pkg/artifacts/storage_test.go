@@ -0,0 +1,296 @@
+package artifacts
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nektos/act/pkg/common"
+)
+
+// fakeS3 is an in-process stand-in of an S3 compatible object store, it checks the signatures of the requests
+type fakeS3 struct {
+	config  common.S3Config
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	s3 := &fakeS3{
+		config:  common.S3Config{Bucket: "bucket", Prefix: "act/artifacts", Region: "eu-west-1", AccessKeyID: "AKID", SecretAccessKey: "secret"},
+		objects: map[string][]byte{},
+	}
+	server := httptest.NewServer(s3)
+	t.Cleanup(server.Close)
+	s3.config.Endpoint = server.URL
+	return s3
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	date, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		http.Error(w, "missing date", http.StatusForbidden)
+		return
+	}
+	signed, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	signed.Header = r.Header.Clone()
+	s.config.Sign(signed, r.Header.Get("X-Amz-Content-Sha256"), date)
+	if signed.Header.Get("Authorization") != r.Header.Get("Authorization") {
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.URL.Path == "/bucket" && r.URL.Query().Get("list-type") == "2" {
+		s.list(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		s.objects[r.URL.Path] = body
+	case http.MethodGet, http.MethodHead:
+		body, ok := s.objects[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+	case http.MethodDelete:
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// list answers ListObjectsV2 with pages of two objects, to exercise the continuation
+func (s *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	var keys []string
+	for name := range s.objects {
+		if key := strings.TrimPrefix(name, "/bucket/"); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if token := r.URL.Query().Get("continuation-token"); token != "" {
+		keys = keys[sort.SearchStrings(keys, token):]
+	}
+	result := listBucketResult{}
+	if len(keys) > 2 {
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[2]
+		keys = keys[:2]
+	}
+	for _, key := range keys {
+		result.Contents = append(result.Contents, listBucketObject{Key: key, Size: int64(len(s.objects["/bucket/"+key])), LastModified: time.Now().UTC()})
+	}
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	IsTruncated           bool
+	NextContinuationToken string `xml:",omitempty"`
+	Contents              []listBucketObject
+}
+
+type listBucketObject struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+func writeStorageFile(t *testing.T, open func(string) (io.WriteCloser, error), key, content string) {
+	t.Helper()
+	file, err := open(key)
+	require.NoError(t, err)
+	_, err = io.WriteString(file, content)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+}
+
+func readStorageFile(t *testing.T, storage Storage, key string) string {
+	t.Helper()
+	file, err := storage.Open(key)
+	require.NoError(t, err)
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func listStorageKeys(t *testing.T, storage Storage, key string) []string {
+	t.Helper()
+	objects, err := storage.List(key)
+	require.NoError(t, err)
+	keys := []string{}
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+	}
+	return keys
+}
+
+func TestStorage(t *testing.T) {
+	s3 := newFakeS3(t)
+	s3Storage, err := NewS3Storage(s3.config)
+	require.NoError(t, err)
+
+	for name, storage := range map[string]Storage{
+		"local":  NewLocalStorage(filepath.Join(t.TempDir(), "artifacts")),
+		"memory": NewMemoryStorage(),
+		"s3":     s3Storage,
+	} {
+		t.Run(name, func(t *testing.T) {
+			writeStorageFile(t, storage.Create, "1/report/report.zip", "0123456789")
+			writeStorageFile(t, storage.Create, "1/logs/a.txt", "replaced")
+			writeStorageFile(t, storage.Create, "1/logs/a.txt", "a")
+			writeStorageFile(t, storage.Append, "1/logs/b.txt", "b1")
+			writeStorageFile(t, storage.Append, "1/logs/b.txt", "b2")
+			writeStorageFile(t, storage.Create, "10/logs/c.txt", "c")
+			// the keys can't escape the root of the storage
+			writeStorageFile(t, storage.Create, "../../1/logs/../d.txt", "d")
+
+			assert.Equal(t, "a", readStorageFile(t, storage, "1/logs/a.txt"))
+			assert.Equal(t, "b1b2", readStorageFile(t, storage, "1/logs/b.txt"))
+			assert.Equal(t, "d", readStorageFile(t, storage, "1/d.txt"))
+			_, err := storage.Open("1/logs/missing.txt")
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+
+			info, err := storage.Stat("/1/report/report.zip")
+			require.NoError(t, err)
+			assert.Equal(t, "1/report/report.zip", info.Key)
+			assert.Equal(t, int64(10), info.Size)
+			_, err = storage.Stat("1/report")
+			assert.ErrorIs(t, err, fs.ErrNotExist, "the directories aren't files")
+
+			assert.Equal(t, []string{"1/d.txt", "1/logs/a.txt", "1/logs/b.txt", "1/report/report.zip"}, listStorageKeys(t, storage, "1"))
+			assert.Equal(t, []string{"1/logs/a.txt"}, listStorageKeys(t, storage, "1/logs/a.txt"))
+			assert.Len(t, listStorageKeys(t, storage, ""), 5)
+			assert.Empty(t, listStorageKeys(t, storage, "2"))
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Range", "bytes=2-5")
+			storage.Serve(rec, req, "1/report/report.zip")
+			assert.Equal(t, http.StatusPartialContent, rec.Code)
+			assert.Equal(t, "2345", rec.Body.String())
+			rec = httptest.NewRecorder()
+			storage.Serve(rec, httptest.NewRequest(http.MethodGet, "/", nil), "1/report/missing.zip")
+			assert.Equal(t, http.StatusNotFound, rec.Code)
+
+			require.NoError(t, storage.Remove("1/logs"))
+			assert.Equal(t, []string{"1/d.txt", "1/report/report.zip"}, listStorageKeys(t, storage, "1"))
+			require.NoError(t, storage.Remove("1/report/report.zip"))
+			assert.Empty(t, listStorageKeys(t, storage, "1*"), "the keys aren't patterns")
+			assert.Error(t, storage.Remove(".."), "the root can't be removed")
+			assert.Equal(t, []string{"1/d.txt", "10/logs/c.txt"}, listStorageKeys(t, storage, ""))
+		})
+	}
+}
+
+func TestOpenStorage(t *testing.T) {
+	dir := t.TempDir()
+	for _, c := range []struct {
+		url  string
+		want string
+		err  string
+	}{
+		{url: "", want: dir},
+		{url: "file:///mnt/artifacts", want: "/mnt/artifacts"},
+		{url: "/mnt/artifacts", want: "/mnt/artifacts"},
+		{url: "s3://bucket/prefix?region=eu-west-1"},
+		{url: "s3:///prefix", err: "bucket is required"},
+		{url: "gs://bucket", err: `unsupported scheme "gs"`},
+	} {
+		t.Run(c.url, func(t *testing.T) {
+			storage, err := OpenStorage(dir, c.url)
+			if c.err != "" {
+				assert.ErrorContains(t, err, c.err)
+				return
+			}
+			require.NoError(t, err)
+			if c.want == "" {
+				assert.IsType(t, &S3Storage{}, storage)
+				return
+			}
+			assert.Equal(t, c.want, storage.(*LocalStorage).rootDir)
+		})
+	}
+}
+
+func TestArtifactServerStorage(t *testing.T) {
+	s3 := newFakeS3(t)
+	s3Storage, err := NewS3Storage(s3.config)
+	require.NoError(t, err)
+
+	for name, storage := range map[string]Storage{
+		"memory": NewMemoryStorage(),
+		"s3":     s3Storage,
+	} {
+		t.Run(name, func(t *testing.T) {
+			handler, err := NewHandler("", Options{RetentionDays: DefaultRetentionDays, Storage: storage})
+			require.NoError(t, err)
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			token, err := common.CreateRuntimeToken(common.RuntimeTokenOptions{Run: common.RunClaims{RunID: 1, Repository: "octo/repo", Workflow: "CI"}})
+			require.NoError(t, err)
+
+			uploadArtifactV3(t, server, token, "1", "logs", `{"Type":"actions_storage","Name":"logs"}`)
+			// the chunks of the v3 uploads after the first one are appended
+			doArtifactRequest(t, http.MethodPut, server.URL+"/upload/1?itemPath=logs/hello.txt", token, " world", http.Header{"Content-Range": {"bytes 5-10/11"}})
+			content := uploadArtifactV4(t, server, token, "1", "report", nil)
+			status, _ := finalizeArtifactV4(t, server, token, "1", "report", int64(len(content)), "sha256:"+sha256Hex(content))
+			require.Equal(t, http.StatusOK, status)
+
+			artifacts, err := ListArtifacts(storage, ArtifactFilter{})
+			require.NoError(t, err)
+			require.Len(t, artifacts, 2)
+			assert.Equal(t, "CI", artifacts[0].Workflow)
+			assert.Equal(t, "CI", artifacts[1].Workflow)
+
+			// the v3 downloads list the containers of the storage and stream the files
+			resp, err := http.Get(server.URL + "/artifact/1/logs/hello.txt")
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			data, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, "hello world", string(data))
+
+			// the v4 downloads are streamed with range requests
+			var signed GetSignedArtifactURLResponse
+			require.Equal(t, http.StatusOK, callTwirp(t, server, token, "GetSignedArtifactURL", &GetSignedArtifactURLRequest{WorkflowRunBackendId: "1", WorkflowJobRunBackendId: "1", Name: "report"}, &signed))
+			req := mustRequest(t, http.MethodGet, signed.SignedUrl, nil)
+			req.Header.Set("Range", "bytes=0-3")
+			resp, err = http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			data, err = io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+			assert.Equal(t, content[:4], data)
+
+			dest := t.TempDir()
+			require.NoError(t, DownloadArtifact(storage, artifacts[0], filepath.Join(dest, artifacts[0].Name)))
+			require.NoError(t, DownloadArtifact(storage, artifacts[1], filepath.Join(dest, artifacts[1].Name)))
+			assert.FileExists(t, filepath.Join(dest, "report", "sub", "report.txt"))
+			assert.FileExists(t, filepath.Join(dest, "logs", "dir", "compressed.txt"))
+
+			require.NoError(t, DeleteArtifacts(storage, artifacts))
+			assert.Empty(t, listStorageKeys(t, storage, ""), "the files, the metadata and the blocks are removed")
+		})
+	}
+	assert.Empty(t, s3.objects)
+}
@@ -4,6 +4,8 @@
 package common
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -14,6 +16,15 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// NewSecret returns a random secret for the tokens of a run, e.g. of the servers only this run uses
+func NewSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
 type actionsClaims struct {
 	jwt.RegisteredClaims
 	Scp    string `json:"scp"`
@@ -21,6 +32,26 @@ type actionsClaims struct {
 	RunID  int64
 	JobID  int64
 	Ac     string `json:"ac"`
+	// Repository is the repository of the run, caches are accounted per repository
+	Repository string `json:"repository,omitempty"`
+	// Workflow is the name of the workflow of the run, artifacts are listed by workflow
+	Workflow string `json:"workflow,omitempty"`
+}
+
+// RunClaims identify the run and the job of a runtime token
+type RunClaims struct {
+	TaskID     int64
+	RunID      int64
+	JobID      int64
+	Repository string // repository of the run, empty if unknown
+	Workflow   string // name of the workflow of the run, empty if unknown
+}
+
+// CacheScope is the access of a runtime token to the caches
+type CacheScope struct {
+	Repository string   // repository of the run, empty if unknown
+	Refs       []string // refs caches are restored from in the order of their priority, nil if unscoped
+	WriteRef   string   // ref new caches are created for
 }
 
 type actionsCacheScope struct {
@@ -35,15 +66,44 @@ const (
 	actionsCachePermissionWrite
 )
 
+// CreateAuthorizationToken creates an unscoped runtime token of the run signed with the empty secret, see CreateRuntimeToken
 func CreateAuthorizationToken(taskID, runID, jobID int64) (string, error) {
+	return CreateRuntimeToken(RuntimeTokenOptions{Run: RunClaims{TaskID: taskID, RunID: runID, JobID: jobID}})
+}
+
+// RuntimeTokenOptions are the claims of a runtime token and the secret it is signed with
+type RuntimeTokenOptions struct {
+	// Secret of shared cache and artifact servers, see RequireAuthorization. The servers accept the tokens signed
+	// with the empty secret when they don't require authorization, so any client can create such tokens.
+	Secret string
+	Run    RunClaims
+	// CacheRefs grant access to the caches of the refs in the order of their priority, entries are written to the
+	// first ref and restored from all of them. Without refs the caches are unscoped.
+	CacheRefs []string
+}
+
+// CreateRuntimeToken creates a runtime token, the ACTIONS_RUNTIME_TOKEN of the jobs
+func CreateRuntimeToken(options RuntimeTokenOptions) (string, error) {
+	run, cacheRefs := options.Run, options.CacheRefs
 	now := time.Now()
 
-	ac, err := json.Marshal(&[]actionsCacheScope{
+	scopes := []actionsCacheScope{
 		{
 			Scope:      "",
 			Permission: actionsCachePermissionWrite,
 		},
-	})
+	}
+	if len(cacheRefs) > 0 {
+		scopes = scopes[:0]
+		for i, ref := range cacheRefs {
+			permission := actionsCachePermission(actionsCachePermissionRead)
+			if i == 0 {
+				permission |= actionsCachePermissionWrite
+			}
+			scopes = append(scopes, actionsCacheScope{Scope: ref, Permission: permission})
+		}
+	}
+	ac, err := json.Marshal(&scopes)
 	if err != nil {
 		return "", err
 	}
@@ -53,15 +113,18 @@ func CreateAuthorizationToken(taskID, runID, jobID int64) (string, error) {
 			ExpiresAt: jwt.NewNumericDate(now.Add(24 * time.Hour)),
 			NotBefore: jwt.NewNumericDate(now),
 		},
-		Scp:    fmt.Sprintf("Actions.Results:%d:%d", runID, jobID),
-		TaskID: taskID,
-		RunID:  runID,
-		JobID:  jobID,
+		Scp:    fmt.Sprintf("Actions.Results:%d:%d", run.RunID, run.JobID),
+		TaskID: run.TaskID,
+		RunID:  run.RunID,
+		JobID:  run.JobID,
 		Ac:     string(ac),
+
+		Repository: run.Repository,
+		Workflow:   run.Workflow,
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	tokenString, err := token.SignedString([]byte{})
+	tokenString, err := token.SignedString([]byte(options.Secret))
 	if err != nil {
 		return "", err
 	}
@@ -70,31 +133,105 @@ func CreateAuthorizationToken(taskID, runID, jobID int64) (string, error) {
 }
 
 func ParseAuthorizationToken(req *http.Request) (int64, error) {
+	c, err := parseAuthorizationClaims(req, "")
+	if err != nil || c == nil {
+		return 0, err
+	}
+	return c.TaskID, nil
+}
+
+// ParseRunClaims returns the run of the token of a request signed with the secret, nil if the request has no token
+func ParseRunClaims(req *http.Request, secret string) (*RunClaims, error) {
+	c, err := parseAuthorizationClaims(req, secret)
+	if err != nil || c == nil {
+		return nil, err
+	}
+	return &RunClaims{
+		TaskID:     c.TaskID,
+		RunID:      c.RunID,
+		JobID:      c.JobID,
+		Repository: c.Repository,
+		Workflow:   c.Workflow,
+	}, nil
+}
+
+// ParseCacheScope returns the access of the token of a request to the caches, the refs are nil if the token has no cache scopes
+func ParseCacheScope(req *http.Request) (*CacheScope, error) {
+	return ParseSignedCacheScope(req, "")
+}
+
+// ParseSignedCacheScope returns the access to the caches like ParseCacheScope of a token signed with the secret
+func ParseSignedCacheScope(req *http.Request, secret string) (*CacheScope, error) {
+	c, err := parseAuthorizationClaims(req, secret)
+	if err != nil || c == nil {
+		return &CacheScope{}, err
+	}
+	cacheScope := &CacheScope{Repository: c.Repository}
+	if c.Ac == "" {
+		return cacheScope, nil
+	}
+	scopes := []actionsCacheScope{}
+	if err := json.Unmarshal([]byte(c.Ac), &scopes); err != nil {
+		return &CacheScope{}, fmt.Errorf("invalid ac claim: %w", err)
+	}
+	for _, scope := range scopes {
+		if scope.Scope == "" {
+			continue
+		}
+		if scope.Permission&actionsCachePermissionRead != 0 {
+			cacheScope.Refs = append(cacheScope.Refs, scope.Scope)
+		}
+		if scope.Permission&actionsCachePermissionWrite != 0 && cacheScope.WriteRef == "" {
+			cacheScope.WriteRef = scope.Scope
+		}
+	}
+	return cacheScope, nil
+}
+
+// RequireAuthorization rejects the requests without a runtime token signed with the secret, see CreateRuntimeToken.
+// The requests accepted by exempt are passed through, e.g. the requests of urls authorized by their own signature.
+func RequireAuthorization(secret string, exempt func(*http.Request) bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if exempt == nil || !exempt(r) {
+			c, err := parseAuthorizationClaims(r, secret)
+			if err == nil && c == nil {
+				err = fmt.Errorf("no token")
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("unauthorized: %v", err), http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func parseAuthorizationClaims(req *http.Request, secret string) (*actionsClaims, error) {
 	h := req.Header.Get("Authorization")
 	if h == "" {
-		return 0, nil
+		return nil, nil
 	}
 
 	parts := strings.SplitN(h, " ", 2)
 	if len(parts) != 2 {
 		log.Errorf("split token failed: %s", h)
-		return 0, fmt.Errorf("split token failed")
+		return nil, fmt.Errorf("split token failed")
 	}
 
 	token, err := jwt.ParseWithClaims(parts[1], &actionsClaims{}, func(t *jwt.Token) (any, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
 		}
-		return []byte{}, nil
+		return []byte(secret), nil
 	})
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	c, ok := token.Claims.(*actionsClaims)
 	if !token.Valid || !ok {
-		return 0, fmt.Errorf("invalid token claim")
+		return nil, fmt.Errorf("invalid token claim")
 	}
 
-	return c.TaskID, nil
+	return c, nil
 }
@@ -6,6 +6,7 @@ package common
 import (
 	"encoding/json"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -60,3 +61,84 @@ func TestParseAuthorizationTokenNoAuthHeader(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, int64(0), rTaskID)
 }
+
+func TestParseCacheScope(t *testing.T) {
+	request := func(token string) *http.Request {
+		headers := http.Header{}
+		if token != "" {
+			headers.Set("Authorization", "Bearer "+token)
+		}
+		return &http.Request{Header: headers}
+	}
+
+	token, err := CreateRuntimeToken(RuntimeTokenOptions{Run: RunClaims{TaskID: 1, RunID: 1, JobID: 2, Repository: "octo/repo"}, CacheRefs: []string{"refs/pull/1/merge", "refs/heads/main"}})
+	assert.NoError(t, err)
+	scope, err := ParseCacheScope(request(token))
+	assert.NoError(t, err)
+	assert.Equal(t, &CacheScope{
+		Repository: "octo/repo",
+		Refs:       []string{"refs/pull/1/merge", "refs/heads/main"},
+		WriteRef:   "refs/pull/1/merge",
+	}, scope)
+
+	// tokens without refs and requests without tokens are unscoped
+	token, err = CreateAuthorizationToken(1, 1, 2)
+	assert.NoError(t, err)
+	scope, err = ParseCacheScope(request(token))
+	assert.NoError(t, err)
+	assert.Equal(t, &CacheScope{}, scope)
+
+	scope, err = ParseCacheScope(request(""))
+	assert.NoError(t, err)
+	assert.Equal(t, &CacheScope{}, scope)
+}
+
+func TestRequireAuthorization(t *testing.T) {
+	handler := RequireAuthorization("s3cret", func(r *http.Request) bool {
+		return r.URL.Path == "/signed"
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(path, token string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	signed, err := CreateRuntimeToken(RuntimeTokenOptions{Secret: "s3cret", Run: RunClaims{TaskID: 1, RunID: 1, JobID: 1, Repository: "octo/repo"}})
+	assert.NoError(t, err)
+	unsigned, err := CreateAuthorizationToken(1, 1, 1)
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusNoContent, serve("/", signed))
+	assert.Equal(t, http.StatusUnauthorized, serve("/", unsigned))
+	assert.Equal(t, http.StatusUnauthorized, serve("/", ""))
+	assert.Equal(t, http.StatusNoContent, serve("/signed", ""))
+
+	scope, err := ParseSignedCacheScope(httptest.NewRequest(http.MethodGet, "/", nil), "s3cret")
+	assert.NoError(t, err)
+	assert.Equal(t, &CacheScope{}, scope)
+}
+
+func TestParseRunClaims(t *testing.T) {
+	run := RunClaims{TaskID: 3, RunID: 1, JobID: 2, Repository: "octo/repo", Workflow: "CI"}
+	token, err := CreateRuntimeToken(RuntimeTokenOptions{Secret: "s3cret", Run: run})
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	claims, err := ParseRunClaims(req, "s3cret")
+	assert.NoError(t, err)
+	assert.Nil(t, claims)
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	claims, err = ParseRunClaims(req, "s3cret")
+	assert.NoError(t, err)
+	assert.Equal(t, &run, claims)
+
+	_, err = ParseRunClaims(req, "")
+	assert.Error(t, err)
+}
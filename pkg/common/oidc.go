@@ -0,0 +1,79 @@
+package common
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IDTokenClaims are the claims of the OIDC tokens of a job, named like the claims of the tokens of GitHub,
+// see https://docs.github.com/en/actions/security-for-github-actions/security-hardening-your-deployments/about-security-hardening-with-openid-connect
+type IDTokenClaims struct {
+	Subject           string `json:"sub"`
+	Ref               string `json:"ref"`
+	Sha               string `json:"sha"`
+	Repository        string `json:"repository"`
+	RepositoryOwner   string `json:"repository_owner"`
+	RunID             string `json:"run_id"`
+	RunNumber         string `json:"run_number"`
+	RunAttempt        string `json:"run_attempt"`
+	Actor             string `json:"actor"`
+	Workflow          string `json:"workflow"`
+	WorkflowRef       string `json:"workflow_ref"`
+	JobWorkflowRef    string `json:"job_workflow_ref"`
+	EventName         string `json:"event_name"`
+	RefType           string `json:"ref_type"`
+	HeadRef           string `json:"head_ref"`
+	BaseRef           string `json:"base_ref"`
+	Environment       string `json:"environment,omitempty"`
+	RunnerEnvironment string `json:"runner_environment"`
+}
+
+// idTokenRequestClaims are the claims of the tokens jobs request OIDC tokens with, ACTIONS_ID_TOKEN_REQUEST_TOKEN
+type idTokenRequestClaims struct {
+	jwt.RegisteredClaims
+	Scp  string        `json:"scp"`
+	OIDC IDTokenClaims `json:"oidc"`
+}
+
+const idTokenRequestScope = "Actions.IDToken"
+
+// CreateIDTokenRequestToken creates the token a job requests OIDC tokens with the claims of, signed with the secret
+// of shared cache and artifact servers like the runtime tokens, see ParseIDTokenRequest
+func CreateIDTokenRequestToken(secret string, claims IDTokenClaims) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, idTokenRequestClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(24 * time.Hour)),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+		Scp:  idTokenRequestScope,
+		OIDC: claims,
+	})
+	return token.SignedString([]byte(secret))
+}
+
+// ParseIDTokenRequest returns the claims of the OIDC tokens requested by a request with a token of CreateIDTokenRequestToken
+func ParseIDTokenRequest(req *http.Request, secret string) (*IDTokenClaims, error) {
+	parts := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("no token")
+	}
+	c := &idTokenRequestClaims{}
+	token, err := jwt.ParseWithClaims(parts[1], c, func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return []byte(secret), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || c.Scp != idTokenRequestScope {
+		return nil, fmt.Errorf("not an id token request token")
+	}
+	return &c.OIDC, nil
+}
@@ -0,0 +1,508 @@
+package common
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config locates a bucket of an S3 compatible object store, e.g. AWS S3 or MinIO.
+type S3Config struct {
+	Endpoint        string // base url of the store, objects are addressed in the path style: <Endpoint>/<Bucket>/<key>
+	Bucket          string
+	Prefix          string // prefix of the object keys, to share a bucket with other data
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // optional, for temporary credentials
+}
+
+// ParseS3URL returns the config of a "s3://bucket/prefix?endpoint=http://minio:9000&region=us-east-1" url,
+// the credentials are taken from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+func ParseS3URL(u *url.URL) S3Config {
+	query := u.Query()
+	region := query.Get("region")
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	return S3Config{
+		Endpoint:        query.Get("endpoint"),
+		Bucket:          u.Host,
+		Prefix:          strings.Trim(u.Path, "/"),
+		Region:          region,
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// S3Object is an object of a bucket listed by S3Client.List
+type S3Object struct {
+	Key          string // relative to the prefix of the config
+	Size         int64
+	LastModified time.Time
+}
+
+// S3Client sends the requests of the objects of a bucket, signed with AWS Signature Version 4
+type S3Client struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+	partSize int64 // objects larger than this are uploaded in parts of this size
+}
+
+const (
+	// s3PartSize is the default size of the parts of multipart uploads, a single PUT is limited to 5 GiB
+	s3PartSize = 64 << 20
+	// s3MaxParts is the maximum number of parts of a multipart upload
+	s3MaxParts = 10000
+)
+
+// newS3HTTPClient returns a client which gives up on unresponsive stores, it has no overall timeout since the
+// transfers of large objects take long
+func newS3HTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: time.Minute,
+			ExpectContinueTimeout: time.Second,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConnsPerHost:   16,
+		},
+	}
+}
+
+// NewS3Client returns a client of the bucket, the endpoint defaults to the one of AWS in the region.
+func NewS3Client(config S3Config) (*S3Client, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("s3: bucket is required")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("s3: invalid endpoint %q: %w", config.Endpoint, err)
+	}
+	return &S3Client{
+		config:   config,
+		endpoint: endpoint,
+		client:   newS3HTTPClient(),
+		partSize: s3PartSize,
+	}, nil
+}
+
+// Head returns the size and the modification time of an object, the error is fs.ErrNotExist if it is missing
+func (c *S3Client) Head(key string) (*S3Object, error) {
+	resp, err := c.Do(c.NewRequest(http.MethodHead, key, nil))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		lastModified, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+		return &S3Object{Key: key, Size: resp.ContentLength, LastModified: lastModified}, nil
+	case http.StatusNotFound:
+		return nil, &fs.PathError{Op: "head", Path: key, Err: fs.ErrNotExist}
+	default:
+		return nil, c.ResponseError(resp)
+	}
+}
+
+// Get returns the content of an object, the error is fs.ErrNotExist if it is missing
+func (c *S3Client) Get(key string) (io.ReadCloser, error) {
+	resp, err := c.Do(c.NewRequest(http.MethodGet, key, nil))
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, &fs.PathError{Op: "get", Path: key, Err: fs.ErrNotExist}
+	default:
+		defer resp.Body.Close()
+		return nil, c.ResponseError(resp)
+	}
+}
+
+// Put stores the size bytes of body as the object, objects larger than the part size are uploaded in parts
+func (c *S3Client) Put(key string, body io.Reader, size int64) error {
+	if size > c.partSize {
+		return c.putMultipart(key, body, size)
+	}
+	_, err := c.putPart(key, nil, body, size)
+	return err
+}
+
+// putPart puts the object or, with the query of a multipart upload, a part of it and returns its ETag
+func (c *S3Client) putPart(key string, query map[string]string, body io.Reader, size int64) (string, error) {
+	req, err := c.newQueryRequest(http.MethodPut, key, query, body)
+	if err == nil {
+		req.ContentLength = size
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	resp, err := c.Do(req, err)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", c.ResponseError(resp)
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+// s3CompletedPart is a part of the request of CompleteMultipartUpload
+type s3CompletedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+// putMultipart uploads the object in parts, see https://docs.aws.amazon.com/AmazonS3/latest/userguide/mpuoverview.html
+func (c *S3Client) putMultipart(key string, body io.Reader, size int64) error {
+	partSize := c.partSize
+	if minPartSize := (size + s3MaxParts - 1) / s3MaxParts; partSize < minPartSize {
+		partSize = minPartSize
+	}
+
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := c.postXML(key, map[string]string{"uploads": ""}, nil, &initiated); err != nil {
+		return err
+	}
+	uploadID := initiated.UploadID
+
+	var parts []s3CompletedPart
+	for offset := int64(0); offset < size; offset += partSize {
+		n := min(partSize, size-offset)
+		query := map[string]string{"partNumber": strconv.Itoa(len(parts) + 1), "uploadId": uploadID}
+		etag, err := c.putPart(key, query, io.LimitReader(body, n), n)
+		if err != nil {
+			c.abortMultipart(key, uploadID)
+			return err
+		}
+		parts = append(parts, s3CompletedPart{PartNumber: len(parts) + 1, ETag: etag})
+	}
+
+	completion, err := xml.Marshal(struct {
+		XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+		Parts   []s3CompletedPart `xml:"Part"`
+	}{Parts: parts})
+	if err == nil {
+		err = c.postXML(key, map[string]string{"uploadId": uploadID}, completion, &struct{}{})
+	}
+	if err != nil {
+		c.abortMultipart(key, uploadID)
+		return err
+	}
+	return nil
+}
+
+// abortMultipart removes the parts of a failed multipart upload
+func (c *S3Client) abortMultipart(key, uploadID string) {
+	resp, err := c.Do(c.newQueryRequest(http.MethodDelete, key, map[string]string{"uploadId": uploadID}, nil))
+	if err == nil {
+		resp.Body.Close()
+	}
+}
+
+// postXML posts to the object and decodes the XML response into result,
+// the responses of CompleteMultipartUpload may be errors despite their status 200
+func (c *S3Client) postXML(key string, query map[string]string, body []byte, result any) error {
+	req, err := c.newQueryRequest(http.MethodPost, key, query, bytes.NewReader(body))
+	if err == nil && body != nil {
+		req.Header.Set("Content-Type", "application/xml")
+	}
+	resp, err := c.Do(req, err)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return c.ResponseError(resp)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("s3 %s %s: %w", req.Method, req.URL.Path, err)
+	}
+	var responseError struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}
+	if xml.Unmarshal(content, &responseError) == nil {
+		return fmt.Errorf("s3 %s %s: %s: %s", req.Method, req.URL.Path, responseError.Code, responseError.Message)
+	}
+	if err := xml.Unmarshal(content, result); err != nil {
+		return fmt.Errorf("s3 %s %s: invalid response: %w", req.Method, req.URL.Path, err)
+	}
+	return nil
+}
+
+// Delete removes an object, removing a missing object succeeds
+func (c *S3Client) Delete(key string) error {
+	resp, err := c.Do(c.NewRequest(http.MethodDelete, key, nil))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return c.ResponseError(resp)
+	}
+	return nil
+}
+
+// listBucketResult is the response of ListObjectsV2, see https://docs.aws.amazon.com/AmazonS3/latest/API/API_ListObjectsV2.html
+type listBucketResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+	}
+}
+
+// List returns the objects whose keys, relative to the prefix of the config, start with prefix, sorted by key
+func (c *S3Client) List(prefix string) ([]*S3Object, error) {
+	keyPrefix := ""
+	if c.config.Prefix != "" {
+		keyPrefix = strings.Trim(c.config.Prefix, "/") + "/"
+	}
+	query := map[string]string{"list-type": "2", "prefix": keyPrefix + prefix}
+
+	var objects []*S3Object
+	for {
+		u := *c.endpoint
+		u.Path = path.Join("/", u.Path, c.config.Bucket)
+		u.RawPath = ""
+		u.RawQuery = awsQueryEncode(query)
+		resp, err := c.Do(http.NewRequest(http.MethodGet, u.String(), nil))
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return nil, c.ResponseError(resp)
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3: invalid list of %s: %w", prefix, err)
+		}
+		for _, content := range result.Contents {
+			objects = append(objects, &S3Object{Key: strings.TrimPrefix(content.Key, keyPrefix), Size: content.Size, LastModified: content.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		query["continuation-token"] = result.NextContinuationToken
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	return objects, nil
+}
+
+// Serve streams an object to the response, the range and the conditional requests are answered by the store
+func (c *S3Client) Serve(w http.ResponseWriter, r *http.Request, key string) {
+	req, err := c.NewRequest(r.Method, key, nil)
+	if err == nil {
+		req = req.WithContext(r.Context())
+		for _, key := range []string{"Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"} {
+			if v := r.Header.Get(key); v != "" {
+				req.Header.Set(key, v)
+			}
+		}
+	}
+	resp, err := c.Do(req, err)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	for _, key := range []string{"Content-Length", "Content-Range", "Content-Type", "Accept-Ranges", "ETag", "Last-Modified"} {
+		if v := resp.Header.Get(key); v != "" {
+			w.Header().Set(key, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+// NewRequest returns a request of the object of the key, relative to the prefix of the config
+func (c *S3Client) NewRequest(method, key string, body io.Reader) (*http.Request, error) {
+	u := *c.endpoint
+	u.Path = path.Join("/", u.Path, c.config.Bucket, c.config.Prefix, key)
+	u.RawPath = ""
+	return http.NewRequest(method, u.String(), body)
+}
+
+// newQueryRequest returns a request of the object of the key with the parameters of query
+func (c *S3Client) newQueryRequest(method, key string, query map[string]string, body io.Reader) (*http.Request, error) {
+	req, err := c.NewRequest(method, key, body)
+	if err == nil && len(query) > 0 {
+		req.URL.RawQuery = awsQueryEncode(query)
+	}
+	return req, err
+}
+
+// Do signs and sends the request, it takes the results of NewRequest for brevity
+func (c *S3Client) Do(req *http.Request, err error) (*http.Response, error) {
+	if err != nil {
+		return nil, err
+	}
+	c.config.Sign(req, S3UnsignedPayload, time.Now())
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s %s: %w", req.Method, req.URL.Path, err)
+	}
+	return resp, nil
+}
+
+// ResponseError returns the error of an unexpected response
+func (c *S3Client) ResponseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("s3 %s %s: %s: %s", resp.Request.Method, resp.Request.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// S3UnsignedPayload skips the hash of the bodies, which would require reading the uploads twice
+const S3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// Sign adds the AWS Signature Version 4 of the request,
+// see https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func (c *S3Config) Sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", now.Format("20060102"), c.Region)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		key = strings.ToLower(key)
+		if strings.HasPrefix(key, "x-amz-") || key == "range" || key == "content-type" || key == "content-md5" {
+			headers[key] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	queryKeys := make([]string, 0, len(query))
+	for key := range query {
+		queryKeys = append(queryKeys, key)
+	}
+	sort.Strings(queryKeys)
+	canonicalQuery := make([]string, 0, len(queryKeys))
+	for _, key := range queryKeys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			canonicalQuery = append(canonicalQuery, awsURIEncode(key, true)+"="+awsURIEncode(value, true))
+		}
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsURIEncode(req.URL.Path, false),
+		strings.Join(canonicalQuery, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hexSHA256(canonicalRequest)}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), now.Format("20060102"))
+	key = hmacSHA256(key, c.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// awsQueryEncode encodes the query like the canonical query of the signatures, url.Values encodes spaces as "+"
+func awsQueryEncode(query map[string]string) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, key := range keys {
+		params = append(params, awsURIEncode(key, true)+"="+awsURIEncode(query[key], true))
+	}
+	return strings.Join(params, "&")
+}
+
+// awsURIEncode encodes all characters except the unreserved ones, the slashes are kept in paths
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,115 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ServerConfig configures a long-running http server, see ListenAndServe
+type ServerConfig struct {
+	Addr            string        // host:port the server listens on
+	TLSCertFile     string        // serves https if set together with TLSKeyFile
+	TLSKeyFile      string        // the private key of TLSCertFile
+	ShutdownTimeout time.Duration // time the requests in progress get to complete on shutdown
+}
+
+// ListenAndServe serves the handler until the context is done, then shuts the server down gracefully.
+// The listener is passed to ready before the server accepts connections, e.g. to log its address.
+func ListenAndServe(ctx context.Context, config ServerConfig, handler http.Handler, ready func(net.Listener)) error {
+	listener, err := net.Listen("tcp", config.Addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		ReadHeaderTimeout: 10 * time.Second,
+		Handler:           handler,
+	}
+
+	if ready != nil {
+		ready(listener)
+	}
+	errs := make(chan error, 1)
+	go func() {
+		if config.TLSCertFile != "" || config.TLSKeyFile != "" {
+			errs <- server.ServeTLS(listener, config.TLSCertFile, config.TLSKeyFile)
+		} else {
+			errs <- server.Serve(listener)
+		}
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx := context.Background()
+	if config.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, config.ShutdownTimeout)
+		defer cancel()
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		_ = server.Close()
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush supports the streaming of the proxied responses
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// AccessLog logs an entry with the method, path, status, size and duration of each request
+func AccessLog(logger log.FieldLogger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		logger.WithFields(log.Fields{
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"status":     recorder.status,
+			"bytes":      recorder.bytes,
+			"duration":   time.Since(start).String(),
+			"remoteAddr": r.RemoteAddr,
+			"userAgent":  r.UserAgent(),
+		}).Info("request")
+	})
+}
@@ -66,6 +66,9 @@ type NewDockerBuildExecutorInput struct {
 	BuildContext io.Reader
 	ImageTag     string
 	Platform     string
+	BuildArgs    map[string]string // values of the ARGs of the Dockerfile, stored in the image history
+	Target       string            // build stage of a multi-stage Dockerfile
+	Secrets      map[string]string // BuildKit secrets by id, mounted with RUN --mount=type=secret and not stored in the image
 }
 
 // NewDockerPullExecutorInput the input for the NewDockerPullExecutor function
@@ -3,16 +3,29 @@
 package container
 
 import (
+	"archive/tar"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/docker/cli/cli/config"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/pkg/archive"
 
 	// github.com/docker/docker/builder/dockerignore is deprecated
 	"github.com/moby/buildkit/frontend/dockerfile/dockerignore"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/auth/authprovider"
+	"github.com/moby/buildkit/session/secrets/secretsprovider"
 	"github.com/moby/patternmatcher"
 
 	"github.com/nektos/act/pkg/common"
@@ -22,11 +35,20 @@ import (
 func NewDockerBuildExecutor(input NewDockerBuildExecutorInput) common.Executor {
 	return func(ctx context.Context) error {
 		logger := common.Logger(ctx)
+		flags := ""
 		if input.Platform != "" {
-			logger.Infof("%sdocker build -t %s --platform %s %s", logPrefix, input.ImageTag, input.Platform, input.ContextDir)
-		} else {
-			logger.Infof("%sdocker build -t %s %s", logPrefix, input.ImageTag, input.ContextDir)
+			flags += " --platform " + input.Platform
+		}
+		if input.Target != "" {
+			flags += " --target " + input.Target
+		}
+		for _, name := range sortedKeys(input.BuildArgs) {
+			flags += " --build-arg " + name
 		}
+		for _, id := range sortedKeys(input.Secrets) {
+			flags += " --secret id=" + id
+		}
+		logger.Infof("%sdocker build -t %s%s %s", logPrefix, input.ImageTag, flags, input.ContextDir)
 		if common.Dryrun(ctx) {
 			return nil
 		}
@@ -46,7 +68,38 @@ func NewDockerBuildExecutor(input NewDockerBuildExecutorInput) common.Executor {
 			Platform:    input.Platform,
 			AuthConfigs: LoadDockerAuthConfigs(ctx),
 			Dockerfile:  input.Dockerfile,
+			BuildArgs:   map[string]*string{},
+			Target:      input.Target,
+		}
+		for name, value := range input.BuildArgs {
+			value := value
+			options.BuildArgs[name] = &value
+		}
+
+		// secrets and foreign platforms need BuildKit, the session serves the secrets and registry credentials to the daemon
+		if len(input.Secrets) > 0 || input.Platform != "" {
+			options.Version = types.BuilderBuildKit
+			sess, err := newBuildSession(ctx, input.Secrets)
+			if err != nil {
+				return err
+			}
+			defer sess.Close()
+			go func() {
+				err := sess.Run(ctx, func(ctx context.Context, proto string, meta map[string][]string) (net.Conn, error) {
+					return cli.DialHijack(ctx, "/session", proto, meta)
+				})
+				if err != nil && ctx.Err() == nil {
+					logger.Debugf("BuildKit session ended: %v", err)
+				}
+			}()
+			options.SessionID = sess.ID()
+			if arch := platformArchitecture(input.Platform); arch != "" {
+				if info, err := GetHostInfo(ctx); err == nil && platformArchitecture(info.Architecture) != arch {
+					logger.Infof("Building for %s on a %s daemon with QEMU emulation", input.Platform, info.Architecture)
+				}
+			}
 		}
+
 		var buildContext io.ReadCloser
 		if input.BuildContext != nil {
 			buildContext = io.NopCloser(input.BuildContext)
@@ -61,14 +114,66 @@ func NewDockerBuildExecutor(input NewDockerBuildExecutorInput) common.Executor {
 
 		logger.Debugf("Creating image from context dir '%s' with tag '%s' and platform '%s'", input.ContextDir, input.ImageTag, input.Platform)
 		resp, err := cli.ImageBuild(ctx, buildContext, options)
-
-		err = logDockerResponse(logger, resp.Body, err != nil)
 		if err != nil {
 			return err
 		}
-		return nil
+
+		err = logDockerResponse(logger, resp.Body, false)
+		if err != nil && strings.Contains(err.Error(), "exec format error") {
+			return fmt.Errorf("%w: the daemon can't run %s binaries, install QEMU emulators with `docker run --privileged --rm tonistiigi/binfmt --install all`", err, input.Platform)
+		}
+		return err
+	}
+}
+
+// newBuildSession creates a BuildKit session serving the secrets and the credentials of the docker config
+func newBuildSession(ctx context.Context, secrets map[string]string) (*session.Session, error) {
+	sess, err := session.NewSession(ctx, "act", "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a BuildKit session: %w", err)
+	}
+	values := make(map[string][]byte, len(secrets))
+	for id, value := range secrets {
+		values[id] = []byte(value)
+	}
+	sess.Allow(secretsprovider.FromMap(values))
+	if cfg, err := config.Load(config.Dir()); err == nil {
+		sess.Allow(authprovider.NewDockerAuthProvider(cfg, nil))
+	} else {
+		common.Logger(ctx).Warnf("Could not load docker config: %v", err)
+	}
+	return sess, nil
+}
+
+// platformArchitecture returns the normalized architecture of a platform like linux/arm64 or of an architecture like aarch64
+func platformArchitecture(platform string) string {
+	if platform == "" {
+		return ""
+	}
+	arch := platform
+	if _, a, ok := strings.Cut(platform, "/"); ok {
+		arch, _, _ = strings.Cut(a, "/")
 	}
+	switch arch {
+	case "x86_64", "x86-64":
+		return "amd64"
+	case "aarch64":
+		return "arm64"
+	case "i386", "i686":
+		return "386"
+	}
+	return arch
 }
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func createBuildContext(ctx context.Context, contextDir string, relDockerfile string) (io.ReadCloser, error) {
 	common.Logger(ctx).Debugf("Creating archive for build context dir '%s' with relative dockerfile '%s'", contextDir, relDockerfile)
 
@@ -115,3 +220,82 @@ func createBuildContext(ctx context.Context, contextDir string, relDockerfile st
 
 	return buildCtx, nil
 }
+
+// BuildContextHash returns a hash of the files of a build context not excluded by its .dockerignore, the Dockerfile,
+// the platform, the build args, the target and the secret ids of a build. Secret values are not part of the image and the hash.
+// The build context is read from the tar stream of input.BuildContext or created from input.ContextDir if it is nil.
+func BuildContextHash(ctx context.Context, input NewDockerBuildExecutorInput) (string, error) {
+	buildContext, dockerfile := input.BuildContext, input.Dockerfile
+	if buildContext == nil {
+		tarball, err := createBuildContext(ctx, input.ContextDir, dockerfile)
+		if err != nil {
+			return "", err
+		}
+		defer tarball.Close()
+		buildContext = tarball
+	}
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	dockerfile = archive.CanonicalTarNameForPath(filepath.Clean(dockerfile))
+
+	type entry struct {
+		name   string
+		header string
+	}
+	entries := []entry{}
+	var excludes []string
+	tr := tar.NewReader(buildContext)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if name == "." {
+			continue
+		}
+		// modification times and owners don't change the image
+		h := sha256.New()
+		if name == ".dockerignore" {
+			if excludes, err = dockerignore.ReadAll(io.TeeReader(tr, h)); err != nil {
+				return "", err
+			}
+		} else if _, err := io.Copy(h, tr); err != nil {
+			return "", err
+		}
+		entries = append(entries, entry{
+			name:   name,
+			header: fmt.Sprintf("%s %c %o %s %x", name, header.Typeflag, header.Mode&0o7777, header.Linkname, h.Sum(nil)),
+		})
+	}
+
+	pm, err := patternmatcher.New(excludes)
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+	h := sha256.New()
+	fmt.Fprintf(h, "dockerfile %s\nplatform %s\ntarget %s\n", dockerfile, input.Platform, input.Target)
+	for _, name := range sortedKeys(input.BuildArgs) {
+		fmt.Fprintf(h, "arg %s=%s\n", name, input.BuildArgs[name])
+	}
+	for _, id := range sortedKeys(input.Secrets) {
+		fmt.Fprintf(h, "secret %s\n", id)
+	}
+	for _, e := range entries {
+		if e.name != dockerfile && e.name != ".dockerignore" {
+			if excluded, err := pm.MatchesOrParentMatches(e.name); err != nil {
+				return "", err
+			} else if excluded {
+				continue
+			}
+		}
+		fmt.Fprintln(h, e.header)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
@@ -0,0 +1,117 @@
+package container
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildContextHash(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	write("Dockerfile", "FROM alpine\nCOPY entrypoint.sh /\n")
+	write("entrypoint.sh", "echo hello\n")
+	write(".dockerignore", "*.log\nnode_modules\n")
+	write("debug.log", "first run\n")
+
+	hash, err := BuildContextHash(ctx, NewDockerBuildExecutorInput{ContextDir: dir, Dockerfile: "Dockerfile", Platform: "linux/amd64"})
+	require.NoError(t, err)
+	assert.Len(t, hash, 16)
+
+	// ignored files and modification times don't change the hash
+	write("debug.log", "second run\n")
+	write("node_modules/dep/index.js", "module.exports = {}\n")
+	write("entrypoint.sh", "echo hello\n")
+	unchanged, err := BuildContextHash(ctx, NewDockerBuildExecutorInput{ContextDir: dir, Dockerfile: "Dockerfile", Platform: "linux/amd64"})
+	require.NoError(t, err)
+	assert.Equal(t, hash, unchanged)
+
+	otherPlatform, err := BuildContextHash(ctx, NewDockerBuildExecutorInput{ContextDir: dir, Dockerfile: "Dockerfile", Platform: "linux/arm64"})
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, otherPlatform)
+
+	input := NewDockerBuildExecutorInput{ContextDir: dir, Dockerfile: "Dockerfile", Platform: "linux/amd64"}
+	input.BuildArgs = map[string]string{"INPUT_VERSION": "1.0"}
+	withArgs, err := BuildContextHash(ctx, input)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, withArgs)
+
+	input.Target = "release"
+	withTarget, err := BuildContextHash(ctx, input)
+	require.NoError(t, err)
+	assert.NotEqual(t, withArgs, withTarget)
+
+	// secret values are never part of the image, only their ids are
+	input.Secrets = map[string]string{"npm_token": "first"}
+	withSecret, err := BuildContextHash(ctx, input)
+	require.NoError(t, err)
+	assert.NotEqual(t, withTarget, withSecret)
+	input.Secrets["npm_token"] = "second"
+	rotatedSecret, err := BuildContextHash(ctx, input)
+	require.NoError(t, err)
+	assert.Equal(t, withSecret, rotatedSecret)
+
+	write("entrypoint.sh", "echo changed\n")
+	changed, err := BuildContextHash(ctx, NewDockerBuildExecutorInput{ContextDir: dir, Dockerfile: "Dockerfile", Platform: "linux/amd64"})
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, changed)
+}
+
+func TestBuildContextHashTarStream(t *testing.T) {
+	newContext := func(files map[string]string) *bytes.Buffer {
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		for _, name := range []string{"./Dockerfile", "./.dockerignore", "./dist/app.js", "./coverage/index.html"} {
+			content, ok := files[name]
+			if !ok {
+				continue
+			}
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}))
+			_, err := tw.Write([]byte(content))
+			require.NoError(t, err)
+		}
+		require.NoError(t, tw.Close())
+		return buf
+	}
+	files := map[string]string{
+		"./Dockerfile":    "FROM node:20\nCOPY dist /app\n",
+		"./.dockerignore": "coverage\n",
+		"./dist/app.js":   "console.log('app')\n",
+	}
+	hash, err := BuildContextHash(context.Background(), NewDockerBuildExecutorInput{BuildContext: newContext(files), Dockerfile: "Dockerfile"})
+	require.NoError(t, err)
+
+	files["./coverage/index.html"] = "<html></html>"
+	withCoverage, err := BuildContextHash(context.Background(), NewDockerBuildExecutorInput{BuildContext: newContext(files), Dockerfile: "Dockerfile"})
+	require.NoError(t, err)
+	assert.Equal(t, hash, withCoverage)
+
+	files["./Dockerfile"] = "FROM node:22\nCOPY dist /app\n"
+	newBase, err := BuildContextHash(context.Background(), NewDockerBuildExecutorInput{BuildContext: newContext(files), Dockerfile: "Dockerfile"})
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, newBase)
+}
+
+func TestPlatformArchitecture(t *testing.T) {
+	for platform, expected := range map[string]string{
+		"":              "",
+		"linux/amd64":   "amd64",
+		"linux/arm64":   "arm64",
+		"linux/arm/v7":  "arm",
+		"x86_64":        "amd64",
+		"aarch64":       "arm64",
+		"linux/ppc64le": "ppc64le",
+	} {
+		assert.Equal(t, expected, platformArchitecture(platform), platform)
+	}
+}
@@ -4,10 +4,19 @@ package container
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"sort"
+	"strings"
 
+	"github.com/docker/distribution/reference"
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
+
+	"github.com/nektos/act/pkg/common"
 )
 
 // ImageExistsLocally returns a boolean indicating if an image with the
@@ -58,3 +67,134 @@ func RemoveImage(ctx context.Context, imageName string, force bool, pruneChildre
 
 	return true, nil
 }
+
+// RemoveImageTags removes the tags of the local images of the repository except the kept ones. The images are deleted
+// once they are untagged, the removal of an image used by a container fails and the other tags are still removed.
+func RemoveImageTags(ctx context.Context, repository string, keep []string) error {
+	cli, err := GetDockerClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	images, err := cli.ImageList(ctx, image.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("reference", repository)),
+	})
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, ref := range staleImageTags(images, repository, keep) {
+		if _, err := cli.ImageRemove(ctx, ref, image.RemoveOptions{PruneChildren: true}); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		common.Logger(ctx).Debugf("removed image %s", ref)
+	}
+	return errors.Join(errs...)
+}
+
+// staleImageTags returns the sorted references of the images tagged in the repository with a tag not kept
+func staleImageTags(images []image.Summary, repository string, keep []string) []string {
+	var refs []string
+	for _, img := range images {
+		for _, ref := range img.RepoTags {
+			i := strings.LastIndex(ref, ":")
+			if i < 0 || strings.Contains(ref[i:], "/") || ref[:i] != repository {
+				continue
+			}
+			kept := false
+			for _, tag := range keep {
+				kept = kept || tag == ref[i+1:]
+			}
+			if !kept {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// SaveImages writes the images with their layers to a single tarball in the format of docker save
+func SaveImages(ctx context.Context, images []string, w io.Writer) error {
+	cli, err := GetDockerClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	reader, err := cli.ImageSave(ctx, images)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	_, err = io.Copy(w, reader)
+	return err
+}
+
+// LoadImages loads the images of a tarball in the format of docker save into the local docker image store
+func LoadImages(ctx context.Context, r io.Reader) error {
+	cli, err := GetDockerClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	resp, err := cli.ImageLoad(ctx, r, false)
+	if err != nil {
+		return err
+	}
+	return logDockerResponse(common.Logger(ctx), resp.Body, false)
+}
+
+// ImageDigest returns the registry digest the local image of the name was pulled with, an empty string for images built locally
+func ImageDigest(ctx context.Context, imageName string) (string, error) {
+	cli, err := GetDockerClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer cli.Close()
+
+	inspectImage, _, err := cli.ImageInspectWithRaw(ctx, imageName)
+	if err != nil {
+		return "", err
+	}
+	named, err := reference.ParseNormalizedNamed(imageName)
+	if err != nil {
+		return "", err
+	}
+	for _, repoDigest := range inspectImage.RepoDigests {
+		ref, err := reference.ParseNormalizedNamed(repoDigest)
+		if err != nil {
+			continue
+		}
+		if canonical, ok := ref.(reference.Canonical); ok && ref.Name() == named.Name() {
+			return canonical.Digest().String(), nil
+		}
+	}
+	return "", nil
+}
+
+// ResolveImageDigest returns the digest of the image in its registry without pulling it
+func ResolveImageDigest(ctx context.Context, imageName, username, password string) (string, error) {
+	cli, err := GetDockerClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer cli.Close()
+
+	imagePullOptions, err := getImagePullOptions(ctx, NewDockerPullExecutorInput{
+		Image:    imageName,
+		Username: username,
+		Password: password,
+	})
+	if err != nil {
+		return "", err
+	}
+	inspect, err := cli.DistributionInspect(ctx, imageName, imagePullOptions.RegistryAuth)
+	if err != nil {
+		return "", err
+	}
+	return inspect.Descriptor.Digest.String(), nil
+}
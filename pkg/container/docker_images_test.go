@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -65,3 +66,19 @@ func TestImageExistsLocally(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, true, imageArm64Exists)
 }
+
+func TestStaleImageTags(t *testing.T) {
+	images := []image.Summary{
+		{RepoTags: []string{"act-my-action-dockeraction:b2", "act-my-action-dockeraction:latest"}},
+		{RepoTags: []string{"act-my-action-dockeraction:a1"}},
+		{RepoTags: []string{"act-my-action-dockeraction:c3", "act-other-dockeraction:c3"}},
+		{RepoTags: []string{"localhost:5000/act-my-action-dockeraction:a1", "<none>:<none>"}},
+		{RepoTags: nil},
+	}
+	assert.Equal(t, []string{
+		"act-my-action-dockeraction:a1",
+		"act-my-action-dockeraction:b2",
+		"act-my-action-dockeraction:latest",
+	}, staleImageTags(images, "act-my-action-dockeraction", []string{"c3"}))
+	assert.Empty(t, staleImageTags(images, "act-missing-dockeraction", nil))
+}
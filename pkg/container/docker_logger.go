@@ -7,7 +7,9 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"strings"
 
+	controlapi "github.com/moby/buildkit/api/services/control"
 	"github.com/sirupsen/logrus"
 )
 
@@ -18,10 +20,14 @@ type dockerMessage struct {
 	ErrorDetail struct {
 		Message string
 	}
-	Status   string `json:"status"`
-	Progress string `json:"progress"`
+	Status   string          `json:"status"`
+	Progress string          `json:"progress"`
+	Aux      json.RawMessage `json:"aux"`
 }
 
+// buildKitTraceID is the id of the messages carrying the BuildKit progress of a build
+const buildKitTraceID = "moby.buildkit.trace"
+
 const logPrefix = "  \U0001F433  "
 
 func logDockerResponse(logger logrus.FieldLogger, dockerResponse io.ReadCloser, isError bool) error {
@@ -42,6 +48,7 @@ func logDockerResponse(logger logrus.FieldLogger, dockerResponse io.ReadCloser,
 		msg.ErrorDetail.Message = ""
 		msg.Status = ""
 		msg.Progress = ""
+		msg.Aux = nil
 
 		if err := json.Unmarshal(line, &msg); err != nil {
 			writeLog(logger, false, "Unable to unmarshal line [%s] ==> %v", string(line), err)
@@ -66,6 +73,10 @@ func logDockerResponse(logger logrus.FieldLogger, dockerResponse io.ReadCloser,
 			}
 		} else if msg.Stream != "" {
 			writeLog(logger, isError, "%s", msg.Stream)
+		} else if msg.ID == buildKitTraceID {
+			logBuildKitTrace(logger, msg.Aux, isError)
+		} else if msg.Aux != nil {
+			writeLog(logger, false, "%s", string(msg.Aux))
 		} else {
 			writeLog(logger, false, "Unable to handle line: %s", string(line))
 		}
@@ -74,6 +85,33 @@ func logDockerResponse(logger logrus.FieldLogger, dockerResponse io.ReadCloser,
 	return nil
 }
 
+// logBuildKitTrace logs the started steps, the output and the errors of a BuildKit progress message
+func logBuildKitTrace(logger logrus.FieldLogger, aux json.RawMessage, isError bool) {
+	var data []byte
+	if err := json.Unmarshal(aux, &data); err != nil {
+		writeLog(logger, false, "Unable to unmarshal BuildKit trace: %v", err)
+		return
+	}
+	var status controlapi.StatusResponse
+	if err := status.Unmarshal(data); err != nil {
+		writeLog(logger, false, "Unable to unmarshal BuildKit trace: %v", err)
+		return
+	}
+	for _, v := range status.Vertexes {
+		switch {
+		case v.Error != "":
+			writeLog(logger, true, "%s: %s", v.Name, v.Error)
+		case v.Started != nil && v.Completed == nil:
+			writeLog(logger, isError, "%s", v.Name)
+		case v.Cached:
+			writeLog(logger, isError, "CACHED %s", v.Name)
+		}
+	}
+	for _, l := range status.Logs {
+		writeLog(logger, isError, "%s", strings.TrimSuffix(string(l.Msg), "\n"))
+	}
+}
+
 func writeLog(logger logrus.FieldLogger, isError bool, format string, args ...interface{}) {
 	if isError {
 		logger.Errorf(format, args...)
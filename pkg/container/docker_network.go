@@ -4,6 +4,8 @@ package container
 
 import (
 	"context"
+	"fmt"
+	"net"
 
 	"github.com/docker/docker/api/types"
 	"github.com/nektos/act/pkg/common"
@@ -77,3 +79,35 @@ func NewDockerNetworkRemoveExecutor(name string) common.Executor {
 		return err
 	}
 }
+
+// DockerBridgeGateway returns the gateway of the default bridge network if it is an address of this machine. The
+// containers of the bridge networks reach the host at this address, the other machines of the network usually don't.
+func DockerBridgeGateway(ctx context.Context) (net.IP, error) {
+	cli, err := GetDockerClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	network, err := cli.NetworkInspect(ctx, "bridge", types.NetworkInspectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, config := range network.IPAM.Config {
+		gateway := net.ParseIP(config.Gateway)
+		if gateway == nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(gateway) {
+				return gateway, nil
+			}
+		}
+	}
+	// e.g. Docker Desktop runs the bridge in a virtual machine
+	return nil, fmt.Errorf("the gateway of the docker bridge network is not an address of this machine")
+}
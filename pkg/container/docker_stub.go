@@ -4,6 +4,8 @@ package container
 
 import (
 	"context"
+	"io"
+	"net"
 	"runtime"
 
 	"github.com/docker/docker/api/types/system"
@@ -23,6 +25,32 @@ func RemoveImage(ctx context.Context, imageName string, force bool, pruneChildre
 	return false, errors.New("Unsupported Operation")
 }
 
+// RemoveImageTags removes the tags of the local images of the repository except the kept ones. The images are deleted
+// once they are untagged, the removal of an image used by a container fails and the other tags are still removed.
+func RemoveImageTags(ctx context.Context, repository string, keep []string) error {
+	return errors.New("Unsupported Operation")
+}
+
+// SaveImages writes the images with their layers to a single tarball in the format of docker save
+func SaveImages(ctx context.Context, images []string, w io.Writer) error {
+	return errors.New("Unsupported Operation")
+}
+
+// LoadImages loads the images of a tarball in the format of docker save into the local docker image store
+func LoadImages(ctx context.Context, r io.Reader) error {
+	return errors.New("Unsupported Operation")
+}
+
+// ImageDigest returns the registry digest the local image of the name was pulled with, an empty string for images built locally
+func ImageDigest(ctx context.Context, imageName string) (string, error) {
+	return "", errors.New("Unsupported Operation")
+}
+
+// ResolveImageDigest returns the digest of the image in its registry without pulling it
+func ResolveImageDigest(ctx context.Context, imageName, username, password string) (string, error) {
+	return "", errors.New("Unsupported Operation")
+}
+
 // NewDockerBuildExecutor function to create a run executor for the container
 func NewDockerBuildExecutor(input NewDockerBuildExecutorInput) common.Executor {
 	return func(ctx context.Context) error {
@@ -30,6 +58,13 @@ func NewDockerBuildExecutor(input NewDockerBuildExecutorInput) common.Executor {
 	}
 }
 
+// BuildContextHash returns a hash of the files of a build context not excluded by its .dockerignore, the Dockerfile,
+// the platform, the build args, the target and the secret ids of a build. Secret values are not part of the image and the hash.
+// The build context is read from the tar stream of input.BuildContext or created from input.ContextDir if it is nil.
+func BuildContextHash(ctx context.Context, input NewDockerBuildExecutorInput) (string, error) {
+	return "", errors.New("Unsupported Operation")
+}
+
 // NewDockerPullExecutor function to create a run executor for the container
 func NewDockerPullExecutor(input NewDockerPullExecutorInput) common.Executor {
 	return func(ctx context.Context) error {
@@ -62,6 +97,11 @@ func NewDockerNetworkCreateExecutor(name string) common.Executor {
 	}
 }
 
+// DockerBridgeGateway returns the gateway of the default bridge network if it is an address of this machine
+func DockerBridgeGateway(ctx context.Context) (net.IP, error) {
+	return nil, errors.New("Unsupported Operation")
+}
+
 func NewDockerNetworkRemoveExecutor(name string) common.Executor {
 	return func(ctx context.Context) error {
 		return nil
@@ -0,0 +1,31 @@
+package container
+
+import (
+	"io"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// DockerfileArgs returns the names of the build arguments declared by the ARG instructions of a Dockerfile
+func DockerfileArgs(dockerfile io.Reader) ([]string, error) {
+	result, err := parser.Parse(dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{}
+	seen := map[string]bool{}
+	for _, node := range result.AST.Children {
+		if !strings.EqualFold(node.Value, "arg") {
+			continue
+		}
+		for n := node.Next; n != nil; n = n.Next {
+			name, _, _ := strings.Cut(n.Value, "=")
+			if name != "" && !seen[name] {
+				seen[name] = true
+				args = append(args, name)
+			}
+		}
+	}
+	return args, nil
+}
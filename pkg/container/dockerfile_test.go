@@ -0,0 +1,28 @@
+package container
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDockerfileArgs(t *testing.T) {
+	dockerfile := `ARG BASE=alpine
+FROM ${BASE} AS build
+arg INPUT_VERSION
+ARG TOOL_URL=https://example.com/tool \
+    CHECKSUM
+RUN --mount=type=secret,id=npm_token echo building
+FROM build AS release
+ARG INPUT_VERSION
+`
+	args, err := DockerfileArgs(strings.NewReader(dockerfile))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"BASE", "INPUT_VERSION", "TOOL_URL", "CHECKSUM"}, args)
+
+	args, err = DockerfileArgs(strings.NewReader("FROM alpine\n"))
+	require.NoError(t, err)
+	assert.Empty(t, args)
+}
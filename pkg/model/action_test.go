@@ -0,0 +1,21 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadActionRunsUsing(t *testing.T) {
+	for _, using := range []string{"node12", "node16", "Node20", "node24", "docker", "composite"} {
+		action, err := ReadAction(strings.NewReader("runs:\n  using: " + using + "\n"))
+		assert.NoError(t, err, using)
+		assert.Equal(t, ActionRunsUsing(strings.ToLower(using)), action.Runs.Using)
+	}
+	assert.True(t, ActionRunsUsing(ActionRunsUsingNode20).IsNode())
+	assert.False(t, ActionRunsUsing(ActionRunsUsingDocker).IsNode())
+
+	_, err := ReadAction(strings.NewReader("runs:\n  using: node14\n"))
+	assert.ErrorContains(t, err, "got node14")
+}
@@ -0,0 +1,107 @@
+package model
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Permission levels of the scopes of the GITHUB_TOKEN
+const (
+	PermissionNone  = "none"
+	PermissionRead  = "read"
+	PermissionWrite = "write"
+)
+
+// PermissionScopes are the scopes of the GITHUB_TOKEN the permissions of a workflow or a job grant
+var PermissionScopes = []string{
+	"actions", "attestations", "checks", "contents", "deployments", "discussions", "id-token", "issues",
+	"packages", "pages", "pull-requests", "repository-projects", "security-events", "statuses",
+}
+
+// Permissions are the levels of the scopes of the GITHUB_TOKEN of a job, the missing scopes have no access.
+// The metadata of the repository is always readable.
+type Permissions map[string]string
+
+// AllPermissions returns the permissions granting the level to all scopes, like read-all and write-all
+func AllPermissions(level string) Permissions {
+	permissions := Permissions{}
+	for _, scope := range PermissionScopes {
+		permissions[scope] = level
+	}
+	// id-token can't be read
+	if level == PermissionRead {
+		permissions["id-token"] = PermissionNone
+	}
+	return permissions
+}
+
+// DefaultPermissions returns the permissions of the jobs of workflows without permissions for the default setting
+// of a repository, permissive or restricted, see
+// https://docs.github.com/en/actions/security-for-github-actions/security-guides/automatic-token-authentication#permissions-for-the-github_token
+func DefaultPermissions(setting string) (Permissions, error) {
+	switch setting {
+	case "", "permissive":
+		// the OIDC tokens are requested with id-token: write only
+		permissions := AllPermissions(PermissionWrite)
+		permissions["id-token"] = PermissionNone
+		return permissions, nil
+	case "restricted":
+		return Permissions{"contents": PermissionRead, "packages": PermissionRead}, nil
+	}
+	return nil, fmt.Errorf("unknown default permissions %q, expected permissive or restricted", setting)
+}
+
+// Allows returns whether the permissions grant the level to the scope, write implies read
+func (p Permissions) Allows(scope, level string) bool {
+	if scope == "metadata" && level == PermissionRead {
+		return true
+	}
+	switch p[scope] {
+	case PermissionWrite:
+		return level == PermissionRead || level == PermissionWrite
+	case PermissionRead:
+		return level == PermissionRead
+	}
+	return level == PermissionNone
+}
+
+// Intersect returns the permissions granted by both p and other, e.g. the permissions of the jobs of a reusable
+// workflow are limited to the permissions of the calling job
+func (p Permissions) Intersect(other Permissions) Permissions {
+	permissions := Permissions{}
+	for _, scope := range PermissionScopes {
+		switch {
+		case p.Allows(scope, PermissionWrite) && other.Allows(scope, PermissionWrite):
+			permissions[scope] = PermissionWrite
+		case p.Allows(scope, PermissionRead) && other.Allows(scope, PermissionRead):
+			permissions[scope] = PermissionRead
+		}
+	}
+	return permissions
+}
+
+// decodePermissions returns the permissions of a permissions node, nil if the node is not set
+func decodePermissions(node yaml.Node) Permissions {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		var val string
+		if !decodeNode(node, &val) {
+			return nil
+		}
+		switch val {
+		case "read-all":
+			return AllPermissions(PermissionRead)
+		case "write-all":
+			return AllPermissions(PermissionWrite)
+		}
+		return nil
+	case yaml.MappingNode:
+		var val map[string]string
+		if !decodeNode(node, &val) {
+			return nil
+		}
+		return Permissions(val)
+	}
+	return nil
+}
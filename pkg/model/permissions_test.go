@@ -0,0 +1,71 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadWorkflow_Permissions(t *testing.T) {
+	workflow, err := ReadWorkflow(strings.NewReader(`
+name: permissions
+on: push
+permissions: read-all
+jobs:
+  inherit:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo
+  mapping:
+    runs-on: ubuntu-latest
+    permissions:
+      contents: write
+      id-token: write
+    steps:
+      - run: echo
+  none:
+    runs-on: ubuntu-latest
+    permissions: {}
+    steps:
+      - run: echo
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, AllPermissions(PermissionRead), workflow.Permissions())
+	assert.Nil(t, workflow.Jobs["inherit"].Permissions())
+	assert.Equal(t, Permissions{"contents": PermissionWrite, "id-token": PermissionWrite}, workflow.Jobs["mapping"].Permissions())
+	assert.Equal(t, Permissions{}, workflow.Jobs["none"].Permissions())
+
+	none := workflow.Jobs["none"].Permissions()
+	assert.True(t, none.Allows("metadata", PermissionRead))
+	assert.False(t, none.Allows("contents", PermissionRead))
+}
+
+func TestPermissions(t *testing.T) {
+	mapping := Permissions{"contents": PermissionWrite, "issues": PermissionRead, "statuses": PermissionNone}
+	assert.True(t, mapping.Allows("contents", PermissionRead))
+	assert.True(t, mapping.Allows("contents", PermissionWrite))
+	assert.True(t, mapping.Allows("issues", PermissionRead))
+	assert.False(t, mapping.Allows("issues", PermissionWrite))
+	assert.False(t, mapping.Allows("statuses", PermissionRead))
+	assert.False(t, mapping.Allows("pull-requests", PermissionRead))
+
+	assert.False(t, AllPermissions(PermissionRead).Allows("id-token", PermissionWrite))
+	assert.True(t, AllPermissions(PermissionWrite).Allows("id-token", PermissionWrite))
+
+	assert.Equal(t, Permissions{"contents": PermissionRead, "issues": PermissionRead}, mapping.Intersect(AllPermissions(PermissionRead)))
+
+	permissive, err := DefaultPermissions("permissive")
+	require.NoError(t, err)
+	assert.True(t, permissive.Allows("contents", PermissionWrite))
+	assert.True(t, permissive.Allows("packages", PermissionWrite))
+	assert.False(t, permissive.Allows("id-token", PermissionWrite))
+	restricted, err := DefaultPermissions("restricted")
+	require.NoError(t, err)
+	assert.True(t, restricted.Allows("contents", PermissionRead))
+	assert.False(t, restricted.Allows("contents", PermissionWrite))
+	_, err = DefaultPermissions("invalid")
+	assert.Error(t, err)
+}
@@ -7,10 +7,13 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"sort"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
 )
 
 // WorkflowPlanner contains methods for creating plans
@@ -144,6 +147,7 @@ func NewWorkflowPlanner(path string, noWorkflowRecurse bool) (WorkflowPlanner, e
 			}
 
 			workflow.File = wf.workflowDirEntry.Name()
+			workflow.Path = f.Name()
 			if workflow.Name == "" {
 				workflow.Name = wf.workflowDirEntry.Name()
 			}
@@ -319,6 +323,100 @@ func (p *Plan) MaxRunNameLen() int {
 	return maxRunNameLen
 }
 
+// Workflows returns the distinct workflows of all runs in the order of the stages
+func (p *Plan) Workflows() []*Workflow {
+	workflows := []*Workflow{}
+	seen := map[*Workflow]bool{}
+	for _, stage := range p.Stages {
+		for _, run := range stage.Runs {
+			if !seen[run.Workflow] {
+				seen[run.Workflow] = true
+				workflows = append(workflows, run.Workflow)
+			}
+		}
+	}
+	return workflows
+}
+
+var (
+	expressionPattern      = regexp.MustCompile(`\$\{\{(?s:(.*?))\}\}`)
+	secretReferencePattern = regexp.MustCompile(`(?i)\bsecrets\b\s*(?:\.\s*([a-z_][a-z0-9_-]*)|\[\s*'([^']*)'\s*\])?`)
+)
+
+// SecretNames returns the upper case names of the secrets the expressions of the jobs of the plan reference, sorted.
+// all is true if the jobs may read any secret, e.g. a reusable workflow called with `secrets: inherit` or toJSON(secrets).
+func (p *Plan) SecretNames() (names []string, all bool) {
+	seen := map[string]bool{}
+	for _, stage := range p.Stages {
+		for _, run := range stage.Runs {
+			job := run.Job()
+			if job == nil {
+				continue
+			}
+			if job.InheritSecrets() {
+				all = true
+			}
+			// the expressions are found in the strings of the job and of the env of the workflow
+			var expressions []string
+			collect := func(value string) {
+				for _, expression := range expressionPattern.FindAllStringSubmatch(value, -1) {
+					expressions = append(expressions, expression[1])
+				}
+			}
+			walkStrings(reflect.ValueOf(run.Workflow.Env), collect)
+			walkStrings(reflect.ValueOf(job), collect)
+			for _, expression := range expressions {
+				for _, reference := range secretReferencePattern.FindAllStringSubmatch(expression, -1) {
+					name := strings.ToUpper(reference[1] + reference[2])
+					if name == "" {
+						all = true
+					} else if !seen[name] {
+						seen[name] = true
+						names = append(names, name)
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, all
+}
+
+// walkStrings calls fn with the strings of v, including the scalars of its yaml nodes
+func walkStrings(v reflect.Value, fn func(string)) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			walkStrings(v.Elem(), fn)
+		}
+	case reflect.String:
+		fn(v.String())
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walkStrings(v.Index(i), fn)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			walkStrings(iter.Key(), fn)
+			walkStrings(iter.Value(), fn)
+		}
+	case reflect.Struct:
+		if node, ok := v.Interface().(yaml.Node); ok {
+			fn(node.Value)
+			for _, child := range node.Content {
+				walkStrings(reflect.ValueOf(child), fn)
+			}
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				walkStrings(v.Field(i), fn)
+			}
+		}
+	}
+}
+
 // GetJobIDs will get all the job names in the stage
 func (s *Stage) GetJobIDs() []string {
 	names := make([]string, 0)
@@ -2,10 +2,12 @@ package model
 
 import (
 	"path/filepath"
+	"strings"
 	"testing"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type WorkflowPlanTest struct {
@@ -56,3 +58,38 @@ func TestWorkflow(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, result)
 }
+
+func TestPlanSecretNames(t *testing.T) {
+	planner, err := NewSingleWorkflowPlanner("secrets.yml", strings.NewReader(`
+on: push
+env:
+  WORKFLOW: ${{ secrets.workflow_secret }}
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/setup-node@v4
+        with:
+          token: ${{ secrets['NPM_TOKEN'] }}
+      - run: echo "${{ secrets.DEPLOY_KEY }} ${{secrets.NPM_TOKEN}}"
+  other:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo ${{ secrets.OTHER }}
+  inherit:
+    uses: octo/repo/.github/workflows/called.yml@main
+    secrets: inherit
+`))
+	require.NoError(t, err)
+
+	plan, err := planner.PlanJob("build")
+	require.NoError(t, err)
+	names, all := plan.SecretNames()
+	assert.Equal(t, []string{"DEPLOY_KEY", "NPM_TOKEN", "WORKFLOW_SECRET"}, names)
+	assert.False(t, all)
+
+	plan, err = planner.PlanJob("inherit")
+	require.NoError(t, err)
+	_, all = plan.SecretNames()
+	assert.True(t, all)
+}
@@ -16,12 +16,19 @@ import (
 
 // Workflow is the structure of the files in .github/workflows
 type Workflow struct {
-	File     string
-	Name     string            `yaml:"name"`
-	RawOn    yaml.Node         `yaml:"on"`
-	Env      map[string]string `yaml:"env"`
-	Jobs     map[string]*Job   `yaml:"jobs"`
-	Defaults Defaults          `yaml:"defaults"`
+	File           string
+	Path           string            // absolute path of the file the planner read the workflow from
+	Name           string            `yaml:"name"`
+	RawOn          yaml.Node         `yaml:"on"`
+	Env            map[string]string `yaml:"env"`
+	Jobs           map[string]*Job   `yaml:"jobs"`
+	Defaults       Defaults          `yaml:"defaults"`
+	RawPermissions yaml.Node         `yaml:"permissions"`
+}
+
+// Permissions returns the permissions of the GITHUB_TOKEN of the jobs of the workflow, nil if not set
+func (w *Workflow) Permissions() Permissions {
+	return decodePermissions(w.RawPermissions)
 }
 
 // On events for the workflow
@@ -186,7 +193,19 @@ type Job struct {
 	Uses           string                    `yaml:"uses"`
 	With           map[string]interface{}    `yaml:"with"`
 	RawSecrets     yaml.Node                 `yaml:"secrets"`
+	RawEnvironment yaml.Node                 `yaml:"environment"`
+	RawPermissions yaml.Node                 `yaml:"permissions"`
 	Result         string
+	Line           int `yaml:"-"` // line of the job in the workflow file
+}
+
+func (j *Job) UnmarshalYAML(node *yaml.Node) error {
+	type JobDefault Job
+	if err := node.Decode((*JobDefault)(j)); err != nil {
+		return err
+	}
+	j.Line = node.Line
+	return nil
 }
 
 // Strategy for the job
@@ -266,6 +285,31 @@ func (j *Job) Secrets() map[string]string {
 	return val
 }
 
+// Permissions returns the permissions of the GITHUB_TOKEN of the job, nil if not set
+func (j *Job) Permissions() Permissions {
+	return decodePermissions(j.RawPermissions)
+}
+
+// EnvironmentName returns the name of the deployment environment of the job, which may be an expression
+func (j *Job) EnvironmentName() string {
+	var val string
+	switch j.RawEnvironment.Kind {
+	case yaml.ScalarNode:
+		if !decodeNode(j.RawEnvironment, &val) {
+			return ""
+		}
+	case yaml.MappingNode:
+		var env struct {
+			Name string `yaml:"name"`
+		}
+		if !decodeNode(j.RawEnvironment, &env) {
+			return ""
+		}
+		val = env.Name
+	}
+	return val
+}
+
 // Container details for the job
 func (j *Job) Container() *ContainerSpec {
 	var val *ContainerSpec
@@ -579,6 +623,16 @@ type Step struct {
 	With               map[string]string `yaml:"with"`
 	RawContinueOnError string            `yaml:"continue-on-error"`
 	TimeoutMinutes     string            `yaml:"timeout-minutes"`
+	Line               int               `yaml:"-"` // line of the step in the workflow or action file
+}
+
+func (s *Step) UnmarshalYAML(node *yaml.Node) error {
+	type StepDefault Step
+	if err := node.Decode((*StepDefault)(s)); err != nil {
+		return err
+	}
+	s.Line = node.Line
+	return nil
 }
 
 // String gets the name of step
@@ -1,6 +1,7 @@
 package runner
 
 import (
+	"archive/tar"
 	"context"
 	"embed"
 	"errors"
@@ -12,7 +13,10 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/kballard/go-shellquote"
 
@@ -164,6 +168,10 @@ func runActionImpl(step actionStep, actionDir string, remoteAction *remoteAction
 		action := step.getActionModel()
 		logger.Debugf("About to run action %v", action)
 
+		if err := checkActionInputs(ctx, step, action); err != nil {
+			return err
+		}
+
 		err := setupActionEnv(ctx, step, remoteAction)
 		if err != nil {
 			return err
@@ -175,11 +183,16 @@ func runActionImpl(step actionStep, actionDir string, remoteAction *remoteAction
 		logger.Debugf("type=%v actionDir=%s actionPath=%s workdir=%s actionCacheDir=%s actionName=%s containerActionDir=%s", stepModel.Type(), actionDir, actionPath, rc.Config.Workdir, rc.ActionCacheDir(), actionName, containerActionDir)
 
 		switch action.Runs.Using {
-		case model.ActionRunsUsingNode:
+		case model.ActionRunsUsingNode12, model.ActionRunsUsingNode16, model.ActionRunsUsingNode20, model.ActionRunsUsingNode24:
 			if err := maybeCopyToActionDir(ctx, step, actionDir, actionPath, containerActionDir); err != nil {
 				return err
 			}
-			containerArgs := []string{rc.GetNodeToolFullPath(ctx), path.Join(containerActionDir, action.Runs.Main)}
+			warnDeprecatedNodeRuntime(ctx, rc, stepModel.Uses, action)
+			nodeToolPath, err := rc.nodeRuntimePath(ctx, action.Runs.Using)
+			if err != nil {
+				return err
+			}
+			containerArgs := []string{nodeToolPath, path.Join(containerActionDir, action.Runs.Main)}
 			logger.Debugf("executing remote job container: %s", containerArgs)
 
 			rc.ApplyExtraPath(ctx, step.getEnv())
@@ -200,7 +213,10 @@ func runActionImpl(step actionStep, actionDir string, remoteAction *remoteAction
 		default:
 			return fmt.Errorf(fmt.Sprintf("The runs.using key must be one of: %v, got %s", []string{
 				model.ActionRunsUsingDocker,
-				model.ActionRunsUsingNode,
+				model.ActionRunsUsingNode12,
+				model.ActionRunsUsingNode16,
+				model.ActionRunsUsingNode20,
+				model.ActionRunsUsingNode24,
 				model.ActionRunsUsingComposite,
 			}, action.Runs.Using))
 		}
@@ -238,6 +254,113 @@ func removeGitIgnore(ctx context.Context, directory string) error {
 	return nil
 }
 
+// dockerActionBuildContext opens the build context of a Dockerfile action, it is nil if the build context is created from contextDir on the host
+func dockerActionBuildContext(ctx context.Context, step actionStep, localAction bool, contextDir string) (io.ReadCloser, error) {
+	rc := step.getRunContext()
+	if localAction {
+		return rc.JobContainer.GetContainerArchive(ctx, contextDir+"/.")
+	} else if rc.Config.ActionCache != nil {
+		rstep := step.(*stepActionRemote)
+		return rc.Config.ActionCache.GetTarArchive(ctx, rstep.cacheDir, rstep.resolvedSha, contextDir)
+	}
+	return nil, nil
+}
+
+// dockerActionBuildArgs returns the env of the step, including the INPUT_ variables, declared as ARG by the Dockerfile of the action.
+// Build args are stored in the image history, secrets are left out and have to be passed as BuildKit secrets.
+func dockerActionBuildArgs(ctx context.Context, step actionStep, localAction bool, contextDir, dockerfile string) (map[string]string, error) {
+	rc := step.getRunContext()
+	var content io.Reader
+	buildContext, err := dockerActionBuildContext(ctx, step, localAction, contextDir)
+	if err != nil {
+		return nil, err
+	}
+	if buildContext == nil {
+		f, err := os.Open(filepath.Join(contextDir, dockerfile))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		content = f
+	} else {
+		defer buildContext.Close()
+		tr := tar.NewReader(buildContext)
+		for content == nil {
+			header, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("%s not found in the build context %s", dockerfile, contextDir)
+			} else if err != nil {
+				return nil, err
+			}
+			if path.Clean(strings.TrimPrefix(header.Name, "./")) == path.Clean(filepath.ToSlash(dockerfile)) {
+				content = tr
+			}
+		}
+	}
+	names, err := container.DockerfileArgs(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", dockerfile, err)
+	}
+
+	secrets := map[string]bool{}
+	for _, secret := range rc.Config.Secrets {
+		if secret != "" {
+			secrets[secret] = true
+		}
+	}
+	env := *step.getEnv()
+	args := map[string]string{}
+	for _, name := range names {
+		value, ok := env[name]
+		if !ok {
+			continue
+		}
+		if secrets[value] {
+			common.Logger(ctx).Warnf("build arg %s holds a secret and is not passed to the build, use a BuildKit secret (--docker-build-secret) instead", name)
+			continue
+		}
+		args[name] = value
+	}
+	return args, nil
+}
+
+// dockerBuildSecrets returns the values of the BuildKit secrets of DockerBuildSecrets by id
+func (rc *RunContext) dockerBuildSecrets(ctx context.Context) map[string]string {
+	if len(rc.Config.DockerBuildSecrets) == 0 {
+		return nil
+	}
+	secrets := map[string]string{}
+	for id, name := range rc.Config.DockerBuildSecrets {
+		value, ok := rc.Config.Secrets[name]
+		if !ok {
+			common.Logger(ctx).Warnf("secret %s of the BuildKit secret %s is not set", name, id)
+			continue
+		}
+		secrets[id] = value
+	}
+	return secrets
+}
+
+var (
+	// dockerActionImagesMutex guards dockerActionImages, parallel jobs build the images of their Dockerfile actions
+	dockerActionImagesMutex sync.Mutex
+	// dockerActionImages are the tags of the images built by this process by image name, parallel jobs may build
+	// an action with different build args and don't remove the images of each other
+	dockerActionImages = map[string][]string{}
+)
+
+// builtDockerActionImage records the tag of a built image and returns the tags of the image name built by this process
+func builtDockerActionImage(imageName string, tag string) []string {
+	dockerActionImagesMutex.Lock()
+	defer dockerActionImagesMutex.Unlock()
+	tags := dockerActionImages[imageName]
+	if !slices.Contains(tags, tag) {
+		tags = append(tags, tag)
+		dockerActionImages[imageName] = tags
+	}
+	return slices.Clone(tags)
+}
+
 // TODO: break out parts of function to reduce complexicity
 //
 //nolint:gocyclo
@@ -255,55 +378,76 @@ func execAsDocker(ctx context.Context, step actionStep, actionName string, based
 		forcePull = rc.Config.ForcePull
 	} else {
 		// "-dockeraction" enshures that "./", "./test " won't get converted to "act-:latest", "act-test-:latest" which are invalid docker image names
-		image = fmt.Sprintf("%s-dockeraction:%s", regexp.MustCompile("[^a-zA-Z0-9]").ReplaceAllString(actionName, "-"), "latest")
-		image = fmt.Sprintf("act-%s", strings.TrimLeft(image, "-"))
-		image = strings.ToLower(image)
+		imageName := fmt.Sprintf("%s-dockeraction", regexp.MustCompile("[^a-zA-Z0-9]").ReplaceAllString(actionName, "-"))
+		imageName = strings.ToLower(fmt.Sprintf("act-%s", strings.TrimLeft(imageName, "-")))
 		contextDir, fileName := filepath.Split(filepath.Join(basedir, action.Runs.Image))
 
-		anyArchExists, err := container.ImageExistsLocally(ctx, image, "any")
-		if err != nil {
-			return err
+		buildInput := container.NewDockerBuildExecutorInput{
+			ContextDir: contextDir,
+			Dockerfile: fileName,
+			Platform:   rc.Config.ContainerArchitecture,
+			Secrets:    rc.dockerBuildSecrets(ctx),
 		}
-
-		correctArchExists, err := container.ImageExistsLocally(ctx, image, rc.Config.ContainerArchitecture)
-		if err != nil {
-			return err
+		if target, ok := findUsesPattern(rc.Config.DockerBuildTargets, step.getStepModel().Uses); ok {
+			buildInput.Target = target
+		} else {
+			buildInput.Target = rc.Config.DockerBuildTargets[""]
 		}
 
-		if anyArchExists && !correctArchExists {
-			wasRemoved, err := container.RemoveImage(ctx, image, true, true)
+		// the image is tagged with the hash of its build context, platform, build args and target, it is rebuilt when any changes
+		tag := "latest"
+		imageExists := false
+		if !common.Dryrun(ctx) {
+			var err error
+			if buildInput.BuildArgs, err = dockerActionBuildArgs(ctx, step, localAction, contextDir, fileName); err != nil {
+				return err
+			}
+			buildContext, err := dockerActionBuildContext(ctx, step, localAction, contextDir)
 			if err != nil {
 				return err
 			}
-			if !wasRemoved {
-				return fmt.Errorf("failed to remove image '%s'", image)
+			hashInput := buildInput
+			hashInput.BuildContext = buildContext
+			tag, err = container.BuildContextHash(ctx, hashInput)
+			if buildContext != nil {
+				buildContext.Close()
+			}
+			if err != nil {
+				return err
+			}
+			if imageExists, err = container.ImageExistsLocally(ctx, imageName+":"+tag, rc.Config.ContainerArchitecture); err != nil {
+				return err
 			}
 		}
+		image = imageName + ":" + tag
+		buildInput.ImageTag = image
 
-		if !correctArchExists || rc.Config.ForceRebuild {
+		if !imageExists || rc.Config.ForceRebuild {
 			logger.Debugf("image '%s' for architecture '%s' will be built from context '%s", image, rc.Config.ContainerArchitecture, contextDir)
-			var buildContext io.ReadCloser
-			if localAction {
-				buildContext, err = rc.JobContainer.GetContainerArchive(ctx, contextDir+"/.")
-				if err != nil {
-					return err
+			prepImage = func(ctx context.Context) error {
+				input := buildInput
+				if !common.Dryrun(ctx) {
+					buildContext, err := dockerActionBuildContext(ctx, step, localAction, contextDir)
+					if err != nil {
+						return err
+					}
+					if buildContext != nil {
+						defer buildContext.Close()
+						input.BuildContext = buildContext
+					}
 				}
-				defer buildContext.Close()
-			} else if rc.Config.ActionCache != nil {
-				rstep := step.(*stepActionRemote)
-				buildContext, err = rc.Config.ActionCache.GetTarArchive(ctx, rstep.cacheDir, rstep.resolvedSha, contextDir)
-				if err != nil {
+				if err := container.NewDockerBuildExecutor(input)(ctx); err != nil {
 					return err
 				}
-				defer buildContext.Close()
+				if common.Dryrun(ctx) {
+					return nil
+				}
+				// the images built for the previous build contexts of the action are not used anymore
+				if err := container.RemoveImageTags(ctx, imageName, builtDockerActionImage(imageName, tag)); err != nil {
+					logger.Debugf("failed to remove the previous images of '%s': %v", imageName, err)
+				}
+				return nil
 			}
-			prepImage = container.NewDockerBuildExecutor(container.NewDockerBuildExecutorInput{
-				ContextDir:   contextDir,
-				Dockerfile:   fileName,
-				ImageTag:     image,
-				BuildContext: buildContext,
-				Platform:     rc.Config.ContainerArchitecture,
-			})
 		} else {
 			logger.Debugf("image '%s' for architecture '%s' already exists", image, rc.Config.ContainerArchitecture)
 		}
@@ -339,10 +483,18 @@ func execAsDocker(ctx context.Context, step actionStep, actionName string, based
 			entrypoint = nil
 		}
 	}
-	stepContainer := newStepContainer(ctx, step, image, cmd, entrypoint)
+	var stepContainer container.Container
+	var pull common.Executor
+	if strings.HasPrefix(action.Runs.Image, "docker://") {
+		stepContainer = newStepContainer(ctx, step, rc.Config.mirrorImage(image), cmd, entrypoint)
+		pull = rc.pullImage(stepContainer, image, forcePull)
+	} else {
+		stepContainer = newStepContainer(ctx, step, image, cmd, entrypoint)
+		pull = stepContainer.Pull(forcePull)
+	}
 	return common.NewPipelineExecutor(
 		prepImage,
-		stepContainer.Pull(forcePull),
+		pull,
 		stepContainer.Remove().IfBool(!rc.Config.ReuseContainers),
 		stepContainer.Create(rc.Config.ContainerCapAdd, rc.Config.ContainerCapDrop),
 		stepContainer.Start(true),
@@ -450,6 +602,64 @@ func populateEnvsFromInput(ctx context.Context, env *map[string]string, action *
 	}
 }
 
+// checkActionInputs compares the with: of the step against the inputs declared by the action.
+// Unknown and deprecated inputs are reported as warnings, missing required inputs without a default fail the step.
+func checkActionInputs(ctx context.Context, step actionStep, action *model.Action) error {
+	// the synthetic actions of act accept every input
+	if action == nil || action.Name == "(Synthetic)" {
+		return nil
+	}
+	rc := step.getRunContext()
+	stepModel := step.getStepModel()
+	logger := common.Logger(ctx)
+
+	// input ids are case insensitive
+	inputs := map[string]model.Input{}
+	valid := make([]string, 0, len(action.Inputs))
+	for inputID, input := range action.Inputs {
+		inputs[strings.ToLower(inputID)] = input
+		valid = append(valid, inputID)
+	}
+	sort.Strings(valid)
+	with := map[string]bool{}
+	unexpected := []string{}
+	for name := range stepModel.With {
+		with[strings.ToLower(name)] = true
+		input, ok := inputs[strings.ToLower(name)]
+		if !ok {
+			// docker actions can override the args and the entrypoint of the image
+			if action.Runs.Using == model.ActionRunsUsingDocker && (name == "args" || name == "entrypoint") {
+				continue
+			}
+			unexpected = append(unexpected, name)
+			continue
+		}
+		if input.DeprecationMessage != "" {
+			message := fmt.Sprintf("Input '%s' has been deprecated with message: %s", name, input.DeprecationMessage)
+			logger.Warnf("%s", message)
+			rc.addAnnotation("warning", nil, message)
+		}
+	}
+	if len(unexpected) > 0 {
+		sort.Strings(unexpected)
+		message := fmt.Sprintf("Unexpected input(s) '%s', valid inputs are ['%s']", strings.Join(unexpected, "', '"), strings.Join(valid, "', '"))
+		logger.Warnf("%s", message)
+		rc.addAnnotation("warning", nil, message)
+	}
+
+	missing := []string{}
+	for _, inputID := range valid {
+		input := action.Inputs[inputID]
+		if input.Required && input.Default == "" && !with[strings.ToLower(inputID)] {
+			missing = append(missing, inputID)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("Input required and not supplied: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
 func getContainerActionPaths(step *model.Step, actionDir string, rc *RunContext) (string, string) {
 	actionName := ""
 	containerActionDir := "."
@@ -498,7 +708,7 @@ func hasPreStep(step actionStep) common.Conditional {
 	return func(ctx context.Context) bool {
 		action := step.getActionModel()
 		return action.Runs.Using == model.ActionRunsUsingComposite ||
-			(action.Runs.Using == model.ActionRunsUsingNode &&
+			(action.Runs.Using.IsNode() &&
 				action.Runs.Pre != "") ||
 			(action.Runs.Using == model.ActionRunsUsingDocker &&
 				action.Runs.PreEntrypoint != "")
@@ -540,12 +750,16 @@ func runPreStep(step actionStep) common.Executor {
 		actionName, containerActionDir := getContainerActionPaths(stepModel, actionLocation, rc)
 
 		switch action.Runs.Using {
-		case model.ActionRunsUsingNode:
+		case model.ActionRunsUsingNode12, model.ActionRunsUsingNode16, model.ActionRunsUsingNode20, model.ActionRunsUsingNode24:
 			if err := maybeCopyToActionDir(ctx, step, actionDir, actionPath, containerActionDir); err != nil {
 				return err
 			}
 
-			containerArgs := []string{rc.GetNodeToolFullPath(ctx), path.Join(containerActionDir, action.Runs.Pre)}
+			nodeToolPath, err := rc.nodeRuntimePath(ctx, action.Runs.Using)
+			if err != nil {
+				return err
+			}
+			containerArgs := []string{nodeToolPath, path.Join(containerActionDir, action.Runs.Pre)}
 			logger.Debugf("executing remote job container: %s", containerArgs)
 
 			rc.ApplyExtraPath(ctx, step.getEnv())
@@ -604,7 +818,7 @@ func hasPostStep(step actionStep) common.Conditional {
 	return func(ctx context.Context) bool {
 		action := step.getActionModel()
 		return action.Runs.Using == model.ActionRunsUsingComposite ||
-			(action.Runs.Using == model.ActionRunsUsingNode &&
+			(action.Runs.Using.IsNode() &&
 				action.Runs.Post != "") ||
 			(action.Runs.Using == model.ActionRunsUsingDocker &&
 				action.Runs.PostEntrypoint != "")
@@ -643,12 +857,16 @@ func runPostStep(step actionStep) common.Executor {
 		actionName, containerActionDir := getContainerActionPaths(stepModel, actionLocation, rc)
 
 		switch action.Runs.Using {
-		case model.ActionRunsUsingNode:
+		case model.ActionRunsUsingNode12, model.ActionRunsUsingNode16, model.ActionRunsUsingNode20, model.ActionRunsUsingNode24:
 
 			populateEnvsFromSavedState(step.getEnv(), step, rc)
 			populateEnvsFromInput(ctx, step.getEnv(), step.getActionModel(), rc)
 
-			containerArgs := []string{rc.GetNodeToolFullPath(ctx), path.Join(containerActionDir, action.Runs.Post)}
+			nodeToolPath, err := rc.nodeRuntimePath(ctx, action.Runs.Using)
+			if err != nil {
+				return err
+			}
+			containerArgs := []string{nodeToolPath, path.Join(containerActionDir, action.Runs.Post)}
 			logger.Debugf("executing remote job container: %s", containerArgs)
 
 			rc.ApplyExtraPath(ctx, step.getEnv())
@@ -0,0 +1,435 @@
+package runner
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/revlist"
+
+	"github.com/nektos/act/pkg/common"
+	"github.com/nektos/act/pkg/container"
+	"github.com/nektos/act/pkg/model"
+)
+
+const (
+	bundleVersion      = 1
+	bundleManifestFile = "manifest.json"
+	bundleImagesFile   = "images.tar"
+	bundleActionsDir   = "actions/"
+	gitBundleSignature = "# v2 git bundle\n"
+)
+
+// BundleManifest describes the content of a bundle written by CreateBundle
+type BundleManifest struct {
+	Version int              `json:"version"`
+	Actions []*BundledAction `json:"actions"`
+	Images  []string         `json:"images"`
+}
+
+// BundledAction is a ref of a remote action or reusable workflow and the commit it resolved to
+type BundledAction struct {
+	Repository string `json:"repository"` // {owner}/{repo}, the cache dir of the ActionCache
+	URL        string `json:"url"`
+	Ref        string `json:"ref"`
+	SHA        string `json:"sha"`
+}
+
+// actionCacheBundler is implemented by ActionCaches able to export and import their repositories as git bundles
+type actionCacheBundler interface {
+	writeBundle(ctx context.Context, cacheDir string, refs map[string]string, w io.Writer) error
+	readBundle(ctx context.Context, cacheDir string, r io.Reader) error
+}
+
+// CreateBundle walks the workflows, their composite actions and reusable workflows transitively and writes
+// every remote action and reusable workflow as git bundle and every image the jobs need as docker save tarball
+// into a gzipped tar archive, so that the workflows can run without network access after LoadBundle.
+func CreateBundle(ctx context.Context, config *Config, workflows []*model.Workflow, w io.Writer) (*BundleManifest, error) {
+	bundler, ok := config.ActionCache.(actionCacheBundler)
+	if !ok {
+		return nil, fmt.Errorf("creating a bundle requires the GoGitActionCache")
+	}
+	manifest, err := collectBundleContent(ctx, config, workflows)
+	if err != nil {
+		return nil, err
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeBundleEntry(tw, bundleManifestFile, int64(len(content)), strings.NewReader(string(content))); err != nil {
+		return nil, err
+	}
+
+	refs := map[string]map[string]string{}
+	for _, action := range manifest.Actions {
+		if refs[action.Repository] == nil {
+			refs[action.Repository] = map[string]string{}
+		}
+		refs[action.Repository][action.Ref] = action.SHA
+	}
+	for _, repository := range sortedStringKeys(refs) {
+		common.Logger(ctx).Infof("Bundling %s", repository)
+		err := writeBundleTempEntry(tw, bundleActionsDir+safeFilename(repository)+".bundle", func(w io.Writer) error {
+			return bundler.writeBundle(ctx, repository, refs[repository], w)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to bundle %s: %w", repository, err)
+		}
+	}
+
+	if len(manifest.Images) > 0 {
+		for _, image := range manifest.Images {
+			err := container.NewDockerPullExecutor(container.NewDockerPullExecutorInput{
+				Image:    image,
+				Platform: config.ContainerArchitecture,
+				Username: config.Secrets["DOCKER_USERNAME"],
+				Password: config.Secrets["DOCKER_PASSWORD"],
+			})(ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+		common.Logger(ctx).Infof("Bundling %d images", len(manifest.Images))
+		err := writeBundleTempEntry(tw, bundleImagesFile, func(w io.Writer) error {
+			return container.SaveImages(ctx, manifest.Images, w)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to save images: %w", err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, gw.Close()
+}
+
+// LoadBundle restores the repositories of a bundle into the ActionCache, with refs used by the
+// GoGitActionCacheOfflineMode, and loads the images into the local docker image store
+func LoadBundle(ctx context.Context, config *Config, r io.Reader) (*BundleManifest, error) {
+	bundler, ok := config.ActionCache.(actionCacheBundler)
+	if !ok {
+		return nil, fmt.Errorf("loading a bundle requires the GoGitActionCache")
+	}
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	defer gr.Close()
+
+	var manifest *BundleManifest
+	repositories := map[string]string{}
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		switch {
+		case header.Name == bundleManifestFile:
+			manifest = &BundleManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("failed to parse bundle manifest: %w", err)
+			}
+			if manifest.Version != bundleVersion {
+				return nil, fmt.Errorf("unsupported bundle version %d", manifest.Version)
+			}
+			for _, action := range manifest.Actions {
+				repositories[bundleActionsDir+safeFilename(action.Repository)+".bundle"] = action.Repository
+			}
+		case manifest == nil:
+			return nil, fmt.Errorf("the bundle has to start with %s", bundleManifestFile)
+		case strings.HasPrefix(header.Name, bundleActionsDir):
+			repository, ok := repositories[header.Name]
+			if !ok {
+				return nil, fmt.Errorf("%s is not in the bundle manifest", header.Name)
+			}
+			common.Logger(ctx).Infof("Loading %s", repository)
+			if err := bundler.readBundle(ctx, repository, tr); err != nil {
+				return nil, fmt.Errorf("failed to load %s: %w", repository, err)
+			}
+		case header.Name == bundleImagesFile:
+			common.Logger(ctx).Infof("Loading %d images", len(manifest.Images))
+			if err := container.LoadImages(ctx, tr); err != nil {
+				return nil, fmt.Errorf("failed to load images: %w", err)
+			}
+		default:
+			common.Logger(ctx).Debugf("ignoring unknown bundle entry %s", header.Name)
+		}
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("the bundle does not contain a %s", bundleManifestFile)
+	}
+	return manifest, nil
+}
+
+// collectBundleContent resolves the remote actions, reusable workflows and images of the workflows
+func collectBundleContent(ctx context.Context, config *Config, workflows []*model.Workflow) (*BundleManifest, error) {
+	manifest := &BundleManifest{
+		Version: bundleVersion,
+		Actions: []*BundledAction{},
+		Images:  []string{},
+	}
+	actions := map[string]*BundledAction{}
+	images := map[string]bool{}
+	addImage := func(image string) {
+		// images computed by expressions can't be resolved without running the workflow
+		if image != "" && !strings.Contains(image, "${{") {
+			images[image] = true
+		}
+	}
+
+	walker := newActionWalker(config, func(_ context.Context, ref *actionReference) error {
+		var org, repo, version string
+		switch ref.Type {
+		case model.StepTypeUsesActionRemote:
+			ra := newRemoteAction(ref.Uses)
+			org, repo, version = ra.Org, ra.Repo, ra.Ref
+		case model.StepTypeReusableWorkflowRemote:
+			rw := newRemoteReusableWorkflow(ref.Uses)
+			org, repo, version = rw.Org, rw.Repo, rw.Ref
+		case model.StepTypeUsesDockerURL:
+			addImage(strings.TrimPrefix(ref.Uses, "docker://"))
+			return nil
+		default:
+			return nil
+		}
+		actions[lockKey(org, repo, version)] = &BundledAction{
+			Repository: fmt.Sprintf("%s/%s", org, repo),
+			URL:        ref.URL,
+			Ref:        version,
+			SHA:        ref.SHA,
+		}
+		return nil
+	})
+	walker.visitJob = func(_ context.Context, job *model.Job) error {
+		for _, label := range job.RunsOn() {
+			if image := config.Platforms[strings.ToLower(label)]; image != "" {
+				if image != "-self-hosted" {
+					addImage(image)
+				}
+				break
+			}
+		}
+		if c := job.Container(); c != nil {
+			addImage(c.Image)
+		}
+		for _, service := range job.Services {
+			if service != nil {
+				addImage(service.Image)
+			}
+		}
+		return nil
+	}
+	walker.visitAction = func(ctx context.Context, ref *actionReference, action *model.Action, readFile actionYamlReader) error {
+		if action.Runs.Using != model.ActionRunsUsingDocker {
+			return nil
+		}
+		if strings.HasPrefix(action.Runs.Image, "docker://") {
+			addImage(strings.TrimPrefix(action.Runs.Image, "docker://"))
+			return nil
+		}
+		reader, closer, err := readFile(path.Clean(action.Runs.Image))
+		if err != nil {
+			return fmt.Errorf("failed to read %s of %s: %w", action.Runs.Image, ref.Uses, err)
+		}
+		defer closer.Close()
+		baseImages, err := dockerfileBaseImages(reader)
+		if err != nil {
+			return fmt.Errorf("failed to read %s of %s: %w", action.Runs.Image, ref.Uses, err)
+		}
+		for _, image := range baseImages {
+			addImage(image)
+		}
+		return nil
+	}
+	if err := walker.walkWorkflows(ctx, workflows); err != nil {
+		return nil, err
+	}
+	for _, runtime := range config.NodeRuntimes {
+		if runtime != nil {
+			addImage(runtime.Image)
+		}
+	}
+
+	for _, key := range sortedStringKeys(actions) {
+		manifest.Actions = append(manifest.Actions, actions[key])
+	}
+	manifest.Images = sortedStringKeys(images)
+	return manifest, nil
+}
+
+// dockerfileBaseImages returns the images of the FROM instructions, except scratch, previous build stages
+// and images depending on build arguments
+func dockerfileBaseImages(r io.Reader) ([]string, error) {
+	images := []string{}
+	stages := map[string]bool{"scratch": true}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+			continue
+		}
+		fields = fields[1:]
+		for len(fields) > 0 && strings.HasPrefix(fields[0], "--") {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		image := fields[0]
+		if len(fields) >= 3 && strings.EqualFold(fields[1], "AS") {
+			stages[strings.ToLower(fields[2])] = true
+		}
+		if stages[strings.ToLower(image)] || strings.Contains(image, "$") {
+			continue
+		}
+		images = append(images, image)
+	}
+	return images, scanner.Err()
+}
+
+func sortedStringKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeBundleEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: size}); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, r)
+	return err
+}
+
+// writeBundleTempEntry buffers the content in a temporary file, as the size has to be known before it is written to the archive
+func writeBundleTempEntry(tw *tar.Writer, name string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp("", "act-bundle-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if err := write(tmp); err != nil {
+		return err
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return writeBundleEntry(tw, name, size, tmp)
+}
+
+// writeBundle writes the commits of the refs with their history in the git bundle format,
+// the refs are named like the refs of the GoGitActionCacheOfflineMode
+func (c GoGitActionCache) writeBundle(_ context.Context, cacheDir string, refs map[string]string, w io.Writer) error {
+	gitPath := path.Join(c.Path, safeFilename(cacheDir)+".git")
+	gogitrepo, err := git.PlainOpen(gitPath)
+	if err != nil {
+		return fmt.Errorf("GoGitActionCache failed to open bare git %s at %s: %w", cacheDir, gitPath, err)
+	}
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(gitBundleSignature); err != nil {
+		return err
+	}
+	hashes := []plumbing.Hash{}
+	for _, ref := range sortedStringKeys(refs) {
+		hash := plumbing.NewHash(refs[ref])
+		hashes = append(hashes, hash)
+		if _, err := fmt.Fprintf(bw, "%s %s\n", hash, offlineRefName(ref)); err != nil {
+			return err
+		}
+	}
+	if _, err := bw.WriteString("\n"); err != nil {
+		return err
+	}
+	objects, err := revlist.Objects(gogitrepo.Storer, hashes, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := packfile.NewEncoder(bw, gogitrepo.Storer, false).Encode(objects, 10); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// readBundle unpacks a git bundle into the bare repository of the cache dir and creates its refs
+func (c GoGitActionCache) readBundle(_ context.Context, cacheDir string, r io.Reader) error {
+	gitPath := path.Join(c.Path, safeFilename(cacheDir)+".git")
+	gogitrepo, err := git.PlainInit(gitPath, true)
+	if errors.Is(err, git.ErrRepositoryAlreadyExists) {
+		gogitrepo, err = git.PlainOpen(gitPath)
+	}
+	if err != nil {
+		return fmt.Errorf("GoGitActionCache failed to open bare git %s at %s: %w", cacheDir, gitPath, err)
+	}
+	br := bufio.NewReader(r)
+	if signature, err := br.ReadString('\n'); err != nil || signature != gitBundleSignature {
+		return fmt.Errorf("not a v2 git bundle")
+	}
+	refs := []*plumbing.Reference{}
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read git bundle header: %w", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "-") {
+			return fmt.Errorf("git bundles with prerequisites are not supported")
+		}
+		hash, name, ok := strings.Cut(line, " ")
+		if !ok {
+			return fmt.Errorf("invalid git bundle ref %q", line)
+		}
+		refs = append(refs, plumbing.NewHashReference(plumbing.ReferenceName(name), plumbing.NewHash(hash)))
+	}
+	if err := packfile.UpdateObjectStorage(gogitrepo.Storer, br); err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if err := gogitrepo.Storer.SetReference(ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c GoGitActionCacheOfflineMode) writeBundle(ctx context.Context, cacheDir string, refs map[string]string, w io.Writer) error {
+	return c.Parent.writeBundle(ctx, cacheDir, refs, w)
+}
+
+func (c GoGitActionCacheOfflineMode) readBundle(ctx context.Context, cacheDir string, r io.Reader) error {
+	return c.Parent.readBundle(ctx, cacheDir, r)
+}
+
+func offlineRefName(ref string) plumbing.ReferenceName {
+	return plumbing.ReferenceName("refs/action-cache-offline/" + ref)
+}
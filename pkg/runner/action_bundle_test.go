@@ -0,0 +1,148 @@
+package runner
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nektos/act/pkg/model"
+)
+
+func initBundleTestRepo(t *testing.T, dir string, files map[string]string) {
+	repo, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+	wt, err := repo.Worktree()
+	require.NoError(t, err)
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+		_, err = wt.Add(name)
+		require.NoError(t, err)
+	}
+	_, err = wt.Commit("init", &git.CommitOptions{
+		Author: &object.Signature{Name: "act", Email: "act@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+	ref, err := repo.Head()
+	require.NoError(t, err)
+	_, err = repo.CreateTag("v1", ref.Hash(), nil)
+	require.NoError(t, err)
+}
+
+func TestBundle(t *testing.T) {
+	ctx := context.Background()
+	server := t.TempDir()
+	initBundleTestRepo(t, filepath.Join(server, "octo", "composite"), map[string]string{
+		"action.yml": "runs:\n  using: composite\n  steps:\n    - uses: octo/tool@v1\n",
+	})
+	initBundleTestRepo(t, filepath.Join(server, "octo", "tool"), map[string]string{
+		"action.yml": "runs:\n  using: node20\n  main: index.js\n",
+		"index.js":   "console.log('tool')\n",
+	})
+
+	workflow, err := model.ReadWorkflow(strings.NewReader(`
+on: push
+jobs:
+  build:
+    runs-on: self-hosted
+    steps:
+      - uses: octo/composite@v1
+`))
+	require.NoError(t, err)
+	workflow.File = "push.yml"
+
+	config := &Config{
+		GitHubServerUrl: "file://" + filepath.ToSlash(server),
+		Platforms:       map[string]string{"self-hosted": "-self-hosted"},
+		ActionCache:     &GoGitActionCache{Path: t.TempDir()},
+	}
+	buf := &bytes.Buffer{}
+	manifest, err := CreateBundle(ctx, config, []*model.Workflow{workflow}, buf)
+	require.NoError(t, err)
+	require.Len(t, manifest.Actions, 2)
+	assert.Equal(t, "octo/composite", manifest.Actions[0].Repository)
+	assert.Equal(t, "v1", manifest.Actions[0].Ref)
+	assert.Equal(t, "octo/tool", manifest.Actions[1].Repository)
+	assert.Empty(t, manifest.Images)
+
+	// the repositories are restored for the offline mode, the server is gone
+	offline := &GoGitActionCacheOfflineMode{Parent: GoGitActionCache{Path: t.TempDir()}}
+	loaded, err := LoadBundle(ctx, &Config{ActionCache: offline}, buf)
+	require.NoError(t, err)
+	assert.Equal(t, manifest, loaded)
+	require.NoError(t, os.RemoveAll(server))
+
+	sha, err := offline.Fetch(ctx, "octo/tool", "file://"+filepath.ToSlash(server)+"/octo/tool", "v1", "")
+	require.NoError(t, err)
+	assert.Equal(t, manifest.Actions[1].SHA, sha)
+	archive, err := offline.GetTarArchive(ctx, "octo/tool", sha, "index.js")
+	require.NoError(t, err)
+	defer archive.Close()
+	tr := tar.NewReader(archive)
+	_, err = tr.Next()
+	require.NoError(t, err)
+	content, err := io.ReadAll(tr)
+	require.NoError(t, err)
+	assert.Equal(t, "console.log('tool')\n", string(content))
+}
+
+func TestCollectBundleContentImages(t *testing.T) {
+	workdir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(workdir, "docker-action"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(workdir, "docker-action", "action.yml"), []byte("runs:\n  using: docker\n  image: Dockerfile\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(workdir, "docker-action", "Dockerfile"), []byte(`ARG VERSION=3
+FROM --platform=linux/amd64 golang:1.21 AS build
+FROM alpine:${VERSION}
+FROM build
+COPY --from=build /bin/app /app
+FROM scratch
+`), 0o600))
+
+	workflow, err := model.ReadWorkflow(strings.NewReader(`
+on: push
+jobs:
+  build:
+    runs-on: [self-hosted, ubuntu-latest]
+    container: node:20
+    services:
+      db:
+        image: postgres:16
+      dynamic:
+        image: ${{ matrix.image }}
+    steps:
+      - uses: ./docker-action
+      - uses: docker://ghcr.io/octo/tool:1
+`))
+	require.NoError(t, err)
+	workflow.File = "push.yml"
+
+	config := &Config{
+		Workdir:   workdir,
+		Platforms: map[string]string{"ubuntu-latest": "catthehacker/ubuntu:act-latest"},
+		NodeRuntimes: map[string]*NodeRuntime{
+			"node24": {Image: "node:24-slim"},
+		},
+	}
+	manifest, err := collectBundleContent(context.Background(), config, []*model.Workflow{workflow})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"catthehacker/ubuntu:act-latest",
+		"ghcr.io/octo/tool:1",
+		"golang:1.21",
+		"node:20",
+		"node:24-slim",
+		"postgres:16",
+	}, manifest.Images)
+	assert.Empty(t, manifest.Actions)
+}
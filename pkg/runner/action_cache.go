@@ -85,6 +85,12 @@ func (c GoGitActionCache) Fetch(ctx context.Context, cacheDir, url, ref, token s
 		return "", fmt.Errorf("GoGitActionCache failed to resolve sha %s with ref %s at %s: %w", url, ref, gitPath, err)
 	}
 	logger.Infof("GoGitActionCache fetch %s with ref %s at %s resolved to %s", url, ref, gitPath, hash.String())
+	if err := gogitrepo.Storer.SetReference(plumbing.NewHashReference(actionCacheRefName(ref), *hash)); err != nil {
+		logger.Debugf("GoGitActionCache failed to keep ref %s at %s: %v", ref, gitPath, err)
+	}
+	if err := touchActionCacheUsage(gitPath, ref, time.Now()); err != nil {
+		logger.Debugf("GoGitActionCache failed to record the use of ref %s at %s: %v", ref, gitPath, err)
+	}
 	return hash.String(), nil
 }
 
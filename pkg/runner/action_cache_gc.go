@@ -0,0 +1,309 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/nektos/act/pkg/common"
+)
+
+const (
+	// actionCacheUsageFile records in a bare repository of the GoGitActionCache when it and its refs were used last
+	actionCacheUsageFile = "act-usage.json"
+	// actionCacheGCFile is touched by every periodic gc of the action cache path
+	actionCacheGCFile = ".act-gc"
+	// actionCacheGCGracePeriod protects entries and objects used by concurrent runs from the gc
+	actionCacheGCGracePeriod = time.Hour
+	// DefaultActionCacheGCInterval is the time between two periodic gcs of the action cache path
+	DefaultActionCacheGCInterval = 24 * time.Hour
+)
+
+// actionCacheUsageMutex serializes the updates of the usage files by parallel jobs
+var actionCacheUsageMutex sync.Mutex
+
+type actionCacheUsage struct {
+	LastUsed time.Time            `json:"lastUsed"`
+	Refs     map[string]time.Time `json:"refs,omitempty"`
+}
+
+// ActionCacheEntry is a bare repository of the GoGitActionCache or a clone of the default action cache
+type ActionCacheEntry struct {
+	Name     string               // directory below the action cache path
+	Clone    bool                 // a clone of the default action cache, a bare repository otherwise
+	Size     int64                // bytes on disk
+	LastUsed time.Time            // last fetch or clone
+	Refs     map[string]time.Time // last fetch of each ref of a bare repository
+}
+
+// ActionCacheGCPolicy is the budget of the action cache path, the least recently used entries are removed first
+type ActionCacheGCPolicy struct {
+	MaxSize int64         // total size in bytes, 0 for no limit
+	MaxAge  time.Duration // entries and refs not used for longer are removed, 0 for no limit
+}
+
+// actionCacheRefName is kept for every fetched ref, it makes later fetches incremental and tells the gc which objects are in use
+func actionCacheRefName(ref string) plumbing.ReferenceName {
+	return plumbing.ReferenceName("refs/action-cache/" + ref)
+}
+
+func readActionCacheUsage(gitPath string) (*actionCacheUsage, error) {
+	usage := &actionCacheUsage{Refs: map[string]time.Time{}}
+	content, err := os.ReadFile(filepath.Join(gitPath, actionCacheUsageFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return usage, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, usage); err != nil {
+		return nil, err
+	}
+	if usage.Refs == nil {
+		usage.Refs = map[string]time.Time{}
+	}
+	return usage, nil
+}
+
+func writeActionCacheUsage(gitPath string, usage *actionCacheUsage) error {
+	content, err := json.Marshal(usage)
+	if err != nil {
+		return err
+	}
+	// other act processes may read the file while it is written
+	tmp := filepath.Join(gitPath, actionCacheUsageFile+".tmp")
+	if err := os.WriteFile(tmp, content, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(gitPath, actionCacheUsageFile))
+}
+
+func touchActionCacheUsage(gitPath, ref string, now time.Time) error {
+	actionCacheUsageMutex.Lock()
+	defer actionCacheUsageMutex.Unlock()
+	usage, err := readActionCacheUsage(gitPath)
+	if err != nil {
+		return err
+	}
+	usage.LastUsed = now
+	usage.Refs[ref] = now
+	return writeActionCacheUsage(gitPath, usage)
+}
+
+// touchActionClone marks a clone of the default action cache as used
+func touchActionClone(ctx context.Context, dir string) {
+	now := time.Now()
+	if err := os.Chtimes(dir, now, now); err != nil {
+		common.Logger(ctx).Debugf("failed to record the use of %s: %v", dir, err)
+	}
+}
+
+func isBareRepository(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, "HEAD"))
+	return err == nil && !info.IsDir()
+}
+
+func isClone(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil && info.IsDir()
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+func readActionCacheEntry(cachePath, name string) (*ActionCacheEntry, error) {
+	dir := filepath.Join(cachePath, name)
+	entry := &ActionCacheEntry{Name: name}
+	switch {
+	case strings.HasSuffix(name, ".git") && isBareRepository(dir):
+		usage, err := readActionCacheUsage(dir)
+		if err != nil {
+			return nil, err
+		}
+		entry.LastUsed = usage.LastUsed
+		entry.Refs = usage.Refs
+	case isClone(dir):
+		entry.Clone = true
+	default:
+		// host workspaces and the tool cache are not managed by the gc
+		return nil, nil
+	}
+	if entry.LastUsed.IsZero() {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+		entry.LastUsed = info.ModTime()
+	}
+	size, err := dirSize(dir)
+	if err != nil {
+		return nil, err
+	}
+	entry.Size = size
+	return entry, nil
+}
+
+// ListActionCache returns the repositories and clones of the action cache path, the least recently used first
+func ListActionCache(cachePath string) ([]*ActionCacheEntry, error) {
+	dirEntries, err := os.ReadDir(cachePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	entries := []*ActionCacheEntry{}
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() {
+			continue
+		}
+		entry, err := readActionCacheEntry(cachePath, dirEntry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LastUsed.Before(entries[j].LastUsed)
+	})
+	return entries, nil
+}
+
+// gcActionCacheRepository removes the refs not used within maxAge and repacks the objects still reachable
+func gcActionCacheRepository(ctx context.Context, gitPath string, maxAge time.Duration, now time.Time) error {
+	actionCacheUsageMutex.Lock()
+	defer actionCacheUsageMutex.Unlock()
+	repo, err := git.PlainOpen(gitPath)
+	if err != nil {
+		return err
+	}
+	usage, err := readActionCacheUsage(gitPath)
+	if err != nil {
+		return err
+	}
+	if maxAge > 0 {
+		for ref, lastUsed := range usage.Refs {
+			if now.Sub(lastUsed) <= maxAge {
+				continue
+			}
+			common.Logger(ctx).Debugf("removing ref %s of %s, last used at %s", ref, gitPath, lastUsed.Format(time.RFC3339))
+			_ = repo.Storer.RemoveReference(actionCacheRefName(ref))
+			_ = repo.Storer.RemoveReference(offlineRefName(ref))
+			delete(usage.Refs, ref)
+		}
+		if err := writeActionCacheUsage(gitPath, usage); err != nil {
+			return err
+		}
+	}
+	if err := repo.Prune(git.PruneOptions{
+		OnlyObjectsOlderThan: now.Add(-actionCacheGCGracePeriod),
+		Handler:              repo.DeleteObject,
+	}); err != nil {
+		return err
+	}
+	return repo.RepackObjects(&git.RepackConfig{
+		OnlyDeletePacksOlderThan: now.Add(-actionCacheGCGracePeriod),
+	})
+}
+
+// PruneActionCache removes the entries of the action cache path exceeding the policy and repacks the remaining repositories.
+// Entries used within the last hour are kept, they may belong to a running workflow.
+func PruneActionCache(ctx context.Context, cachePath string, policy ActionCacheGCPolicy) ([]*ActionCacheEntry, error) {
+	logger := common.Logger(ctx)
+	entries, err := ListActionCache(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	removed := []*ActionCacheEntry{}
+	remove := func(entry *ActionCacheEntry) error {
+		logger.Infof("removing %s from the action cache, last used at %s", entry.Name, entry.LastUsed.Format(time.RFC3339))
+		if err := os.RemoveAll(filepath.Join(cachePath, entry.Name)); err != nil {
+			return err
+		}
+		removed = append(removed, entry)
+		return nil
+	}
+
+	kept := []*ActionCacheEntry{}
+	var size int64
+	for _, entry := range entries {
+		if policy.MaxAge > 0 && now.Sub(entry.LastUsed) > policy.MaxAge && now.Sub(entry.LastUsed) > actionCacheGCGracePeriod {
+			if err := remove(entry); err != nil {
+				return removed, err
+			}
+			continue
+		}
+		if !entry.Clone {
+			gitPath := filepath.Join(cachePath, entry.Name)
+			if err := gcActionCacheRepository(ctx, gitPath, policy.MaxAge, now); err != nil {
+				logger.Warnf("failed to gc %s: %v", gitPath, err)
+			} else if entry, err = readActionCacheEntry(cachePath, entry.Name); err != nil {
+				return removed, err
+			}
+		}
+		kept = append(kept, entry)
+		size += entry.Size
+	}
+
+	// kept is still ordered by the last use
+	for _, entry := range kept {
+		if policy.MaxSize <= 0 || size <= policy.MaxSize {
+			break
+		}
+		if now.Sub(entry.LastUsed) <= actionCacheGCGracePeriod {
+			continue
+		}
+		if err := remove(entry); err != nil {
+			return removed, err
+		}
+		size -= entry.Size
+	}
+	return removed, nil
+}
+
+// PruneActionCacheIfDue runs PruneActionCache if the last gc of the action cache path is older than interval
+func PruneActionCacheIfDue(ctx context.Context, cachePath string, policy ActionCacheGCPolicy, interval time.Duration) error {
+	marker := filepath.Join(cachePath, actionCacheGCFile)
+	if info, err := os.Stat(marker); err == nil && time.Since(info.ModTime()) < interval {
+		return nil
+	}
+	if err := os.MkdirAll(cachePath, 0o755); err != nil {
+		return err
+	}
+	// touched first, concurrent runs don't start another gc
+	if err := os.WriteFile(marker, nil, 0o644); err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := os.Chtimes(marker, now, now); err != nil {
+		return err
+	}
+	_, err := PruneActionCache(ctx, cachePath, policy)
+	return err
+}
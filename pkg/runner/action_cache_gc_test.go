@@ -0,0 +1,106 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruneActionCache(t *testing.T) {
+	ctx := context.Background()
+	server := t.TempDir()
+	initBundleTestRepo(t, filepath.Join(server, "octo", "tool"), map[string]string{
+		"action.yml": "runs:\n  using: node20\n  main: index.js\n",
+	})
+	initBundleTestRepo(t, filepath.Join(server, "octo", "other"), map[string]string{
+		"action.yml": "runs:\n  using: node20\n  main: index.js\n",
+	})
+
+	cachePath := t.TempDir()
+	cache := &GoGitActionCache{Path: cachePath}
+	url := "file://" + filepath.ToSlash(server)
+	sha, err := cache.Fetch(ctx, "octo/tool", url+"/octo/tool", "v1", "")
+	require.NoError(t, err)
+	_, err = cache.Fetch(ctx, "octo/tool", url+"/octo/tool", "master", "")
+	require.NoError(t, err)
+	_, err = cache.Fetch(ctx, "octo/other", url+"/octo/other", "v1", "")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(cachePath, "octo-clone@v1", ".git"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(cachePath, "octo-clone@v1", "action.yml"), []byte("runs:\n  using: composite\n"), 0o600))
+	// a host workspace isn't an action
+	require.NoError(t, os.MkdirAll(filepath.Join(cachePath, "0123abcd", "hostexecutor"), 0o755))
+
+	entries, err := ListActionCache(cachePath)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	names := map[string]*ActionCacheEntry{}
+	for _, entry := range entries {
+		assert.Positive(t, entry.Size)
+		names[entry.Name] = entry
+	}
+	require.Contains(t, names, "octo-tool.git")
+	assert.Len(t, names["octo-tool.git"].Refs, 2)
+	assert.True(t, names["octo-clone@v1"].Clone)
+
+	// the master ref and the clone are unused for a week, the other repository for a day
+	old := time.Now().Add(-7 * 24 * time.Hour)
+	toolPath := filepath.Join(cachePath, "octo-tool.git")
+	usage, err := readActionCacheUsage(toolPath)
+	require.NoError(t, err)
+	usage.Refs["master"] = old
+	require.NoError(t, writeActionCacheUsage(toolPath, usage))
+	require.NoError(t, os.Chtimes(filepath.Join(cachePath, "octo-clone@v1"), old, old))
+	otherPath := filepath.Join(cachePath, "octo-other.git")
+	usage, err = readActionCacheUsage(otherPath)
+	require.NoError(t, err)
+	usage.LastUsed = time.Now().Add(-24 * time.Hour)
+	require.NoError(t, writeActionCacheUsage(otherPath, usage))
+
+	removed, err := PruneActionCache(ctx, cachePath, ActionCacheGCPolicy{MaxAge: 48 * time.Hour})
+	require.NoError(t, err)
+	require.Len(t, removed, 1)
+	assert.Equal(t, "octo-clone@v1", removed[0].Name)
+	assert.NoDirExists(t, filepath.Join(cachePath, "octo-clone@v1"))
+
+	repo, err := git.PlainOpen(toolPath)
+	require.NoError(t, err)
+	_, err = repo.Reference(actionCacheRefName("master"), true)
+	assert.Error(t, err)
+	ref, err := repo.Reference(actionCacheRefName("v1"), true)
+	require.NoError(t, err)
+	assert.Equal(t, sha, ref.Hash().String())
+	archive, err := cache.GetTarArchive(ctx, "octo/tool", sha, "action.yml")
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+
+	// the size budget removes the least recently used repository, the recently used one is in use
+	removed, err = PruneActionCache(ctx, cachePath, ActionCacheGCPolicy{MaxSize: 1})
+	require.NoError(t, err)
+	require.Len(t, removed, 1)
+	assert.Equal(t, "octo-other.git", removed[0].Name)
+	assert.DirExists(t, toolPath)
+}
+
+func TestPruneActionCacheIfDue(t *testing.T) {
+	ctx := context.Background()
+	cachePath := t.TempDir()
+	clone := filepath.Join(cachePath, "octo-clone@v1")
+	require.NoError(t, os.MkdirAll(filepath.Join(clone, ".git"), 0o755))
+	old := time.Now().Add(-7 * 24 * time.Hour)
+	require.NoError(t, os.Chtimes(clone, old, old))
+
+	require.NoError(t, PruneActionCacheIfDue(ctx, cachePath, ActionCacheGCPolicy{MaxAge: 48 * time.Hour}, time.Hour))
+	assert.NoDirExists(t, clone)
+
+	// the last gc was just now
+	require.NoError(t, os.MkdirAll(filepath.Join(clone, ".git"), 0o755))
+	require.NoError(t, os.Chtimes(clone, old, old))
+	require.NoError(t, PruneActionCacheIfDue(ctx, cachePath, ActionCacheGCPolicy{MaxAge: 48 * time.Hour}, time.Hour))
+	assert.DirExists(t, clone)
+}
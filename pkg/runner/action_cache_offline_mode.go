@@ -26,7 +26,7 @@ func (c GoGitActionCacheOfflineMode) Fetch(ctx context.Context, cacheDir, url, r
 	if err != nil {
 		return "", fetchErr
 	}
-	refName := plumbing.ReferenceName("refs/action-cache-offline/" + ref)
+	refName := offlineRefName(ref)
 	r, err := gogitrepo.Reference(refName, true)
 	if fetchErr == nil {
 		if err != nil || sha != r.Hash().String() {
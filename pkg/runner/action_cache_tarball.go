@@ -0,0 +1,286 @@
+package runner
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/nektos/act/pkg/common"
+)
+
+// TarballActionCache downloads actions with the repository tarball API of GitHub instead of git
+// and stores the extracted trees by commit SHA below Path
+type TarballActionCache struct {
+	Path   string       // directory of the extracted trees
+	APIURL string       // REST API of the instance, e.g. https://ghes.example.com/api/v3, repositories of github.com always use https://api.github.com
+	Client *http.Client // defaults to http.DefaultClient
+}
+
+var fullShaPattern = regexp.MustCompile("^[0-9a-f]{40}$")
+
+// maxTarballSymlinkDepth limits the symlinks followed by GetTarArchive
+const maxTarballSymlinkDepth = 10
+
+func (c TarballActionCache) client() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return http.DefaultClient
+}
+
+// repositoryAPIURL returns the API url of the repository of an action url like https://github.com/{owner}/{repo}
+func (c TarballActionCache) repositoryAPIURL(url string) (string, error) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.Split(strings.Trim(strings.TrimSuffix(u.Path, ".git"), "/"), "/")
+	if len(parts) < 2 {
+		return "", fmt.Errorf("%s is not the url of a repository", url)
+	}
+	apiURL := strings.TrimSuffix(c.APIURL, "/")
+	if u.Host == "github.com" || apiURL == "" {
+		apiURL = "https://api.github.com"
+	}
+	return fmt.Sprintf("%s/repos/%s/%s", apiURL, parts[len(parts)-2], parts[len(parts)-1]), nil
+}
+
+func (c TarballActionCache) get(ctx context.Context, url, accept, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("GET %s: %s %s", url, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+func (c TarballActionCache) treePath(sha string) string {
+	return filepath.Join(c.Path, sha)
+}
+
+func (c TarballActionCache) Fetch(ctx context.Context, cacheDir, url, ref, token string) (string, error) {
+	logger := common.Logger(ctx)
+
+	repoAPIURL, err := c.repositoryAPIURL(url)
+	if err != nil {
+		return "", fmt.Errorf("TarballActionCache failed to fetch %s with ref %s: %w", url, ref, err)
+	}
+	sha := ref
+	// a tree is never changed once extracted, pinned actions don't need the API
+	if _, err := os.Stat(c.treePath(sha)); !fullShaPattern.MatchString(sha) || err != nil {
+		resp, err := c.get(ctx, repoAPIURL+"/commits/"+neturl.PathEscape(ref), "application/vnd.github.sha", token)
+		if err != nil {
+			return "", fmt.Errorf("TarballActionCache failed to resolve %s with ref %s: %w", url, ref, err)
+		}
+		content, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("TarballActionCache failed to resolve %s with ref %s: %w", url, ref, err)
+		}
+		sha = strings.TrimSpace(string(content))
+		if !fullShaPattern.MatchString(sha) {
+			return "", fmt.Errorf("TarballActionCache failed to resolve %s with ref %s: unexpected sha %q", url, ref, sha)
+		}
+	}
+
+	treePath := c.treePath(sha)
+	if _, err := os.Stat(treePath); err == nil {
+		logger.Debugf("TarballActionCache cache hit %s with ref %s at %s", url, ref, treePath)
+		return sha, nil
+	}
+	logger.Infof("TarballActionCache download %s with ref %s to %s", url, ref, treePath)
+	resp, err := c.get(ctx, repoAPIURL+"/tarball/"+sha, "application/vnd.github+json", token)
+	if err != nil {
+		return "", fmt.Errorf("TarballActionCache failed to download %s with sha %s: %w", url, sha, err)
+	}
+	defer resp.Body.Close()
+	if err := os.MkdirAll(c.Path, 0o755); err != nil {
+		return "", err
+	}
+	// extracted next to the tree and renamed, concurrent fetches of the same sha see a complete tree or none
+	tmpPath, err := os.MkdirTemp(c.Path, sha+".tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpPath)
+	if err := extractTarball(resp.Body, tmpPath); err != nil {
+		return "", fmt.Errorf("TarballActionCache failed to extract %s with sha %s: %w", url, sha, err)
+	}
+	if err := os.Rename(tmpPath, treePath); err != nil {
+		if _, statErr := os.Stat(treePath); statErr != nil {
+			return "", fmt.Errorf("TarballActionCache failed to store %s with sha %s at %s: %w", url, sha, treePath, err)
+		}
+	}
+	logger.Infof("TarballActionCache fetch %s with ref %s at %s resolved to %s", url, ref, treePath, sha)
+	return sha, nil
+}
+
+// extractTarball extracts a repository tarball without its top level directory {owner}-{repo}-{sha}
+func extractTarball(r io.Reader, dest string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		_, name, _ := strings.Cut(strings.TrimPrefix(header.Name, "./"), "/")
+		name = path.Clean(name)
+		if name == "." || name == "" {
+			continue
+		}
+		if !fs.ValidPath(name) {
+			return fmt.Errorf("invalid path %s in tarball", header.Name)
+		}
+		target := filepath.Join(dest, filepath.FromSlash(name))
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0o755)
+		case tar.TypeReg:
+			err = writeTarballFile(target, tr, header.FileInfo().Mode().Perm())
+		case tar.TypeSymlink:
+			if err = os.MkdirAll(filepath.Dir(target), 0o755); err == nil {
+				err = os.Symlink(header.Linkname, target)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeTarballFile(target string, r io.Reader, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm|0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (c TarballActionCache) GetTarArchive(ctx context.Context, cacheDir, sha, includePrefix string) (io.ReadCloser, error) {
+	logger := common.Logger(ctx)
+
+	treePath := c.treePath(sha)
+
+	logger.Infof("TarballActionCache get content %s with sha %s subpath %s at %s", cacheDir, sha, includePrefix, treePath)
+
+	if !fullShaPattern.MatchString(sha) {
+		return nil, fmt.Errorf("TarballActionCache failed to open %s with sha %s: not a commit sha", cacheDir, sha)
+	}
+	if _, err := os.Stat(treePath); err != nil {
+		return nil, fmt.Errorf("TarballActionCache failed to open %s with sha %s subpath %s at %s: %w", cacheDir, sha, includePrefix, treePath, err)
+	}
+	tree := os.DirFS(treePath)
+	rpipe, wpipe := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(wpipe)
+		cleanIncludePrefix := path.Clean(includePrefix)
+		err := fs.WalkDir(tree, ".", func(name string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			return tarballCopyFileOrDir(ctx, treePath, tw, cleanIncludePrefix, name, name, 0)
+		})
+		if err == nil {
+			err = tw.Close()
+		}
+		wpipe.CloseWithError(err)
+	}()
+	return rpipe, nil
+}
+
+// tarballCopyFileOrDir writes the file origin, resolved to the file or directory file of the tree, like actionCacheCopyFileOrDir
+func tarballCopyFileOrDir(ctx context.Context, treePath string, tw *tar.Writer, cleanIncludePrefix, origin, file string, depth int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	name := origin
+	if strings.HasPrefix(name, cleanIncludePrefix+"/") {
+		name = name[len(cleanIncludePrefix)+1:]
+	} else if cleanIncludePrefix != "." && name != cleanIncludePrefix {
+		return nil
+	}
+	tree := os.DirFS(treePath)
+	info, err := os.Lstat(filepath.Join(treePath, filepath.FromSlash(file)))
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSymlink == fs.ModeSymlink {
+		if depth >= maxTarballSymlinkDepth {
+			return fmt.Errorf("%s: too many levels of symbolic links", origin)
+		}
+		link, err := os.Readlink(filepath.Join(treePath, filepath.FromSlash(file)))
+		if err != nil {
+			return err
+		}
+		dest := path.Join(path.Dir(file), filepath.ToSlash(link))
+		if !fs.ValidPath(dest) {
+			return fmt.Errorf("%s (%s): symlink outside of the repository", dest, origin)
+		}
+		destInfo, err := os.Lstat(filepath.Join(treePath, filepath.FromSlash(dest)))
+		if err != nil {
+			return fmt.Errorf("%s (%s): %w", dest, origin, err)
+		}
+		if destInfo.IsDir() {
+			return fs.WalkDir(tree, dest, func(sub string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				return tarballCopyFileOrDir(ctx, treePath, tw, cleanIncludePrefix, origin+strings.TrimPrefix(sub, dest), sub, depth+1)
+			})
+		}
+		return tarballCopyFileOrDir(ctx, treePath, tw, cleanIncludePrefix, origin, dest, depth+1)
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	f, err := tree.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
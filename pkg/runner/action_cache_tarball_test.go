@@ -0,0 +1,141 @@
+package runner
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTarball(t *testing.T, prefix string, entries []*tar.Header, contents map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: prefix + "/", Typeflag: tar.TypeDir, Mode: 0o755}))
+	for _, header := range entries {
+		content := contents[header.Name]
+		header.Name = prefix + "/" + header.Name
+		header.Size = int64(len(content))
+		require.NoError(t, tw.WriteHeader(header))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func readTestTarArchive(t *testing.T, archive io.ReadCloser) map[string]string {
+	defer archive.Close()
+	files := map[string]string{}
+	tr := tar.NewReader(archive)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[header.Name] = string(content)
+	}
+}
+
+func TestTarballActionCache(t *testing.T) {
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	tarball := newTestTarball(t, "octo-tool-0123456", []*tar.Header{
+		{Name: "action.yml", Typeflag: tar.TypeReg, Mode: 0o644},
+		{Name: "dist/", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "dist/index.js", Typeflag: tar.TypeReg, Mode: 0o755},
+		{Name: "sub/action.yml", Typeflag: tar.TypeSymlink, Linkname: "../action.yml"},
+		{Name: "lib", Typeflag: tar.TypeSymlink, Linkname: "dist"},
+	}, map[string]string{
+		"action.yml":    "runs:\n  using: node20\n  main: dist/index.js\n",
+		"dist/index.js": "console.log('tool')\n",
+	})
+
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/api/v3/repos/octo/tool/commits/v1":
+			assert.Equal(t, "application/vnd.github.sha", r.Header.Get("Accept"))
+			_, _ = w.Write([]byte(sha))
+		case "/api/v3/repos/octo/tool/tarball/" + sha:
+			http.Redirect(w, r, "/codeload/octo/tool/legacy.tar.gz/"+sha, http.StatusFound)
+		case "/codeload/octo/tool/legacy.tar.gz/" + sha:
+			_, _ = w.Write(tarball)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	cache := &TarballActionCache{Path: t.TempDir(), APIURL: server.URL + "/api/v3"}
+	resolved, err := cache.Fetch(ctx, "octo/tool", server.URL+"/octo/tool", "v1", "token")
+	require.NoError(t, err)
+	assert.Equal(t, sha, resolved)
+	assert.Len(t, requests, 3)
+
+	// the sha is stored, no request is needed
+	resolved, err = cache.Fetch(ctx, "octo/tool", server.URL+"/octo/tool", sha, "token")
+	require.NoError(t, err)
+	assert.Equal(t, sha, resolved)
+	assert.Len(t, requests, 3)
+
+	archive, err := cache.GetTarArchive(ctx, "octo/tool", sha, ".")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"action.yml":     "runs:\n  using: node20\n  main: dist/index.js\n",
+		"dist/index.js":  "console.log('tool')\n",
+		"lib/index.js":   "console.log('tool')\n",
+		"sub/action.yml": "runs:\n  using: node20\n  main: dist/index.js\n",
+	}, readTestTarArchive(t, archive))
+
+	archive, err = cache.GetTarArchive(ctx, "octo/tool", sha, "sub/action.yml")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"sub/action.yml": "runs:\n  using: node20\n  main: dist/index.js\n",
+	}, readTestTarArchive(t, archive))
+
+	archive, err = cache.GetTarArchive(ctx, "octo/tool", sha, "lib")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"index.js": "console.log('tool')\n",
+	}, readTestTarArchive(t, archive))
+
+	_, err = cache.Fetch(ctx, "octo/tool", server.URL+"/octo/tool", "v2", "token")
+	assert.ErrorContains(t, err, "404 Not Found")
+}
+
+func TestExtractTarballRejectsTraversal(t *testing.T) {
+	tarball := newTestTarball(t, "octo-tool-0123456", []*tar.Header{
+		{Name: "../../escape", Typeflag: tar.TypeReg, Mode: 0o644},
+	}, map[string]string{})
+	assert.ErrorContains(t, extractTarball(bytes.NewReader(tarball), t.TempDir()), "invalid path")
+}
+
+func TestTarballActionCacheRepositoryAPIURL(t *testing.T) {
+	cache := TarballActionCache{APIURL: "https://ghes.example.com/api/v3/"}
+	for url, expected := range map[string]string{
+		"https://ghes.example.com/octo/tool":     "https://ghes.example.com/api/v3/repos/octo/tool",
+		"https://ghes.example.com/octo/tool.git": "https://ghes.example.com/api/v3/repos/octo/tool",
+		"https://github.com/actions/checkout":    "https://api.github.com/repos/actions/checkout",
+	} {
+		actual, err := cache.repositoryAPIURL(url)
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	}
+	_, err := cache.repositoryAPIURL("https://github.com/octo")
+	assert.Error(t, err)
+}
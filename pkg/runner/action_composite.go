@@ -75,6 +75,7 @@ func newCompositeRunContext(ctx context.Context, parent *RunContext, step action
 		Parent:           parent,
 		EventJSON:        parent.EventJSON,
 		nodeToolFullPath: parent.nodeToolFullPath,
+		nodeRuntimePaths: parent.nodeRuntimePaths,
 		GHContextData:    parent.GHContextData,
 	}
 	if parent.ContextData != nil {
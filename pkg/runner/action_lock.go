@@ -0,0 +1,166 @@
+package runner
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/nektos/act/pkg/common"
+	"github.com/nektos/act/pkg/model"
+)
+
+const lockfileVersion = 1
+
+// Lockfile pins the refs of remote actions and reusable workflows to commit SHAs and images to digests
+type Lockfile struct {
+	Version int                      `yaml:"version"`
+	Actions map[string]*LockedAction `yaml:"actions"`          // keyed by {owner}/{repo}@{ref}
+	Images  map[string]*LockedImage  `yaml:"images,omitempty"` // keyed by the image of the workflow, written by act lock --images
+}
+
+// LockedAction is the commit SHA a ref resolved to and the workflows and actions using it
+type LockedAction struct {
+	URL    string   `yaml:"url"`
+	SHA    string   `yaml:"sha"`
+	UsedBy []string `yaml:"used-by"`
+}
+
+func lockKey(org, repo, ref string) string {
+	return fmt.Sprintf("%s/%s@%s", org, repo, ref)
+}
+
+// ReadLockfile reads a lockfile written by act lock
+func ReadLockfile(file string) (*Lockfile, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	lockfile := &Lockfile{}
+	if err := yaml.Unmarshal(content, lockfile); err != nil {
+		return nil, fmt.Errorf("failed to parse lockfile %s: %w", file, err)
+	}
+	if lockfile.Version != lockfileVersion {
+		return nil, fmt.Errorf("unsupported lockfile version %d in %s", lockfile.Version, file)
+	}
+	if lockfile.Actions == nil {
+		lockfile.Actions = map[string]*LockedAction{}
+	}
+	return lockfile, nil
+}
+
+// Write writes the lockfile with sorted keys, so it can be diffed and reviewed
+func (l *Lockfile) Write(file string) error {
+	content, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, content, 0o644)
+}
+
+func (l *Lockfile) lockedSha(org, repo, ref string) (string, error) {
+	key := lockKey(org, repo, ref)
+	if locked, ok := l.Actions[key]; ok && locked.SHA != "" {
+		return locked.SHA, nil
+	}
+	return "", fmt.Errorf("%s is not in the lockfile, run `act lock` to update it", key)
+}
+
+// fetchAction resolves a ref through the ActionCache. With a lockfile the ref has to be locked
+// and resolve to the locked SHA, a ref pointing to another commit is reported as drift.
+func (rc *RunContext) fetchAction(ctx context.Context, cacheDir, url, org, repo, ref, token string) (string, error) {
+	sha, err := rc.Config.ActionCache.Fetch(ctx, cacheDir, url, ref, token)
+	if err != nil || rc.Config.ActionLockfile == nil {
+		return sha, err
+	}
+	lockedSha, err := rc.Config.ActionLockfile.lockedSha(org, repo, ref)
+	if err != nil {
+		return "", err
+	}
+	if sha != lockedSha {
+		return "", fmt.Errorf("%s resolved to %s but is locked to %s, run `act lock` to update the lockfile", lockKey(org, repo, ref), sha, lockedSha)
+	}
+	return sha, nil
+}
+
+// newActionCacheReader reads the files of an action from the ActionCache and follows symlinks inside the repository
+func newActionCacheReader(ctx context.Context, cache ActionCache, cacheDir, sha, actionPath string) actionYamlReader {
+	return func(filename string) (io.Reader, io.Closer, error) {
+		spath := path.Join(actionPath, filename)
+		for i := 0; i < maxSymlinkDepth; i++ {
+			tars, err := cache.GetTarArchive(ctx, cacheDir, sha, spath)
+			if err != nil {
+				return nil, nil, os.ErrNotExist
+			}
+			treader := tar.NewReader(tars)
+			header, err := treader.Next()
+			if err != nil {
+				return nil, nil, os.ErrNotExist
+			}
+			if header.FileInfo().Mode()&os.ModeSymlink == os.ModeSymlink {
+				spath, err = symlinkJoin(spath, header.Linkname, ".")
+				if err != nil {
+					return nil, nil, err
+				}
+			} else {
+				return treader, tars, nil
+			}
+		}
+		return nil, nil, fmt.Errorf("max depth %d of symlinks exceeded while reading %s", maxSymlinkDepth, spath)
+	}
+}
+
+// LockActions walks the workflows, their composite actions and reusable workflows transitively
+// and resolves the ref of every remote action and reusable workflow to a commit SHA
+func LockActions(ctx context.Context, config *Config, workflows []*model.Workflow) (*Lockfile, error) {
+	if config.ActionCache == nil {
+		return nil, fmt.Errorf("locking actions requires an ActionCache")
+	}
+	lockfile := &Lockfile{
+		Version: lockfileVersion,
+		Actions: map[string]*LockedAction{},
+	}
+	walker := newActionWalker(config, func(ctx context.Context, ref *actionReference) error {
+		var org, repo, version string
+		switch ref.Type {
+		case model.StepTypeUsesActionRemote:
+			ra := newRemoteAction(ref.Uses)
+			org, repo, version = ra.Org, ra.Repo, ra.Ref
+		case model.StepTypeReusableWorkflowRemote:
+			rw := newRemoteReusableWorkflow(ref.Uses)
+			org, repo, version = rw.Org, rw.Repo, rw.Ref
+		default:
+			return nil
+		}
+		lockfile.lock(ctx, lockKey(org, repo, version), ref)
+		return nil
+	})
+	if err := walker.walkWorkflows(ctx, workflows); err != nil {
+		return nil, err
+	}
+	return lockfile, nil
+}
+
+func (l *Lockfile) lock(ctx context.Context, key string, ref *actionReference) {
+	locked, ok := l.Actions[key]
+	if !ok {
+		common.Logger(ctx).Infof("Locked %s to %s", key, ref.SHA)
+		locked = &LockedAction{
+			URL: ref.URL,
+			SHA: ref.SHA,
+		}
+		l.Actions[key] = locked
+	}
+	for _, u := range locked.UsedBy {
+		if u == ref.UsedBy {
+			return
+		}
+	}
+	locked.UsedBy = append(locked.UsedBy, ref.UsedBy)
+	sort.Strings(locked.UsedBy)
+}
@@ -0,0 +1,219 @@
+package runner
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nektos/act/pkg/model"
+)
+
+type fakeActionCache struct {
+	refs  map[string]string            // {cacheDir}@{ref} => sha
+	files map[string]map[string]string // sha => path => content
+}
+
+func (c *fakeActionCache) Fetch(_ context.Context, cacheDir, _, ref, _ string) (string, error) {
+	if sha, ok := c.refs[cacheDir+"@"+ref]; ok {
+		return sha, nil
+	}
+	return "", fmt.Errorf("unknown ref %s of %s", ref, cacheDir)
+}
+
+func (c *fakeActionCache) GetTarArchive(_ context.Context, _, sha, includePrefix string) (io.ReadCloser, error) {
+	content, ok := c.files[sha][includePrefix]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	if err := tw.WriteHeader(&tar.Header{Name: includePrefix, Mode: 0o644, Size: int64(len(content))}); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write([]byte(content)); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(buf), nil
+}
+
+func newFakeLockActionCache() *fakeActionCache {
+	return &fakeActionCache{
+		refs: map[string]string{
+			"actions/checkout@v4": "sha-checkout",
+			"octo/composite@v1":   "sha-composite",
+			"octo/tool@v2":        "sha-tool",
+			"octo/workflows@main": "sha-workflows",
+		},
+		files: map[string]map[string]string{
+			"sha-checkout": {"action.yml": "runs:\n  using: node20\n  main: index.js\n"},
+			"sha-tool":     {"action.yml": "runs:\n  using: node20\n  main: index.js\n"},
+			"sha-composite": {"sub/action.yml": `
+runs:
+  using: composite
+  steps:
+    - uses: octo/tool@v2
+`},
+			"sha-workflows": {".github/workflows/reuse.yml": `
+on: workflow_call
+jobs:
+  reuse:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+      - uses: octo/tool@v2
+`},
+		},
+	}
+}
+
+func TestLockActions(t *testing.T) {
+	workdir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(workdir, "local-action"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(workdir, "local-action", "action.yml"), []byte(`
+runs:
+  using: composite
+  steps:
+    - uses: octo/composite/sub@v1
+`), 0o600))
+
+	workflow, err := model.ReadWorkflow(strings.NewReader(`
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+      - uses: ./local-action
+      - uses: docker://alpine:3.18
+      - run: echo done
+  call:
+    uses: octo/workflows/.github/workflows/reuse.yml@main
+`))
+	require.NoError(t, err)
+	workflow.File = "push.yml"
+	workflow.Path = filepath.Join(workdir, ".github", "workflows", "push.yml")
+
+	config := &Config{
+		Workdir:        workdir,
+		GitHubInstance: "github.com",
+		ActionCache:    newFakeLockActionCache(),
+	}
+	lockfile, err := LockActions(context.Background(), config, []*model.Workflow{workflow})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]*LockedAction{
+		"actions/checkout@v4": {
+			URL:    "https://github.com/actions/checkout",
+			SHA:    "sha-checkout",
+			UsedBy: []string{".github/workflows/push.yml", "octo/workflows/.github/workflows/reuse.yml@main"},
+		},
+		"octo/composite@v1": {
+			URL:    "https://github.com/octo/composite",
+			SHA:    "sha-composite",
+			UsedBy: []string{"./local-action"},
+		},
+		"octo/tool@v2": {
+			URL:    "https://github.com/octo/tool",
+			SHA:    "sha-tool",
+			UsedBy: []string{"octo/composite/sub@v1", "octo/workflows/.github/workflows/reuse.yml@main"},
+		},
+		"octo/workflows@main": {
+			URL:    "https://github.com/octo/workflows",
+			SHA:    "sha-workflows",
+			UsedBy: []string{".github/workflows/push.yml"},
+		},
+	}, lockfile.Actions)
+
+	file := filepath.Join(workdir, "act.lock")
+	require.NoError(t, lockfile.Write(file))
+	read, err := ReadLockfile(file)
+	require.NoError(t, err)
+	assert.Equal(t, lockfile, read)
+
+	config.ActionCache = &fakeActionCache{}
+	_, err = LockActions(context.Background(), config, []*model.Workflow{workflow})
+	assert.ErrorContains(t, err, "unknown ref v4 of actions/checkout")
+}
+
+func TestLockActionsWorkflowPaths(t *testing.T) {
+	workdir := t.TempDir()
+	readWorkflow := func(dir, content string) *model.Workflow {
+		workflow, err := model.ReadWorkflow(strings.NewReader(content))
+		require.NoError(t, err)
+		workflow.File = "ci.yml"
+		workflow.Path = filepath.Join(workdir, dir, "ci.yml")
+		return workflow
+	}
+	// the workflows have the same file name in different directories, the local action is created by an earlier step
+	first := readWorkflow("first", `
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: ./generated-action
+      - uses: actions/checkout@v4
+`)
+	second := readWorkflow("second", `
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: octo/tool@v2
+`)
+
+	config := &Config{
+		Workdir:        workdir,
+		GitHubInstance: "github.com",
+		ActionCache:    newFakeLockActionCache(),
+	}
+	lockfile, err := LockActions(context.Background(), config, []*model.Workflow{first, second})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first/ci.yml"}, lockfile.Actions["actions/checkout@v4"].UsedBy)
+	assert.Equal(t, []string{"second/ci.yml"}, lockfile.Actions["octo/tool@v2"].UsedBy)
+}
+
+func TestFetchActionLocked(t *testing.T) {
+	cache := newFakeLockActionCache()
+	rc := &RunContext{
+		Config: &Config{
+			ActionCache: cache,
+		},
+	}
+	ctx := context.Background()
+
+	// without a lockfile the ref is resolved as is
+	sha, err := rc.fetchAction(ctx, "octo/tool", "https://github.com/octo/tool", "octo", "tool", "v2", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "sha-tool", sha)
+
+	rc.Config.ActionLockfile = &Lockfile{
+		Version: lockfileVersion,
+		Actions: map[string]*LockedAction{
+			"octo/tool@v2": {SHA: "sha-tool"},
+		},
+	}
+	sha, err = rc.fetchAction(ctx, "octo/tool", "https://github.com/octo/tool", "octo", "tool", "v2", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "sha-tool", sha)
+
+	cache.refs["octo/tool@v2"] = "sha-moved"
+	_, err = rc.fetchAction(ctx, "octo/tool", "https://github.com/octo/tool", "octo", "tool", "v2", "")
+	assert.ErrorContains(t, err, "octo/tool@v2 resolved to sha-moved but is locked to sha-tool")
+
+	_, err = rc.fetchAction(ctx, "actions/checkout", "https://github.com/actions/checkout", "actions", "checkout", "v4", "")
+	assert.ErrorContains(t, err, "actions/checkout@v4 is not in the lockfile")
+}
@@ -0,0 +1,165 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/nektos/act/pkg/common"
+	"github.com/nektos/act/pkg/model"
+)
+
+// ActionMock is a stub used instead of an action, a docker:// image or a reusable workflow
+type ActionMock struct {
+	Outputs map[string]string `yaml:"outputs"` // outputs of the step or the reusable workflow, may contain expressions
+	Env     map[string]string `yaml:"env"`     // env added for the following steps
+	Path    []string          `yaml:"path"`    // directories added to the PATH of the following steps
+	Run     string            `yaml:"run"`     // script executed in place of the action
+	Shell   string            `yaml:"shell"`   // shell used to execute the script
+	Result  string            `yaml:"result"`  // success or failure, defaults to success
+}
+
+// findActionMock returns the mock for a uses: reference, see findUsesPattern
+func findActionMock(mocks map[string]*ActionMock, uses string) *ActionMock {
+	mock, _ := findUsesPattern(mocks, uses)
+	return mock
+}
+
+// findUsesPattern returns the value for a uses: reference. Values are keyed by the exact reference or
+// a path.Match pattern, a pattern without @ matches every ref. The longest matching pattern wins.
+func findUsesPattern[T any](values map[string]T, uses string) (T, bool) {
+	var zero T
+	if len(values) == 0 || uses == "" {
+		return zero, false
+	}
+	if value, ok := values[uses]; ok {
+		return value, true
+	}
+
+	patterns := make([]string, 0, len(values))
+	for pattern := range values {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+
+	for _, pattern := range patterns {
+		name := uses
+		if !strings.Contains(pattern, "@") && !strings.HasPrefix(uses, "docker://") {
+			name, _, _ = strings.Cut(uses, "@")
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return values[pattern], true
+		}
+	}
+	return zero, false
+}
+
+type stepActionMock struct {
+	Step       *model.Step
+	RunContext *RunContext
+	mock       *ActionMock
+	env        map[string]string
+}
+
+func (sam *stepActionMock) pre() common.Executor {
+	return func(ctx context.Context) error {
+		return nil
+	}
+}
+
+func (sam *stepActionMock) main() common.Executor {
+	sam.env = map[string]string{}
+	return runStepExecutor(sam, stepStageMain, func(ctx context.Context) error {
+		rc := sam.RunContext
+		common.Logger(ctx).Infof("  \U0001F3AD  Mocked %s", sam.Step.Uses)
+
+		if sam.mock.Run != "" {
+			sr := &stepRun{
+				Step: &model.Step{
+					ID:               sam.Step.ID,
+					Run:              sam.mock.Run,
+					Shell:            sam.mock.Shell,
+					WorkingDirectory: sam.Step.WorkingDirectory,
+				},
+				RunContext: rc,
+				env:        sam.env,
+			}
+			if err := sr.runExecutor()(ctx); err != nil {
+				return err
+			}
+		}
+
+		eval := rc.NewStepExpressionEvaluator(ctx, sam)
+		for name, value := range sam.mock.Outputs {
+			rc.setOutput(ctx, map[string]string{"name": name}, eval.Interpolate(ctx, value))
+		}
+		for name, value := range sam.mock.Env {
+			rc.setEnv(ctx, map[string]string{"name": name}, eval.Interpolate(ctx, value))
+		}
+		for _, p := range sam.mock.Path {
+			rc.addPath(ctx, p)
+		}
+
+		if sam.mock.Result == model.StepStatusFailure.String() {
+			return fmt.Errorf("mocked step '%s' failed", sam.Step.Uses)
+		}
+		return nil
+	})
+}
+
+func (sam *stepActionMock) post() common.Executor {
+	return func(ctx context.Context) error {
+		return nil
+	}
+}
+
+func (sam *stepActionMock) getRunContext() *RunContext {
+	return sam.RunContext
+}
+
+func (sam *stepActionMock) getGithubContext(ctx context.Context) *model.GithubContext {
+	return sam.getRunContext().getGithubContext(ctx)
+}
+
+func (sam *stepActionMock) getStepModel() *model.Step {
+	return sam.Step
+}
+
+func (sam *stepActionMock) getEnv() *map[string]string {
+	return &sam.env
+}
+
+func (sam *stepActionMock) getIfExpression(_ context.Context, _ stepStage) string {
+	return sam.Step.If.Value
+}
+
+// newMockReusableWorkflowExecutor sets the outputs and the result of a job calling a mocked reusable workflow
+func newMockReusableWorkflowExecutor(rc *RunContext, mock *ActionMock) common.Executor {
+	return func(ctx context.Context) error {
+		logger := common.Logger(ctx)
+		job := rc.Run.Job()
+		logger.Infof("\U0001F3AD  Mocked %s", job.Uses)
+		if mock.Run != "" || len(mock.Env) > 0 || len(mock.Path) > 0 {
+			logger.Warnf("run, env and path of the mock for %s are ignored, a reusable workflow only has outputs and a result", job.Uses)
+		}
+
+		job.Outputs = map[string]string{}
+		for name, value := range mock.Outputs {
+			job.Outputs[name] = rc.ExprEval.Interpolate(ctx, value)
+		}
+
+		if mock.Result == model.StepStatusFailure.String() {
+			rc.result(mock.Result)
+			return fmt.Errorf("mocked reusable workflow '%s' failed", job.Uses)
+		}
+		rc.result(model.StepStatusSuccess.String())
+		return nil
+	}
+}
@@ -0,0 +1,45 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindActionMock(t *testing.T) {
+	exact := &ActionMock{Result: "exact"}
+	anyRef := &ActionMock{Result: "anyRef"}
+	org := &ActionMock{Result: "org"}
+	docker := &ActionMock{Result: "docker"}
+	workflow := &ActionMock{Result: "workflow"}
+	mocks := map[string]*ActionMock{
+		"aws-actions/configure-aws-credentials@v4": exact,
+		"aws-actions/configure-aws-credentials":    anyRef,
+		"aws-actions/*":                            org,
+		"docker://alpine:*":                        docker,
+		"octo-org/*/.github/workflows/deploy.yml":  workflow,
+	}
+
+	table := []struct {
+		uses     string
+		expected *ActionMock
+	}{
+		{"aws-actions/configure-aws-credentials@v4", exact},
+		{"aws-actions/configure-aws-credentials@v3", anyRef},
+		{"aws-actions/amazon-ecr-login@v2", org},
+		{"aws-actions/amazon-ecr-login/sub@v2", nil},
+		{"docker://alpine:3.18", docker},
+		{"docker://ubuntu:22.04", nil},
+		{"octo-org/deployments/.github/workflows/deploy.yml@main", workflow},
+		{"actions/checkout@v4", nil},
+		{"", nil},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.uses, func(t *testing.T) {
+			assert.Equal(t, tt.expected, findActionMock(mocks, tt.uses))
+		})
+	}
+
+	assert.Nil(t, findActionMock(nil, "actions/checkout@v4"))
+}
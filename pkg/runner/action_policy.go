@@ -0,0 +1,154 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"gopkg.in/yaml.v3"
+
+	"github.com/nektos/act/pkg/common"
+	"github.com/nektos/act/pkg/model"
+)
+
+// ActionPolicy restricts the actions, reusable workflows and docker images workflows may use,
+// similar to the actions permissions of a GitHub organization
+type ActionPolicy struct {
+	Allow             []string `yaml:"allow"`              // patterns of allowed actions and reusable workflows (e.g. actions/*), everything is allowed if empty
+	Deny              []string `yaml:"deny"`               // patterns of denied actions and reusable workflows, deny wins over allow
+	RequireSHAPin     bool     `yaml:"require-sha-pin"`    // actions and reusable workflows have to be referenced by a full commit SHA
+	TrustedRegistries []string `yaml:"trusted-registries"` // registries with an optional namespace docker:// images may be pulled from (e.g. ghcr.io/octo-org), every registry if empty
+}
+
+// PolicyViolation is a uses: reference violating the ActionPolicy
+type PolicyViolation struct {
+	File   string
+	Line   int
+	Uses   string
+	Reason string
+}
+
+func (v PolicyViolation) String() string {
+	return fmt.Sprintf("%s:%d: %s %s", v.File, v.Line, v.Uses, v.Reason)
+}
+
+var fullSha = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// ReadActionPolicy reads a policy file
+func ReadActionPolicy(file string) (*ActionPolicy, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	policy := &ActionPolicy{}
+	if err := yaml.Unmarshal(content, policy); err != nil {
+		return nil, fmt.Errorf("failed to parse action policy %s: %w", file, err)
+	}
+	return policy, nil
+}
+
+// CheckActionPolicy walks the workflows, their composite actions and reusable workflows transitively
+// and returns every violation of the policy. Remote actions and reusable workflows are only
+// descended into with an ActionCache.
+func CheckActionPolicy(ctx context.Context, config *Config, workflows []*model.Workflow) ([]PolicyViolation, error) {
+	violations := []PolicyViolation{}
+	walker := newActionWalker(config, func(_ context.Context, ref *actionReference) error {
+		for _, reason := range config.ActionPolicy.check(ref) {
+			violations = append(violations, PolicyViolation{
+				File:   ref.File,
+				Line:   ref.Line,
+				Uses:   ref.Uses,
+				Reason: reason,
+			})
+		}
+		return nil
+	})
+	if err := walker.walkWorkflows(ctx, workflows); err != nil {
+		return violations, err
+	}
+	return violations, nil
+}
+
+func (p *ActionPolicy) check(ref *actionReference) []string {
+	reasons := []string{}
+	switch ref.Type {
+	case model.StepTypeUsesActionRemote, model.StepTypeReusableWorkflowRemote:
+		if len(p.Allow) > 0 && !matchesPolicyPattern(p.Allow, ref.Uses) {
+			reasons = append(reasons, "is not allowed")
+		}
+		if matchesPolicyPattern(p.Deny, ref.Uses) {
+			reasons = append(reasons, "is denied")
+		}
+		if _, version, _ := strings.Cut(ref.Uses, "@"); p.RequireSHAPin && !fullSha.MatchString(version) {
+			reasons = append(reasons, "is not pinned to a full commit SHA")
+		}
+	case model.StepTypeUsesDockerURL:
+		if len(p.TrustedRegistries) == 0 {
+			break
+		}
+		image := strings.TrimPrefix(ref.Uses, "docker://")
+		named, err := reference.ParseNormalizedNamed(image)
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf("is not a valid image reference: %v", err))
+			break
+		}
+		if !isTrustedRegistry(p.TrustedRegistries, named.Name()) {
+			reasons = append(reasons, fmt.Sprintf("uses the untrusted registry %s", reference.Domain(named)))
+		}
+	}
+	return reasons
+}
+
+// matchesPolicyPattern matches the uses: against path.Match patterns, a pattern without @ matches every ref
+// and {owner}/* matches all actions and reusable workflows of the owner, also in subdirectories
+func matchesPolicyPattern(patterns []string, uses string) bool {
+	name, _, _ := strings.Cut(uses, "@")
+	candidates := []string{name}
+	if parts := strings.SplitN(name, "/", 3); len(parts) == 3 {
+		candidates = append(candidates, parts[0]+"/"+parts[1])
+	}
+	for _, pattern := range patterns {
+		if strings.Contains(pattern, "@") {
+			if ok, _ := path.Match(pattern, uses); ok {
+				return true
+			}
+			continue
+		}
+		for _, candidate := range candidates {
+			if ok, _ := path.Match(pattern, candidate); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isTrustedRegistry(registries []string, name string) bool {
+	for _, registry := range registries {
+		registry = strings.TrimSuffix(registry, "/")
+		if name == registry || strings.HasPrefix(name, registry+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkActionPolicy reports every violation of the policy and fails before any job starts
+func checkActionPolicy(ctx context.Context, config *Config, plan *model.Plan) error {
+	violations, err := CheckActionPolicy(ctx, config, plan.Workflows())
+	if err != nil {
+		return err
+	}
+	logger := common.Logger(ctx)
+	for _, violation := range violations {
+		logger.Errorf("❌  Policy violation %s", violation)
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("%d action policy violation(s) found", len(violations))
+	}
+	return nil
+}
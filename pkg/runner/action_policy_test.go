@@ -0,0 +1,114 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nektos/act/pkg/model"
+)
+
+func TestCheckActionPolicy(t *testing.T) {
+	workdir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(workdir, "local-action"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(workdir, "local-action", "action.yml"), []byte(`runs:
+  using: composite
+  steps:
+    - uses: octo/composite/sub@v1
+`), 0o600))
+
+	workflow, err := model.ReadWorkflow(strings.NewReader(`on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+      - uses: ./local-action
+      - uses: docker://alpine:3.18
+      - uses: docker://ghcr.io/octo/tool:1
+  call:
+    uses: octo/workflows/.github/workflows/reuse.yml@main
+`))
+	require.NoError(t, err)
+	workflow.File = "push.yml"
+
+	config := &Config{
+		Workdir:        workdir,
+		GitHubInstance: "github.com",
+		ActionCache:    newFakeLockActionCache(),
+		ActionPolicy: &ActionPolicy{
+			Allow:             []string{"actions/*", "octo/*"},
+			Deny:              []string{"octo/tool"},
+			TrustedRegistries: []string{"ghcr.io/octo"},
+		},
+	}
+	violations, err := CheckActionPolicy(context.Background(), config, []*model.Workflow{workflow})
+	require.NoError(t, err)
+
+	// the tool is used by the composite action and the reusable workflow
+	assert.ElementsMatch(t, []PolicyViolation{
+		{File: "push.yml", Line: 8, Uses: "docker://alpine:3.18", Reason: "uses the untrusted registry docker.io"},
+		{File: "octo/composite@v1/sub/action.yml", Line: 5, Uses: "octo/tool@v2", Reason: "is denied"},
+		{File: "octo/workflows@main/.github/workflows/reuse.yml", Line: 8, Uses: "octo/tool@v2", Reason: "is denied"},
+	}, violations)
+	assert.Equal(t, "push.yml:8: docker://alpine:3.18 uses the untrusted registry docker.io", PolicyViolation{File: "push.yml", Line: 8, Uses: "docker://alpine:3.18", Reason: "uses the untrusted registry docker.io"}.String())
+
+	config.ActionPolicy = &ActionPolicy{
+		Allow:         []string{"actions/checkout@*"},
+		RequireSHAPin: true,
+	}
+	violations, err = CheckActionPolicy(context.Background(), config, []*model.Workflow{workflow})
+	require.NoError(t, err)
+	assert.Contains(t, violations, PolicyViolation{File: "push.yml", Line: 6, Uses: "actions/checkout@v4", Reason: "is not pinned to a full commit SHA"})
+	assert.Contains(t, violations, PolicyViolation{File: "push.yml", Line: 11, Uses: "octo/workflows/.github/workflows/reuse.yml@main", Reason: "is not allowed"})
+	assert.NotContains(t, violations, PolicyViolation{File: "push.yml", Line: 6, Uses: "actions/checkout@v4", Reason: "is not allowed"})
+}
+
+func TestActionPolicyCheck(t *testing.T) {
+	sha := "b4ffde65f46336ab88eb53be808477a3936bae11"
+	table := []struct {
+		policy  ActionPolicy
+		ref     actionReference
+		reasons []string
+	}{
+		{ActionPolicy{}, actionReference{Uses: "actions/checkout@v4", Type: model.StepTypeUsesActionRemote}, []string{}},
+		{ActionPolicy{Allow: []string{"actions/*"}}, actionReference{Uses: "actions/cache/save@v4", Type: model.StepTypeUsesActionRemote}, []string{}},
+		{ActionPolicy{Allow: []string{"actions/checkout@v3"}}, actionReference{Uses: "actions/checkout@v4", Type: model.StepTypeUsesActionRemote}, []string{"is not allowed"}},
+		{ActionPolicy{Allow: []string{"actions/*"}, Deny: []string{"actions/checkout"}}, actionReference{Uses: "actions/checkout@v4", Type: model.StepTypeUsesActionRemote}, []string{"is denied"}},
+		{ActionPolicy{RequireSHAPin: true}, actionReference{Uses: "actions/checkout@" + sha, Type: model.StepTypeUsesActionRemote}, []string{}},
+		{ActionPolicy{RequireSHAPin: true}, actionReference{Uses: "octo/w/.github/workflows/w.yml@main", Type: model.StepTypeReusableWorkflowRemote}, []string{"is not pinned to a full commit SHA"}},
+		{ActionPolicy{Deny: []string{"*"}, RequireSHAPin: true}, actionReference{Uses: "./local-action", Type: model.StepTypeUsesActionLocal}, []string{}},
+		{ActionPolicy{TrustedRegistries: []string{"docker.io"}}, actionReference{Uses: "docker://alpine", Type: model.StepTypeUsesDockerURL}, []string{}},
+		{ActionPolicy{TrustedRegistries: []string{"ghcr.io/octo/"}}, actionReference{Uses: "docker://ghcr.io/octopus/tool", Type: model.StepTypeUsesDockerURL}, []string{"uses the untrusted registry ghcr.io"}},
+	}
+	for _, tt := range table {
+		t.Run(tt.ref.Uses, func(t *testing.T) {
+			assert.Equal(t, tt.reasons, tt.policy.check(&tt.ref))
+		})
+	}
+}
+
+func TestReadActionPolicy(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.yml")
+	require.NoError(t, os.WriteFile(file, []byte(`allow:
+  - actions/*
+deny:
+  - actions/cache@v1
+require-sha-pin: true
+trusted-registries:
+  - ghcr.io
+`), 0o600))
+	policy, err := ReadActionPolicy(file)
+	require.NoError(t, err)
+	assert.Equal(t, &ActionPolicy{
+		Allow:             []string{"actions/*"},
+		Deny:              []string{"actions/cache@v1"},
+		RequireSHAPin:     true,
+		TrustedRegistries: []string{"ghcr.io"},
+	}, policy)
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"io"
 	"io/fs"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/nektos/act/pkg/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 type closerMock struct {
@@ -249,3 +252,105 @@ func TestActionRunner(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckActionInputs(t *testing.T) {
+	action := &model.Action{
+		Inputs: map[string]model.Input{
+			"token":   {Required: true},
+			"path":    {Required: true, Default: "."},
+			"Ref":     {},
+			"version": {DeprecationMessage: "use ref instead"},
+		},
+		Runs: model.ActionRuns{
+			Using: "docker",
+		},
+	}
+	table := []struct {
+		name        string
+		with        map[string]string
+		err         string
+		annotations []string
+	}{
+		{
+			name: "valid",
+			with: map[string]string{"token": "t", "ref": "main", "args": "--verbose"},
+		},
+		{
+			name:        "unknown",
+			with:        map[string]string{"token": "t", "tokn": "t", "pth": "."},
+			annotations: []string{"Unexpected input(s) 'pth', 'tokn', valid inputs are ['Ref', 'path', 'token', 'version']"},
+		},
+		{
+			name:        "deprecated",
+			with:        map[string]string{"token": "t", "version": "v1"},
+			annotations: []string{"Input 'version' has been deprecated with message: use ref instead"},
+		},
+		{
+			name: "missing-required",
+			with: map[string]string{"ref": "main"},
+			err:  "Input required and not supplied: token",
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &RunContext{}
+			step := &stepActionRemote{
+				Step:       &model.Step{With: tt.with},
+				RunContext: rc,
+			}
+			err := checkActionInputs(context.Background(), step, action)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			messages := []string{}
+			for _, annotation := range rc.annotations {
+				assert.Equal(t, "warning", annotation.Level)
+				messages = append(messages, annotation.Message)
+			}
+			assert.ElementsMatch(t, tt.annotations, messages)
+		})
+	}
+
+	// synthetic actions accept every input
+	assert.NoError(t, checkActionInputs(context.Background(), &stepActionRemote{Step: &model.Step{}, RunContext: &RunContext{}}, &model.Action{
+		Name:   "(Synthetic)",
+		Inputs: map[string]model.Input{"required": {Required: true}},
+	}))
+}
+
+func TestDockerActionBuildArgs(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM alpine\nARG INPUT_VERSION\nARG TOKEN\nARG UNSET\n"), 0o644))
+
+	step := &stepActionRemote{
+		Step: &model.Step{Uses: "octo/tool@v1"},
+		RunContext: &RunContext{Config: &Config{
+			Secrets:            map[string]string{"NPM_TOKEN": "s3cr3t"},
+			DockerBuildSecrets: map[string]string{"npm_token": "NPM_TOKEN", "missing": "MISSING"},
+		}},
+		env: map[string]string{
+			"INPUT_VERSION": "1.2.3",
+			"TOKEN":         "s3cr3t",
+			"GITHUB_SHA":    "0123456",
+		},
+	}
+	args, err := dockerActionBuildArgs(context.Background(), step, false, dir, "Dockerfile")
+	require.NoError(t, err)
+	// only declared ARGs are passed, secrets never end up in the image history
+	assert.Equal(t, map[string]string{"INPUT_VERSION": "1.2.3"}, args)
+
+	assert.Equal(t, map[string]string{"npm_token": "s3cr3t"}, step.RunContext.dockerBuildSecrets(context.Background()))
+}
+
+func TestBuiltDockerActionImage(t *testing.T) {
+	t.Cleanup(func() {
+		delete(dockerActionImages, "act-test-built-dockeraction")
+	})
+	assert.Equal(t, []string{"a1"}, builtDockerActionImage("act-test-built-dockeraction", "a1"))
+	// a parallel job builds the action with other build args, both images are kept
+	assert.Equal(t, []string{"a1", "b2"}, builtDockerActionImage("act-test-built-dockeraction", "b2"))
+	assert.Equal(t, []string{"a1", "b2"}, builtDockerActionImage("act-test-built-dockeraction", "a1"))
+}
@@ -0,0 +1,281 @@
+package runner
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/nektos/act/pkg/common"
+	"github.com/nektos/act/pkg/model"
+)
+
+// actionReference is a uses: of a job or a step found while walking workflows and actions
+type actionReference struct {
+	Uses   string
+	Type   model.StepType
+	File   string // workflow or action file containing the reference
+	Line   int
+	UsedBy string // workflow file or uses: of the action or reusable workflow containing the reference
+	SHA    string // commit of a remote action or reusable workflow, empty without an ActionCache
+	URL    string // repository of a remote action or reusable workflow
+}
+
+// actionWalker visits every uses: of workflows, their composite actions and reusable workflows transitively.
+// Remote actions and reusable workflows are only descended into if an ActionCache is available.
+type actionWalker struct {
+	cache     ActionCache
+	serverURL string
+	token     string
+	workdir   string
+	visit     func(ctx context.Context, ref *actionReference) error
+	// optional, called for every job running steps
+	visitJob func(ctx context.Context, job *model.Job) error
+	// optional, called once for every action read with a reader of the files of the action
+	visitAction func(ctx context.Context, ref *actionReference, action *model.Action, readFile actionYamlReader) error
+	shas        map[string]string
+	visited     map[string]bool
+}
+
+func newActionWalker(config *Config, visit func(ctx context.Context, ref *actionReference) error) *actionWalker {
+	return &actionWalker{
+		cache:     config.ActionCache,
+		serverURL: config.GetGitHubServerUrl(),
+		token:     config.Token,
+		workdir:   config.Workdir,
+		visit:     visit,
+		shas:      map[string]string{},
+		visited:   map[string]bool{},
+	}
+}
+
+func (w *actionWalker) walkWorkflows(ctx context.Context, workflows []*model.Workflow) error {
+	for _, workflow := range workflows {
+		// workflows of different directories may have the same file name
+		file := workflow.Path
+		if file == "" {
+			file = workflow.File
+		}
+		if w.visited[file] {
+			continue
+		}
+		w.visited[file] = true
+		usedBy := file
+		if rel, err := filepath.Rel(w.workdir, file); err == nil && filepath.IsAbs(file) {
+			usedBy = filepath.ToSlash(rel)
+		}
+		if err := w.walkWorkflow(ctx, workflow, usedBy, usedBy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *actionWalker) fetch(ctx context.Context, org, repo, ref string) (string, string, error) {
+	url := fmt.Sprintf("%s/%s/%s", w.serverURL, org, repo)
+	if w.cache == nil {
+		return "", url, nil
+	}
+	key := lockKey(org, repo, ref)
+	if sha, ok := w.shas[key]; ok {
+		return sha, url, nil
+	}
+	sha, err := w.cache.Fetch(ctx, fmt.Sprintf("%s/%s", org, repo), url, ref, w.token)
+	if err != nil {
+		return "", url, fmt.Errorf("failed to fetch \"%s\" version \"%s\": %w", url, ref, err)
+	}
+	w.shas[key] = sha
+	return sha, url, nil
+}
+
+func (w *actionWalker) walkWorkflow(ctx context.Context, workflow *model.Workflow, file, usedBy string) error {
+	for _, jobID := range workflow.GetJobIDs() {
+		job := workflow.GetJob(jobID)
+		jobType, err := job.Type()
+		if err != nil {
+			return err
+		}
+		switch jobType {
+		case model.JobTypeReusableWorkflowLocal:
+			ref := &actionReference{Uses: job.Uses, Type: model.StepTypeReusableWorkflowLocal, File: file, Line: job.Line, UsedBy: usedBy}
+			if err := w.visit(ctx, ref); err != nil {
+				return err
+			}
+			if err := w.walkLocalReusableWorkflow(ctx, job.Uses); err != nil {
+				return err
+			}
+		case model.JobTypeReusableWorkflowRemote:
+			if err := w.walkRemoteReusableWorkflow(ctx, job, file, usedBy); err != nil {
+				return err
+			}
+		default:
+			if w.visitJob != nil {
+				if err := w.visitJob(ctx, job); err != nil {
+					return err
+				}
+			}
+			if err := w.walkSteps(ctx, job.Steps, file, usedBy); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *actionWalker) walkLocalReusableWorkflow(ctx context.Context, uses string) error {
+	if w.visited[uses] {
+		return nil
+	}
+	w.visited[uses] = true
+	f, err := os.Open(filepath.Join(w.workdir, uses))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	workflow, err := model.ReadWorkflow(f)
+	if err != nil {
+		return fmt.Errorf("failed to read reusable workflow %s: %w", uses, err)
+	}
+	return w.walkWorkflow(ctx, workflow, path.Clean(uses), uses)
+}
+
+func (w *actionWalker) walkRemoteReusableWorkflow(ctx context.Context, job *model.Job, file, usedBy string) error {
+	rw := newRemoteReusableWorkflow(job.Uses)
+	if rw == nil {
+		return fmt.Errorf("expected format {owner}/{repo}/.github/workflows/{filename}@{ref}. Actual '%s' Input string was not in a correct format", job.Uses)
+	}
+	sha, url, err := w.fetch(ctx, rw.Org, rw.Repo, rw.Ref)
+	if err != nil {
+		return err
+	}
+	ref := &actionReference{Uses: job.Uses, Type: model.StepTypeReusableWorkflowRemote, File: file, Line: job.Line, UsedBy: usedBy, SHA: sha, URL: url}
+	if err := w.visit(ctx, ref); err != nil {
+		return err
+	}
+	if sha == "" || w.visited[job.Uses] {
+		return nil
+	}
+	w.visited[job.Uses] = true
+
+	workflowFile := fmt.Sprintf(".github/workflows/%s", rw.Filename)
+	archive, err := w.cache.GetTarArchive(ctx, fmt.Sprintf("%s/%s", rw.Org, rw.Repo), sha, workflowFile)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	treader := tar.NewReader(archive)
+	if _, err = treader.Next(); err != nil {
+		return fmt.Errorf("failed to read reusable workflow %s: %w", job.Uses, err)
+	}
+	workflow, err := model.ReadWorkflow(treader)
+	if err != nil {
+		return fmt.Errorf("failed to read reusable workflow %s: %w", job.Uses, err)
+	}
+	return w.walkWorkflow(ctx, workflow, fmt.Sprintf("%s/%s@%s/%s", rw.Org, rw.Repo, rw.Ref, workflowFile), job.Uses)
+}
+
+func (w *actionWalker) walkSteps(ctx context.Context, steps []*model.Step, file, usedBy string) error {
+	for _, step := range steps {
+		if step == nil || step.Uses == "" {
+			continue
+		}
+		ref := &actionReference{Uses: step.Uses, Type: step.Type(), File: file, Line: step.Line, UsedBy: usedBy}
+
+		var action *model.Action
+		var actionFile string
+		var readFile actionYamlReader
+		switch ref.Type {
+		case model.StepTypeUsesActionRemote:
+			ra := newRemoteAction(step.Uses)
+			if ra == nil {
+				return fmt.Errorf("Expected format {org}/{repo}[/path]@ref. Actual '%s' Input string was not in a correct format", step.Uses)
+			}
+			var err error
+			if ref.SHA, ref.URL, err = w.fetch(ctx, ra.Org, ra.Repo, ra.Ref); err != nil {
+				return err
+			}
+			if err := w.visit(ctx, ref); err != nil {
+				return err
+			}
+			if ref.SHA == "" || w.visited[step.Uses] {
+				continue
+			}
+			w.visited[step.Uses] = true
+			cacheDir := fmt.Sprintf("%s/%s", ra.Org, ra.Repo)
+			readFile = newActionCacheReader(ctx, w.cache, cacheDir, ref.SHA, ra.Path)
+			if action, actionFile, err = readWalkedAction(ctx, step, ref.SHA, ra.Path, readFile); err != nil {
+				return err
+			}
+			actionFile = fmt.Sprintf("%s/%s@%s/%s", ra.Org, ra.Repo, ra.Ref, path.Join(ra.Path, actionFile))
+		case model.StepTypeUsesActionLocal:
+			if err := w.visit(ctx, ref); err != nil {
+				return err
+			}
+			if w.visited[step.Uses] {
+				continue
+			}
+			w.visited[step.Uses] = true
+			actionDir := filepath.Join(w.workdir, step.Uses)
+			readFile = func(filename string) (io.Reader, io.Closer, error) {
+				f, err := os.Open(filepath.Join(actionDir, filename))
+				return f, f, err
+			}
+			var err error
+			if action, actionFile, err = readWalkedAction(ctx, step, actionDir, "", readFile); errors.Is(err, fs.ErrNotExist) {
+				// e.g. the action is created by an earlier step
+				common.Logger(ctx).Infof("Skipping local action %s, it is not in the workdir", step.Uses)
+				continue
+			} else if err != nil {
+				return err
+			}
+			actionFile = path.Join(step.Uses, actionFile)
+		default:
+			if err := w.visit(ctx, ref); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if w.visitAction != nil {
+			if err := w.visitAction(ctx, ref, action, readFile); err != nil {
+				return err
+			}
+		}
+		if action.Runs.Using == model.ActionRunsUsingComposite {
+			compositeSteps := make([]*model.Step, 0, len(action.Runs.Steps))
+			for i := range action.Runs.Steps {
+				compositeSteps = append(compositeSteps, &action.Runs.Steps[i])
+			}
+			if err := w.walkSteps(ctx, compositeSteps, actionFile, step.Uses); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readWalkedAction reads the action model and returns the name of the action file it was read from
+func readWalkedAction(ctx context.Context, step *model.Step, actionDir, actionPath string, readFile actionYamlReader) (*model.Action, string, error) {
+	actionFile := "action.yml"
+	reader := func(filename string) (io.Reader, io.Closer, error) {
+		r, c, err := readFile(filename)
+		if err == nil {
+			actionFile = filename
+		}
+		return r, c, err
+	}
+	action, err := readActionImpl(ctx, step, actionDir, actionPath, reader, discardFile)
+	if err != nil {
+		common.Logger(ctx).Debugf("failed to read action %s: %v", step.Uses, err)
+	}
+	return action, actionFile, err
+}
+
+func discardFile(_ string, _ []byte, _ fs.FileMode) error {
+	return nil
+}
@@ -51,10 +51,15 @@ func (rc *RunContext) commandHandler(ctx context.Context) common.LineHandler {
 			rc.addPath(ctx, arg)
 		case "debug":
 			logger.Debugf("%s", arg)
+		case "notice":
+			logger.Infof("%s", arg)
+			rc.addAnnotation(command, kvPairs, arg)
 		case "warning":
 			logger.Warnf("%s", arg)
+			rc.addAnnotation(command, kvPairs, arg)
 		case "error":
 			logger.Errorf("%s", arg)
+			rc.addAnnotation(command, kvPairs, arg)
 		case "add-mask":
 			rc.AddMask(arg)
 			logger.Infof("  \U00002699  %s", "***")
@@ -92,6 +92,7 @@ func (rc *RunContext) NewExpressionEvaluatorWithEnv(ctx context.Context, env map
 		ContextData: rc.ContextData,
 		HashFiles:   getHashFilesFunction(ctx, rc),
 	}
+	rc.scopeGithubToken(ee)
 	if rc.JobContainer != nil {
 		ee.Runner = rc.JobContainer.GetRunnerContext(ctx)
 	}
@@ -157,6 +158,7 @@ func (rc *RunContext) newStepExpressionEvaluator(ctx context.Context, step step,
 		ContextData: rc.ContextData,
 		HashFiles:   getHashFilesFunction(ctx, rc),
 	}
+	rc.scopeGithubToken(ee)
 	if rc.JobContainer != nil {
 		ee.Runner = rc.JobContainer.GetRunnerContext(ctx)
 		ee.EnvCaseSens = !rc.JobContainer.IsEnvironmentCaseInsensitive()
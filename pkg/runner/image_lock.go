@@ -0,0 +1,121 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+
+	"github.com/nektos/act/pkg/common"
+	"github.com/nektos/act/pkg/container"
+	"github.com/nektos/act/pkg/model"
+)
+
+// LockedImage is the registry digest an image of the workflows resolved to
+type LockedImage struct {
+	Digest string `yaml:"digest"`
+}
+
+// mirrorImage replaces the registry or repository prefix of an image by its mirror of RegistryMirrors,
+// the longest matching prefix wins. Prefixes are matched against the normalized name, e.g. docker.io/library/node.
+func (config *Config) mirrorImage(image string) string {
+	if len(config.RegistryMirrors) == 0 {
+		return image
+	}
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		// images computed by expressions are mirrored after the interpolation
+		return image
+	}
+	name := named.Name()
+	var prefix, mirror string
+	for p, m := range config.RegistryMirrors {
+		p = strings.TrimSuffix(p, "/")
+		if (name == p || strings.HasPrefix(name, p+"/")) && len(p) > len(prefix) {
+			prefix, mirror = p, strings.TrimSuffix(m, "/")
+		}
+	}
+	if prefix == "" {
+		return image
+	}
+	mirrored := mirror + strings.TrimPrefix(name, prefix)
+	if tagged, ok := named.(reference.Tagged); ok {
+		mirrored += ":" + tagged.Tag()
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		mirrored += "@" + digested.Digest().String()
+	}
+	return mirrored
+}
+
+// pullImage pulls the mirrored image of a container and verifies the digest of the image of the workflow
+func (rc *RunContext) pullImage(c container.Container, image string, forcePull bool) common.Executor {
+	return c.Pull(forcePull).Then(rc.verifyImage(image))
+}
+
+// verifyImage logs and reports the digest the image of the workflow was pulled with and fails if it differs from the locked digest
+func (rc *RunContext) verifyImage(image string) common.Executor {
+	return func(ctx context.Context) error {
+		if common.Dryrun(ctx) || image == "" {
+			return nil
+		}
+		logger := common.Logger(ctx)
+		pulled := rc.Config.mirrorImage(image)
+		digest, err := container.ImageDigest(ctx, pulled)
+		switch {
+		case err != nil:
+			logger.Debugf("failed to get the digest of %s: %v", pulled, err)
+		case digest == "":
+			logger.Debugf("image %s has no registry digest", pulled)
+		default:
+			logger.Infof("image %s resolved to %s", pulled, digest)
+			rc.addImageDigest(image, digest)
+		}
+
+		lockfile := rc.Config.ActionLockfile
+		if lockfile == nil {
+			return nil
+		}
+		locked, ok := lockfile.Images[image]
+		if !ok || locked.Digest == "" {
+			logger.Warnf("image %s is not in the lockfile, run `act lock --images` to pin it", image)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to verify the digest of %s: %w", pulled, err)
+		}
+		if digest != locked.Digest {
+			return fmt.Errorf("image %s resolved to %s but is locked to %s, run `act lock --images` to update the lockfile", pulled, digest, locked.Digest)
+		}
+		return nil
+	}
+}
+
+func (rc *RunContext) addImageDigest(image, digest string) {
+	jrc := rc.jobRunContext()
+	jrc.imagesMutex.Lock()
+	defer jrc.imagesMutex.Unlock()
+	if jrc.images == nil {
+		jrc.images = map[string]string{}
+	}
+	jrc.images[image] = digest
+}
+
+// LockImages resolves the images of the workflows, their actions and the platforms to the digests of their (mirrored) registries
+func LockImages(ctx context.Context, config *Config, workflows []*model.Workflow, lockfile *Lockfile) error {
+	content, err := collectBundleContent(ctx, config, workflows)
+	if err != nil {
+		return err
+	}
+	lockfile.Images = map[string]*LockedImage{}
+	for _, image := range content.Images {
+		digest, err := container.ResolveImageDigest(ctx, config.mirrorImage(image), config.Secrets["DOCKER_USERNAME"], config.Secrets["DOCKER_PASSWORD"])
+		if err != nil {
+			return fmt.Errorf("failed to resolve the digest of %s: %w", image, err)
+		}
+		common.Logger(ctx).Infof("Locked %s to %s", image, digest)
+		lockfile.Images[image] = &LockedImage{Digest: digest}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirrorImage(t *testing.T) {
+	config := &Config{
+		RegistryMirrors: map[string]string{
+			"docker.io":            "mirror.example.com/dockerhub/",
+			"docker.io/library":    "mirror.example.com/library",
+			"ghcr.io/octo":         "registry.example.com/octo",
+			"ghcr.io/octo/special": "special.example.com",
+		},
+	}
+	digest := "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	table := map[string]string{
+		"node:20":                          "mirror.example.com/library/node:20",
+		"postgres":                         "mirror.example.com/library/postgres",
+		"catthehacker/ubuntu:act-latest":   "mirror.example.com/dockerhub/catthehacker/ubuntu:act-latest",
+		"alpine@" + digest:                 "mirror.example.com/library/alpine@" + digest,
+		"ghcr.io/octo/tool:1":              "registry.example.com/octo/tool:1",
+		"ghcr.io/octo/special:1":           "special.example.com:1",
+		"ghcr.io/octopus/tool:1":           "ghcr.io/octopus/tool:1",
+		"quay.io/octo/tool":                "quay.io/octo/tool",
+		"${{ matrix.image }}":              "${{ matrix.image }}",
+		"registry.example.com/octo/tool:1": "registry.example.com/octo/tool:1",
+	}
+	for image, expected := range table {
+		assert.Equal(t, expected, config.mirrorImage(image), image)
+	}
+	assert.Equal(t, "node:20", (&Config{}).mirrorImage("node:20"))
+}
+
+func TestReadLockfileImages(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "act.lock")
+	lockfile := &Lockfile{
+		Version: lockfileVersion,
+		Actions: map[string]*LockedAction{},
+		Images: map[string]*LockedImage{
+			"node:20": {Digest: "sha256:0123"},
+		},
+	}
+	require.NoError(t, lockfile.Write(file))
+	content, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "images:\n    node:20:\n        digest: sha256:0123\n")
+
+	read, err := ReadLockfile(file)
+	require.NoError(t, err)
+	assert.Equal(t, lockfile, read)
+}
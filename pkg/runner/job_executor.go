@@ -3,6 +3,7 @@ package runner
 import (
 	"context"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/nektos/act/pkg/common"
@@ -63,6 +64,23 @@ func newJobExecutor(info jobInfo, sf stepFactory, rc *RunContext) common.Executo
 		if stepModel.ID == "" {
 			stepModel.ID = fmt.Sprintf("%d", i)
 		}
+	}
+
+	selectedSteps, selectionWarnings := selectSteps(rc.Config, infoSteps)
+	steps = append(steps, func(ctx context.Context) error {
+		logger := common.Logger(ctx)
+		for _, warning := range selectionWarnings {
+			logger.Warn(warning)
+		}
+		return nil
+	})
+
+	for i, stepModel := range infoSteps {
+		stepModel := stepModel
+		if !selectedSteps[i] {
+			steps = append(steps, useStepLogger(rc, stepModel, stepStageMain, skipStepExecutor(rc, stepModel)))
+			continue
+		}
 
 		step, err := sf.newStep(stepModel, rc)
 
@@ -95,6 +113,12 @@ func newJobExecutor(info jobInfo, sf stepFactory, rc *RunContext) common.Executo
 		}
 	}
 
+	if postExecutor == nil {
+		postExecutor = func(ctx context.Context) error {
+			return nil
+		}
+	}
+
 	postExecutor = postExecutor.Finally(func(ctx context.Context) error {
 		jobError := common.JobError(ctx)
 		if rc.Config.AutoRemove || jobError == nil {
@@ -135,6 +159,70 @@ func newJobExecutor(info jobInfo, sf stepFactory, rc *RunContext) common.Executo
 		Finally(info.closeContainer()))
 }
 
+// selectSteps returns for every step of the job whether it is part of the
+// step selection configured by --step, --skip-step, --from-step and --until-step
+func selectSteps(config *Config, steps []*model.Step) ([]bool, []string) {
+	selected := make([]bool, len(steps))
+	warnings := []string{}
+
+	from, until := 0, len(steps)-1
+	if config != nil && config.FromStep != "" {
+		if i := stepIndex(steps, config.FromStep); i >= 0 {
+			from = i
+		} else {
+			warnings = append(warnings, fmt.Sprintf("Step '%s' of --from-step not found, running from the first step", config.FromStep))
+		}
+	}
+	if config != nil && config.UntilStep != "" {
+		if i := stepIndex(steps, config.UntilStep); i >= 0 {
+			until = i
+		} else {
+			warnings = append(warnings, fmt.Sprintf("Step '%s' of --until-step not found, running until the last step", config.UntilStep))
+		}
+	}
+
+	for i, stepModel := range steps {
+		selected[i] = i >= from && i <= until
+		if config == nil {
+			continue
+		}
+		if len(config.Steps) > 0 && !slices.Contains(config.Steps, stepModel.ID) {
+			selected[i] = false
+		}
+		if slices.Contains(config.SkipSteps, stepModel.ID) {
+			selected[i] = false
+		}
+	}
+	return selected, warnings
+}
+
+func stepIndex(steps []*model.Step, id string) int {
+	for i, stepModel := range steps {
+		if stepModel.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// skipStepExecutor marks a step excluded by the step selection as skipped and
+// seeds its outputs, so that later steps can still resolve steps.<id>.outputs
+func skipStepExecutor(rc *RunContext, stepModel *model.Step) common.Executor {
+	return func(ctx context.Context) error {
+		outputs := make(map[string]string)
+		for k, v := range rc.Config.SkippedStepOutputs[stepModel.ID] {
+			outputs[k] = v
+		}
+		rc.StepResults[stepModel.ID] = &model.StepResult{
+			Outcome:    model.StepStatusSkipped,
+			Conclusion: model.StepStatusSkipped,
+			Outputs:    outputs,
+		}
+		common.Logger(ctx).WithField("stepResult", model.StepStatusSkipped).Infof("  \u23ED  Skipping step '%s' excluded by step selection", stepModel.ID)
+		return nil
+	}
+}
+
 func setJobResult(ctx context.Context, info jobInfo, rc *RunContext, success bool) {
 	logger := common.Logger(ctx)
 
@@ -340,3 +340,107 @@ func TestNewJobExecutor(t *testing.T) {
 		})
 	}
 }
+
+func TestSelectSteps(t *testing.T) {
+	steps := []*model.Step{{ID: "checkout"}, {ID: "build"}, {ID: "test"}, {ID: "deploy"}}
+
+	table := []struct {
+		name     string
+		config   *Config
+		selected []bool
+		warnings int
+	}{
+		{"all", &Config{}, []bool{true, true, true, true}, 0},
+		{"step", &Config{Steps: []string{"build", "deploy"}}, []bool{false, true, false, true}, 0},
+		{"skipStep", &Config{SkipSteps: []string{"checkout"}}, []bool{false, true, true, true}, 0},
+		{"fromStep", &Config{FromStep: "test"}, []bool{false, false, true, true}, 0},
+		{"untilStep", &Config{UntilStep: "build"}, []bool{true, true, false, false}, 0},
+		{"range", &Config{FromStep: "build", UntilStep: "test", SkipSteps: []string{"test"}}, []bool{false, true, false, false}, 0},
+		{"unknownBounds", &Config{FromStep: "missing", UntilStep: "missing"}, []bool{true, true, true, true}, 2},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, warnings := selectSteps(tt.config, steps)
+			assert.Equal(t, tt.selected, selected)
+			assert.Len(t, warnings, tt.warnings)
+		})
+	}
+}
+
+func TestNewJobExecutorStepSelection(t *testing.T) {
+	ctx := common.WithJobErrorContainer(context.Background())
+	jim := &jobInfoMock{}
+	sfm := &stepFactoryMock{}
+	rc := &RunContext{
+		JobContainer: &jobContainerMock{},
+		Run: &model.Run{
+			JobID: "test",
+			Workflow: &model.Workflow{
+				Jobs: map[string]*model.Job{
+					"test": {},
+				},
+			},
+		},
+		Config: &Config{
+			SkipSteps: []string{"1"},
+			SkippedStepOutputs: map[string]map[string]string{
+				"1": {"version": "1.0.0"},
+			},
+		},
+		StepResults:      map[string]*model.StepResult{},
+		nodeToolFullPath: "node",
+	}
+	rc.ExprEval = rc.NewExpressionEvaluator(ctx)
+	executorOrder := make([]string, 0)
+
+	steps := []*model.Step{{ID: "1"}, {ID: "2"}}
+	jim.On("steps").Return(steps)
+	jim.On("matrix").Return(map[string]interface{}{})
+	jim.On("startContainer").Return(func(ctx context.Context) error {
+		executorOrder = append(executorOrder, "startContainer")
+		return nil
+	})
+
+	sm := &stepMock{}
+	sfm.On("newStep", steps[1], rc).Return(sm, nil)
+	sm.On("pre").Return(func(ctx context.Context) error {
+		executorOrder = append(executorOrder, "pre2")
+		return nil
+	})
+	sm.On("main").Return(func(ctx context.Context) error {
+		executorOrder = append(executorOrder, "step2")
+		return nil
+	})
+	sm.On("post").Return(func(ctx context.Context) error {
+		executorOrder = append(executorOrder, "post2")
+		return nil
+	})
+
+	jim.On("interpolateOutputs").Return(func(ctx context.Context) error {
+		executorOrder = append(executorOrder, "interpolateOutputs")
+		return nil
+	})
+	jim.On("stopContainer").Return(func(ctx context.Context) error {
+		executorOrder = append(executorOrder, "stopContainer")
+		return nil
+	})
+	jim.On("result", "success")
+	jim.On("closeContainer").Return(func(ctx context.Context) error {
+		executorOrder = append(executorOrder, "closeContainer")
+		return nil
+	})
+
+	err := newJobExecutor(jim, sfm, rc)(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"startContainer", "pre2", "step2", "post2", "stopContainer", "interpolateOutputs", "closeContainer"}, executorOrder)
+	assert.Equal(t, &model.StepResult{
+		Outcome:    model.StepStatusSkipped,
+		Conclusion: model.StepStatusSkipped,
+		Outputs:    map[string]string{"version": "1.0.0"},
+	}, rc.StepResults["1"])
+
+	jim.AssertExpectations(t)
+	sfm.AssertExpectations(t)
+	sm.AssertExpectations(t)
+}
@@ -0,0 +1,194 @@
+package runner
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/nektos/act/pkg/common"
+	"github.com/nektos/act/pkg/container"
+	"github.com/nektos/act/pkg/model"
+)
+
+// NodeRuntime selects the node binary running the javascript actions of a runtime (e.g. node20).
+// Only one of Path, HostPath and Image is used, in this order, the node found on the PATH of the job container otherwise.
+type NodeRuntime struct {
+	Path     string // node binary in the job container, or in the image if Image is set
+	HostPath string // node binary on the host, copied into the tool directory of the job
+	Image    string // image whose node binary (Path, defaults to /usr/local/bin/node) is copied into the tool directory of the job
+}
+
+const defaultNodeImagePath = "/usr/local/bin/node"
+
+// ParseNodeRuntime parses {runtime}={path}, {runtime}=host:{path} and {runtime}=docker://{image}[#{path}]
+func ParseNodeRuntime(s string) (string, *NodeRuntime, error) {
+	using, value, ok := strings.Cut(s, "=")
+	if !ok || value == "" || !model.ActionRunsUsing(using).IsNode() {
+		return "", nil, fmt.Errorf("invalid node runtime %q, expected {runtime}={path}, {runtime}=host:{path} or {runtime}=docker://{image}[#{path}] with a runtime like node20", s)
+	}
+	runtime := &NodeRuntime{}
+	switch {
+	case strings.HasPrefix(value, "host:"):
+		runtime.HostPath = strings.TrimPrefix(value, "host:")
+	case strings.HasPrefix(value, "docker://"):
+		runtime.Image, runtime.Path, _ = strings.Cut(strings.TrimPrefix(value, "docker://"), "#")
+	default:
+		runtime.Path = value
+	}
+	return using, runtime, nil
+}
+
+// deprecatedNodeRuntimes are the warnings of GitHub for retired runtimes, %s is replaced by the actions using them
+var deprecatedNodeRuntimes = map[model.ActionRunsUsing]string{
+	model.ActionRunsUsingNode12: "Node.js 12 actions are deprecated. Please update the following actions to use Node.js 16: %s. For more information see: https://github.blog/changelog/2022-09-22-github-actions-all-actions-will-begin-running-on-node16-instead-of-node12/.",
+	model.ActionRunsUsingNode16: "Node.js 16 actions are deprecated. Please update the following actions to use Node.js 20: %s. For more information see: https://github.blog/changelog/2023-09-22-github-actions-transitioning-from-node-16-to-node-20/.",
+	model.ActionRunsUsingNode20: "Node.js 20 actions are deprecated. Please update the following actions to use Node.js 24: %s.",
+}
+
+func warnDeprecatedNodeRuntime(ctx context.Context, rc *RunContext, uses string, action *model.Action) {
+	format, ok := deprecatedNodeRuntimes[action.Runs.Using]
+	// the synthetic action running with: args is provided by act and not updated by the user
+	if !ok || action.Name == "(Synthetic)" {
+		return
+	}
+	message := fmt.Sprintf(format, uses)
+	common.Logger(ctx).Warnf("%s", message)
+	rc.addAnnotation("warning", nil, message)
+}
+
+// nodeRuntimePath returns the node binary for the runtime, the node of the job container if the runtime is not configured
+func (rc *RunContext) nodeRuntimePath(ctx context.Context, using model.ActionRunsUsing) (string, error) {
+	runtime, ok := rc.Config.NodeRuntimes[string(using)]
+	if !ok || runtime == nil {
+		return rc.GetNodeToolFullPath(ctx), nil
+	}
+	if nodePath, ok := rc.nodeRuntimePaths[using]; ok {
+		return nodePath, nil
+	}
+
+	_, isHostEnv := rc.JobContainer.(*container.HostEnvironment)
+	var nodePath string
+	var err error
+	switch {
+	case runtime.Image != "":
+		nodePath, err = rc.copyNodeFromImage(ctx, using, runtime)
+	case runtime.HostPath != "" && isHostEnv:
+		nodePath = runtime.HostPath
+	case runtime.HostPath != "":
+		nodePath, err = rc.copyNodeFromHost(ctx, using, runtime.HostPath)
+	default:
+		nodePath = runtime.Path
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to provide node for %s: %w", using, err)
+	}
+	common.Logger(ctx).Debugf("using %s for %s actions", nodePath, using)
+	if rc.nodeRuntimePaths == nil {
+		rc.nodeRuntimePaths = map[model.ActionRunsUsing]string{}
+	}
+	rc.nodeRuntimePaths[using] = nodePath
+	return nodePath, nil
+}
+
+// nodeRuntimeDir is the tool directory of the job the node binaries are copied to
+func (rc *RunContext) nodeRuntimeDir(using model.ActionRunsUsing) string {
+	return path.Join(rc.JobContainer.GetActPath(), "node", string(using))
+}
+
+func (rc *RunContext) copyNodeFromHost(ctx context.Context, using model.ActionRunsUsing, hostPath string) (string, error) {
+	if common.Dryrun(ctx) {
+		return path.Join(rc.nodeRuntimeDir(using), "node"), nil
+	}
+	content, err := os.ReadFile(hostPath)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "node", Mode: 0o755, Size: int64(len(content))}); err != nil {
+		return "", err
+	}
+	if _, err := tw.Write(content); err != nil {
+		return "", err
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	dir := rc.nodeRuntimeDir(using)
+	if err := rc.JobContainer.CopyTarStream(ctx, dir, buf); err != nil {
+		return "", err
+	}
+	return path.Join(dir, "node"), nil
+}
+
+// copyNodeFromImage creates a container of the image without starting it and copies its node binary into the job
+func (rc *RunContext) copyNodeFromImage(ctx context.Context, using model.ActionRunsUsing, runtime *NodeRuntime) (string, error) {
+	if common.Dryrun(ctx) {
+		return path.Join(rc.nodeRuntimeDir(using), "node"), nil
+	}
+	imagePath := runtime.Path
+	if imagePath == "" {
+		imagePath = defaultNodeImagePath
+	}
+	image := rc.Config.mirrorImage(runtime.Image)
+	err := container.NewDockerPullExecutor(container.NewDockerPullExecutorInput{
+		Image:     image,
+		ForcePull: rc.Config.ForcePull,
+		Platform:  rc.Config.ContainerArchitecture,
+		Username:  rc.Config.Secrets["DOCKER_USERNAME"],
+		Password:  rc.Config.Secrets["DOCKER_PASSWORD"],
+	}).Then(rc.verifyImage(runtime.Image))(ctx)
+	if err != nil {
+		return "", err
+	}
+	sidecar := container.NewContainer(&container.NewContainerInput{
+		Image:    image,
+		Name:     createContainerName(rc.jobContainerName(), string(using)),
+		Username: rc.Config.Secrets["DOCKER_USERNAME"],
+		Password: rc.Config.Secrets["DOCKER_PASSWORD"],
+		Platform: rc.Config.ContainerArchitecture,
+	})
+	if err := sidecar.Create(nil, nil)(ctx); err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = sidecar.Remove().Then(sidecar.Close())(ctx)
+	}()
+
+	archive, err := sidecar.GetContainerArchive(ctx, imagePath)
+	if err != nil {
+		return "", err
+	}
+	defer archive.Close()
+
+	// the archive contains the binary under its base name, it is renamed to node
+	treader := tar.NewReader(archive)
+	header, err := treader.Next()
+	if err != nil {
+		return "", err
+	}
+	if header.Typeflag == tar.TypeSymlink {
+		return "", fmt.Errorf("%s is a symlink to %s in %s, configure the path of the binary", imagePath, header.Linkname, runtime.Image)
+	}
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "node", Mode: 0o755, Size: header.Size}); err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(tw, treader); err != nil {
+		return "", err
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	dir := rc.nodeRuntimeDir(using)
+	if err := rc.JobContainer.CopyTarStream(ctx, dir, buf); err != nil {
+		return "", err
+	}
+	return path.Join(dir, "node"), nil
+}
@@ -0,0 +1,102 @@
+package runner
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nektos/act/pkg/model"
+)
+
+func TestParseNodeRuntime(t *testing.T) {
+	table := []struct {
+		value   string
+		using   string
+		runtime *NodeRuntime
+	}{
+		{"node20=/opt/node20/bin/node", "node20", &NodeRuntime{Path: "/opt/node20/bin/node"}},
+		{"node16=host:/usr/bin/node", "node16", &NodeRuntime{HostPath: "/usr/bin/node"}},
+		{"node24=docker://node:24-slim", "node24", &NodeRuntime{Image: "node:24-slim"}},
+		{"node24=docker://ghcr.io/octo/node:24#/opt/node/bin/node", "node24", &NodeRuntime{Image: "ghcr.io/octo/node:24", Path: "/opt/node/bin/node"}},
+	}
+	for _, tt := range table {
+		t.Run(tt.value, func(t *testing.T) {
+			using, runtime, err := ParseNodeRuntime(tt.value)
+			require.NoError(t, err)
+			assert.Equal(t, tt.using, using)
+			assert.Equal(t, tt.runtime, runtime)
+		})
+	}
+
+	for _, value := range []string{"node20", "node20=", "node14=/usr/bin/node", "docker=/usr/bin/node"} {
+		_, _, err := ParseNodeRuntime(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestNodeRuntimePath(t *testing.T) {
+	ctx := context.Background()
+	hostNode := filepath.Join(t.TempDir(), "node")
+	require.NoError(t, os.WriteFile(hostNode, []byte("#!/bin/sh\n"), 0o755))
+
+	cm := &containerMock{}
+	rc := &RunContext{
+		Config: &Config{
+			NodeRuntimes: map[string]*NodeRuntime{
+				"node20": {Path: "/opt/node20/bin/node"},
+				"node24": {HostPath: hostNode},
+			},
+		},
+		JobContainer:     cm,
+		nodeToolFullPath: "node",
+	}
+
+	var copied string
+	cm.On("CopyTarStream", ctx, "/var/run/act/node/node24", mock.Anything).Run(func(args mock.Arguments) {
+		tr := tar.NewReader(args.Get(2).(io.Reader))
+		header, err := tr.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "node", header.Name)
+		assert.Equal(t, int64(0o755), header.Mode)
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		copied = string(content)
+	}).Return(nil).Once()
+
+	nodePath, err := rc.nodeRuntimePath(ctx, model.ActionRunsUsingNode16)
+	assert.NoError(t, err)
+	assert.Equal(t, "node", nodePath)
+
+	nodePath, err = rc.nodeRuntimePath(ctx, model.ActionRunsUsingNode20)
+	assert.NoError(t, err)
+	assert.Equal(t, "/opt/node20/bin/node", nodePath)
+
+	// the host binary is copied only once per job
+	for i := 0; i < 2; i++ {
+		nodePath, err = rc.nodeRuntimePath(ctx, model.ActionRunsUsingNode24)
+		assert.NoError(t, err)
+		assert.Equal(t, "/var/run/act/node/node24/node", nodePath)
+	}
+	assert.Equal(t, "#!/bin/sh\n", copied)
+	cm.AssertExpectations(t)
+}
+
+func TestWarnDeprecatedNodeRuntime(t *testing.T) {
+	rc := &RunContext{}
+	ctx := context.Background()
+
+	warnDeprecatedNodeRuntime(ctx, rc, "actions/checkout@v2", &model.Action{Runs: model.ActionRuns{Using: model.ActionRunsUsingNode12}})
+	warnDeprecatedNodeRuntime(ctx, rc, "actions/checkout@v4", &model.Action{Runs: model.ActionRuns{Using: model.ActionRunsUsingNode24}})
+	warnDeprecatedNodeRuntime(ctx, rc, "./with-args", &model.Action{Name: "(Synthetic)", Runs: model.ActionRuns{Using: model.ActionRunsUsingNode12}})
+
+	require.Len(t, rc.annotations, 1)
+	assert.Equal(t, "warning", rc.annotations[0].Level)
+	assert.Contains(t, rc.annotations[0].Message, "Node.js 12 actions are deprecated. Please update the following actions to use Node.js 16: actions/checkout@v2.")
+}
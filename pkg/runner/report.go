@@ -0,0 +1,138 @@
+package runner
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/nektos/act/pkg/common"
+	"github.com/nektos/act/pkg/model"
+)
+
+// Annotation is a message reported by a step via the ::notice::, ::warning:: or ::error:: workflow commands
+type Annotation struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	Title   string `json:"title,omitempty"`
+	File    string `json:"file,omitempty"`
+	Line    string `json:"line,omitempty"`
+	StepID  string `json:"stepID,omitempty"`
+}
+
+// JobReport is the outcome of a single job run, there is one report for every matrix combination
+type JobReport struct {
+	JobID       string                       `json:"jobID"`
+	Name        string                       `json:"name"`
+	Matrix      map[string]interface{}       `json:"matrix,omitempty"`
+	Result      string                       `json:"result"`
+	Outputs     map[string]string            `json:"outputs,omitempty"`
+	Steps       map[string]*model.StepResult `json:"steps,omitempty"`
+	Annotations []Annotation                 `json:"annotations,omitempty"`
+	Summary     string                       `json:"summary,omitempty"`
+	Images      map[string]string            `json:"images,omitempty"` // registry digests of the pulled images
+}
+
+// Report collects the job reports of a plan execution
+type Report struct {
+	mu   sync.Mutex
+	jobs []*JobReport
+}
+
+// Jobs returns the reports of all finished jobs in order of completion
+func (r *Report) Jobs() []*JobReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*JobReport{}, r.jobs...)
+}
+
+// Job returns the reports of all matrix runs of the job with the given id
+func (r *Report) Job(jobID string) []*JobReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	jobs := []*JobReport{}
+	for _, job := range r.jobs {
+		if job.JobID == jobID {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+func (r *Report) addJob(rc *RunContext) {
+	if r == nil {
+		return
+	}
+	job := rc.Run.Job()
+	report := &JobReport{
+		JobID:       rc.Run.JobID,
+		Name:        rc.String(),
+		Matrix:      rc.Matrix,
+		Result:      job.Result,
+		Outputs:     map[string]string{},
+		Steps:       map[string]*model.StepResult{},
+		Annotations: rc.annotations,
+		Summary:     rc.summary,
+		Images:      rc.images,
+	}
+	for k, v := range job.Outputs {
+		report.Outputs[k] = v
+	}
+	for k, v := range rc.StepResults {
+		report.Steps[k] = v
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs = append(r.jobs, report)
+}
+
+// jobRunContext returns the RunContext of the job, composite actions record into the job they are used by
+func (rc *RunContext) jobRunContext() *RunContext {
+	for rc.Parent != nil {
+		rc = rc.Parent
+	}
+	return rc
+}
+
+func (rc *RunContext) addAnnotation(level string, kvPairs map[string]string, arg string) {
+	jrc := rc.jobRunContext()
+	jrc.annotations = append(jrc.annotations, Annotation{
+		Level:   level,
+		Message: arg,
+		Title:   kvPairs["title"],
+		File:    kvPairs["file"],
+		Line:    kvPairs["line"],
+		StepID:  rc.CurrentStep,
+	})
+}
+
+// appendStepSummary adds the content of the GITHUB_STEP_SUMMARY file of a step to the job summary
+func (rc *RunContext) appendStepSummary(ctx context.Context, summaryPath string) error {
+	if common.Dryrun(ctx) || rc.Config == nil || rc.Config.Report == nil {
+		return nil
+	}
+	summaryTar, err := rc.JobContainer.GetContainerArchive(ctx, summaryPath)
+	if err != nil {
+		return err
+	}
+	defer summaryTar.Close()
+
+	reader := tar.NewReader(summaryTar)
+	if _, err = reader.Next(); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	summary := &strings.Builder{}
+	if _, err = io.Copy(summary, reader); err != nil {
+		return err
+	}
+	if summary.Len() > 0 {
+		jrc := rc.jobRunContext()
+		jrc.summary += summary.String()
+	}
+	return nil
+}
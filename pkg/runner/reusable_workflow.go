@@ -32,14 +32,28 @@ func newRemoteReusableWorkflowExecutor(rc *RunContext) common.Executor {
 	// instead we will just use {owner}-{repo}@{ref} as our target directory. This should also improve performance when we are using
 	// multiple reusable workflows from the same repository and ref since for each workflow we won't have to clone it again
 	filename := fmt.Sprintf("%s/%s@%s", remoteReusableWorkflow.Org, remoteReusableWorkflow.Repo, remoteReusableWorkflow.Ref)
-	workflowDir := fmt.Sprintf("%s/%s", rc.ActionCacheDir(), safeFilename(filename))
 
 	if rc.Config.ActionCache != nil {
 		return newActionCacheReusableWorkflowExecutor(rc, filename, remoteReusableWorkflow)
 	}
 
+	// without an ActionCache the ref can't be checked for drift, clone the locked sha instead
+	if rc.Config.ActionLockfile != nil {
+		sha, err := rc.Config.ActionLockfile.lockedSha(remoteReusableWorkflow.Org, remoteReusableWorkflow.Repo, remoteReusableWorkflow.Ref)
+		if err != nil {
+			return common.NewErrorExecutor(err)
+		}
+		remoteReusableWorkflow.Ref = sha
+		filename = fmt.Sprintf("%s/%s@%s", remoteReusableWorkflow.Org, remoteReusableWorkflow.Repo, remoteReusableWorkflow.Ref)
+	}
+	workflowDir := fmt.Sprintf("%s/%s", rc.ActionCacheDir(), safeFilename(filename))
+
 	return common.NewPipelineExecutor(
 		newMutexExecutor(cloneIfRequired(rc, *remoteReusableWorkflow, workflowDir)),
+		func(ctx context.Context) error {
+			touchActionClone(ctx, workflowDir)
+			return nil
+		},
 		newReusableWorkflowExecutor(rc, workflowDir, fmt.Sprintf("./.github/workflows/%s", remoteReusableWorkflow.Filename)),
 	)
 }
@@ -48,7 +62,7 @@ func newActionCacheReusableWorkflowExecutor(rc *RunContext, filename string, rem
 	return func(ctx context.Context) error {
 		ghctx := rc.getGithubContext(ctx)
 		remoteReusableWorkflow.URL = ghctx.ServerURL
-		sha, err := rc.Config.ActionCache.Fetch(ctx, filename, remoteReusableWorkflow.CloneURL(), remoteReusableWorkflow.Ref, ghctx.Token)
+		sha, err := rc.fetchAction(ctx, filename, remoteReusableWorkflow.CloneURL(), remoteReusableWorkflow.Org, remoteReusableWorkflow.Repo, remoteReusableWorkflow.Ref, ghctx.Token)
 		if err != nil {
 			return err
 		}
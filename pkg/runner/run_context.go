@@ -18,6 +18,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/go-connections/nat"
@@ -25,6 +26,7 @@ import (
 	"github.com/nektos/act/pkg/container"
 	"github.com/nektos/act/pkg/exprparser"
 	"github.com/nektos/act/pkg/model"
+	"github.com/nektos/act/pkg/tokenproxy"
 	"github.com/opencontainers/selinux/go-selinux"
 )
 
@@ -55,6 +57,12 @@ type RunContext struct {
 	GHContextData       *string
 	Cancelled           bool
 	nodeToolFullPath    string
+	nodeRuntimePaths    map[model.ActionRunsUsing]string
+	annotations         []Annotation      // annotations reported by the steps of the job
+	summary             string            // job summary written by the steps to GITHUB_STEP_SUMMARY
+	images              map[string]string // digests of the images pulled by the job, keyed by the image of the workflow
+	imagesMutex         sync.Mutex
+	serviceImages       []string // images of the ServiceContainers as written in the workflow
 }
 
 func (rc *RunContext) AddMask(mask string) {
@@ -336,7 +344,7 @@ func (rc *RunContext) startJobContainer() common.Executor {
 			c := container.NewContainer(&container.NewContainerInput{
 				Name:           serviceContainerName,
 				WorkingDir:     ext.ToContainerPath(rc.Config.Workdir),
-				Image:          imageName,
+				Image:          rc.Config.mirrorImage(imageName),
 				Username:       username,
 				Password:       password,
 				Env:            envs,
@@ -354,6 +362,7 @@ func (rc *RunContext) startJobContainer() common.Executor {
 				PortBindings:   portBindings,
 			})
 			rc.ServiceContainers = append(rc.ServiceContainers, c)
+			rc.serviceImages = append(rc.serviceImages, imageName)
 		}
 
 		rc.cleanUpJobContainer = func(ctx context.Context) error {
@@ -399,7 +408,7 @@ func (rc *RunContext) startJobContainer() common.Executor {
 			Cmd:            nil,
 			Entrypoint:     []string{"tail", "-f", "/dev/null"},
 			WorkingDir:     ext.ToContainerPath(rc.Config.Workdir),
-			Image:          image,
+			Image:          rc.Config.mirrorImage(image),
 			Username:       username,
 			Password:       password,
 			Name:           name,
@@ -421,7 +430,7 @@ func (rc *RunContext) startJobContainer() common.Executor {
 
 		return common.NewPipelineExecutor(
 			rc.pullServicesImages(rc.Config.ForcePull),
-			rc.JobContainer.Pull(rc.Config.ForcePull),
+			rc.pullImage(rc.JobContainer, image, rc.Config.ForcePull),
 			rc.stopJobContainer(),
 			container.NewDockerNetworkCreateExecutor(networkName).IfBool(createAndDeleteNetwork),
 			rc.startServiceContainers(networkName),
@@ -556,8 +565,8 @@ func (rc *RunContext) stopJobContainer() common.Executor {
 func (rc *RunContext) pullServicesImages(forcePull bool) common.Executor {
 	return func(ctx context.Context) error {
 		execs := []common.Executor{}
-		for _, c := range rc.ServiceContainers {
-			execs = append(execs, c.Pull(forcePull))
+		for i, c := range rc.ServiceContainers {
+			execs = append(execs, rc.pullImage(c, rc.serviceImages[i], forcePull))
 		}
 		return common.NewParallelExecutor(len(execs), execs...)(ctx)
 	}
@@ -710,6 +719,9 @@ func (rc *RunContext) Executor() (common.Executor, error) {
 	case model.JobTypeInvalid:
 		return nil, err
 	}
+	if mock := findActionMock(rc.Config.ActionMocks, rc.Run.Job().Uses); mock != nil {
+		executor = newMockReusableWorkflowExecutor(rc, mock)
+	}
 
 	return func(ctx context.Context) error {
 		res, err := rc.isEnabled(ctx)
@@ -1068,8 +1080,12 @@ func (rc *RunContext) withGithubEnv(ctx context.Context, github *model.GithubCon
 	env["GITHUB_API_URL"] = github.APIURL
 	env["GITHUB_GRAPHQL_URL"] = github.GraphQLURL
 
-	if rc.Config.ArtifactServerPath != "" {
-		setActionRuntimeVars(rc, env)
+	if rc.Config.ArtifactServerPath != "" || rc.Config.ArtifactServerURL != "" {
+		setActionRuntimeVars(rc, github, env)
+		setIDTokenRequestVars(ctx, rc, github, env)
+	} else if env["ACTIONS_RESULTS_URL"] != "" {
+		// the cache service v2 is a results service and needs a runtime token as well
+		setActionRuntimeToken(rc, github, env)
 	}
 
 	for _, platformName := range rc.runsOnPlatformNames(ctx) {
@@ -1087,25 +1103,179 @@ func (rc *RunContext) withGithubEnv(ctx context.Context, github *model.GithubCon
 	return env
 }
 
-func setActionRuntimeVars(rc *RunContext, env map[string]string) {
+func setActionRuntimeVars(rc *RunContext, github *model.GithubContext, env map[string]string) {
 	actionsRuntimeURL := os.Getenv("ACTIONS_RUNTIME_URL")
-	if actionsRuntimeURL == "" {
+	if actionsRuntimeURL == "" && rc.Config.ArtifactServerURL != "" {
+		actionsRuntimeURL = strings.TrimSuffix(rc.Config.ArtifactServerURL, "/") + "/"
+	} else if actionsRuntimeURL == "" {
 		actionsRuntimeURL = fmt.Sprintf("http://%s:%s/", rc.Config.ArtifactServerAddr, rc.Config.ArtifactServerPort)
 	}
 	env["ACTIONS_RUNTIME_URL"] = actionsRuntimeURL
-	env["ACTIONS_RESULTS_URL"] = actionsRuntimeURL
+	// the cache server forwards the artifact service when it serves the results services
+	if env["ACTIONS_RESULTS_URL"] == "" {
+		env["ACTIONS_RESULTS_URL"] = actionsRuntimeURL
+	}
+	setActionRuntimeToken(rc, github, env)
+}
 
+func setActionRuntimeToken(rc *RunContext, github *model.GithubContext, env map[string]string) {
 	actionsRuntimeToken := os.Getenv("ACTIONS_RUNTIME_TOKEN")
 	if actionsRuntimeToken == "" {
 		runID := int64(1)
 		if rid, ok := rc.Config.Env["GITHUB_RUN_ID"]; ok {
 			runID, _ = strconv.ParseInt(rid, 10, 64)
 		}
-		actionsRuntimeToken, _ = common.CreateAuthorizationToken(runID, runID, runID)
+		run := common.RunClaims{TaskID: runID, RunID: runID, JobID: runID, Repository: github.Repository, Workflow: github.Workflow}
+		actionsRuntimeToken, _ = common.CreateRuntimeToken(common.RuntimeTokenOptions{Secret: rc.Config.ServerToken, Run: run, CacheRefs: cacheRefs(github)})
 	}
 	env["ACTIONS_RUNTIME_TOKEN"] = actionsRuntimeToken
 }
 
+// setIDTokenRequestVars points the OIDC token requests of the job, e.g. of @actions/core's getIDToken, to the issuer
+// of the artifact server, which signs the tokens with the claims of the request token
+func setIDTokenRequestVars(ctx context.Context, rc *RunContext, github *model.GithubContext, env map[string]string) {
+	// like GitHub, only the jobs granted id-token: write can request OIDC tokens
+	if env["ACTIONS_ID_TOKEN_REQUEST_URL"] != "" || !rc.permissions().Allows("id-token", model.PermissionWrite) {
+		return
+	}
+	// the route of artifacts.OIDCTokenPath, getIDToken appends the audience to the query
+	env["ACTIONS_ID_TOKEN_REQUEST_URL"] = env["ACTIONS_RUNTIME_URL"] + "_apis/oidc/token?api-version=2.0"
+	secret := rc.Config.OIDCSecret
+	if secret == "" {
+		secret = rc.Config.ServerToken
+	}
+	env["ACTIONS_ID_TOKEN_REQUEST_TOKEN"], _ = common.CreateIDTokenRequestToken(secret, rc.idTokenClaims(ctx, github))
+}
+
+// workflowPath returns the path of the workflow file in the repository
+func (rc *RunContext) workflowPath() string {
+	workflow := rc.Run.Workflow
+	if workflow.Path != "" && rc.Config.Workdir != "" {
+		if rel, err := filepath.Rel(rc.Config.Workdir, workflow.Path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return ".github/workflows/" + workflow.File
+}
+
+// idTokenClaims returns the claims of the OIDC tokens of the job, derived from the github context like GitHub does
+func (rc *RunContext) idTokenClaims(ctx context.Context, github *model.GithubContext) common.IDTokenClaims {
+	var environment string
+	if job := rc.Run.Job(); job != nil {
+		environment = job.EnvironmentName()
+		if rc.ExprEval != nil {
+			environment = rc.ExprEval.Interpolate(ctx, environment)
+		}
+	}
+	workflowRef := fmt.Sprintf("%s/%s@%s", github.Repository, rc.workflowPath(), github.Ref)
+
+	subject := "repo:" + github.Repository + ":ref:" + github.Ref
+	if environment != "" {
+		subject = "repo:" + github.Repository + ":environment:" + environment
+	} else if github.EventName == "pull_request" || github.EventName == "pull_request_target" {
+		subject = "repo:" + github.Repository + ":pull_request"
+	}
+	return common.IDTokenClaims{
+		Subject:           subject,
+		Ref:               github.Ref,
+		Sha:               github.Sha,
+		Repository:        github.Repository,
+		RepositoryOwner:   github.RepositoryOwner,
+		RunID:             github.RunID,
+		RunNumber:         github.RunNumber,
+		RunAttempt:        github.RunAttempt,
+		Actor:             github.Actor,
+		Workflow:          github.Workflow,
+		WorkflowRef:       workflowRef,
+		JobWorkflowRef:    workflowRef,
+		EventName:         github.EventName,
+		RefType:           github.RefType,
+		HeadRef:           github.HeadRef,
+		BaseRef:           github.BaseRef,
+		Environment:       environment,
+		RunnerEnvironment: "self-hosted",
+	}
+}
+
+// permissions returns the permissions of the GITHUB_TOKEN of the job, those of the job, of the workflow or the defaults.
+// The jobs of a reusable workflow inherit the permissions of the calling job, which they can only reduce.
+func (rc *RunContext) permissions() model.Permissions {
+	var permissions model.Permissions
+	if job := rc.Run.Job(); job != nil {
+		permissions = job.Permissions()
+	}
+	if permissions == nil {
+		permissions = rc.Run.Workflow.Permissions()
+	}
+	if rc.caller != nil {
+		caller := rc.caller.runContext.permissions()
+		if permissions == nil {
+			return caller
+		}
+		return permissions.Intersect(caller)
+	}
+	if permissions == nil {
+		permissions = rc.Config.DefaultPermissions
+	}
+	if permissions == nil {
+		permissions, _ = model.DefaultPermissions("permissive")
+	}
+	return permissions
+}
+
+// scopeGithubToken replaces the real GITHUB_TOKEN of the github context and the secrets of an evaluation environment
+// with the token of the job scoped to its permissions, which the token proxy forwards within them. Only the proxy
+// accepts the scoped token, so the steps can't use it for git or docker registries like ghcr.io.
+func (rc *RunContext) scopeGithubToken(ee *exprparser.EvaluationEnvironment) {
+	if rc.Config.TokenProxySecret == "" || ee.Github == nil {
+		return
+	}
+	token, _ := tokenproxy.CreateToken(rc.Config.TokenProxySecret, tokenproxy.Claims{
+		Repository:  ee.Github.Repository,
+		Job:         rc.String(),
+		Permissions: rc.permissions(),
+	})
+
+	github := *ee.Github
+	github.Token = token
+	ee.Github = &github
+	secrets := make(map[string]string, len(ee.Secrets)+1)
+	for k, v := range ee.Secrets {
+		secrets[k] = v
+	}
+	// the GITHUB_TOKEN passed to a reusable workflow may be another token
+	if v, ok := secrets["GITHUB_TOKEN"]; !ok || v == rc.Config.Token {
+		secrets["GITHUB_TOKEN"] = token
+	}
+	ee.Secrets = secrets
+}
+
+// cacheRefs returns the refs a job may restore caches from in the order GitHub searches them: the ref of the run,
+// the base branch of a pull request and the default branch. Caches are created for the ref of the run only,
+// so branches never see the caches of other feature branches.
+func cacheRefs(github *model.GithubContext) []string {
+	refs := []string{}
+	add := func(ref string) {
+		if ref == "" || ref == "refs/heads/" {
+			return
+		}
+		for _, r := range refs {
+			if r == ref {
+				return
+			}
+		}
+		refs = append(refs, ref)
+	}
+	add(github.Ref)
+	if github.BaseRef != "" {
+		add("refs/heads/" + strings.TrimPrefix(github.BaseRef, "refs/heads/"))
+	}
+	if defaultBranch, ok := nestedMapLookup(github.Event, "repository", "default_branch").(string); ok {
+		add("refs/heads/" + defaultBranch)
+	}
+	return refs
+}
+
 func (rc *RunContext) handleCredentials(ctx context.Context) (string, string, error) {
 	// TODO: remove below 2 lines when we can release act with breaking changes
 	username := rc.Config.Secrets["DOCKER_USERNAME"]
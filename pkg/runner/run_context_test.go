@@ -3,7 +3,9 @@ package runner
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"sort"
@@ -11,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/nektos/act/pkg/common"
 	"github.com/nektos/act/pkg/exprparser"
 	"github.com/nektos/act/pkg/model"
 
@@ -693,7 +696,7 @@ func TestSetRuntimeVariables(t *testing.T) {
 	}
 	v := "http://myhost:8000/"
 	env := map[string]string{}
-	setActionRuntimeVars(rc, env)
+	setActionRuntimeVars(rc, &model.GithubContext{}, env)
 
 	assert.Equal(t, v, env["ACTIONS_RESULTS_URL"])
 	assert.Equal(t, v, env["ACTIONS_RUNTIME_URL"])
@@ -717,7 +720,7 @@ func TestSetRuntimeVariablesWithRunID(t *testing.T) {
 	}
 	v := "http://myhost:8000/"
 	env := map[string]string{}
-	setActionRuntimeVars(rc, env)
+	setActionRuntimeVars(rc, &model.GithubContext{}, env)
 
 	assert.Equal(t, v, env["ACTIONS_RESULTS_URL"])
 	assert.Equal(t, v, env["ACTIONS_RUNTIME_URL"])
@@ -732,3 +735,218 @@ func TestSetRuntimeVariablesWithRunID(t *testing.T) {
 	assert.True(t, ok, "scp claim exists")
 	assert.Equal(t, "Actions.Results:45:45", scp, "contains expected scp claim")
 }
+
+func TestSetRuntimeVariablesWithServerURL(t *testing.T) {
+	rc := &RunContext{
+		Config: &Config{
+			ArtifactServerURL: "https://act.example.com",
+			ServerToken:       "s3cret",
+		},
+	}
+	env := map[string]string{}
+	setActionRuntimeVars(rc, &model.GithubContext{}, env)
+
+	assert.Equal(t, "https://act.example.com/", env["ACTIONS_RUNTIME_URL"])
+	assert.Equal(t, "https://act.example.com/", env["ACTIONS_RESULTS_URL"])
+
+	// the shared servers only accept the runtime tokens signed with their secret
+	req := &http.Request{Header: http.Header{"Authorization": []string{"Bearer " + env["ACTIONS_RUNTIME_TOKEN"]}}}
+	_, err := common.ParseSignedCacheScope(req, "s3cret")
+	assert.NoError(t, err)
+	_, err = common.ParseCacheScope(req)
+	assert.Error(t, err)
+}
+
+func TestSetIDTokenRequestVars(t *testing.T) {
+	workflow, err := model.ReadWorkflow(strings.NewReader(`
+name: deploy
+on: push
+jobs:
+  deploy:
+    runs-on: ubuntu-latest
+    environment:
+      name: production
+    steps:
+      - run: echo
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo
+`))
+	assert.NoError(t, err)
+	workflow.File = "deploy.yml"
+	github := &model.GithubContext{
+		Repository:      "octo/repo",
+		RepositoryOwner: "octo",
+		Ref:             "refs/heads/main",
+		Sha:             "abc",
+		EventName:       "push",
+		Workflow:        "deploy",
+		RunID:           "45",
+	}
+
+	idToken := model.Permissions{"id-token": model.PermissionWrite}
+	for _, c := range []struct {
+		job     string
+		subject string
+	}{
+		{job: "deploy", subject: "repo:octo/repo:environment:production"},
+		{job: "build", subject: "repo:octo/repo:ref:refs/heads/main"},
+	} {
+		rc := &RunContext{
+			Config: &Config{ArtifactServerURL: "https://act.example.com", ServerToken: "s3cret", DefaultPermissions: idToken},
+			Run:    &model.Run{JobID: c.job, Workflow: workflow},
+		}
+		env := map[string]string{}
+		setActionRuntimeVars(rc, github, env)
+		setIDTokenRequestVars(context.Background(), rc, github, env)
+		assert.Equal(t, "https://act.example.com/_apis/oidc/token?api-version=2.0", env["ACTIONS_ID_TOKEN_REQUEST_URL"])
+
+		req := &http.Request{Header: http.Header{"Authorization": []string{"Bearer " + env["ACTIONS_ID_TOKEN_REQUEST_TOKEN"]}}}
+		claims, err := common.ParseIDTokenRequest(req, "s3cret")
+		assert.NoError(t, err)
+		assert.Equal(t, c.subject, claims.Subject)
+		assert.Equal(t, "octo/repo/.github/workflows/deploy.yml@refs/heads/main", claims.JobWorkflowRef)
+		assert.Equal(t, "45", claims.RunID)
+		assert.Equal(t, "self-hosted", claims.RunnerEnvironment)
+		_, err = common.ParseIDTokenRequest(req, "")
+		assert.Error(t, err)
+	}
+
+	// the secret of the run takes precedence over the secret of the servers
+	rc := &RunContext{
+		Config: &Config{ArtifactServerURL: "https://act.example.com", ServerToken: "s3cret", OIDCSecret: "run", DefaultPermissions: idToken},
+		Run:    &model.Run{JobID: "build", Workflow: workflow},
+	}
+	env := map[string]string{}
+	setActionRuntimeVars(rc, github, env)
+	setIDTokenRequestVars(context.Background(), rc, github, env)
+	req := &http.Request{Header: http.Header{"Authorization": []string{"Bearer " + env["ACTIONS_ID_TOKEN_REQUEST_TOKEN"]}}}
+	_, err = common.ParseIDTokenRequest(req, "run")
+	assert.NoError(t, err)
+
+	// only the jobs granted id-token: write can request OIDC tokens, the permissive default does not grant it
+	rc = &RunContext{
+		Config: &Config{ArtifactServerURL: "https://act.example.com"},
+		Run:    &model.Run{JobID: "build", Workflow: workflow},
+	}
+	env = map[string]string{}
+	setActionRuntimeVars(rc, github, env)
+	setIDTokenRequestVars(context.Background(), rc, github, env)
+	assert.Empty(t, env["ACTIONS_ID_TOKEN_REQUEST_TOKEN"])
+
+	rc = &RunContext{
+		Config: &Config{ArtifactServerURL: "https://act.example.com", DefaultPermissions: model.Permissions{"contents": model.PermissionRead}},
+		Run:    &model.Run{JobID: "build", Workflow: workflow},
+	}
+	env = map[string]string{}
+	setActionRuntimeVars(rc, github, env)
+	setIDTokenRequestVars(context.Background(), rc, github, env)
+	assert.Empty(t, env["ACTIONS_ID_TOKEN_REQUEST_URL"])
+	assert.Empty(t, env["ACTIONS_ID_TOKEN_REQUEST_TOKEN"])
+
+	// the workflow refs have the path of the workflow file in the repository
+	workflow.Path = filepath.Join("/repo", ".github", "workflows", "deploy", "prod.yml")
+	rc = &RunContext{Config: &Config{Workdir: "/repo"}, Run: &model.Run{JobID: "build", Workflow: workflow}}
+	claims := rc.idTokenClaims(context.Background(), github)
+	assert.Equal(t, "octo/repo/.github/workflows/deploy/prod.yml@refs/heads/main", claims.WorkflowRef)
+	assert.Equal(t, "octo/repo/.github/workflows/deploy/prod.yml@refs/heads/main", claims.JobWorkflowRef)
+	rc.Config.Workdir = "/other"
+	claims = rc.idTokenClaims(context.Background(), github)
+	assert.Equal(t, "octo/repo/.github/workflows/deploy.yml@refs/heads/main", claims.WorkflowRef)
+
+	// the pull requests have their own subject
+	rc = &RunContext{Config: &Config{}, Run: &model.Run{JobID: "build", Workflow: workflow}}
+	claims = rc.idTokenClaims(context.Background(), &model.GithubContext{Repository: "octo/repo", EventName: "pull_request"})
+	assert.Equal(t, "repo:octo/repo:pull_request", claims.Subject)
+}
+
+func TestPermissions(t *testing.T) {
+	workflow, err := model.ReadWorkflow(strings.NewReader(`
+name: permissions
+on: push
+permissions:
+  contents: read
+  issues: write
+jobs:
+  inherit:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo
+  own:
+    runs-on: ubuntu-latest
+    permissions:
+      pull-requests: write
+    steps:
+      - run: echo
+`))
+	assert.NoError(t, err)
+	noPermissions, err := model.ReadWorkflow(strings.NewReader(`
+name: defaults
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo
+`))
+	assert.NoError(t, err)
+	permissive, err := model.DefaultPermissions("permissive")
+	assert.NoError(t, err)
+	restricted, err := model.DefaultPermissions("restricted")
+	assert.NoError(t, err)
+
+	newRunContext := func(workflow *model.Workflow, jobID string, config *Config) *RunContext {
+		return &RunContext{Config: config, Run: &model.Run{JobID: jobID, Workflow: workflow}}
+	}
+	assert.Equal(t, model.Permissions{"contents": "read", "issues": "write"}, newRunContext(workflow, "inherit", &Config{}).permissions())
+	assert.Equal(t, model.Permissions{"pull-requests": "write"}, newRunContext(workflow, "own", &Config{}).permissions())
+	assert.Equal(t, permissive, newRunContext(noPermissions, "build", &Config{}).permissions())
+	assert.Equal(t, restricted, newRunContext(noPermissions, "build", &Config{DefaultPermissions: restricted}).permissions())
+
+	// the jobs of a reusable workflow can only reduce the permissions of the calling job
+	called := newRunContext(noPermissions, "build", &Config{})
+	called.caller = &caller{runContext: newRunContext(workflow, "inherit", &Config{})}
+	assert.Equal(t, model.Permissions{"contents": "read", "issues": "write"}, called.permissions())
+	called = newRunContext(workflow, "own", &Config{})
+	called.caller = &caller{runContext: newRunContext(workflow, "inherit", &Config{})}
+	assert.Equal(t, model.Permissions{}, called.permissions())
+
+	// the jobs see a GITHUB_TOKEN scoped to their permissions with the token proxy
+	rc := newRunContext(workflow, "own", &Config{Token: "real", TokenProxySecret: "s3cret"})
+	ee := &exprparser.EvaluationEnvironment{
+		Github:  &model.GithubContext{Repository: "octo/repo", Token: "real"},
+		Secrets: map[string]string{"GITHUB_TOKEN": "real", "OTHER": "other"},
+	}
+	rc.scopeGithubToken(ee)
+	assert.NotEqual(t, "real", ee.Github.Token)
+	assert.Equal(t, ee.Github.Token, ee.Secrets["GITHUB_TOKEN"])
+	assert.Equal(t, "other", ee.Secrets["OTHER"])
+
+	rc = newRunContext(workflow, "own", &Config{Token: "real"})
+	ee = &exprparser.EvaluationEnvironment{Github: &model.GithubContext{Token: "real"}, Secrets: map[string]string{"GITHUB_TOKEN": "real"}}
+	rc.scopeGithubToken(ee)
+	assert.Equal(t, "real", ee.Github.Token)
+	assert.Equal(t, "real", ee.Secrets["GITHUB_TOKEN"])
+}
+
+func TestCacheRefs(t *testing.T) {
+	event := map[string]interface{}{"repository": map[string]interface{}{"default_branch": "main"}}
+	assert.Equal(t, []string{"refs/heads/feature", "refs/heads/main"}, cacheRefs(&model.GithubContext{Ref: "refs/heads/feature", Event: event}))
+	assert.Equal(t, []string{"refs/heads/main"}, cacheRefs(&model.GithubContext{Ref: "refs/heads/main", Event: event}))
+	assert.Equal(t, []string{"refs/pull/7/merge", "refs/heads/release", "refs/heads/main"}, cacheRefs(&model.GithubContext{Ref: "refs/pull/7/merge", BaseRef: "release", Event: event}))
+	assert.Empty(t, cacheRefs(&model.GithubContext{}))
+
+	// the runtime token carries the refs as cache scopes
+	rc := &RunContext{Config: &Config{}}
+	env := map[string]string{}
+	setActionRuntimeToken(rc, &model.GithubContext{Ref: "refs/heads/feature", Repository: "octo/repo", Event: event}, env)
+	req := &http.Request{Header: http.Header{"Authorization": []string{"Bearer " + env["ACTIONS_RUNTIME_TOKEN"]}}}
+	scope, err := common.ParseCacheScope(req)
+	assert.NoError(t, err)
+	assert.Equal(t, &common.CacheScope{
+		Repository: "octo/repo",
+		Refs:       []string{"refs/heads/feature", "refs/heads/main"},
+		WriteRef:   "refs/heads/feature",
+	}, scope)
+}
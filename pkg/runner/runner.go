@@ -22,50 +22,68 @@ type Runner interface {
 
 // Config contains the config for a new runner
 type Config struct {
-	Actor                              string                     // the user that triggered the event
-	Workdir                            string                     // path to working directory
-	BindWorkdir                        bool                       // bind the workdir to the job container
-	ActionCacheDir                     string                     // path used for caching action contents
-	ActionOfflineMode                  bool                       // when offline, use caching action contents
-	EventName                          string                     // name of event to run
-	EventPath                          string                     // path to JSON file to use for event.json in containers
-	DefaultBranch                      string                     // name of the main branch for this repository
-	ReuseContainers                    bool                       // reuse containers to maintain state
-	ForcePull                          bool                       // force pulling of the image, even if already present
-	ForceRebuild                       bool                       // force rebuilding local docker image action
-	LogOutput                          bool                       // log the output from docker run
-	JSONLogger                         bool                       // use json or text logger
-	LogPrefixJobID                     bool                       // switches from the full job name to the job id
-	Env                                map[string]string          // env for containers
-	Inputs                             map[string]string          // manually passed action inputs
-	Secrets                            map[string]string          // list of secrets
-	Vars                               map[string]string          // list of vars
-	Token                              string                     // GitHub token
-	InsecureSecrets                    bool                       // switch hiding output when printing to terminal
-	Platforms                          map[string]string          // list of platforms
-	Privileged                         bool                       // use privileged mode
-	UsernsMode                         string                     // user namespace to use
-	ContainerArchitecture              string                     // Desired OS/architecture platform for running containers
-	ContainerDaemonSocket              string                     // Path to Docker daemon socket
-	ContainerOptions                   string                     // Options for the job container
-	UseGitIgnore                       bool                       // controls if paths in .gitignore should not be copied into container, default true
-	GitHubInstance                     string                     // GitHub instance to use, default "github.com"
-	GitHubServerUrl                    string                     // GitHub server url to use
-	GitHubApiServerUrl                 string                     // GitHub api server url to use
-	GitHubGraphQlApiServerUrl          string                     // GitHub graphql server url to use
-	ContainerCapAdd                    []string                   // list of kernel capabilities to add to the containers
-	ContainerCapDrop                   []string                   // list of kernel capabilities to remove from the containers
-	AutoRemove                         bool                       // controls if the container is automatically removed upon workflow completion
-	ArtifactServerPath                 string                     // the path where the artifact server stores uploads
-	ArtifactServerAddr                 string                     // the address the artifact server binds to
-	ArtifactServerPort                 string                     // the port the artifact server binds to
-	NoSkipCheckout                     bool                       // do not skip actions/checkout
-	RemoteName                         string                     // remote name in local git repo config
-	ReplaceGheActionWithGithubCom      []string                   // Use actions from GitHub Enterprise instance to GitHub
-	ReplaceGheActionTokenWithGithubCom string                     // Token of private action repo on GitHub.
-	Matrix                             map[string]map[string]bool // Matrix config to run
+	Actor                              string                       // the user that triggered the event
+	Workdir                            string                       // path to working directory
+	BindWorkdir                        bool                         // bind the workdir to the job container
+	ActionCacheDir                     string                       // path used for caching action contents
+	ActionOfflineMode                  bool                         // when offline, use caching action contents
+	EventName                          string                       // name of event to run
+	EventPath                          string                       // path to JSON file to use for event.json in containers
+	DefaultBranch                      string                       // name of the main branch for this repository
+	ReuseContainers                    bool                         // reuse containers to maintain state
+	ForcePull                          bool                         // force pulling of the image, even if already present
+	ForceRebuild                       bool                         // force rebuilding local docker image action
+	LogOutput                          bool                         // log the output from docker run
+	JSONLogger                         bool                         // use json or text logger
+	LogPrefixJobID                     bool                         // switches from the full job name to the job id
+	Env                                map[string]string            // env for containers
+	Inputs                             map[string]string            // manually passed action inputs
+	Secrets                            map[string]string            // list of secrets
+	Vars                               map[string]string            // list of vars
+	Token                              string                       // GitHub token
+	InsecureSecrets                    bool                         // switch hiding output when printing to terminal
+	Platforms                          map[string]string            // list of platforms
+	Privileged                         bool                         // use privileged mode
+	UsernsMode                         string                       // user namespace to use
+	ContainerArchitecture              string                       // Desired OS/architecture platform for running containers
+	ContainerDaemonSocket              string                       // Path to Docker daemon socket
+	ContainerOptions                   string                       // Options for the job container
+	UseGitIgnore                       bool                         // controls if paths in .gitignore should not be copied into container, default true
+	GitHubInstance                     string                       // GitHub instance to use, default "github.com"
+	GitHubServerUrl                    string                       // GitHub server url to use
+	GitHubApiServerUrl                 string                       // GitHub api server url to use
+	GitHubGraphQlApiServerUrl          string                       // GitHub graphql server url to use
+	ContainerCapAdd                    []string                     // list of kernel capabilities to add to the containers
+	ContainerCapDrop                   []string                     // list of kernel capabilities to remove from the containers
+	AutoRemove                         bool                         // controls if the container is automatically removed upon workflow completion
+	ArtifactServerPath                 string                       // the path where the artifact server stores uploads
+	ArtifactServerAddr                 string                       // the address the artifact server binds to
+	ArtifactServerPort                 string                       // the port the artifact server binds to
+	ArtifactServerURL                  string                       // the url of a running artifact server, e.g. `act serve-artifacts`, used instead of the address and the port
+	ServerToken                        string                       // the secret of shared cache and artifact servers, signs the runtime tokens
+	OIDCSecret                         string                       // signs the OIDC request tokens of the jobs for the OIDC issuer of the artifact server, ServerToken if empty
+	TokenProxySecret                   string                       // the jobs get a GITHUB_TOKEN scoped to their permissions, signed with it for the token proxy of GITHUB_API_URL, if set
+	DefaultPermissions                 model.Permissions            // permissions of the GITHUB_TOKEN of the jobs of workflows without permissions, permissive if nil
+	NoSkipCheckout                     bool                         // do not skip actions/checkout
+	RemoteName                         string                       // remote name in local git repo config
+	ReplaceGheActionWithGithubCom      []string                     // Use actions from GitHub Enterprise instance to GitHub
+	ReplaceGheActionTokenWithGithubCom string                       // Token of private action repo on GitHub.
+	Matrix                             map[string]map[string]bool   // Matrix config to run
+	Steps                              []string                     // run only the steps with these ids
+	SkipSteps                          []string                     // skip the steps with these ids
+	FromStep                           string                       // skip all steps before the step with this id
+	UntilStep                          string                       // skip all steps after the step with this id
+	SkippedStepOutputs                 map[string]map[string]string // outputs of steps excluded by the step selection
+	ActionMocks                        map[string]*ActionMock       // stubs used instead of actions, docker images and reusable workflows by uses: pattern
+	Report                             *Report                      // collects results, outputs, annotations and summaries of all jobs if set
 	ContainerNetworkMode               docker_container.NetworkMode // the network mode of job containers (the value of --network)
 	ActionCache                        ActionCache                  // Use a custom ActionCache Implementation
+	ActionLockfile                     *Lockfile                    // pins remote actions and reusable workflows to the locked SHAs and fails on drift
+	ActionPolicy                       *ActionPolicy                // restricts the actions, reusable workflows and docker images workflows may use
+	NodeRuntimes                       map[string]*NodeRuntime      // node binaries of the runtimes of javascript actions, keyed by runs.using (e.g. node20)
+	RegistryMirrors                    map[string]string            // mirrors of registries or repository prefixes (e.g. docker.io=mirror.example.com/dockerhub) used to pull images
+	DockerBuildTargets                 map[string]string            // build stages of the Dockerfiles of docker actions by uses: pattern, "" applies to every action
+	DockerBuildSecrets                 map[string]string            // BuildKit secrets of docker action builds, the id maps to the name of the secret
 	DownloadAction                     func(git.NewGitCloneExecutorInput) common.Executor
 	HostEnvironmentDir                 string
 }
@@ -150,6 +168,13 @@ func (runner *runnerImpl) NewPlanExecutor(plan *model.Plan) common.Executor {
 	stagePipeline := make([]common.Executor, 0)
 	log.Debugf("Plan Stages: %v", plan.Stages)
 
+	// the policy is checked once for the whole plan, before any job starts
+	if runner.config.ActionPolicy != nil && runner.caller == nil {
+		stagePipeline = append(stagePipeline, func(ctx context.Context) error {
+			return checkActionPolicy(ctx, runner.config, plan)
+		})
+	}
+
 	for i := range plan.Stages {
 		stage := plan.Stages[i]
 		stagePipeline = append(stagePipeline, func(ctx context.Context) error {
@@ -230,7 +255,9 @@ func (runner *runnerImpl) NewPlanExecutor(plan *model.Plan) common.Executor {
 							return err
 						}
 
-						return executor(common.WithJobErrorContainer(WithJobLogger(ctx, rc.Run.JobID, jobName, rc.Config, &rc.Masks, matrix)))
+						err = executor(common.WithJobErrorContainer(WithJobLogger(ctx, rc.Run.JobID, jobName, rc.Config, &rc.Masks, matrix)))
+						rc.Config.Report.addJob(rc)
+						return err
 					})
 				}
 				pipeline = append(pipeline, common.NewParallelExecutor(maxParallel, stageExecutor...))
@@ -203,6 +203,10 @@ func runStepExecutor(step step, stage stepStage, executor common.Executor) commo
 		if err != nil {
 			return err
 		}
+		err = rc.appendStepSummary(ctx, path.Join(actPath, summaryFileCommand))
+		if err != nil {
+			return err
+		}
 		if orgerr != nil {
 			return orgerr
 		}
@@ -36,12 +36,25 @@ func (sal *stepActionLocal) pre() common.Executor {
 
 func (sal *stepActionLocal) main() common.Executor {
 	return runStepExecutor(sal, stepStageMain, func(ctx context.Context) error {
+		actionDir := filepath.Join(sal.getRunContext().Config.Workdir, sal.Step.Uses)
+
 		if common.Dryrun(ctx) {
-			return nil
+			// the job container is not available, the action is read from the workdir to check the inputs
+			hostReader := func(filename string) (io.Reader, io.Closer, error) {
+				f, err := os.Open(filepath.Join(actionDir, filename))
+				return f, f, err
+			}
+			actionModel, err := sal.readAction(ctx, sal.Step, actionDir, "", hostReader, discardFile)
+			if errors.Is(err, fs.ErrNotExist) {
+				// e.g. the action is created by an earlier step
+				common.Logger(ctx).Infof("Skipping the input check of local action %s, it is not in the workdir", sal.Step.Uses)
+				return nil
+			} else if err != nil {
+				return err
+			}
+			return checkActionInputs(ctx, sal, actionModel)
 		}
 
-		actionDir := filepath.Join(sal.getRunContext().Config.Workdir, sal.Step.Uses)
-
 		localReader := func(ctx context.Context) actionYamlReader {
 			_, cpath := getContainerActionPaths(sal.Step, path.Join(actionDir, ""), sal.RunContext)
 			return func(filename string) (io.Reader, io.Closer, error) {
@@ -101,6 +101,48 @@ func TestStepActionLocalTest(t *testing.T) {
 	salm.AssertExpectations(t)
 }
 
+func TestStepActionLocalDryrunMissingAction(t *testing.T) {
+	ctx := common.WithDryrun(context.Background(), true)
+
+	cm := &containerMock{}
+
+	sal := &stepActionLocal{
+		readAction: readActionImpl,
+		RunContext: &RunContext{
+			StepResults: map[string]*model.StepResult{},
+			ExprEval:    &expressionEvaluator{},
+			Config: &Config{
+				Workdir: t.TempDir(),
+			},
+			Run: &model.Run{
+				JobID: "1",
+				Workflow: &model.Workflow{
+					Jobs: map[string]*model.Job{
+						"1": {},
+					},
+				},
+			},
+			JobContainer: cm,
+		},
+		Step: &model.Step{
+			ID:   "1",
+			Uses: "./created/by/an/earlier/step",
+		},
+	}
+
+	cm.On("Copy", "/var/run/act", mock.AnythingOfType("[]*container.FileEntry")).Return(func(ctx context.Context) error {
+		return nil
+	})
+	cm.On("UpdateFromEnv", mock.Anything, mock.AnythingOfType("*map[string]string")).Return(func(ctx context.Context) error {
+		return nil
+	})
+	cm.On("GetContainerArchive", ctx, "/var/run/act/workflow/pathcmd.txt").Return(io.NopCloser(&bytes.Buffer{}), nil)
+
+	// the action may be created by an earlier step, which doesn't run in a dryrun
+	assert.NoError(t, sal.pre()(ctx))
+	assert.NoError(t, sal.main()(ctx))
+}
+
 func TestStepActionLocalPost(t *testing.T) {
 	table := []struct {
 		name               string
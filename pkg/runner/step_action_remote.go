@@ -1,7 +1,6 @@
 package runner
 
 import (
-	"archive/tar"
 	"context"
 	"errors"
 	"fmt"
@@ -70,38 +69,12 @@ func (sar *stepActionRemote) prepareActionExecutor() common.Executor {
 			sar.cacheDir = fmt.Sprintf("%s/%s", sar.remoteAction.Org, sar.remoteAction.Repo)
 			repoURL := sar.remoteAction.URL + "/" + sar.cacheDir
 			repoRef := sar.remoteAction.Ref
-			sar.resolvedSha, err = cache.Fetch(ctx, sar.cacheDir, repoURL, repoRef, github.Token)
+			sar.resolvedSha, err = sar.RunContext.fetchAction(ctx, sar.cacheDir, repoURL, sar.remoteAction.Org, sar.remoteAction.Repo, repoRef, github.Token)
 			if err != nil {
 				return fmt.Errorf("failed to fetch \"%s\" version \"%s\": %w", repoURL, repoRef, err)
 			}
 
-			remoteReader := func(ctx context.Context) actionYamlReader {
-				return func(filename string) (io.Reader, io.Closer, error) {
-					spath := path.Join(sar.remoteAction.Path, filename)
-					for i := 0; i < maxSymlinkDepth; i++ {
-						tars, err := cache.GetTarArchive(ctx, sar.cacheDir, sar.resolvedSha, spath)
-						if err != nil {
-							return nil, nil, os.ErrNotExist
-						}
-						treader := tar.NewReader(tars)
-						header, err := treader.Next()
-						if err != nil {
-							return nil, nil, os.ErrNotExist
-						}
-						if header.FileInfo().Mode()&os.ModeSymlink == os.ModeSymlink {
-							spath, err = symlinkJoin(spath, header.Linkname, ".")
-							if err != nil {
-								return nil, nil, err
-							}
-						} else {
-							return treader, tars, nil
-						}
-					}
-					return nil, nil, fmt.Errorf("max depth %d of symlinks exceeded while reading %s", maxSymlinkDepth, spath)
-				}
-			}
-
-			actionModel, err := sar.readAction(ctx, sar.Step, sar.resolvedSha, sar.remoteAction.Path, remoteReader(ctx), os.WriteFile)
+			actionModel, err := sar.readAction(ctx, sar.Step, sar.resolvedSha, sar.remoteAction.Path, newActionCacheReader(ctx, cache, sar.cacheDir, sar.resolvedSha, sar.remoteAction.Path), os.WriteFile)
 			sar.action = actionModel
 			return err
 		}
@@ -111,9 +84,16 @@ func (sar *stepActionRemote) prepareActionExecutor() common.Executor {
 		if sar.RunContext.Config.DownloadAction != nil {
 			cloneExecutor = sar.RunContext.Config.DownloadAction
 		}
+		ref := sar.remoteAction.Ref
+		if lockfile := sar.RunContext.Config.ActionLockfile; lockfile != nil {
+			var err error
+			if ref, err = lockfile.lockedSha(sar.remoteAction.Org, sar.remoteAction.Repo, ref); err != nil {
+				return err
+			}
+		}
 		gitClone := cloneExecutor(git.NewGitCloneExecutorInput{
 			URL:   sar.remoteAction.CloneURL(),
-			Ref:   sar.remoteAction.Ref,
+			Ref:   ref,
 			Dir:   actionDir,
 			Token: github.Token,
 			OfflineMode: sar.RunContext.Config.ActionOfflineMode,
@@ -129,6 +109,7 @@ func (sar *stepActionRemote) prepareActionExecutor() common.Executor {
 				return err
 			}
 		}
+		touchActionClone(ctx, actionDir)
 
 		remoteReader := func(ctx context.Context) actionYamlReader {
 			return func(filename string) (io.Reader, io.Closer, error) {
@@ -72,10 +72,10 @@ func (sd *stepDocker) runUsesContainer() common.Executor {
 			entrypoint = []string{entry}
 		}
 
-		stepContainer := sd.newStepContainer(ctx, image, cmd, entrypoint)
+		stepContainer := sd.newStepContainer(ctx, rc.Config.mirrorImage(image), cmd, entrypoint)
 
 		return common.NewPipelineExecutor(
-			stepContainer.Pull(rc.Config.ForcePull),
+			rc.pullImage(stepContainer, image, rc.Config.ForcePull),
 			stepContainer.Remove().IfBool(!rc.Config.ReuseContainers),
 			stepContainer.Create(rc.Config.ContainerCapAdd, rc.Config.ContainerCapDrop),
 			stepContainer.Start(true),
@@ -13,6 +13,16 @@ type stepFactory interface {
 type stepFactoryImpl struct{}
 
 func (sf *stepFactoryImpl) newStep(stepModel *model.Step, rc *RunContext) (step, error) {
+	if rc.Config != nil {
+		if mock := findActionMock(rc.Config.ActionMocks, stepModel.Uses); mock != nil {
+			return &stepActionMock{
+				Step:       stepModel,
+				RunContext: rc,
+				mock:       mock,
+			}, nil
+		}
+	}
+
 	switch stepModel.Type() {
 	case model.StepTypeInvalid:
 		return nil, fmt.Errorf("Invalid run/uses syntax for job:%s step:%+v", rc.Run, stepModel)
@@ -67,6 +67,29 @@ func TestStepFactoryNewStep(t *testing.T) {
 	}
 }
 
+func TestStepFactoryMockedStep(t *testing.T) {
+	rc := &RunContext{
+		Config: &Config{
+			ActionMocks: map[string]*ActionMock{
+				"remote/*":     {},
+				"docker://*":   {},
+				"./local@main": {},
+			},
+		},
+	}
+	sf := &stepFactoryImpl{}
+
+	for _, uses := range []string{"remote/action@v1", "docker://image:tag", "./local@main"} {
+		step, err := sf.newStep(&model.Step{Uses: uses}, rc)
+		assert.Nil(t, err)
+		assert.IsType(t, &stepActionMock{}, step, uses)
+	}
+
+	step, err := sf.newStep(&model.Step{Uses: "./local@v1"}, rc)
+	assert.Nil(t, err)
+	assert.IsType(t, &stepActionLocal{}, step)
+}
+
 func TestStepFactoryInvalidStep(t *testing.T) {
 	model := &model.Step{
 		Uses: "remote/action@v1",
@@ -31,7 +31,12 @@ func (sr *stepRun) pre() common.Executor {
 
 func (sr *stepRun) main() common.Executor {
 	sr.env = map[string]string{}
-	return runStepExecutor(sr, stepStageMain, common.NewPipelineExecutor(
+	return runStepExecutor(sr, stepStageMain, sr.runExecutor())
+}
+
+// runExecutor writes the script of the step and executes it with the env of the step
+func (sr *stepRun) runExecutor() common.Executor {
+	return common.NewPipelineExecutor(
 		sr.setupShellCommandExecutor(),
 		func(ctx context.Context) error {
 			sr.getRunContext().ApplyExtraPath(ctx, &sr.env)
@@ -40,7 +45,7 @@ func (sr *stepRun) main() common.Executor {
 			}
 			return sr.getRunContext().JobContainer.Exec(sr.cmd, sr.env, "", sr.WorkingDirectory)(ctx)
 		},
-	))
+	)
 }
 
 func (sr *stepRun) post() common.Executor {
@@ -0,0 +1,42 @@
+package secretprovider
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// The files are encrypted with age, https://age-encryption.org/v1, to X25519 recipients like those of `age-keygen`
+// and of the age keys of sops
+
+const ageIntro = "age-encryption.org/v1\n"
+
+// parseAgeIdentities returns the identities of an age key file, one per line with comments starting with #
+func parseAgeIdentities(data []byte) ([]age.Identity, error) {
+	return age.ParseIdentities(bytes.NewReader(data))
+}
+
+// isAgeEncrypted returns whether the data is an age file, binary or armored
+func isAgeEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(ageIntro)) || bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header))
+}
+
+// decryptAge decrypts an age file, binary or armored, with the first identity it is encrypted to
+func decryptAge(data []byte, identities []age.Identity) ([]byte, error) {
+	var r io.Reader = bytes.NewReader(data)
+	if !bytes.HasPrefix(data, []byte(ageIntro)) {
+		r = armor.NewReader(bytes.NewReader(bytes.TrimSpace(data)))
+	}
+	plaintext, err := age.Decrypt(r, identities...)
+	if err != nil {
+		return nil, err
+	}
+	out, err := io.ReadAll(plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return out, nil
+}
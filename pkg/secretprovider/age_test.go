@@ -0,0 +1,75 @@
+package secretprovider
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newAgeKey returns an age identity in the format of age-keygen and its recipient
+func newAgeKey(t *testing.T) (string, age.Recipient) {
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	return identity.String(), identity.Recipient()
+}
+
+// encryptAge encrypts the plaintext to the recipient like `age -r`, or `age -a -r` if armored
+func encryptAge(t *testing.T, plaintext []byte, recipient age.Recipient, armored bool) []byte {
+	out := &bytes.Buffer{}
+	var dst io.WriteCloser = nopWriteCloser{out}
+	if armored {
+		dst = armor.NewWriter(out)
+	}
+	w, err := age.Encrypt(dst, recipient)
+	require.NoError(t, err)
+	_, err = w.Write(plaintext)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, dst.Close())
+	return out.Bytes()
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestDecryptAge(t *testing.T) {
+	identity, recipient := newAgeKey(t)
+	_, other := newAgeKey(t)
+	identities, err := parseAgeIdentities([]byte("# created: 2024-01-01T00:00:00Z\n# public key: age1...\n" + identity + "\n"))
+	require.NoError(t, err)
+
+	large := bytes.Repeat([]byte("0123456789abcdef"), 64*1024/16*2+1)
+	for _, plaintext := range [][]byte{{}, []byte("SECRET=value\n"), large[:64*1024], large} {
+		for _, armored := range []bool{false, true} {
+			data := encryptAge(t, plaintext, recipient, armored)
+			assert.True(t, isAgeEncrypted(data))
+			decrypted, err := decryptAge(data, identities)
+			require.NoError(t, err)
+			assert.Equal(t, len(plaintext), len(decrypted))
+			assert.True(t, bytes.Equal(plaintext, decrypted))
+		}
+	}
+
+	_, err = decryptAge(encryptAge(t, []byte("SECRET=value"), other, false), identities)
+	var noMatch *age.NoIdentityMatchError
+	assert.ErrorAs(t, err, &noMatch)
+
+	data := encryptAge(t, []byte("SECRET=value"), recipient, false)
+	data[len(data)-1] ^= 1
+	_, err = decryptAge(data, identities)
+	assert.Error(t, err)
+
+	assert.False(t, isAgeEncrypted([]byte("SECRET=value")))
+	_, err = parseAgeIdentities([]byte("SECRET=value"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,137 @@
+// Package secretprovider fetches the secrets of the jobs from external sources, e.g. a password manager, an encrypted
+// file or the credentials of git, instead of plaintext files.
+package secretprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrNotFound is returned by the providers that don't have a secret
+var ErrNotFound = errors.New("secret not found")
+
+// Provider fetches the values of secrets
+type Provider interface {
+	// Secret returns the value of the secret of the upper case name, ErrNotFound if the provider doesn't have it
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// Options configure the providers of ParseRule
+type Options struct {
+	KeyFile        string // age identities the encrypted files are decrypted with
+	GitHubInstance string // host of the credentials of the git-credential providers without a host, github.com if empty
+}
+
+// Rule fetches the secrets matching its pattern with its provider
+type Rule struct {
+	Pattern  string // upper case name of a secret, a prefix followed by * or * for all secrets
+	Provider Provider
+}
+
+// ParseRule parses a rule in the format PATTERN=PROVIDER[:ARG], the providers are
+//
+//	exec:COMMAND            prints the secret of the name in $ACT_SECRET_NAME to stdout, run by the shell
+//	encrypted-file:FILE     an age encrypted dotenv or yaml file, decrypted with the identities of Options.KeyFile
+//	git-credential[:HOST]   the password of `git credential fill` for the host, Options.GitHubInstance by default
+func ParseRule(spec string, options Options) (*Rule, error) {
+	pattern, provider, ok := strings.Cut(spec, "=")
+	pattern = strings.ToUpper(strings.TrimSpace(pattern))
+	if !ok || pattern == "" || strings.Contains(strings.TrimSuffix(pattern, "*"), "*") {
+		return nil, fmt.Errorf("invalid secret provider %q, expected NAME=PROVIDER, PREFIX*=PROVIDER or *=PROVIDER", spec)
+	}
+	kind, arg, _ := strings.Cut(provider, ":")
+	rule := &Rule{Pattern: pattern}
+	switch kind {
+	case "exec":
+		if arg == "" {
+			return nil, fmt.Errorf("secret provider %q: exec needs a command", spec)
+		}
+		rule.Provider = &ExecProvider{Command: arg}
+	case "encrypted-file":
+		if arg == "" {
+			return nil, fmt.Errorf("secret provider %q: encrypted-file needs a file", spec)
+		}
+		if options.KeyFile == "" {
+			return nil, fmt.Errorf("secret provider %q: encrypted-file needs a key file", spec)
+		}
+		rule.Provider = &EncryptedFileProvider{Path: arg, KeyFile: options.KeyFile}
+	case "git-credential":
+		host := arg
+		if host == "" {
+			host = options.GitHubInstance
+		}
+		if host == "" {
+			host = "github.com"
+		}
+		rule.Provider = &GitCredentialProvider{Host: host}
+	default:
+		return nil, fmt.Errorf("secret provider %q: unknown provider %q, expected exec, encrypted-file or git-credential", spec, kind)
+	}
+	return rule, nil
+}
+
+// Match returns whether the rule fetches the secret of the upper case name
+func (r *Rule) Match(name string) bool {
+	if prefix, ok := strings.CutSuffix(r.Pattern, "*"); ok {
+		return strings.HasPrefix(name, prefix)
+	}
+	return r.Pattern == name
+}
+
+// Resolver fetches secrets with the rule of the name, or else of the longest prefix
+type Resolver struct {
+	rules []*Rule
+}
+
+// NewResolver returns a resolver of the rules
+func NewResolver(rules ...*Rule) *Resolver {
+	rules = append([]*Rule{}, rules...)
+	// the names before the prefixes, the longest prefixes first
+	sort.SliceStable(rules, func(i, j int) bool {
+		iPrefix, jPrefix := strings.HasSuffix(rules[i].Pattern, "*"), strings.HasSuffix(rules[j].Pattern, "*")
+		if iPrefix != jPrefix {
+			return jPrefix
+		}
+		return len(rules[i].Pattern) > len(rules[j].Pattern)
+	})
+	return &Resolver{rules: rules}
+}
+
+// Names returns the names of the rules without a prefix, the secrets fetched when the jobs may read any secret
+func (r *Resolver) Names() []string {
+	var names []string
+	for _, rule := range r.rules {
+		if !strings.HasSuffix(rule.Pattern, "*") {
+			names = append(names, rule.Pattern)
+		}
+	}
+	return names
+}
+
+// Resolve fetches the secrets of the names missing in secrets and adds them, the secrets without a rule and the
+// secrets the provider of their rule doesn't have are left out like the undefined secrets of GitHub.
+func (r *Resolver) Resolve(ctx context.Context, names []string, secrets map[string]string) error {
+	for _, name := range names {
+		name = strings.ToUpper(name)
+		if _, ok := secrets[name]; ok {
+			continue
+		}
+		for _, rule := range r.rules {
+			if !rule.Match(name) {
+				continue
+			}
+			value, err := rule.Provider.Secret(ctx, name)
+			if errors.Is(err, ErrNotFound) {
+				break
+			} else if err != nil {
+				return fmt.Errorf("failed to fetch secret %s: %w", name, err)
+			}
+			secrets[name] = value
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package secretprovider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mapProvider map[string]string
+
+func (p mapProvider) Secret(_ context.Context, name string) (string, error) {
+	if value, ok := p[name]; ok {
+		return value, nil
+	}
+	return "", ErrNotFound
+}
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule("npm_token=exec:pass show npm", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "NPM_TOKEN", rule.Pattern)
+	assert.Equal(t, &ExecProvider{Command: "pass show npm"}, rule.Provider)
+
+	rule, err = ParseRule("GITHUB_TOKEN=git-credential", Options{GitHubInstance: "github.example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, &GitCredentialProvider{Host: "github.example.com"}, rule.Provider)
+
+	rule, err = ParseRule("*=encrypted-file:.secrets.age", Options{KeyFile: "key.txt"})
+	require.NoError(t, err)
+	assert.True(t, rule.Match("ANY"))
+
+	for _, spec := range []string{"NAME", "=exec:true", "A*B=exec:true", "NAME=exec", "NAME=encrypted-file:.secrets.age", "NAME=vault:path"} {
+		_, err := ParseRule(spec, Options{})
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestResolver(t *testing.T) {
+	resolver := NewResolver(
+		&Rule{Pattern: "*", Provider: mapProvider{"A": "all", "AWS_KEY": "all", "OTHER": "all"}},
+		&Rule{Pattern: "AWS_*", Provider: mapProvider{"AWS_KEY": "aws", "AWS_SECRET": "aws"}},
+		&Rule{Pattern: "AWS_SECRET", Provider: mapProvider{}},
+		&Rule{Pattern: "A", Provider: mapProvider{"A": "a"}},
+	)
+	assert.Equal(t, []string{"AWS_SECRET", "A"}, resolver.Names())
+
+	secrets := map[string]string{"OTHER": "file"}
+	require.NoError(t, resolver.Resolve(context.Background(), []string{"a", "AWS_KEY", "AWS_SECRET", "OTHER", "MISSING"}, secrets))
+	// the most specific rule wins, the secrets it doesn't have stay undefined
+	assert.Equal(t, map[string]string{"A": "a", "AWS_KEY": "aws", "OTHER": "file"}, secrets)
+}
+
+func TestExecProvider(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	provider := &ExecProvider{Command: `echo "value of $ACT_SECRET_NAME"`}
+	value, err := provider.Secret(context.Background(), "NPM_TOKEN")
+	require.NoError(t, err)
+	assert.Equal(t, "value of NPM_TOKEN", value)
+
+	_, err = (&ExecProvider{Command: "exit 1"}).Secret(context.Background(), "NPM_TOKEN")
+	assert.Error(t, err)
+}
+
+func TestEncryptedFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	identity, recipient := newAgeKey(t)
+	keyFile := filepath.Join(dir, "key.txt")
+	require.NoError(t, os.WriteFile(keyFile, []byte(identity+"\n"), 0o600))
+
+	for _, c := range []struct {
+		name    string
+		content string
+		format  string
+	}{
+		{name: ".secrets.age", content: "npm_token=dotenv\nOTHER=\"quoted value\"\n", format: "dotenv"},
+		{name: "secrets.yaml.age", content: "npm_token: yaml\nOTHER: quoted value\n", format: "yaml"},
+	} {
+		file := filepath.Join(dir, c.name)
+		require.NoError(t, os.WriteFile(file, encryptAge(t, []byte(c.content), recipient, true), 0o600))
+		rule, err := ParseRule("*=encrypted-file:"+file, Options{KeyFile: keyFile})
+		require.NoError(t, err)
+
+		secrets := map[string]string{}
+		require.NoError(t, NewResolver(rule).Resolve(context.Background(), []string{"NPM_TOKEN", "OTHER", "MISSING"}, secrets))
+		assert.Equal(t, map[string]string{"NPM_TOKEN": c.format, "OTHER": "quoted value"}, secrets, c.name)
+	}
+
+	plain := filepath.Join(dir, ".secrets")
+	require.NoError(t, os.WriteFile(plain, []byte("NPM_TOKEN=plain\n"), 0o600))
+	_, err := (&EncryptedFileProvider{Path: plain, KeyFile: keyFile}).Secret(context.Background(), "NPM_TOKEN")
+	assert.ErrorContains(t, err, "not an age encrypted file")
+}
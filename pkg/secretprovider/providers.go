@@ -0,0 +1,125 @@
+package secretprovider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// ExecProvider runs a command printing the secret of the name in $ACT_SECRET_NAME, e.g. the CLI of a password manager
+type ExecProvider struct {
+	Command string
+}
+
+func (p *ExecProvider) Secret(ctx context.Context, name string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", p.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", p.Command)
+	}
+	cmd.Env = append(os.Environ(), "ACT_SECRET_NAME="+name)
+	// the password managers may prompt for a passphrase
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", p.Command, err)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(out), "\n"), "\r"), nil
+}
+
+// GitCredentialProvider returns the password git has stored for a host, e.g. the token of `gh auth login`
+type GitCredentialProvider struct {
+	Host string
+}
+
+func (p *GitCredentialProvider) Secret(ctx context.Context, _ string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "credential", "fill")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=https\nhost=%s\n\n", p.Host))
+	out, err := cmd.Output()
+	if err != nil {
+		// git fails if no helper has credentials and it may not prompt
+		return "", ErrNotFound
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if password, ok := strings.CutPrefix(scanner.Text(), "password="); ok && password != "" {
+			return password, nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+// EncryptedFileProvider returns the secrets of an age encrypted file, the format of the decrypted file is yaml for
+// the .yml and .yaml extensions and dotenv otherwise, a trailing .age extension is ignored
+type EncryptedFileProvider struct {
+	Path    string
+	KeyFile string
+
+	once    sync.Once
+	secrets map[string]string
+	err     error
+}
+
+func (p *EncryptedFileProvider) Secret(_ context.Context, name string) (string, error) {
+	p.once.Do(func() {
+		p.secrets, p.err = p.read()
+	})
+	if p.err != nil {
+		return "", p.err
+	}
+	value, ok := p.secrets[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (p *EncryptedFileProvider) read() (map[string]string, error) {
+	keys, err := os.ReadFile(p.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := parseAgeIdentities(keys)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p.KeyFile, err)
+	}
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !isAgeEncrypted(data) {
+		return nil, fmt.Errorf("%s: not an age encrypted file", p.Path)
+	}
+	plaintext, err := decryptAge(data, identities)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p.Path, err)
+	}
+
+	values := map[string]string{}
+	if ext := filepath.Ext(strings.TrimSuffix(p.Path, ".age")); ext == ".yml" || ext == ".yaml" {
+		err = yaml.Unmarshal(plaintext, &values)
+	} else {
+		values, err = godotenv.UnmarshalBytes(plaintext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p.Path, err)
+	}
+	secrets := make(map[string]string, len(values))
+	for k, v := range values {
+		secrets[strings.ToUpper(k)] = v
+	}
+	return secrets, nil
+}
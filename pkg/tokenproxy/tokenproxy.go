@@ -0,0 +1,382 @@
+// Package tokenproxy is a proxy of the GitHub API the jobs use as GITHUB_API_URL. The jobs get a GITHUB_TOKEN scoped
+// to their permissions, the proxy forwards their requests with the real token within these permissions and rejects
+// the others like GitHub, so missing permissions are caught before pushing. Only the REST API is proxied, the scoped
+// tokens can't be used for git over https or for docker registries like ghcr.io.
+package tokenproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nektos/act/pkg/model"
+)
+
+// Claims are the claims of the scoped GITHUB_TOKEN of a job
+type Claims struct {
+	Repository  string            `json:"repository"`
+	Job         string            `json:"job"` // name of the job for the messages
+	Permissions model.Permissions `json:"permissions"`
+}
+
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Scp string `json:"scp"`
+	Claims
+}
+
+const tokenScope = "Actions.GitHubToken"
+
+// CreateToken creates the scoped GITHUB_TOKEN of a job, signed with the secret of the proxy
+func CreateToken(secret string, claims Claims) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(24 * time.Hour)),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+		Scp:    tokenScope,
+		Claims: claims,
+	})
+	return token.SignedString([]byte(secret))
+}
+
+// parseToken returns the claims of a scoped token, nil if the token is another token, e.g. a personal access token
+func parseToken(value, secret string) *Claims {
+	c := &tokenClaims{}
+	token, err := jwt.ParseWithClaims(value, c, func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return []byte(secret), nil
+	})
+	if err != nil || !token.Valid || c.Scp != tokenScope {
+		return nil
+	}
+	return &c.Claims
+}
+
+// requestToken returns the token of a request, sent as a bearer token, `token <token>` or the password of basic auth
+func requestToken(req *http.Request) string {
+	if _, password, ok := req.BasicAuth(); ok {
+		return password
+	}
+	parts := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// Handler forwards the requests of the jobs to the GitHub API
+type Handler struct {
+	proxy    *httputil.ReverseProxy
+	upstream *url.URL
+	token    string
+	secret   string
+
+	mu     sync.Mutex
+	public map[string]bool // visibility of the other repositories by lower case name
+}
+
+// NewHandler returns a proxy forwarding the requests of the scoped tokens signed with secret to the GitHub API at
+// upstream with the real token. The requests of other tokens are forwarded unchanged.
+func NewHandler(upstream, token, secret string) (*Handler, error) {
+	// anyone could sign the scoped tokens of an empty secret
+	if secret == "" {
+		return nil, errors.New("the GitHub token proxy needs a secret")
+	}
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub API url %q: %w", upstream, err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		req.Host = u.Host
+	}
+	return &Handler{proxy: proxy, upstream: u, token: token, secret: secret, public: map[string]bool{}}, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	claims := parseToken(requestToken(r), h.secret)
+	if claims == nil {
+		h.proxy.ServeHTTP(w, r)
+		return
+	}
+	scope, level := requiredPermission(r.Method, r.URL.Path, claims.Repository)
+	if scope == "metadata" && isGraphQL(r.URL.Path) && isGraphQLMutation(r) {
+		// the mutations of graphql aren't mapped to scopes, like the administration of a repository
+		scope, level = "", model.PermissionWrite
+	}
+	if scope == "" || !claims.Permissions.Allows(scope, level) {
+		message := fmt.Sprintf("%s %s needs a token with more access than GITHUB_TOKEN can be granted", r.Method, r.URL.Path)
+		if scope != "" {
+			message = fmt.Sprintf("%s %s needs `permissions: %s: %s`", r.Method, r.URL.Path, scope, level)
+		}
+		log.Warnf("The GITHUB_TOKEN of job %s is rejected: %s", claims.Job, message)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"message":           "Resource not accessible by integration: " + message,
+			"documentation_url": "https://docs.github.com/actions/using-jobs/assigning-permissions-to-jobs",
+		})
+		return
+	}
+
+	// like GitHub, the token of a job reads the public repositories only besides its own repository
+	if repository := otherRepository(r.URL.Path, claims.Repository); repository != "" && !h.isPublic(r, repository) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(map[string]string{"message": "Not Found"})
+		return
+	}
+
+	r.Header.Del("Authorization")
+	// the routes of accounts, e.g. /user/repos, are read without the real token, so they return public resources only
+	if h.token != "" && !isAccountRoute(r.URL.Path) {
+		r.Header.Set("Authorization", "token "+h.token)
+	}
+	h.proxy.ServeHTTP(w, r)
+}
+
+// isPublic returns whether the repository of the name is public, the visibility is read with the real token once
+func (h *Handler) isPublic(r *http.Request, repository string) bool {
+	key := strings.ToLower(repository)
+	h.mu.Lock()
+	public, ok := h.public[key]
+	h.mu.Unlock()
+	if ok {
+		return public
+	}
+
+	u := *h.upstream
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/repos/" + repository
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, u.String(), nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if h.token != "" {
+		req.Header.Set("Authorization", "token "+h.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	var repo struct {
+		Private    bool   `json:"private"`
+		Visibility string `json:"visibility"`
+	}
+	if resp.StatusCode == http.StatusOK && json.NewDecoder(resp.Body).Decode(&repo) == nil {
+		public = !repo.Private && (repo.Visibility == "" || repo.Visibility == "public")
+	} else if resp.StatusCode != http.StatusNotFound {
+		// e.g. a rate limit, the visibility is read again by the next request
+		return false
+	}
+	h.mu.Lock()
+	h.public[key] = public
+	h.mu.Unlock()
+	return public
+}
+
+// otherRepository returns the owner/repo of the routes of a repository other than the repository of the job
+func otherRepository(urlPath, repository string) string {
+	segments := strings.Split(strings.Trim(urlPath, "/"), "/")
+	if len(segments) < 3 || segments[0] != "repos" || strings.EqualFold(segments[1]+"/"+segments[2], repository) {
+		return ""
+	}
+	return segments[1] + "/" + segments[2]
+}
+
+// isAccountRoute returns whether the route belongs to no repository, e.g. the routes of users, organizations and search,
+// except graphql and the packages, which the permissions of the job grant
+func isAccountRoute(urlPath string) bool {
+	segments := strings.Split(strings.Trim(urlPath, "/"), "/")
+	if segments[0] == "repos" || isGraphQL(urlPath) {
+		return false
+	}
+	for _, segment := range segments {
+		if segment == "packages" {
+			return false
+		}
+	}
+	return true
+}
+
+func isGraphQL(urlPath string) bool {
+	return strings.Trim(urlPath, "/") == "graphql"
+}
+
+// maxGraphQLBody limits the graphql requests the proxy reads to find mutations
+const maxGraphQLBody = 1 << 20
+
+// isGraphQLMutation returns whether a graphql request runs a mutation, requests that can't be parsed count as mutations.
+// The body of the request is restored for the upstream.
+func isGraphQLMutation(r *http.Request) bool {
+	if r.Method == http.MethodGet {
+		return isMutationDocument(r.URL.Query().Get("query"))
+	}
+	if r.Body == nil {
+		return false
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxGraphQLBody+1))
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil || len(body) > maxGraphQLBody {
+		return true
+	}
+	var request struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return true
+	}
+	return isMutationDocument(request.Query)
+}
+
+// isMutationDocument returns whether a graphql document has a mutation or a subscription operation, the keywords of
+// the operations are the names at the top level of the document outside of strings and comments
+func isMutationDocument(document string) bool {
+	depth := 0
+	for i := 0; i < len(document); i++ {
+		switch c := document[i]; {
+		case c == '#':
+			for i < len(document) && document[i] != '\n' {
+				i++
+			}
+		case c == '"':
+			// block strings """...""" and strings with escapes
+			if strings.HasPrefix(document[i:], `"""`) {
+				end := strings.Index(document[i+3:], `"""`)
+				if end < 0 {
+					return true
+				}
+				i += end + 5
+				continue
+			}
+			for i++; i < len(document) && document[i] != '"'; i++ {
+				if document[i] == '\\' {
+					i++
+				}
+			}
+		case c == '{' || c == '(' || c == '[':
+			depth++
+		case c == '}' || c == ')' || c == ']':
+			depth--
+		case depth == 0 && isNameStart(c):
+			start := i
+			for i < len(document) && isNameChar(document[i]) {
+				i++
+			}
+			if name := document[start:i]; name == "mutation" || name == "subscription" {
+				return true
+			}
+			i--
+		}
+	}
+	return false
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || c >= '0' && c <= '9'
+}
+
+// repositoryScopes are the scopes of the routes of a repository by their first segment below /repos/{owner}/{repo}
+var repositoryScopes = map[string]string{
+	"actions":              "actions",
+	"attestations":         "attestations",
+	"check-runs":           "checks",
+	"check-suites":         "checks",
+	"archive":              "contents",
+	"branches":             "contents",
+	"commits":              "contents",
+	"compare":              "contents",
+	"contents":             "contents",
+	"dispatches":           "contents",
+	"git":                  "contents",
+	"merges":               "contents",
+	"readme":               "contents",
+	"releases":             "contents",
+	"tags":                 "contents",
+	"tarball":              "contents",
+	"zipball":              "contents",
+	"deployments":          "deployments",
+	"environments":         "deployments",
+	"discussions":          "discussions",
+	"assignees":            "issues",
+	"issues":               "issues",
+	"labels":               "issues",
+	"milestones":           "issues",
+	"pages":                "pages",
+	"pulls":                "pull-requests",
+	"projects":             "repository-projects",
+	"code-scanning":        "security-events",
+	"dependabot":           "security-events",
+	"secret-scanning":      "security-events",
+	"vulnerability-alerts": "security-events",
+	"statuses":             "statuses",
+}
+
+// requiredPermission returns the scope and the level of the permission a request of the GitHub REST API needs,
+// the scope is empty if no permission grants the access to the GITHUB_TOKEN, e.g. the administration of a repository.
+func requiredPermission(method, urlPath, repository string) (string, string) {
+	level := model.PermissionWrite
+	if method == http.MethodGet || method == http.MethodHead {
+		level = model.PermissionRead
+	}
+	segments := strings.Split(strings.Trim(urlPath, "/"), "/")
+	switch {
+	case segments[0] == "graphql":
+		// the queries of graphql aren't mapped to scopes, they need the metadata only, see isGraphQLMutation
+		return "metadata", model.PermissionRead
+	case segments[0] == "repos" && len(segments) >= 3:
+		// the other repositories are readable if they are public, see otherRepository, they are never writable,
+		// the settings of the repository are readable with the metadata
+		if !strings.EqualFold(segments[1]+"/"+segments[2], repository) || len(segments) == 3 {
+			break
+		}
+		rest := segments[3:]
+		// the statuses and the checks of a commit belong to their scopes
+		if rest[0] == "commits" && len(rest) >= 3 {
+			switch rest[2] {
+			case "status", "statuses":
+				return "statuses", level
+			case "check-runs", "check-suites":
+				return "checks", level
+			case "pulls":
+				return "pull-requests", level
+			}
+		}
+		if scope, ok := repositoryScopes[rest[0]]; ok {
+			return scope, level
+		}
+	default:
+		for _, segment := range segments {
+			if segment == "packages" {
+				return "packages", level
+			}
+		}
+	}
+	if level == model.PermissionRead {
+		return "metadata", level
+	}
+	return "", level
+}
@@ -0,0 +1,185 @@
+package tokenproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nektos/act/pkg/model"
+)
+
+func TestHandler(t *testing.T) {
+	var forwarded *http.Request
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the visibility of the other repositories
+		switch r.URL.Path {
+		case "/api/v3/repos/octo/public":
+			_, _ = w.Write([]byte(`{"private": false, "visibility": "public"}`))
+			return
+		case "/api/v3/repos/octo/internal":
+			_, _ = w.Write([]byte(`{"private": true, "visibility": "internal"}`))
+			return
+		case "/api/v3/repos/octo/private":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		forwarded = r
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+	handler, err := NewHandler(upstream.URL+"/api/v3", "real", "s3cret")
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	token, err := CreateToken("s3cret", Claims{
+		Repository:  "octo/repo",
+		Job:         "CI/build",
+		Permissions: model.Permissions{"contents": model.PermissionRead, "issues": model.PermissionWrite},
+	})
+	require.NoError(t, err)
+
+	doBody := func(method, path, body string, setAuth func(*http.Request)) *http.Response {
+		forwarded = nil
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		setAuth(req)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	do := func(method, path string, setAuth func(*http.Request)) *http.Response {
+		return doBody(method, path, "{}", setAuth)
+	}
+	bearer := func(token string) func(*http.Request) {
+		return func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	for _, c := range []struct {
+		method string
+		path   string
+		auth   func(*http.Request)
+	}{
+		{method: http.MethodGet, path: "/repos/octo/repo/contents/README.md", auth: bearer(token)},
+		{method: http.MethodPost, path: "/repos/octo/repo/issues/1/comments", auth: func(req *http.Request) {
+			req.Header.Set("Authorization", "token "+token)
+		}},
+		{method: http.MethodGet, path: "/repos/octo/repo", auth: func(req *http.Request) {
+			req.SetBasicAuth("x-access-token", token)
+		}},
+		{method: http.MethodGet, path: "/repos/octo/public/releases/latest", auth: bearer(token)},
+	} {
+		resp := do(c.method, c.path, c.auth)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "%s %s", c.method, c.path)
+		require.NotNil(t, forwarded)
+		assert.Equal(t, "token real", forwarded.Header.Get("Authorization"))
+		assert.Equal(t, "/api/v3"+c.path, forwarded.URL.Path)
+	}
+
+	// the requests outside the permissions are rejected like GitHub
+	for _, path := range []string{"/repos/octo/repo/contents/README.md", "/repos/octo/repo/pulls", "/repos/octo/other/issues"} {
+		resp := do(http.MethodPost, path, bearer(token))
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, path)
+		assert.Nil(t, forwarded, path)
+		body := map[string]string{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Contains(t, body["message"], "Resource not accessible by integration")
+	}
+
+	// the private repositories other than the repository of the job aren't readable
+	for _, path := range []string{"/repos/octo/private/contents/README.md", "/repos/octo/internal/issues"} {
+		resp := do(http.MethodGet, path, bearer(token))
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+		assert.Nil(t, forwarded, path)
+	}
+
+	// the routes of accounts are read without the real token
+	resp := do(http.MethodGet, "/user/repos", bearer(token))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotNil(t, forwarded)
+	assert.Empty(t, forwarded.Header.Get("Authorization"))
+
+	// the queries of graphql are forwarded with the real token, the mutations are rejected
+	resp = doBody(http.MethodPost, "/graphql", `{"query": "# mutation\nquery($q: String = \"mutation {\") { viewer { login } }"}`, bearer(token))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotNil(t, forwarded)
+	assert.Equal(t, "token real", forwarded.Header.Get("Authorization"))
+	for _, body := range []string{`{"query": "mutation { addComment(input: {}) { clientMutationId } }"}`, `{"query": "query { viewer { login } } mutation M { merge }"}`, `[{"query": "{ viewer { login } }"}]`} {
+		resp := doBody(http.MethodPost, "/graphql", body, bearer(token))
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, body)
+		assert.Nil(t, forwarded, body)
+	}
+
+	// the other tokens, e.g. personal access tokens or the tokens of other secrets, are forwarded unchanged
+	other, err := CreateToken("other", Claims{Repository: "octo/repo"})
+	require.NoError(t, err)
+	unsigned, err := CreateToken("", Claims{Repository: "octo/repo", Permissions: model.AllPermissions(model.PermissionWrite)})
+	require.NoError(t, err)
+	for _, token := range []string{"ghp_personal", other, unsigned} {
+		resp := do(http.MethodPost, "/repos/octo/repo/pulls", bearer(token))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		require.NotNil(t, forwarded)
+		assert.Equal(t, "Bearer "+token, forwarded.Header.Get("Authorization"))
+	}
+}
+
+func TestIsMutationDocument(t *testing.T) {
+	for document, mutation := range map[string]bool{
+		"{ viewer { login } }":                              false,
+		"query Q { repository(name: \"mutation\") { id } }": false,
+		"# mutation {\nquery { viewer { login } }":          false,
+		"query { a(b: \"\"\"\nmutation { }\"\"\") }":        false,
+		"query { mutation { id } }":                         false,
+		"mutation { merge }":                                true,
+		"fragment F on User { login }\nmutation { merge }":  true,
+		"subscription { events }":                           true,
+		"query { a(b: \"\"\"unterminated) }":                true,
+	} {
+		assert.Equal(t, mutation, isMutationDocument(document), document)
+	}
+}
+
+func TestNewHandlerSecret(t *testing.T) {
+	_, err := NewHandler("https://api.github.com", "real", "")
+	assert.Error(t, err)
+}
+
+func TestRequiredPermission(t *testing.T) {
+	for _, c := range []struct {
+		method string
+		path   string
+		scope  string
+		level  string
+	}{
+		{http.MethodGet, "/repos/octo/repo", "metadata", model.PermissionRead},
+		{http.MethodPatch, "/repos/octo/repo", "", model.PermissionWrite},
+		{http.MethodGet, "/repos/Octo/Repo/actions/runs", "actions", model.PermissionRead},
+		{http.MethodPost, "/repos/octo/repo/releases", "contents", model.PermissionWrite},
+		{http.MethodPost, "/repos/octo/repo/dispatches", "contents", model.PermissionWrite},
+		{http.MethodPost, "/repos/octo/repo/statuses/abc", "statuses", model.PermissionWrite},
+		{http.MethodGet, "/repos/octo/repo/commits/abc/status", "statuses", model.PermissionRead},
+		{http.MethodGet, "/repos/octo/repo/commits/abc/check-runs", "checks", model.PermissionRead},
+		{http.MethodGet, "/repos/octo/repo/commits/abc", "contents", model.PermissionRead},
+		{http.MethodPut, "/repos/octo/repo/pulls/1/merge", "pull-requests", model.PermissionWrite},
+		{http.MethodPost, "/repos/octo/repo/labels", "issues", model.PermissionWrite},
+		{http.MethodPut, "/repos/octo/repo/collaborators/hubot", "", model.PermissionWrite},
+		{http.MethodGet, "/repos/octo/other/contents/README.md", "metadata", model.PermissionRead},
+		{http.MethodPost, "/repos/octo/other/issues", "", model.PermissionWrite},
+		{http.MethodGet, "/orgs/octo/packages/container/app/versions", "packages", model.PermissionRead},
+		{http.MethodDelete, "/user/packages/container/app", "packages", model.PermissionWrite},
+		{http.MethodPost, "/graphql", "metadata", model.PermissionRead},
+		{http.MethodGet, "/users/hubot", "metadata", model.PermissionRead},
+	} {
+		scope, level := requiredPermission(c.method, c.path, "octo/repo")
+		assert.Equal(t, c.scope, scope, "%s %s", c.method, c.path)
+		assert.Equal(t, c.level, level, "%s %s", c.method, c.path)
+	}
+}
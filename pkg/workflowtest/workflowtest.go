@@ -0,0 +1,311 @@
+// Package workflowtest runs workflows against test cases and checks job results, outputs,
+// step conclusions, annotations and summaries against the expectations of each case.
+package workflowtest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/nektos/act/pkg/common"
+	"github.com/nektos/act/pkg/model"
+	"github.com/nektos/act/pkg/runner"
+)
+
+// File is the structure of a test case file
+type File struct {
+	Cases []*Case `yaml:"cases"`
+}
+
+// Case describes how to trigger the workflows and what to expect from the run
+type Case struct {
+	Name      string                        `yaml:"name"`
+	Event     string                        `yaml:"event"`
+	EventPath string                        `yaml:"eventpath"`
+	Job       string                        `yaml:"job"`
+	Inputs    map[string]string             `yaml:"inputs"`
+	Secrets   map[string]string             `yaml:"secrets"`
+	Vars      map[string]string             `yaml:"vars"`
+	Env       map[string]string             `yaml:"env"`
+	Matrix    map[string][]string           `yaml:"matrix"`
+	Mocks     map[string]*runner.ActionMock `yaml:"mocks"`
+	Expect    Expectation                   `yaml:"expect"`
+
+	file string
+}
+
+// Expectation contains the expected outcome per job id
+type Expectation struct {
+	Jobs map[string]*JobExpectation `yaml:"jobs"`
+}
+
+// JobExpectation is the expected outcome of a job, it has to hold for every matrix run of the job
+type JobExpectation struct {
+	Result      string                  `yaml:"result"`
+	Outputs     map[string]string       `yaml:"outputs"`
+	Steps       map[string]string       `yaml:"steps"`
+	Annotations []AnnotationExpectation `yaml:"annotations"`
+	Summary     []string                `yaml:"summary"`
+}
+
+// AnnotationExpectation matches an annotation by level and a substring of its message
+type AnnotationExpectation struct {
+	Level   string `yaml:"level"`
+	Message string `yaml:"message"`
+}
+
+// String returns the name of the case or its location in the test file
+func (c *Case) String() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.file
+}
+
+// ReadCases reads all test cases from a file or from every yaml file in a directory
+func ReadCases(path string) ([]*Case, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{path}
+	if fi.IsDir() {
+		files = nil
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if ext := filepath.Ext(entry.Name()); !entry.IsDir() && (ext == ".yml" || ext == ".yaml") {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	cases := []*Case{}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var f File
+		if err := yaml.Unmarshal(content, &f); err != nil {
+			return nil, fmt.Errorf("failed to read test cases from %s: %w", file, err)
+		}
+		for i, c := range f.Cases {
+			c.file = fmt.Sprintf("%s#%d", file, i)
+			if c.EventPath != "" && !filepath.IsAbs(c.EventPath) {
+				c.EventPath = filepath.Join(filepath.Dir(file), c.EventPath)
+			}
+			cases = append(cases, c)
+		}
+	}
+	return cases, nil
+}
+
+// Result is the outcome of a single test case
+type Result struct {
+	Case     *Case
+	Report   *runner.Report
+	Failures []string
+	Err      error
+}
+
+// Passed reports whether the run matched all expectations
+func (r *Result) Passed() bool {
+	return r.Err == nil && len(r.Failures) == 0
+}
+
+// Options configure how the workflows of a test case are planned
+type Options struct {
+	WorkflowsPath     string
+	NoWorkflowRecurse bool
+}
+
+// Run plans and executes the workflows for a test case and checks the expectations.
+// The config is copied, the case overrides the event, inputs, secrets, vars, env, matrix filters and action mocks
+func Run(ctx context.Context, opts Options, config runner.Config, c *Case) *Result {
+	result := &Result{
+		Case:   c,
+		Report: &runner.Report{},
+	}
+
+	// the planner is recreated for every case, because job results are stored in the workflow model
+	planner, err := model.NewWorkflowPlanner(opts.WorkflowsPath, opts.NoWorkflowRecurse)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	eventName := c.Event
+	if eventName == "" {
+		eventName = "push"
+	}
+	var plan *model.Plan
+	if c.Job != "" {
+		plan, err = planner.PlanJob(c.Job)
+	} else {
+		plan, err = planner.PlanEvent(eventName)
+	}
+	if plan == nil {
+		result.Err = err
+		return result
+	}
+
+	config.EventName = eventName
+	config.EventPath = c.EventPath
+	config.Inputs = mergeMaps(config.Inputs, c.Inputs)
+	config.Secrets = mergeMaps(config.Secrets, c.Secrets)
+	config.Vars = mergeMaps(config.Vars, c.Vars)
+	config.Env = mergeMaps(config.Env, c.Env)
+	config.Report = result.Report
+	if len(c.Mocks) > 0 {
+		mocks := map[string]*runner.ActionMock{}
+		for k, v := range config.ActionMocks {
+			mocks[k] = v
+		}
+		for k, v := range c.Mocks {
+			mocks[k] = v
+		}
+		config.ActionMocks = mocks
+	}
+	if len(c.Matrix) > 0 {
+		config.Matrix = map[string]map[string]bool{}
+		for k, values := range c.Matrix {
+			config.Matrix[k] = map[string]bool{}
+			for _, v := range values {
+				config.Matrix[k][v] = true
+			}
+		}
+	}
+
+	r, err := runner.New(&config)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	// a failing job is not an error of the test case, it is checked against the expected result
+	_ = r.NewPlanExecutor(plan)(ctx)
+
+	result.Failures = Check(c, result.Report, common.Dryrun(ctx))
+	return result
+}
+
+// Check compares the report of a run against the expectations of a test case.
+// In dryrun mode only the plan and the evaluation of if: conditions are checked,
+// which means jobs and steps are either expected to be skipped or not.
+func Check(c *Case, report *runner.Report, dryrun bool) []string {
+	failures := []string{}
+	failf := func(format string, args ...interface{}) {
+		failures = append(failures, fmt.Sprintf(format, args...))
+	}
+
+	for _, jobID := range sortedKeys(c.Expect.Jobs) {
+		expected := c.Expect.Jobs[jobID]
+		jobs := report.Job(jobID)
+		if len(jobs) == 0 {
+			if expected.Result != "" && expected.Result != "skipped" {
+				failf("job '%s' did not run, expected result '%s'", jobID, expected.Result)
+			}
+			// the steps of a job which did not run are skipped, its outputs are empty
+			for _, stepID := range sortedKeys(expected.Steps) {
+				if expected.Steps[stepID] != "skipped" {
+					failf("step '%s' of job '%s' did not run, expected '%s'", stepID, jobID, expected.Steps[stepID])
+				}
+			}
+			if dryrun {
+				continue
+			}
+			for _, name := range sortedKeys(expected.Outputs) {
+				if expected.Outputs[name] != "" {
+					failf("output '%s' of job '%s' is '', expected '%s'", name, jobID, expected.Outputs[name])
+				}
+			}
+			if len(expected.Annotations) > 0 || len(expected.Summary) > 0 {
+				failf("job '%s' did not run, expected annotations or a summary", jobID)
+			}
+			continue
+		}
+
+		for _, job := range jobs {
+			if expected.Result != "" && !resultMatches(expected.Result, job.Result, dryrun) {
+				failf("job '%s' finished with result '%s', expected '%s'", job.Name, job.Result, expected.Result)
+			}
+
+			for _, stepID := range sortedKeys(expected.Steps) {
+				conclusion := ""
+				if step, ok := job.Steps[stepID]; ok {
+					conclusion = step.Conclusion.String()
+				}
+				if !resultMatches(expected.Steps[stepID], conclusion, dryrun) {
+					failf("step '%s' of job '%s' concluded with '%s', expected '%s'", stepID, job.Name, conclusion, expected.Steps[stepID])
+				}
+			}
+
+			if dryrun {
+				continue
+			}
+
+			for _, name := range sortedKeys(expected.Outputs) {
+				if actual, ok := job.Outputs[name]; !ok || actual != expected.Outputs[name] {
+					failf("output '%s' of job '%s' is '%s', expected '%s'", name, job.Name, actual, expected.Outputs[name])
+				}
+			}
+
+			for _, annotation := range expected.Annotations {
+				if !hasAnnotation(job.Annotations, annotation) {
+					failf("job '%s' has no %s annotation containing '%s'", job.Name, annotation.Level, annotation.Message)
+				}
+			}
+
+			for _, content := range expected.Summary {
+				if !strings.Contains(job.Summary, content) {
+					failf("summary of job '%s' does not contain '%s'", job.Name, content)
+				}
+			}
+		}
+	}
+	return failures
+}
+
+// resultMatches compares job results or step conclusions, a dryrun only decides whether something is skipped
+func resultMatches(expected, actual string, dryrun bool) bool {
+	if dryrun && expected != "skipped" && actual != "" {
+		return actual != "skipped"
+	}
+	return expected == actual
+}
+
+func hasAnnotation(annotations []runner.Annotation, expected AnnotationExpectation) bool {
+	for _, annotation := range annotations {
+		if (expected.Level == "" || annotation.Level == expected.Level) && strings.Contains(annotation.Message, expected.Message) {
+			return true
+		}
+	}
+	return false
+}
+
+func mergeMaps(maps ...map[string]string) map[string]string {
+	rtnMap := make(map[string]string)
+	for _, m := range maps {
+		for k, v := range m {
+			rtnMap[k] = v
+		}
+	}
+	return rtnMap
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,139 @@
+package workflowtest
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nektos/act/pkg/common"
+	"github.com/nektos/act/pkg/runner"
+)
+
+func TestReadCases(t *testing.T) {
+	cases, err := ReadCases("testdata/cases")
+	require.NoError(t, err)
+	require.Len(t, cases, 3)
+
+	// files are read in lexical order
+	assert.Equal(t, filepath.Join("testdata", "cases", "eventpath.yml#0"), cases[0].String())
+	assert.Equal(t, filepath.Join("testdata", "cases", "event.json"), cases[0].EventPath)
+	assert.Equal(t, "deploy disabled", cases[1].String())
+	assert.Equal(t, "skipped", cases[1].Expect.Jobs["build"].Steps["deploy"])
+	assert.Equal(t, map[string]string{"DEPLOY": "true"}, cases[2].Env)
+
+	cases, err = ReadCases("testdata/cases/push.yml")
+	require.NoError(t, err)
+	assert.Len(t, cases, 2)
+
+	_, err = ReadCases("testdata/missing")
+	assert.Error(t, err)
+}
+
+func TestRunDryrun(t *testing.T) {
+	cases, err := ReadCases("testdata/cases/push.yml")
+	require.NoError(t, err)
+
+	ctx := common.WithDryrun(context.Background(), true)
+	opts := Options{WorkflowsPath: "testdata/workflows"}
+	config := runner.Config{
+		Workdir:        "testdata",
+		ActionCacheDir: t.TempDir(),
+		Platforms:      map[string]string{"ubuntu-latest": "-self-hosted"},
+	}
+	for _, c := range cases {
+		t.Run(c.String(), func(t *testing.T) {
+			result := Run(ctx, opts, config, c)
+			assert.NoError(t, result.Err)
+			assert.Empty(t, result.Failures)
+			assert.True(t, result.Passed())
+		})
+	}
+}
+
+func TestRunReport(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	cases, err := ReadCases("testdata/report.yml")
+	require.NoError(t, err)
+	require.Len(t, cases, 1)
+
+	opts := Options{WorkflowsPath: "testdata/report"}
+	config := runner.Config{
+		Workdir:        "testdata",
+		ActionCacheDir: t.TempDir(),
+		Platforms:      map[string]string{"ubuntu-latest": "-self-hosted"},
+	}
+	result := Run(context.Background(), opts, config, cases[0])
+	require.NoError(t, result.Err)
+	assert.Empty(t, result.Failures)
+
+	jobs := result.Report.Job("report")
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "Greeting", jobs[0].Annotations[0].Title)
+	assert.Equal(t, "greet", jobs[0].Annotations[0].StepID)
+
+	// outputs, annotations and summaries are not checked in dryrun mode
+	result = Run(common.WithDryrun(context.Background(), true), opts, config, cases[0])
+	assert.True(t, result.Passed())
+}
+
+func TestRunMocks(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	cases, err := ReadCases("testdata/mocks.yml")
+	require.NoError(t, err)
+
+	opts := Options{WorkflowsPath: "testdata/mocks"}
+	config := runner.Config{
+		Workdir:        "testdata",
+		ActionCacheDir: t.TempDir(),
+		Platforms:      map[string]string{"ubuntu-latest": "-self-hosted"},
+	}
+	for _, c := range cases {
+		t.Run(c.String(), func(t *testing.T) {
+			result := Run(context.Background(), opts, config, c)
+			assert.NoError(t, result.Err)
+			assert.Empty(t, result.Failures)
+		})
+	}
+}
+
+func TestCheckFailures(t *testing.T) {
+	c := &Case{
+		Expect: Expectation{
+			Jobs: map[string]*JobExpectation{
+				"build":   {Steps: map[string]string{"deploy": "success", "lint": "skipped"}, Outputs: map[string]string{"version": "1.0", "empty": ""}},
+				"release": {Result: "success"},
+				"skipped": {Result: "skipped", Steps: map[string]string{"deploy": "skipped"}},
+			},
+		},
+	}
+
+	failures := Check(c, &runner.Report{}, false)
+	assert.Equal(t, []string{
+		"step 'deploy' of job 'build' did not run, expected 'success'",
+		"output 'version' of job 'build' is '', expected '1.0'",
+		"job 'release' did not run, expected result 'success'",
+	}, failures)
+
+	// a dryrun checks the steps only
+	failures = Check(c, &runner.Report{}, true)
+	assert.Equal(t, []string{
+		"step 'deploy' of job 'build' did not run, expected 'success'",
+		"job 'release' did not run, expected result 'success'",
+	}, failures)
+}
+
+func TestResultMatches(t *testing.T) {
+	assert.True(t, resultMatches("success", "success", false))
+	assert.False(t, resultMatches("failure", "success", false))
+	assert.True(t, resultMatches("failure", "success", true))
+	assert.False(t, resultMatches("failure", "skipped", true))
+	assert.True(t, resultMatches("skipped", "skipped", true))
+	assert.False(t, resultMatches("skipped", "success", true))
+}